@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// sdListenFDsStart is the first file descriptor systemd passes, SD_LISTEN_FDS_START.
+const sdListenFDsStart = 3
+
+var (
+	activationOnce sync.Once
+	activated      map[string]net.Listener
+)
+
+// activatedListener returns the socket systemd passed us under name, set with
+// FileDescriptorName= in the socket unit, or nil if we weren't socket activated.
+// The daemon takes "events" for the event socket and "api" for the HTTP API.
+func activatedListener(name string) net.Listener {
+	activationOnce.Do(func() { activated = systemdListeners() })
+	return activated[name]
+}
+
+// systemdListeners picks up the sockets passed with the LISTEN_FDS protocol, the
+// way sd_listen_fds_with_names does.
+func systemdListeners() map[string]net.Listener {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	// Commands we run mustn't think the sockets are meant for them
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := map[string]net.Listener{}
+	for i := 0; i < count; i++ {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(sdListenFDsStart+i), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			slog.Warn("Ignoring socket passed by systemd", "name", name, "err", err)
+			continue
+		}
+		slog.Info("Using socket passed by systemd", "name", name, "addr", listener.Addr())
+		listeners[name] = listener
+	}
+	return listeners
+}
@@ -0,0 +1,21 @@
+package main
+
+import "log/slog"
+
+// activeRecently reports whether the keyboard or mouse was used within
+// activity_window, which postpones a lock for the device leaving. When the
+// idle time can't be read it says no, so locking works as without it.
+func activeRecently() bool {
+	active := false
+	if ActivityWindow > 0 {
+		idle, err := IdleTime()
+		if err != nil {
+			slog.Debug("Failed to read the idle time", "err", err)
+		}
+		active = err == nil && idle < ActivityWindow
+	}
+	if active != CurrentState().Active {
+		updateState(func(s *DaemonState) { s.Active = active })
+	}
+	return active
+}
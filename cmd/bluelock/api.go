@@ -0,0 +1,345 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ConfigUpdate holds the settings that can be changed at runtime through the API.
+// Nil fields are left unchanged.
+type ConfigUpdate struct {
+	BluetoothDeviceAddress *string `json:"bluetooth_device_address"`
+	LockRSSI               *int    `json:"lock_rssi"`
+	UnlockRSSI             *int    `json:"unlock_rssi"`
+	CheckInterval          *string `json:"check_interval"`
+	SessionTimeout         *string `json:"session_timeout"`
+	Debug                  *bool   `json:"debug"`
+	Schedule               *string `json:"schedule"`
+	OutsideSchedule        *string `json:"outside_schedule"`
+}
+
+// StartAPI starts the HTTP API on addr in the background. Every request must carry
+// `Authorization: Bearer <token>`.
+func StartAPI(addr, token string) error {
+	if token == "" {
+		return errors.New("api_token must be set when api_listen is used")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", handleStatus)
+	mux.HandleFunc("/pause", handlePause)
+	mux.HandleFunc("/lock", handleLock)
+	mux.HandleFunc("/unlock", handleUnlock)
+	mux.HandleFunc("/config", handleConfig)
+	mux.HandleFunc("/metrics", handleMetrics)
+	mux.HandleFunc("/events", handleEvents)
+
+	// Use the socket systemd passed us, otherwise bind to localhost unless a host
+	// was given explicitly
+	listener := activatedListener("api")
+	if listener == nil {
+		var err error
+		if listener, err = net.Listen("tcp", localAddr(addr)); err != nil {
+			return err
+		}
+	}
+	// The dashboard page holds nothing secret, it asks for the token and
+	// sends it with its own requests
+	root := http.NewServeMux()
+	root.HandleFunc("/ui", handleUI)
+	root.Handle("/", requireToken(token, mux))
+	server := &http.Server{
+		Handler:           root,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			slog.Error("HTTP API stopped", "err", err)
+		}
+	}()
+	slog.Info("HTTP API listening", "addr", listener.Addr().String())
+	return nil
+}
+
+// localAddr binds addr to localhost unless it names a host.
+func localAddr(addr string) string {
+	if !strings.Contains(addr, ":") {
+		return "127.0.0.1:" + addr
+	} else if strings.HasPrefix(addr, ":") {
+		return "127.0.0.1" + addr
+	}
+	return addr
+}
+
+// requireToken rejects requests that don't carry the configured bearer token.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// runOnMonitor runs fn on the monitor loop and waits for it to finish.
+func runOnMonitor(fn func()) {
+	done := make(chan struct{})
+	controlQueue <- func() {
+		fn()
+		close(done)
+	}
+	<-done
+}
+
+// handleStatus reports the current daemon state.
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	writeJSON(w, http.StatusOK, CurrentState())
+}
+
+// handlePause pauses automatic locking and unlocking. POST /pause?duration=10m pauses,
+// DELETE /pause resumes.
+func handlePause(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		duration, err := time.ParseDuration(r.URL.Query().Get("duration"))
+		if err != nil || duration <= 0 {
+			writeError(w, http.StatusBadRequest, "duration must be a positive duration such as 10m")
+			return
+		}
+		runOnMonitor(func() { pauseFor(duration) })
+	case http.MethodDelete:
+		runOnMonitor(func() { pauseFor(0) })
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use GET, POST or DELETE")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]time.Time{"paused_until": CurrentState().PausedUntil})
+}
+
+// pauseFor pauses automatic locking and unlocking for duration, or resumes
+// with 0. It runs on the monitor loop.
+func pauseFor(duration time.Duration) {
+	if duration <= 0 {
+		updateState(func(s *DaemonState) { s.PausedUntil = time.Time{} })
+		slog.Info("Resumed")
+		return
+	}
+	updateState(func(s *DaemonState) { s.PausedUntil = time.Now().Add(duration) })
+	slog.Info("Paused", "duration", duration)
+}
+
+// handleLock locks the system immediately. The lock holds until the device has left range.
+func handleLock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	runOnMonitor(lockManually)
+	writeJSON(w, http.StatusOK, CurrentState())
+}
+
+// handleUnlock confirms an unlock armed by confirm_unlock with POST /unlock and
+// {"pin": "1234"}. Without unlock_pin only the notification's button confirms,
+// the token alone isn't the user.
+func handleUnlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if UnlockPIN == "" {
+		writeError(w, http.StatusForbidden, "set unlock_pin to confirm unlocks through the API")
+		return
+	}
+	var body struct {
+		PIN string `json:"pin"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+	}
+	var err error
+	runOnMonitor(func() { err = confirmUnlock(body.PIN) })
+	switch err {
+	case nil:
+		writeJSON(w, http.StatusOK, CurrentState())
+	case errWrongPIN:
+		writeError(w, http.StatusForbidden, err.Error())
+	case errNotArmed:
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "unlock failed: "+err.Error())
+	}
+}
+
+// handleConfig returns the active configuration, or updates it on PATCH.
+func handleConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch, http.MethodPut:
+		var update ConfigUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		var err error
+		runOnMonitor(func() { err = applyConfigUpdate(update) })
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Info("Configuration updated through the API")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use GET or PATCH")
+		return
+	}
+	var config map[string]any
+	runOnMonitor(func() { config = currentConfig() })
+	writeJSON(w, http.StatusOK, config)
+}
+
+// handleEvents writes the recent events as JSON lines, like `bluelock events`.
+// GET /events?follow=1 keeps streaming new ones.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	follow := r.URL.Query().Get("follow")
+	events, recent, cancel := SubscribeEvents(64)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(w)
+	for _, e := range recent {
+		if err := encoder.Encode(e); err != nil {
+			return
+		}
+	}
+	if follow == "" || follow == "0" || follow == "false" {
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok || encoder.Encode(e) != nil {
+				return
+			}
+		}
+	}
+}
+
+// applyConfigUpdate validates update and applies it to the running configuration.
+func applyConfigUpdate(update ConfigUpdate) error {
+	checkInterval, sessionTimeout := CheckInterval, SessionTimeout
+	var err error
+	if update.CheckInterval != nil {
+		if checkInterval, err = time.ParseDuration(*update.CheckInterval); err != nil || checkInterval <= 0 {
+			return fmt.Errorf("check_interval: invalid duration %q", *update.CheckInterval)
+		}
+	}
+	if update.SessionTimeout != nil {
+		if sessionTimeout, err = time.ParseDuration(*update.SessionTimeout); err != nil || sessionTimeout <= 0 {
+			return fmt.Errorf("session_timeout: invalid duration %q", *update.SessionTimeout)
+		}
+	}
+
+	lockRSSI, unlockRSSI := LockRSSI, UnlockRSSI
+	if update.LockRSSI != nil {
+		lockRSSI = *update.LockRSSI
+		if err := checkRSSI("lock_rssi", lockRSSI); err != nil {
+			return err
+		}
+	}
+	if update.UnlockRSSI != nil {
+		unlockRSSI = *update.UnlockRSSI
+		if err := checkRSSI("unlock_rssi", unlockRSSI); err != nil {
+			return err
+		}
+	}
+	if err := checkThresholds(lockRSSI, unlockRSSI); err != nil {
+		return err
+	}
+
+	if update.BluetoothDeviceAddress != nil && !bluetoothAddress.MatchString(*update.BluetoothDeviceAddress) {
+		return fmt.Errorf("bluetooth_device_address: invalid address %q", *update.BluetoothDeviceAddress)
+	}
+	if update.Schedule != nil {
+		if _, err := parseSchedule(*update.Schedule); err != nil {
+			return fmt.Errorf("schedule: %v", err)
+		}
+	}
+	if update.OutsideSchedule != nil && *update.OutsideSchedule != OutsideIdle && *update.OutsideSchedule != OutsideLockOnly {
+		return fmt.Errorf("outside_schedule: must be idle or lock_only, not %q", *update.OutsideSchedule)
+	}
+
+	CheckInterval, SessionTimeout = checkInterval, sessionTimeout
+	if update.BluetoothDeviceAddress != nil {
+		BluetoothDeviceAddress = strings.ToUpper(*update.BluetoothDeviceAddress)
+	}
+	LockRSSI, UnlockRSSI = lockRSSI, unlockRSSI
+	if update.Debug != nil {
+		SetDebug(*update.Debug)
+	}
+	if update.Schedule != nil {
+		Schedule = *update.Schedule
+	}
+	if update.OutsideSchedule != nil {
+		OutsideSchedule = *update.OutsideSchedule
+	}
+	publishSettings()
+	return nil
+}
+
+// currentConfig returns the active configuration keyed by flag name.
+func currentConfig() map[string]any {
+	return map[string]any{
+		"bluetooth_device_address": BluetoothDeviceAddress,
+		"check_interval":           CheckInterval.String(),
+		"check_repeat":             CheckRepeat,
+		"lock_rssi":                LockRSSI,
+		"unlock_rssi":              UnlockRSSI,
+		"desktop_env":              DesktopEnv,
+		"session_timeout":          SessionTimeout.String(),
+		"debug":                    Debug,
+		"dry_run":                  DryRun,
+		"profile":                  activeProfile,
+		"schedule":                 Schedule,
+		"outside_schedule":         OutsideSchedule,
+	}
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// RunningApps returns the executable names of the running processes.
+func RunningApps() (map[string]bool, error) {
+	out, err := RunCommand([]string{"ps", "-axco", "comm="}, lockCommandTimeout, nil)
+	if err != nil {
+		return nil, errors.New("ps: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	running := map[string]bool{}
+	for _, name := range strings.Split(string(out), "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			running[filepath.Base(name)] = true
+		}
+	}
+	return running, nil
+}
+
+// frontmostScript prints the frontmost application and whether its front
+// window is fullscreen, e.g. "Keynote|true".
+const frontmostScript = `tell application "System Events"
+	set p to first process whose frontmost is true
+	set fs to false
+	try
+		set fs to value of attribute "AXFullScreen" of front window of p
+	end try
+	return (name of p) & "|" & fs
+end tell`
+
+// FocusedWindow returns the frontmost application and whether its window is
+// fullscreen, which needs the Accessibility permission for the fullscreen part.
+func FocusedWindow() (app string, fullscreen bool, err error) {
+	out, err := RunCommand([]string{"osascript", "-e", frontmostScript}, lockCommandTimeout, nil)
+	if err != nil {
+		return "", false, errors.New("osascript: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	app, state, _ := strings.Cut(strings.TrimSpace(string(out)), "|")
+	return app, state == "true", nil
+}
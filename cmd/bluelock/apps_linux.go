@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// RunningApps returns the executable names of the running processes.
+func RunningApps() (map[string]bool, error) {
+	return runningProcesses(), nil
+}
+
+// xpropActive and xpropClass parse `xprop` for the active window and its
+// WM_CLASS, e.g. `WM_CLASS(STRING) = "libreoffice", "libreoffice-impress"`.
+var (
+	xpropActive = regexp.MustCompile(`window id # (0x[0-9a-fA-F]+)`)
+	xpropClass  = regexp.MustCompile(`"([^"]*)"`)
+)
+
+// FocusedWindow returns the application id or window class of the focused
+// window and whether it's fullscreen, from sway, Hyprland or X11.
+func FocusedWindow() (app string, fullscreen bool, err error) {
+	switch {
+	case os.Getenv("SWAYSOCK") != "":
+		return swayFocused()
+	case os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "":
+		out, err := exec.Command("hyprctl", "activewindow", "-j").Output()
+		if err != nil {
+			return "", false, fmt.Errorf("hyprctl: %v", err)
+		}
+		var window struct {
+			Class      string          `json:"class"`
+			Fullscreen json.RawMessage `json:"fullscreen"` // A bool, or a mode number in newer versions
+		}
+		if err := json.Unmarshal(out, &window); err != nil {
+			return "", false, fmt.Errorf("hyprctl: %v", err)
+		}
+		mode := string(window.Fullscreen)
+		return window.Class, mode != "" && mode != "false" && mode != "0", nil
+	case os.Getenv("DISPLAY") != "":
+		out, err := exec.Command("xprop", "-root", "_NET_ACTIVE_WINDOW").Output()
+		if err != nil {
+			return "", false, fmt.Errorf("xprop: %v", err)
+		}
+		m := xpropActive.FindSubmatch(out)
+		if m == nil {
+			return "", false, nil
+		}
+		out, err = exec.Command("xprop", "-id", string(m[1]), "WM_CLASS", "_NET_WM_STATE").Output()
+		if err != nil {
+			return "", false, fmt.Errorf("xprop: %v", err)
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if strings.HasPrefix(line, "WM_CLASS") {
+				// The instance, then the class
+				if classes := xpropClass.FindAllStringSubmatch(line, -1); len(classes) > 0 {
+					app = classes[len(classes)-1][1]
+				}
+			}
+		}
+		return app, strings.Contains(string(out), "_NET_WM_STATE_FULLSCREEN"), nil
+	}
+	return "", false, errors.New("the focused window can only be read on sway, Hyprland and X11")
+}
+
+// swayNode is a node of `swaymsg -t get_tree`.
+type swayNode struct {
+	Focused          bool   `json:"focused"`
+	AppID            string `json:"app_id"`
+	FullscreenMode   int    `json:"fullscreen_mode"`
+	WindowProperties struct {
+		Class string `json:"class"`
+	} `json:"window_properties"`
+	Nodes         []swayNode `json:"nodes"`
+	FloatingNodes []swayNode `json:"floating_nodes"`
+}
+
+// swayFocused finds the focused window in sway's tree.
+func swayFocused() (string, bool, error) {
+	out, err := exec.Command("swaymsg", "-t", "get_tree", "-r").Output()
+	if err != nil {
+		return "", false, fmt.Errorf("swaymsg: %v", err)
+	}
+	var root swayNode
+	if err := json.Unmarshal(out, &root); err != nil {
+		return "", false, fmt.Errorf("swaymsg: %v", err)
+	}
+	var find func(n swayNode) (swayNode, bool)
+	find = func(n swayNode) (swayNode, bool) {
+		if n.Focused {
+			return n, true
+		}
+		for _, child := range append(n.Nodes, n.FloatingNodes...) {
+			if found, ok := find(child); ok {
+				return found, true
+			}
+		}
+		return swayNode{}, false
+	}
+	node, ok := find(root)
+	if !ok {
+		return "", false, nil
+	}
+	app := node.AppID
+	if app == "" {
+		app = node.WindowProperties.Class // XWayland
+	}
+	return app, node.FullscreenMode > 0, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"strings"
+)
+
+// RunningApps returns the executable names of the running processes, without
+// .exe, from tasklist.
+func RunningApps() (map[string]bool, error) {
+	out, err := RunCommand([]string{"tasklist", "/fo", "csv", "/nh"}, lockCommandTimeout, nil)
+	if err != nil {
+		return nil, errors.New("tasklist: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	records, err := csv.NewReader(strings.NewReader(string(out))).ReadAll()
+	if err != nil {
+		return nil, errors.New("tasklist: " + err.Error())
+	}
+	running := map[string]bool{}
+	for _, record := range records {
+		if len(record) > 0 {
+			running[strings.TrimSuffix(strings.ToLower(record[0]), ".exe")] = true
+		}
+	}
+	return running, nil
+}
+
+// FocusedWindow isn't available on Windows yet, so only process names match there.
+func FocusedWindow() (app string, fullscreen bool, err error) {
+	return "", false, errors.New("the focused window can't be read on Windows")
+}
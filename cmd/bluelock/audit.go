@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEntry is one line of the audit log. Each entry carries the hash of the
+// previous one, so editing or removing a line breaks the chain from there on.
+type AuditEntry struct {
+	Seq      int64     `json:"seq"`
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Trigger  string    `json:"trigger"`
+	Reason   string    `json:"reason"`
+	RSSI     *int      `json:"rssi,omitempty"`
+	Device   string    `json:"device"`
+	DryRun   bool      `json:"dry_run,omitempty"`
+	PrevHash string    `json:"prev_hash"`
+	Hash     string    `json:"hash"`
+}
+
+// AuditLog appends hash-chained entries to a file.
+type AuditLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	key      []byte
+	seq      int64
+	lastHash string
+}
+
+// OpenAuditLog opens the audit log at path for appending, continuing the chain
+// from its last entry. With a key, entries are chained with HMAC-SHA256 so the
+// chain can't be recomputed without it.
+func OpenAuditLog(path string, key []byte) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	log := &AuditLog{key: key}
+	if last, err := lastAuditEntry(path); err != nil {
+		return nil, err
+	} else if last != nil {
+		log.seq, log.lastHash = last.Seq, last.Hash
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	log.file = file
+	return log, nil
+}
+
+// lastAuditEntry returns the final entry of the audit log at path, if any.
+func lastAuditEntry(path string) (*AuditEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var last *AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s: unreadable entry: %w", path, err)
+		}
+		last = &entry
+	}
+	return last, scanner.Err()
+}
+
+// Record appends an entry for a lock or unlock event.
+func (l *AuditLog) Record(e Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := AuditEntry{
+		Seq:      l.seq + 1,
+		Time:     e.Time,
+		Action:   e.Type,
+		Trigger:  auditTrigger(e.Reason),
+		Reason:   e.Reason,
+		RSSI:     e.RSSI,
+		Device:   e.Device,
+		DryRun:   DryRun,
+		PrevHash: l.lastHash,
+	}
+	entry.Hash = entry.computeHash(l.key)
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.seq, l.lastHash = entry.Seq, entry.Hash
+	return nil
+}
+
+// computeHash returns the chain hash of the entry, covering every field but Hash.
+func (entry AuditEntry) computeHash(key []byte) string {
+	entry.Hash = ""
+	data, _ := json.Marshal(entry)
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// auditTrigger maps an event reason to what triggered the action.
+func auditTrigger(reason string) string {
+	switch reason {
+	case ReasonInRange, ReasonOutOfRange:
+		return "rssi"
+	case ReasonSessionTimeout:
+		return "timeout"
+	case ReasonManual:
+		return "manual"
+	default:
+		return reason
+	}
+}
+
+// StartAuditLog records every lock and unlock to the audit log at path.
+func StartAuditLog(path, keyFile string) error {
+	var key []byte
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return err
+		}
+		key = []byte(strings.TrimSpace(string(data)))
+	}
+	log, err := OpenAuditLog(path, key)
+	if err != nil {
+		return err
+	}
+	HandleEvents(func(e Event) {
+		if e.Type != EventLock && e.Type != EventUnlock {
+			return
+		}
+		if err := log.Record(e); err != nil {
+			slog.Error("Failed to write audit log", "err", err)
+		}
+	})
+	return nil
+}
+
+// VerifyAuditLog checks the hash chain of the audit log at path and returns the
+// number of valid entries, or an error describing the first broken entry.
+func VerifyAuditLog(path string, key []byte) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count := 0
+	var prev AuditEntry
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return count, fmt.Errorf("line %d: unreadable entry: %w", line, err)
+		}
+		if count > 0 && entry.Seq != prev.Seq+1 {
+			return count, fmt.Errorf("line %d: sequence jumps from %d to %d, entries are missing", line, prev.Seq, entry.Seq)
+		}
+		if entry.PrevHash != prev.Hash {
+			return count, fmt.Errorf("line %d: previous hash doesn't match, an earlier entry was changed or removed", line)
+		}
+		if entry.computeHash(key) != entry.Hash {
+			return count, fmt.Errorf("line %d: hash doesn't match, the entry was modified", line)
+		}
+		prev = entry
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// RunAuditCommand implements `bluelock audit verify`.
+func RunAuditCommand(args []string) int {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "usage: bluelock audit verify [--file path] [--key_file path]")
+		return 2
+	}
+	fs := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	path := fs.String("file", DefaultAuditLog(), "Audit log to verify")
+	keyFile := fs.String("key_file", "", "HMAC key the log was written with")
+	fs.Parse(args[1:])
+
+	var key []byte
+	if *keyFile != "" {
+		data, err := os.ReadFile(*keyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to read key:", err)
+			return 1
+		}
+		key = []byte(strings.TrimSpace(string(data)))
+	}
+	count, err := VerifyAuditLog(*path, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Audit log is NOT intact after %d entries: %s\n", count, err)
+		return 1
+	}
+	fmt.Printf("Audit log is intact: %d entries.\n", count)
+	return 0
+}
+
+// DefaultAuditLog returns the default location of the audit log.
+func DefaultAuditLog() string {
+	return stateFile("audit.log")
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// How suspend_after puts the machine to sleep, as logind names it.
+const (
+	SuspendSleep     = "suspend"
+	SuspendHibernate = "hibernate"
+	SuspendHybrid    = "hybrid-sleep"
+	SuspendThenHib   = "suspend-then-hibernate"
+)
+
+// What the away actions changed, so that only that is undone on return.
+var (
+	displaysOff  bool
+	pausedPlayer []string
+	mutedAudio   bool
+)
+
+// awaySince is when the session locked because the device left, or last saw it
+// since; zero once it unlocked. suspend_after counts from it.
+var awaySince time.Time
+
+// runAwayActions runs what's configured beyond the lock itself when the
+// session locks because the device left: the displays go off with
+// displays_off, playing media is paused with pause_media, the output is muted
+// with mute_audio, the clipboard is cleared with clear_clipboard and the ssh
+// agent is locked with ssh_agent.
+func runAwayActions(reason string) {
+	if reason != ReasonOutOfRange || DryRun {
+		return
+	}
+	awaySince = time.Now()
+	if PauseMediaAway {
+		players, err := PauseMedia()
+		if err != nil {
+			slog.Warn("Failed to pause the media", "err", err)
+		}
+		if len(players) > 0 {
+			slog.Info("Media paused", "players", len(players))
+		}
+		pausedPlayer = append(pausedPlayer, players...)
+	}
+	if MuteAudioAway {
+		was, err := SetMuted(true)
+		if err != nil {
+			slog.Warn("Failed to mute the audio", "err", err)
+		} else if !was {
+			slog.Info("Audio muted")
+			mutedAudio = true
+		}
+	}
+	if ClearClipboardAway {
+		if err := ClearClipboard(); err != nil {
+			slog.Warn("Failed to clear the clipboard", "err", err)
+		} else {
+			slog.Info("Clipboard cleared")
+		}
+	}
+	if SSHAgentAway != "" {
+		if err := LockSSHAgent(SSHAgentAway); err != nil {
+			slog.Warn("Failed to lock the ssh agent", "err", err)
+		} else if SSHAgentAway == SSHAgentLock {
+			// The random password only lives in this process
+			slog.Info("SSH agent locked, restarting bluelock before it's unlocked loses the password, then ssh-add -D and add the keys again", "mode", SSHAgentAway)
+		} else {
+			slog.Info("SSH agent locked", "mode", SSHAgentAway)
+		}
+	}
+	if DisplaysOff {
+		if err := SetDisplayPower(false); err != nil {
+			slog.Warn("Failed to turn the displays off", "err", err)
+		} else {
+			slog.Info("Displays off")
+			displaysOff = true
+		}
+	}
+}
+
+// runReturnActions undoes the away actions when the session unlocks.
+func runReturnActions() {
+	awaySince = time.Time{}
+	if displaysOff {
+		displaysOff = false
+		if err := SetDisplayPower(true); err != nil {
+			slog.Warn("Failed to turn the displays back on", "err", err)
+		}
+	}
+	if err := UnlockSSHAgent(); err != nil {
+		slog.Warn("Failed to unlock the ssh agent", "err", err)
+	}
+	if mutedAudio {
+		mutedAudio = false
+		if _, err := SetMuted(false); err != nil {
+			slog.Warn("Failed to unmute the audio", "err", err)
+		}
+	}
+	if len(pausedPlayer) > 0 {
+		players := pausedPlayer
+		pausedPlayer = nil
+		if !ResumeMediaReturn {
+			return
+		}
+		if err := ResumeMedia(players); err != nil {
+			slog.Warn("Failed to resume the media", "err", err)
+		}
+	}
+}
+
+// suspendWhenLongAway puts the machine to sleep with suspend_mode once the
+// session has been locked and the device away for suspend_after. It runs on the
+// monitor loop after each check.
+func suspendWhenLongAway(now time.Time, inRange bool) {
+	if SuspendAfter <= 0 || awaySince.IsZero() {
+		return
+	}
+	// Someone unlocked without bluelock, or is at the keyboard
+	if machine.Mode != "locked" || machine.Active {
+		awaySince = time.Time{}
+		return
+	}
+	if inRange {
+		awaySince = now
+		return
+	}
+	if now.Sub(awaySince) < SuspendAfter {
+		return
+	}
+	slog.Info("Away for long, going to sleep", "away", now.Sub(awaySince).Round(time.Second), "mode", SuspendMode)
+	if err := Suspend(SuspendMode); err != nil {
+		slog.Warn("Failed to suspend", "mode", SuspendMode, "err", err)
+	}
+	// Count again from here, so that after the wake Bluetooth has a whole
+	// suspend_after to find the device again before the next sleep
+	awaySince = time.Now()
+}
@@ -0,0 +1,1110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/statemachine"
+)
+
+// Declare command-line flags.
+var (
+	BluetoothDeviceAddress string
+	CheckInterval          time.Duration
+	CheckRepeat            int
+	LockRSSI               int
+	UnlockRSSI             int
+	DesktopEnv             string
+	SessionTimeout         time.Duration
+	Debug                  bool
+	APIListen              string
+	APIToken               string
+	GRPCListen             string
+	DebugListen            string
+	EventsSocket           string
+	RecordHistory          bool
+	HistoryDB              string
+	HistoryRetention       time.Duration
+	DryRun                 bool
+	LogFormat              string
+	LogTarget              string
+	LogFile                string
+	LogMaxSizeMB           int
+	LogMaxAge              time.Duration
+	LogMaxBackups          int
+	LogCompress            bool
+	Audit                  bool
+	AuditLogPath           string
+	AuditKeyFile           string
+	NotifyLock             bool
+	NotifyUnlock           bool
+	NotifyDeviceLost       bool
+	NotifySessionTimeout   bool
+	NotifyErrors           bool
+	NotifyPresence         bool
+	Tray                   bool
+	LockWarning            time.Duration
+	LockWarningCommand     string
+	WebhookURLs            stringList
+	WebhookEvents          string
+	WebhookSecret          string
+	WebhookRetries         int
+	NtfyTopic              string
+	NtfyToken              string
+	TelegramBotToken       string
+	TelegramChatID         string
+	PushEvents             string
+	MQTTBroker             string
+	MQTTUsername           string
+	MQTTPassword           string
+	MQTTClientID           string
+	MQTTTopicPrefix        string
+	MQTTCAFile             string
+	MQTTCertFile           string
+	MQTTKeyFile            string
+	HomeAssistant          bool
+	HADiscoveryPrefix      string
+	ConfigFile             string
+	PreLockHooks           stringList
+	PostLockHooks          stringList
+	PreUnlockHooks         stringList
+	PostUnlockHooks        stringList
+	ArriveHooks            stringList
+	DepartHooks            stringList
+	HookTimeout            time.Duration
+	MaxLockVeto            time.Duration
+	LockCommand            commandFlag
+	UnlockCommand          commandFlag
+	LockRetries            int
+	VerifyLock             bool
+	LockFallback           bool
+	UnlockByKillingLocker  bool
+	LockConsolesWith       string
+	LogindSession          string
+	SystemMode             bool
+	UserDevices            stringList
+	DevicePolicy           string
+	BluetoothHelper        string
+	ScannerBackend         string
+	BluetoothAdapter       string
+	LockOnCrash            bool
+	OnExit                 string
+	BlindAfter             int
+	ProfileName            string
+	DisableOnUnknownWifi   bool
+	TrustedSSIDs           stringList
+	TrustedSubnets         stringList
+	Schedule               string
+	OutsideSchedule        string
+	LockDevices            stringList
+	PresenceNames          stringList
+	PresenceCommand        commandFlag
+	PresenceTimeout        time.Duration
+	PresenceFailure        string
+	PresenceHosts          stringList
+	PresenceTopic          string
+	UnlockWhen             string
+	ActivityWindow         time.Duration
+	LeftBehindAfter        time.Duration
+	ConfirmUnlock          bool
+	ConfirmWindow          time.Duration
+	UnlockPIN              string
+	WornDevice             string
+	PeerSecret             string
+	PeerPort               int
+	PeerAddresses          stringList
+	FollowMe               bool
+	RespectInhibitors      bool
+	DeferLockFor           stringList
+	USBTokens              stringList
+	InhibitIdle            bool
+	InhibitIdleMargin      int
+	DisplaysOff            bool
+	PauseMediaAway         bool
+	ResumeMediaReturn      bool
+	MuteAudioAway          bool
+	ClearClipboardAway     bool
+	SSHAgentAway           string
+	SuspendAfter           time.Duration
+	SuspendMode            string
+	LockWhen               string
+)
+
+// Default values for flags
+const (
+	defaultBluetoothDeviceAddress = "XX:XX:XX:XX:XX:XX"
+	defaultCheckInterval          = 5 * time.Second
+	defaultCheckRepeat            = 3
+	defaultLockRSSI               = -14
+	defaultUnlockRSSI             = -14
+	defaultDesktopEnv             = "auto"
+	defaultSessionTimeout         = 30 * time.Minute
+	defaultDebug                  = true
+	defaultAPIListen              = ""
+	defaultAPIToken               = ""
+	defaultGRPCListen             = ""
+	defaultDebugListen            = ""
+	defaultRecordHistory          = false
+	defaultHistoryRetention       = 30 * 24 * time.Hour
+	defaultDryRun                 = false
+	defaultLogFormat              = "text"
+	defaultLogTarget              = "auto"
+	defaultLogFile                = ""
+	defaultLogMaxSizeMB           = 10
+	defaultLogMaxAge              = 7 * 24 * time.Hour
+	defaultLogMaxBackups          = 5
+	defaultLogCompress            = true
+	defaultAudit                  = false
+	defaultAuditKeyFile           = ""
+	defaultNotifyLock             = false
+	defaultNotifyUnlock           = false
+	defaultNotifyDeviceLost       = true
+	defaultNotifySessionTimeout   = true
+	defaultNotifyErrors           = true
+	defaultNotifyPresence         = false
+	defaultTray                   = false
+	defaultLockWarning            = 0
+	defaultLockWarningCommand     = `spd-say "Locking in {seconds} seconds"`
+	defaultWebhookEvents          = "lock,unlock,device_lost,lock_failed"
+	defaultWebhookSecret          = ""
+	defaultWebhookRetries         = 3
+	defaultNtfyTopic              = ""
+	defaultNtfyToken              = ""
+	defaultTelegramBotToken       = ""
+	defaultTelegramChatID         = ""
+	defaultPushEvents             = "lock,device_lost,lock_failed"
+	defaultMQTTBroker             = ""
+	defaultMQTTUsername           = ""
+	defaultMQTTPassword           = ""
+	defaultMQTTClientID           = ""
+	defaultMQTTCAFile             = ""
+	defaultMQTTCertFile           = ""
+	defaultMQTTKeyFile            = ""
+	defaultPresenceTopic          = ""
+	defaultPresenceTimeout        = 5 * time.Second
+	defaultPresenceFailure        = FailAbsent
+	defaultUnlockWhen             = ""
+	defaultActivityWindow         = 0
+	defaultLeftBehindAfter        = 0
+	defaultConfirmUnlock          = false
+	defaultConfirmWindow          = 30 * time.Second
+	defaultUnlockPIN              = ""
+	defaultWornDevice             = ""
+	defaultPeerSecret             = ""
+	defaultPeerPort               = 8788
+	defaultFollowMe               = false
+	defaultRespectInhibitors      = false
+	defaultInhibitIdle            = false
+	defaultInhibitIdleMargin      = 5
+	defaultDisplaysOff            = false
+	defaultPauseMedia             = false
+	defaultResumeMedia            = true
+	defaultMuteAudio              = false
+	defaultClearClipboard         = false
+	defaultSSHAgent               = ""
+	defaultSuspendAfter           = 0
+	defaultSuspendMode            = SuspendSleep
+	defaultLockWhen               = ""
+	defaultHomeAssistant          = false
+	defaultHADiscoveryPrefix      = "homeassistant"
+	defaultConfigFile             = ""
+	defaultHookTimeout            = 10 * time.Second
+	defaultMaxLockVeto            = 30 * time.Minute
+	defaultLockRetries            = 2
+	defaultVerifyLock             = true
+	defaultLockFallback           = true
+	defaultUnlockByKillingLocker  = false
+	defaultLockConsolesWith       = ""
+	defaultLogindSession          = ""
+	defaultSystemMode             = false
+	defaultDevicePolicy           = PolicyAny
+	defaultBluetoothHelper        = ""
+	defaultScannerBackend         = "auto"
+	defaultBluetoothAdapter       = "hci0"
+	defaultLockOnCrash            = true
+	defaultOnExit                 = ExitLeave
+	defaultBlindAfter             = 3
+	defaultProfileName            = autoProfile
+	defaultDisableOnUnknownWifi   = false
+	defaultSchedule               = ""
+	defaultOutsideSchedule        = OutsideIdle
+)
+
+// stringList is a flag that can be given several times, collecting every value.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// flagAliases are shorter names the command line takes for common flags.
+var flagAliases = map[string]string{
+	"device":   "bluetooth_device_address",
+	"interval": "check_interval",
+}
+
+// canonicalFlagArgs rewrites hyphenated spellings such as --lock-rssi=-20 and
+// the flagAliases to the flags' real names, so they override the config file
+// like any other flag.
+func canonicalFlagArgs(args []string) []string {
+	canonical := make([]string, len(args))
+	copy(canonical, args)
+	for i, arg := range canonical {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		dashes := arg[:len(arg)-len(name)]
+		name, value, hasValue := strings.Cut(name, "=")
+		real := strings.ReplaceAll(name, "-", "_")
+		if alias, ok := flagAliases[real]; ok {
+			real = alias
+		}
+		if real == name || flag.Lookup(real) == nil {
+			continue
+		}
+		canonical[i] = dashes + real
+		if hasValue {
+			canonical[i] += "=" + value
+		}
+	}
+	return canonical
+}
+
+// InitializeFlags initializes command-line flags and sets default values.
+func InitializeFlags() {
+	DefineFlags()
+
+	// Parse the flags
+	flag.CommandLine.Parse(canonicalFlagArgs(os.Args[1:]))
+
+	if err := LoadSettings(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := ValidateConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid settings:")
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintln(os.Stderr, "  "+line)
+		}
+		os.Exit(2)
+	}
+}
+
+// DefineFlags registers every setting as a flag on the command line.
+func DefineFlags() {
+	flag.StringVar(&ConfigFile, "config", defaultConfigFile, "JSON, YAML or TOML file of settings keyed by flag name, layered over the defaults in /etc/bluelock (default $XDG_CONFIG_HOME/bluelock/config.json)")
+	flag.StringVar(&ProfileName, "profile", defaultProfileName, "Profile from the config file's profiles section to use, auto to pick the first whose match fits, or empty for none")
+	flag.BoolVar(&DisableOnUnknownWifi, "disable_on_unknown_wifi", defaultDisableOnUnknownWifi, "Neither lock nor unlock while on a Wi-Fi network that no profile matches by ssid")
+	flag.Var(&TrustedSSIDs, "trusted_ssid", "Wi-Fi network on which bluelock unlocks but doesn't lock, can be given several times")
+	flag.Var(&TrustedSubnets, "trusted_subnet", "Network such as 192.168.1.0/24 on which bluelock unlocks but doesn't lock, can be given several times")
+	flag.StringVar(&Schedule, "schedule", defaultSchedule, "When to lock and unlock, e.g. Mon-Fri 08:00-18:00; Sat 10:00-14:00, empty for always")
+	flag.StringVar(&OutsideSchedule, "outside_schedule", defaultOutsideSchedule, "What to do outside the schedule: idle, or lock_only to lock but never unlock")
+	flag.Var(&LockDevices, "lock_device", "Device whose approach locks the screen instead, as AA:BB:CC:DD:EE:FF[=rssi] or unknown[=rssi] for any unpaired one, can be given several times")
+	flag.Var(&PresenceNames, "presence", "How to tell you're there: bluetooth (the RSSI), ble (advertisements), connection, exec (presence_command), lan (presence_host), mqtt (presence_topic), peer (other machines, peer_secret), usb (usb_device) or worn (a smartwatch's heart rate); present while any is, can be given several times")
+	flag.Var(&PresenceCommand, "presence_command", "Command for presence exec, exiting 0 when you're there and 1 when you're not, or printing {\"present\": true}")
+	flag.DurationVar(&PresenceTimeout, "presence_timeout", defaultPresenceTimeout, "How long presence_command may run before it's killed and counts as failed")
+	flag.StringVar(&PresenceFailure, "presence_failure", defaultPresenceFailure, "What a failed presence_command counts as: absent, present or last (its previous answer)")
+	flag.Var(&PresenceHosts, "presence_host", "Phone on the local network for presence lan, by IP address, hostname or MAC address; can be given several times")
+	flag.StringVar(&PresenceTopic, "presence_topic", defaultPresenceTopic, "MQTT topic for presence mqtt, whose messages home, present, on, true or 1 mean you're there")
+	flag.StringVar(&UnlockWhen, "unlock_when", defaultUnlockWhen, "When to unlock, combining presence providers with AND, OR, NOT and parentheses, e.g. \"bluetooth AND lan\"; empty for any of --presence")
+	flag.StringVar(&LockWhen, "lock_when", defaultLockWhen, "When to lock, like unlock_when, e.g. \"NOT bluetooth\"; empty for whenever unlock_when doesn't hold")
+	flag.DurationVar(&ActivityWindow, "activity_window", defaultActivityWindow, "Don't lock for the device leaving while the keyboard or mouse was used this recently, 0 to lock regardless")
+	flag.DurationVar(&LeftBehindAfter, "left_behind_after", defaultLeftBehindAfter, "Warn when the keyboard or mouse is in use but the device hasn't answered for this long, e.g. 10m; 0 never warns")
+	flag.BoolVar(&RespectInhibitors, "respect_inhibitors", defaultRespectInhibitors, "Defer automatic locks while an application, like a video player, inhibits the screensaver; for at most max_lock_veto")
+	flag.Var(&DeferLockFor, "defer_lock_for", "Defer automatic locks while this application runs or has the focused window, or with name:fullscreen while its window is focused and fullscreen; for at most max_lock_veto, can be given several times")
+	flag.Var(&USBTokens, "usb_device", "USB device, e.g. a YubiKey as 1050:0407 (vendor:product), that keeps the session from locking while it's plugged in; can be given several times")
+	flag.BoolVar(&InhibitIdle, "inhibit_idle", defaultInhibitIdle, "Inhibit the desktop's idle timeout while unlocked with the device clearly present")
+	flag.IntVar(&InhibitIdleMargin, "inhibit_idle_margin", defaultInhibitIdleMargin, "How far above unlock_rssi the RSSI must be for inhibit_idle")
+	flag.BoolVar(&DisplaysOff, "displays_off", defaultDisplaysOff, "Turn the displays off when locking because the device left, and back on when it returns")
+	flag.BoolVar(&PauseMediaAway, "pause_media", defaultPauseMedia, "Pause playing media (MPRIS players on Linux) when locking because the device left")
+	flag.BoolVar(&ResumeMediaReturn, "resume_media", defaultResumeMedia, "Resume the media pause_media paused when unlocking")
+	flag.BoolVar(&MuteAudioAway, "mute_audio", defaultMuteAudio, "Mute the audio output when locking because the device left, and unmute it when unlocking")
+	flag.BoolVar(&ClearClipboardAway, "clear_clipboard", defaultClearClipboard, "Clear the clipboard when locking because the device left")
+	flag.StringVar(&SSHAgentAway, "ssh_agent", defaultSSHAgent, "What to do to the ssh agent when locking because the device left: lock (unlocked again on return) or delete its keys; empty to leave it")
+	flag.DurationVar(&SuspendAfter, "suspend_after", defaultSuspendAfter, "Put the machine to sleep after it has been locked with the device away this long, e.g. 30m; 0 never does")
+	flag.StringVar(&SuspendMode, "suspend_mode", defaultSuspendMode, "How suspend_after sleeps: suspend, hibernate, hybrid-sleep or suspend-then-hibernate")
+	flag.BoolVar(&ConfirmUnlock, "confirm_unlock", defaultConfirmUnlock, "Only arm the unlock when the device comes into range, and unlock once it's confirmed with unlock_pin or the notification's button")
+	flag.DurationVar(&ConfirmWindow, "confirm_window", defaultConfirmWindow, "How long an armed unlock waits for confirmation")
+	flag.StringVar(&UnlockPIN, "unlock_pin", defaultUnlockPIN, "PIN that confirms an armed unlock through POST /unlock; empty to confirm only with the notification's button")
+	flag.StringVar(&WornDevice, "worn_device", defaultWornDevice, "Smartwatch whose heart rate the worn presence provider checks, empty for bluetooth_device_address")
+	flag.StringVar(&PeerSecret, "peer_secret", defaultPeerSecret, "Secret shared by the bluelock instances that lock together; empty to not talk to peers")
+	flag.IntVar(&PeerPort, "peer_port", defaultPeerPort, "UDP port peers talk on")
+	flag.Var(&PeerAddresses, "peer_address", "Peer to talk to, host or host:port; can be given several times, none to broadcast on the local network")
+	flag.BoolVar(&FollowMe, "follow_me", defaultFollowMe, "In peer mode, only keep the machine nearest the device unlocked, by the RSSI each peer sees")
+	flag.StringVar(&BluetoothDeviceAddress, "bluetooth_device_address", defaultBluetoothDeviceAddress, "Bluetooth device address (or --device)")
+	flag.DurationVar(&CheckInterval, "check_interval", defaultCheckInterval, "Interval between checks (or --interval)")
+	flag.IntVar(&CheckRepeat, "check_repeat", defaultCheckRepeat, "Number of times to check the device")
+	flag.IntVar(&LockRSSI, "lock_rssi", defaultLockRSSI, "RSSI value to lock the system")
+	flag.IntVar(&UnlockRSSI, "unlock_rssi", defaultUnlockRSSI, "RSSI value to unlock the system")
+	flag.StringVar(&DesktopEnv, "desktop_env", defaultDesktopEnv, "Desktop environment (e.g., CINNAMON, GNOME, KDE, XFCE, SWAY, HYPRLAND, I3LOCK, LIGHTDM, DBUS), or auto to detect it")
+	flag.Var(&LockCommand, "lock_command", "Command that locks the screen, overriding desktop_env")
+	flag.Var(&UnlockCommand, "unlock_command", "Command that unlocks the screen, overriding desktop_env")
+	flag.IntVar(&LockRetries, "lock_retries", defaultLockRetries, "How many times to retry a lock or unlock that failed")
+	flag.BoolVar(&VerifyLock, "verify_lock", defaultVerifyLock, "Check that the screen really locked or unlocked")
+	flag.BoolVar(&UnlockByKillingLocker, "unlock_by_killing_locker", defaultUnlockByKillingLocker, "Let I3LOCK and XSECURELOCK unlock by killing the locker, which anyone who can kill it can do too")
+	flag.StringVar(&LockConsolesWith, "lock_consoles", defaultLockConsolesWith, "Also lock the virtual consoles with physlock or vlock, empty to leave them")
+	flag.StringVar(&LogindSession, "logind_session", defaultLogindSession, "logind session to lock and unlock, empty to find our own")
+	flag.BoolVar(&SystemMode, "system", defaultSystemMode, "Run as one system-wide daemon locking each user_device user's sessions on their own")
+	flag.Var(&UserDevices, "user_device", "In system mode, user=XX:XX:XX:XX:XX:XX whose sessions follow that device, can be given several times")
+	flag.StringVar(&DevicePolicy, "device_policy", defaultDevicePolicy, "In system mode, whether a user with several devices is present while any of them is in range or only while all of them are")
+	flag.StringVar(&BluetoothHelper, "bluetooth_helper", defaultBluetoothHelper, "Socket of a bluelock helper running as root to scan through, empty to scan ourselves")
+	flag.StringVar(&ScannerBackend, "scanner", defaultScannerBackend, "How to read the RSSI: hcitool, bluez (D-Bus, no root needed), or auto to use hcitool when it's allowed")
+	flag.StringVar(&BluetoothAdapter, "bluetooth_adapter", defaultBluetoothAdapter, "Bluetooth adapter BlueZ scans with")
+	flag.BoolVar(&LockOnCrash, "lock_on_crash", defaultLockOnCrash, "Lock the screen when the monitor loop crashes, before restarting it")
+	flag.StringVar(&OnExit, "on_exit", defaultOnExit, "What to do with the session when bluelock stops: leave it, lock it, or restore-previous to lock or unlock it back to how it was at startup")
+	flag.BoolVar(&LockFallback, "lock_fallback", defaultLockFallback, "Try loginctl, the other desktops' lockers and xdg-screensaver when locking fails")
+	flag.DurationVar(&SessionTimeout, "session_timeout", defaultSessionTimeout, "Session timeout duration")
+	flag.BoolVar(&Debug, "debug", defaultDebug, "Enable debug mode")
+	flag.StringVar(&LogFormat, "log_format", defaultLogFormat, "Log output format: text or json")
+	flag.StringVar(&LogTarget, "log_target", defaultLogTarget, "Where to log: auto, stderr, file, journal or syslog")
+	flag.StringVar(&LogFile, "log_file", defaultLogFile, "Write logs to this file, rotating it as it grows")
+	flag.IntVar(&LogMaxSizeMB, "log_max_size", defaultLogMaxSizeMB, "Rotate the log file after this many megabytes")
+	flag.DurationVar(&LogMaxAge, "log_max_age", defaultLogMaxAge, "Rotate the log file after it has been written to this long")
+	flag.IntVar(&LogMaxBackups, "log_max_backups", defaultLogMaxBackups, "Number of rotated log files to keep, 0 for all")
+	flag.BoolVar(&LogCompress, "log_compress", defaultLogCompress, "Gzip rotated log files")
+	flag.BoolVar(&Audit, "audit", defaultAudit, "Record every lock and unlock to the audit log")
+	flag.StringVar(&AuditLogPath, "audit_log", DefaultAuditLog(), "Append-only, hash-chained audit log")
+	flag.StringVar(&AuditKeyFile, "audit_key_file", defaultAuditKeyFile, "File with a secret key used to HMAC the audit chain")
+	flag.BoolVar(&NotifyLock, "notify_lock", defaultNotifyLock, "Show a desktop notification when the system locks")
+	flag.BoolVar(&NotifyUnlock, "notify_unlock", defaultNotifyUnlock, "Show a desktop notification when the system unlocks")
+	flag.BoolVar(&NotifyDeviceLost, "notify_device_lost", defaultNotifyDeviceLost, "Show a desktop notification when the device stops answering")
+	flag.BoolVar(&NotifySessionTimeout, "notify_session_timeout", defaultNotifySessionTimeout, "Show a desktop notification when the session times out")
+	flag.BoolVar(&NotifyErrors, "notify_errors", defaultNotifyErrors, "Show a desktop notification when Bluetooth checks fail")
+	flag.BoolVar(&NotifyPresence, "notify_presence", defaultNotifyPresence, "Show a desktop notification when the device arrives or departs")
+	flag.BoolVar(&Tray, "tray", defaultTray, "Show a tray icon with the state and a menu to pause, resume, lock and open the config (needs yad on Linux)")
+	flag.IntVar(&BlindAfter, "blind_after", defaultBlindAfter, "Consecutive failed scans after which bluelock reports itself blind")
+	flag.DurationVar(&LockWarning, "lock_warning", defaultLockWarning, "Warn this long before locking when the device leaves, 0 to lock at once")
+	flag.StringVar(&LockWarningCommand, "lock_warning_command", defaultLockWarningCommand, "Command run as the lock warning, {seconds} is replaced by the delay")
+	flag.Var(&WebhookURLs, "webhook_url", "URL to POST events to as JSON, can be given several times")
+	flag.StringVar(&WebhookEvents, "webhook_events", defaultWebhookEvents, "Comma-separated event types sent to webhooks")
+	flag.StringVar(&WebhookSecret, "webhook_secret", defaultWebhookSecret, "Secret for the X-Bluelock-Signature HMAC header")
+	flag.IntVar(&WebhookRetries, "webhook_retries", defaultWebhookRetries, "How many times to retry a failed webhook delivery")
+	flag.StringVar(&NtfyTopic, "ntfy_topic", defaultNtfyTopic, "ntfy topic name on ntfy.sh, or a full topic URL on another server")
+	flag.StringVar(&NtfyToken, "ntfy_token", defaultNtfyToken, "Access token for a protected ntfy topic")
+	flag.StringVar(&TelegramBotToken, "telegram_bot_token", defaultTelegramBotToken, "Telegram bot token for push messages")
+	flag.StringVar(&TelegramChatID, "telegram_chat_id", defaultTelegramChatID, "Telegram chat to send push messages to")
+	flag.StringVar(&PushEvents, "push_events", defaultPushEvents, "Comma-separated event types sent to ntfy and Telegram")
+	flag.StringVar(&MQTTBroker, "mqtt_broker", defaultMQTTBroker, "MQTT broker to publish presence to (tcp://host:1883 or ssl://host:8883), empty to disable")
+	flag.StringVar(&MQTTUsername, "mqtt_username", defaultMQTTUsername, "MQTT username")
+	flag.StringVar(&MQTTPassword, "mqtt_password", defaultMQTTPassword, "MQTT password")
+	flag.StringVar(&MQTTClientID, "mqtt_client_id", defaultMQTTClientID, "MQTT client id, defaults to bluelock-<hostname>")
+	flag.StringVar(&MQTTTopicPrefix, "mqtt_topic_prefix", DefaultMQTTTopicPrefix(), "Prefix of the MQTT topics")
+	flag.StringVar(&MQTTCAFile, "mqtt_ca_file", defaultMQTTCAFile, "CA certificates to verify an ssl:// broker with")
+	flag.StringVar(&MQTTCertFile, "mqtt_cert_file", defaultMQTTCertFile, "Client certificate for the MQTT broker")
+	flag.StringVar(&MQTTKeyFile, "mqtt_key_file", defaultMQTTKeyFile, "Private key of mqtt_cert_file")
+	flag.BoolVar(&HomeAssistant, "homeassistant", defaultHomeAssistant, "Announce a presence sensor and a lock entity through Home Assistant MQTT discovery")
+	flag.StringVar(&HADiscoveryPrefix, "homeassistant_discovery_prefix", defaultHADiscoveryPrefix, "Home Assistant MQTT discovery prefix")
+	flag.Var(&PreLockHooks, "pre_lock_hook", "Command run before locking, can be given several times")
+	flag.Var(&PostLockHooks, "post_lock_hook", "Command run after locking, can be given several times")
+	flag.Var(&PreUnlockHooks, "pre_unlock_hook", "Command run before unlocking, can be given several times")
+	flag.Var(&PostUnlockHooks, "post_unlock_hook", "Command run after unlocking, can be given several times")
+	flag.Var(&ArriveHooks, "arrive_hook", "Command run when the device arrives, whether or not that unlocks, can be given several times")
+	flag.Var(&DepartHooks, "depart_hook", "Command run when the device departs, whether or not that locks, can be given several times")
+	flag.DurationVar(&HookTimeout, "hook_timeout", defaultHookTimeout, "How long a hook may run before it's killed")
+	flag.DurationVar(&MaxLockVeto, "max_lock_veto", defaultMaxLockVeto, "How long pre-lock hooks may keep vetoing a lock, 0 to ignore vetoes")
+	flag.BoolVar(&DryRun, "dry_run", defaultDryRun, "Run detection but only log what would be locked or unlocked")
+	flag.StringVar(&APIListen, "api_listen", defaultAPIListen, "Address for the HTTP API (e.g. 127.0.0.1:8787), empty to disable")
+	flag.StringVar(&APIToken, "api_token", defaultAPIToken, "Bearer token required by the HTTP API")
+	flag.StringVar(&GRPCListen, "grpc_listen", defaultGRPCListen, "Address for the gRPC API (e.g. 127.0.0.1:8789), empty to disable, requires api_token")
+	flag.StringVar(&DebugListen, "debug_listen", defaultDebugListen, "Localhost address to serve pprof profiles and expvar on (e.g. 127.0.0.1:6060), empty to disable")
+	flag.StringVar(&EventsSocket, "events_socket", DefaultEventsSocket(), "Unix socket streaming JSON-lines events, empty to disable")
+	flag.BoolVar(&RecordHistory, "record_history", defaultRecordHistory, "Record RSSI samples and events to the history database")
+	flag.StringVar(&HistoryDB, "history_db", DefaultHistoryDB(), "SQLite history database (requires sqlite3)")
+	flag.DurationVar(&HistoryRetention, "history_retention", defaultHistoryRetention, "How long to keep history, 0 to keep everything")
+}
+
+// LoadSettings fills in every flag not given on the command line from the
+// environment, then the profile picked from the config files, then the files.
+func LoadSettings() error {
+	if err := ApplyEnvironment(); err != nil {
+		return err
+	}
+	flag.Visit(func(f *flag.Flag) { fixedSettings[f.Name] = true })
+	for _, path := range ConfigLayers(UserConfigFile()) {
+		if err := ApplyConfigFile(path); err != nil {
+			return err
+		}
+	}
+
+	// The profile's settings win over the files it's in
+	name, err := pickProfile(ProfileName, Profiles)
+	if err != nil {
+		return err
+	}
+	if err := ApplyProfile(name); err != nil {
+		return err
+	}
+	activeProfile = name
+	rememberConfig()
+	return nil
+}
+
+// DaemonState is the runtime state of the monitor loop, shared with the APIs,
+// hooks and everything else running beside it. The settings variables belong
+// to the monitor loop, which applies changes to them; other goroutines read
+// the device from here and the rest with CurrentSettings.
+type DaemonState struct {
+	Device      string    `json:"device"` // The bluetooth_device_address being watched
+	Mode        string    `json:"mode"`
+	RSSI        int       `json:"rssi"`
+	Connected   bool      `json:"connected"`
+	InRange     bool      `json:"in_range"`
+	LastSeen    time.Time `json:"last_seen"`
+	PausedUntil time.Time `json:"paused_until"`
+	ManualLock  bool      `json:"manual_lock"`
+	Standby     bool      `json:"standby"` // On an unknown Wi-Fi network with disable_on_unknown_wifi
+	Trusted     bool      `json:"trusted"` // On a trusted_ssid or trusted_subnet, so not locking
+
+	OutsideSchedule string `json:"outside_schedule,omitempty"` // OutsideIdle or OutsideLockOnly outside the schedule
+
+	LockDevice    string          `json:"lock_device,omitempty"` // The lock_device that's near, holding the screen locked
+	Presence      map[string]bool `json:"presence,omitempty"`    // What each presence provider said at the last check
+	Active        bool            `json:"active"`                // Keyboard or mouse used within activity_window
+	Disabled      bool            `json:"disabled"`              // Turned off with `bluelock disable`
+	DisabledUntil time.Time       `json:"disabled_until"`        // When it ends, zero for until `bluelock enable`
+
+	Health       string  `json:"health"`        // HealthOK, HealthDegraded or HealthBlind
+	ScanFailures int     `json:"scan_failures"` // Scans that failed in a row
+	ScanSeconds  float64 `json:"scan_seconds"`  // How long the latest scan took
+
+	Version string `json:"version"` // The daemon's BuildInfo, for bug reports
+}
+
+// LiveSettings are the settings the API and config reloads change while the
+// daemon runs, as of the last change.
+type LiveSettings struct {
+	LockRSSI        int
+	UnlockRSSI      int
+	CheckInterval   time.Duration
+	SessionTimeout  time.Duration
+	Debug           bool
+	Schedule        string
+	OutsideSchedule string
+}
+
+var (
+	stateMu  sync.Mutex
+	state    = DaemonState{Mode: "locked", Health: HealthOK, Version: currentBuild().String()}
+	settings LiveSettings
+)
+
+// controlQueue carries requests that must run on the monitor loop, such as API commands.
+var controlQueue = make(chan func(), 8)
+
+// CurrentState returns a copy of the daemon state. It's safe to call from
+// any goroutine, but not from within updateState.
+func CurrentState() DaemonState {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return state
+}
+
+// updateState applies fn to the daemon state while holding the lock. fn must
+// not emit events or call CurrentState.
+func updateState(fn func(s *DaemonState)) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	fn(&state)
+}
+
+// CurrentSettings returns a copy of the live settings. Unlike the variables
+// themselves it's safe to call from any goroutine.
+func CurrentSettings() LiveSettings {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return settings
+}
+
+// publishSettings shares the live settings with the other goroutines, and the
+// device through the state. The monitor loop calls it whenever they change.
+func publishSettings() {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	state.Device = BluetoothDeviceAddress
+	settings = LiveSettings{
+		LockRSSI:        LockRSSI,
+		UnlockRSSI:      UnlockRSSI,
+		CheckInterval:   CheckInterval,
+		SessionTimeout:  SessionTimeout,
+		Debug:           Debug,
+		Schedule:        Schedule,
+		OutsideSchedule: OutsideSchedule,
+	}
+}
+
+// lockCommandTimeout bounds a single lock or unlock command.
+const lockCommandTimeout = 10 * time.Second
+
+// LockSystem locks the system with the platform's screen locker and checks that
+// the screen really locked.
+func LockSystem() error {
+	if DryRun {
+		slog.Info("Dry run: would lock the system", "desktop_env", DesktopEnv)
+		return nil
+	}
+	if err := screenLocker.Lock(); err != nil {
+		return err
+	}
+	slog.Info("System locked")
+	return nil
+}
+
+// UnlockSystem unlocks the system with the locker that locked it, and checks that
+// the screen really unlocked.
+func UnlockSystem() error {
+	if DryRun {
+		slog.Info("Dry run: would unlock the system", "desktop_env", DesktopEnv)
+		return nil
+	}
+	if err := screenLocker.Unlock(); err != nil {
+		return err
+	}
+	slog.Info("System unlocked")
+	return nil
+}
+
+// PingBluetoothDevice checks the RSSI of the Bluetooth device for proximity detection.
+func PingBluetoothDevice() (bool, error) {
+	wasConnected := CurrentState().Connected
+	updateState(func(s *DaemonState) { s.Connected = false })
+	defer func() {
+		// Report the device going silent once, on the first scan it misses
+		if wasConnected && !CurrentState().Connected {
+			EmitEvent(Event{Type: EventDeviceLost})
+		}
+	}()
+	started := time.Now()
+	rssi, found, err := scanner.ReadRSSI(BluetoothDeviceAddress)
+	ObserveScanDuration(time.Since(started))
+	recordScan(time.Since(started), err)
+	if err != nil {
+		// The scan itself failed, which is a backend error and not an absent device
+		EmitEvent(Event{Type: EventError, Message: err.Error()})
+		EmitEvent(Event{Type: EventRSSISample})
+		return false, nil
+	}
+	if !found {
+		// The device didn't answer, record an empty sample
+		slog.Debug("Device not found")
+		EmitEvent(Event{Type: EventRSSISample})
+		return false, nil
+	}
+
+	updateState(func(s *DaemonState) {
+		s.RSSI = rssi
+		s.Connected = true
+		s.LastSeen = time.Now()
+	})
+	slog.Debug("RSSI sample", "rssi", rssi)
+	EmitEvent(Event{Type: EventRSSISample, RSSI: &rssi})
+
+	// Check if RSSI meets the proximity thresholds
+	if RSSIInRange(rssi) {
+		return true, nil // Device is close enough for unlocking
+	}
+	slog.Debug("Device out of range", "rssi", rssi)
+	return false, nil
+}
+
+// machine is the daemon's state machine. It is only used from the monitor loop.
+var machine = NewStateMachine(time.Now())
+
+// MonitorBluetooth monitors the Bluetooth device connection and locks/unlocks
+// based on range until ctx is done.
+func MonitorBluetooth(ctx context.Context) {
+	supervise("monitor loop", func() { monitorLoop(ctx) }, failSafeLock)
+}
+
+// monitorLoop checks the device every check_interval until ctx is done.
+func monitorLoop(ctx context.Context) {
+	for ctx.Err() == nil {
+		ReloadConfig()
+
+		// Check if the user is there with the configured presence providers
+		inRange, away, err := CheckPresence()
+		if err != nil {
+			slog.Error("Error during presence check", "err", err)
+			EmitEvent(Event{Type: EventError, Message: err.Error()})
+			waitForNextCheck(ctx)
+			continue
+		}
+		updateState(func(s *DaemonState) { s.InRange = inRange })
+		reportPresence(inRange, away)
+		inRange, away, elsewhere := followMe(inRange, away)
+
+		currentTime := time.Now()
+		outside := outsideSchedule(currentTime)
+		paused := currentTime.Before(CurrentState().PausedUntil) || onVacation(currentTime) || onUnknownWifi() || outside == OutsideIdle
+		syncMachine(machine)
+		machine.Trusted = onTrustedNetwork()
+		machine.LockOnly = outside == OutsideLockOnly
+		machine.Blocked = checkLockDevices()
+		machine.Holding = !inRange && !away
+		machine.Active = activeRecently()
+		if !inRange {
+			disarmUnlock()
+		}
+		switch action, reason := machine.Step(currentTime, inRange, paused); action {
+		case ActionUnlock:
+			if needsConfirmation(reason) {
+				machine.DeferUnlock()
+				armUnlock(currentTime)
+			} else if err := unlockSession(reason); err != nil {
+				// Try again at the next check
+				machine.DeferUnlock()
+			}
+		case ActionWarn:
+			WarnBeforeLock(LockWarning)
+		case ActionCancelLock:
+			if reason == ReasonTrusted {
+				slog.Info("On a trusted network, pending lock canceled")
+			} else if reason == ReasonActive {
+				slog.Info("Keyboard or mouse in use, pending lock canceled")
+			} else {
+				slog.Info("Device back in range, pending lock canceled")
+			}
+			EmitEvent(Event{Type: EventLockCancel, Reason: reason, RSSI: lastRSSI()})
+		case ActionLock:
+			if elsewhere && reason == ReasonOutOfRange {
+				reason = ReasonElsewhere
+			}
+			if reason == ReasonSessionTimeout {
+				slog.Info("Session timeout reached, locking system")
+			}
+			if err := lockSession(reason); err == errLockVetoed {
+				machine.Veto(currentTime, reason)
+			} else if err != nil {
+				machine.RetryLock(currentTime, reason)
+			}
+		}
+		updateState(func(s *DaemonState) { s.ManualLock = machine.ManualLock })
+		saveState()
+		updateIdleInhibit()
+		suspendWhenLongAway(currentTime, inRange)
+		checkLeftBehind(currentTime)
+
+		// Wait before the next check
+		waitForNextCheck(ctx)
+	}
+}
+
+// failSafeLock locks the screen after the monitor loop crashed, since we no
+// longer know the device is there. The lock holds until the user unlocks.
+func failSafeLock() {
+	slog.Warn("Locking because the monitor loop crashed")
+	if err := LockSystem(); err != nil {
+		slog.Error("Failed to lock the system", "desktop_env", DesktopEnv, "err", err)
+		EmitEvent(Event{Type: EventLockFailed, Reason: ReasonCrash, Message: err.Error()})
+		return
+	}
+	machine.LockManually()
+	updateState(func(s *DaemonState) { s.ManualLock = true })
+	EmitEvent(Event{Type: EventLock, Reason: ReasonCrash})
+	setMode("locked", ReasonCrash)
+}
+
+// Reasons recorded with lock/unlock events and state changes.
+const (
+	ReasonInRange        = statemachine.ReasonInRange
+	ReasonOutOfRange     = statemachine.ReasonOutOfRange
+	ReasonSessionTimeout = statemachine.ReasonSessionTimeout
+	ReasonManual         = "manual"
+	ReasonExternal       = "external"                 // The user locked or unlocked the screen themselves
+	ReasonCrash          = "crash"                    // Fail-safe lock after the monitor loop panicked
+	ReasonExit           = "exit"                     // on_exit when the daemon stopped
+	ReasonTrusted        = statemachine.ReasonTrusted // A pending lock dropped on a trusted network
+	ReasonLockDevice     = statemachine.ReasonLockDevice
+	ReasonActive         = statemachine.ReasonActive // A pending lock dropped while the keyboard or mouse is in use
+	ReasonConfirmed      = "confirmed"               // An in-range unlock confirmed with confirm_unlock
+	ReasonPeer           = "peer"                    // A peer instance saw the user leave
+	ReasonElsewhere      = "elsewhere"               // With follow_me, a peer is nearer the device
+)
+
+// errLockVetoed is returned by lockSession when a pre-lock hook vetoed the lock.
+var errLockVetoed = errors.New("lock vetoed by a pre-lock hook")
+
+// lockFailing is set while locks keep failing, so the failure is only reported
+// once. It is only used from the monitor loop.
+var lockFailing bool
+
+// lockSession locks the system and records why. It returns errLockVetoed if a
+// pre-lock hook vetoed the lock, which manual locks can't be, or the error if
+// the system didn't lock.
+func lockSession(reason string) error {
+	if reason != ReasonManual && reason != ReasonLockDevice && machine.CanVeto(time.Now()) {
+		if by := lockDeferral(); by != "" {
+			slog.Info("Lock deferred", "by", by, "reason", reason)
+			EmitEvent(Event{Type: EventLockVetoed, Reason: reason, RSSI: lastRSSI(), Message: by})
+			return errLockVetoed
+		}
+	}
+	vetoed := runHooks(PreLockHooks, "pre", "lock", reason)
+	if vetoed && reason != ReasonManual && machine.CanVeto(time.Now()) {
+		slog.Info("Lock vetoed by a pre-lock hook", "reason", reason)
+		EmitEvent(Event{Type: EventLockVetoed, Reason: reason, RSSI: lastRSSI()})
+		return errLockVetoed
+	}
+	if vetoed {
+		slog.Warn("Ignoring pre-lock hook veto", "reason", reason, "max_lock_veto", MaxLockVeto)
+	}
+	if err := LockSystem(); err != nil {
+		slog.Error("Failed to lock the system", "desktop_env", DesktopEnv, "err", err)
+		if !lockFailing {
+			lockFailing = true
+			EmitEvent(Event{Type: EventLockFailed, Reason: reason, RSSI: lastRSSI(), Message: err.Error()})
+		}
+		return err
+	}
+	lockFailing = false
+	EmitEvent(Event{Type: EventLock, Reason: reason, RSSI: lastRSSI()})
+	setMode("locked", reason)
+	runAwayActions(reason)
+	go runHooks(PostLockHooks, "post", "lock", reason)
+	return nil
+}
+
+// unlockSession unlocks the system and records why. When the unlock fails it
+// records nothing and returns the error.
+func unlockSession(reason string) error {
+	runReturnActions()
+	runHooks(PreUnlockHooks, "pre", "unlock", reason)
+	if err := UnlockSystem(); err != nil {
+		slog.Error("Failed to unlock the system", "desktop_env", DesktopEnv, "err", err)
+		EmitEvent(Event{Type: EventError, Message: "unlock failed: " + err.Error()})
+		return err
+	}
+	EmitEvent(Event{Type: EventUnlock, Reason: reason, RSSI: lastRSSI()})
+	setMode("unlocked", reason)
+	go runHooks(PostUnlockHooks, "post", "unlock", reason)
+	return nil
+}
+
+// lockManually locks the system on request. The lock holds until the device has
+// left range. When already locked it only makes the lock hold.
+func lockManually() {
+	if machine.Mode != "locked" && lockSession(ReasonManual) != nil {
+		return
+	}
+	machine.LockManually()
+	updateState(func(s *DaemonState) { s.ManualLock = true })
+}
+
+// unlockManually unlocks the system on request. If the device isn't in range the
+// next check locks it again.
+func unlockManually() {
+	if unlockSession(ReasonManual) != nil {
+		return
+	}
+	machine.UnlockManually(time.Now())
+	updateState(func(s *DaemonState) { s.ManualLock = false })
+}
+
+// lockChangedOutside records a lock or unlock the user did themselves, so bluelock
+// doesn't undo it while the device stays where it is: a lock holds until the
+// device has left range, an unlock until it has come back.
+func lockChangedOutside(locked bool) {
+	if locked == (machine.Mode == "locked") {
+		return
+	}
+	if locked {
+		slog.Info("Screen locked outside bluelock")
+		machine.LockManually()
+		updateState(func(s *DaemonState) { s.ManualLock = true })
+		EmitEvent(Event{Type: EventLock, Reason: ReasonExternal, RSSI: lastRSSI()})
+		setMode("locked", ReasonExternal)
+		return
+	}
+	slog.Info("Screen unlocked outside bluelock")
+	machine.UnlockOutside(time.Now())
+	updateState(func(s *DaemonState) { s.ManualLock = false })
+	EmitEvent(Event{Type: EventUnlock, Reason: ReasonExternal, RSSI: lastRSSI()})
+	setMode("unlocked", ReasonExternal)
+}
+
+// setMode records the lock mode and emits a state_change event when it changes.
+func setMode(mode, reason string) {
+	var from string
+	updateState(func(s *DaemonState) {
+		from = s.Mode
+		s.Mode = mode
+	})
+	if from != mode {
+		EmitEvent(Event{Type: EventStateChange, From: from, To: mode, Reason: reason})
+	}
+}
+
+// lastRSSI returns the RSSI from the latest scan, or nil if the device didn't answer.
+func lastRSSI() *int {
+	st := CurrentState()
+	if !st.Connected {
+		return nil
+	}
+	return &st.RSSI
+}
+
+// waitForNextCheck sleeps for CheckInterval while running queued control requests
+// and keeping the systemd watchdog fed, or until ctx is done.
+func waitForNextCheck(ctx context.Context) {
+	pingWatchdog()
+	timer := time.NewTimer(CheckInterval)
+	defer timer.Stop()
+	var watchdog <-chan time.Time
+	if interval := watchdogInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
+	for {
+		select {
+		case fn := <-controlQueue:
+			fn()
+		case <-watchdog:
+			pingWatchdog()
+		case <-timer.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func main() {
+	// ssh-add asking for the password bluelock locks its agent with
+	if runAskpass() {
+		return
+	}
+
+	// Run a subcommand if one was given
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "completion":
+			os.Exit(RunCompletionCommand(os.Args[2:]))
+		case "__complete":
+			os.Exit(RunCompleteCommand(os.Args[2:]))
+		case "version", "--version":
+			os.Exit(RunVersionCommand(os.Args[2:]))
+		case "events":
+			os.Exit(RunEventsCommand(os.Args[2:]))
+		case "status":
+			os.Exit(RunStatusCommand(os.Args[2:]))
+		case "top":
+			os.Exit(RunTopCommand(os.Args[2:]))
+		case "history":
+			os.Exit(RunHistoryCommand(os.Args[2:]))
+		case "export":
+			os.Exit(RunExportCommand(os.Args[2:]))
+		case "simulate":
+			os.Exit(RunSimulateCommand(os.Args[2:]))
+		case "stats":
+			os.Exit(RunStatsCommand(os.Args[2:]))
+		case "audit":
+			os.Exit(RunAuditCommand(os.Args[2:]))
+		case "helper":
+			os.Exit(RunHelperCommand(os.Args[2:]))
+		case "install":
+			os.Exit(RunInstallCommand(os.Args[2:]))
+		case "uninstall":
+			os.Exit(RunUninstallCommand(os.Args[2:]))
+		case "config":
+			os.Exit(RunConfigCommand(os.Args[2:]))
+		case "disable":
+			os.Exit(RunDisableCommand(os.Args[2:]))
+		case "enable":
+			os.Exit(RunEnableCommand(os.Args[2:]))
+		case "profile":
+			os.Exit(RunProfileCommand(os.Args[2:]))
+		case "setup":
+			os.Exit(RunSetupCommand(os.Args[2:]))
+		}
+	} else if needsSetup() {
+		// First run: ask instead of failing on the missing device address
+		os.Exit(RunSetupCommand(nil))
+	}
+
+	// Initialize command-line flags
+	InitializeFlags()
+	if err := SetupLogging(LogFormat, LogTarget); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	publishSettings()
+
+	// Pick how to scan
+	var err error
+	if BluetoothHelper != "" {
+		// Scan through the privileged helper so we can run unprivileged
+		scanner = helperScanner{socket: BluetoothHelper}
+	} else if scanner, err = NewScanner(); err != nil {
+		slog.Error("Invalid configuration", "err", err)
+		os.Exit(2)
+	}
+
+	if err := setupPresence(); err != nil {
+		slog.Error("Invalid configuration", "err", err)
+		os.Exit(2)
+	}
+	if _, ok := scanner.(nearbyScanner); wantsNearby() && !ok {
+		slog.Error("Invalid configuration", "err", "lock_device=unknown needs a scanner that sees every device nearby, use scanner=bluez")
+		os.Exit(2)
+	}
+
+	var seats []*seat
+	if SystemMode {
+		// A system daemon serves several users and has no desktop of its own
+		if seats, err = systemSeats(); err != nil {
+			slog.Error("Invalid configuration", "err", err)
+			os.Exit(2)
+		}
+	} else {
+		setupDesktop()
+		recordModeAtStart(restoreState(time.Now()))
+	}
+
+	// Print the parsed config values
+	if SystemMode {
+		slog.Info("Bluetooth Unlock is now active in system mode!", "users", len(seats), "version", CurrentState().Version)
+	} else {
+		slog.Info("Bluetooth Unlock is now active!", "desktop_env", DesktopEnv, "device", BluetoothDeviceAddress, "version", CurrentState().Version)
+	}
+	if DryRun {
+		slog.Warn("Dry run: the system will not actually be locked or unlocked")
+	}
+
+	// Record history if requested
+	if RecordHistory {
+		if err := StartHistory(HistoryDB, HistoryRetention); err != nil {
+			slog.Error("Failed to start history recording", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// Open the audit log if requested
+	if Audit {
+		if err := StartAuditLog(AuditLogPath, AuditKeyFile); err != nil {
+			slog.Error("Failed to open audit log", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// Show desktop notifications if any are enabled
+	if NotifyLock || NotifyUnlock || NotifyDeviceLost || NotifySessionTimeout || NotifyErrors || NotifyPresence || LeftBehindAfter > 0 || ConfirmUnlock {
+		StartNotifications()
+	}
+
+	// Show the tray icon if requested
+	if Tray {
+		StartTray()
+	}
+
+	// Send events to webhooks if any are configured
+	if len(WebhookURLs) > 0 {
+		StartWebhooks(WebhookURLs, strings.Split(WebhookEvents, ","), WebhookSecret, WebhookRetries)
+	}
+
+	// Send push notifications to the phone if configured
+	StartPush(strings.Split(PushEvents, ","), WebhookRetries)
+
+	// Publish presence to an MQTT broker if configured
+	if MQTTBroker != "" {
+		if err := StartMQTT(); err != nil {
+			slog.Error("Failed to set up MQTT", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// Lock together with the other machines if configured
+	if PeerSecret != "" {
+		if err := StartPeers(); err != nil {
+			slog.Error("Failed to start peer mode", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// Start the event stream socket if configured
+	if EventsSocket != "" || activatedListener("events") != nil {
+		if err := StartEventSocket(EventsSocket); err != nil {
+			slog.Error("Failed to start event socket", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// Start the HTTP API if requested
+	if SystemMode && activatedListener("api") != nil {
+		slog.Warn("Not serving the HTTP API on the activated socket, it isn't supported in system mode")
+	} else if APIListen != "" || activatedListener("api") != nil {
+		if err := StartAPI(APIListen, APIToken); err != nil {
+			slog.Error("Failed to start HTTP API", "err", err)
+			os.Exit(1)
+		}
+	}
+	if GRPCListen != "" {
+		if err := StartGRPC(GRPCListen, APIToken); err != nil {
+			slog.Error("Failed to start gRPC API", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// Serve profiles for debugging if requested
+	if DebugListen != "" {
+		if err := StartDebug(DebugListen); err != nil {
+			slog.Error("Failed to start debug endpoint", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// Everything is set up, tell systemd when run with Type=notify
+	sdNotify("READY=1")
+
+	// Monitor Bluetooth connection and manage lock/unlock states until
+	// stopped by a signal
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if SystemMode {
+		RunSystemMode(ctx, seats)
+		applySeatsOnExit(seats)
+	} else {
+		MonitorBluetooth(ctx)
+		applyOnExit()
+		saveState()
+	}
+	StopMQTT()
+	sdNotify("STOPPING=1")
+	slog.Info("Stopped")
+}
+
+// setupDesktop works out the desktop environment unless it was given and sets
+// up its screen locker.
+func setupDesktop() {
+	DesktopEnv = strings.ToUpper(DesktopEnv)
+	if DesktopEnv == "" || DesktopEnv == "AUTO" {
+		DesktopEnv = DetectDesktopEnv()
+		slog.Info("Detected desktop environment", "desktop_env", DesktopEnv,
+			"xdg_current_desktop", os.Getenv("XDG_CURRENT_DESKTOP"), "xdg_session_type", os.Getenv("XDG_SESSION_TYPE"))
+	}
+	locker, err := NewLocker(DesktopEnv)
+	if err != nil {
+		slog.Error("Invalid configuration", "err", err)
+		os.Exit(2)
+	}
+	if watcher, ok := locker.(lockWatcher); ok {
+		watcher.Watch()
+	}
+	screenLocker = locker
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// spBluetooth is the part of `system_profiler SPBluetoothDataType -json` that
+// lists the paired devices, keyed by name.
+type spBluetooth struct {
+	SPBluetoothDataType []struct {
+		Connected    []map[string]spDevice `json:"device_connected"`
+		NotConnected []map[string]spDevice `json:"device_not_connected"`
+	}
+}
+
+// spDevice is a device in the system_profiler report.
+type spDevice struct {
+	Address string          `json:"device_address"`
+	RSSI    json.RawMessage `json:"device_rssi"`
+}
+
+// scannerBackends are the scanners built for macOS.
+const scannerBackends = "system_profiler"
+
+// systemProfilerScanner reads the RSSI of a connected device from system_profiler.
+type systemProfilerScanner struct{}
+
+// NewScanner returns the Bluetooth scanner, system_profiler on macOS.
+func NewScanner() (Scanner, error) {
+	if ScannerBackend != "auto" {
+		return nil, fmt.Errorf("scanner %q isn't available here, use auto", ScannerBackend)
+	}
+	return systemProfilerScanner{}, nil
+}
+
+// ReadRSSI reads the device's RSSI. found is false when the device isn't
+// connected. macOS doesn't report RSSI for every device, a connected one without
+// it is reported at 0, which is always in range.
+func (systemProfilerScanner) ReadRSSI(address string) (rssi int, found bool, err error) {
+	report, err := bluetoothReport()
+	if err != nil {
+		return 0, false, err
+	}
+	for _, controller := range report.SPBluetoothDataType {
+		for _, devices := range controller.Connected {
+			for name, device := range devices {
+				if !strings.EqualFold(device.Address, address) {
+					continue
+				}
+				value := strings.Trim(string(device.RSSI), `"`)
+				if value == "" {
+					slog.Debug("Device connected without an RSSI", "name", name)
+					return 0, true, nil
+				}
+				if rssi, err = strconv.Atoi(value); err != nil {
+					return 0, false, fmt.Errorf("system_profiler: failed to parse RSSI value %q", value)
+				}
+				return rssi, true, nil
+			}
+		}
+	}
+	return 0, false, nil
+}
+
+// Connected reports whether system_profiler lists the device as connected.
+func (systemProfilerScanner) Connected(address string) (bool, error) {
+	report, err := bluetoothReport()
+	if err != nil {
+		return false, err
+	}
+	for _, controller := range report.SPBluetoothDataType {
+		for _, devices := range controller.Connected {
+			for _, device := range devices {
+				if strings.EqualFold(device.Address, address) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// bluetoothReport runs system_profiler for the Bluetooth devices.
+func bluetoothReport() (spBluetooth, error) {
+	var report spBluetooth
+	out, err := RunCommand([]string{"system_profiler", "SPBluetoothDataType", "-json"}, lockCommandTimeout, nil)
+	if err != nil {
+		return report, errors.New("system_profiler: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return report, fmt.Errorf("system_profiler: %w", err)
+	}
+	return report, nil
+}
+
+// PairedDevices lists the paired devices, connected or not, from system_profiler.
+func PairedDevices() ([]PairedDevice, error) {
+	report, err := bluetoothReport()
+	if err != nil {
+		return nil, err
+	}
+	var devices []PairedDevice
+	for _, controller := range report.SPBluetoothDataType {
+		for _, group := range append(controller.Connected, controller.NotConnected...) {
+			for name, device := range group {
+				devices = append(devices, PairedDevice{Address: device.Address, Name: name})
+			}
+		}
+	}
+	return devices, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/proximity"
+)
+
+// scannerBackends are the scanners the scanner flag picks from here.
+const scannerBackends = "hcitool,bluez"
+
+// hcitoolScanner uses `hcitool` to read the RSSI of a connected device.
+type hcitoolScanner = proximity.Hcitool
+
+// hcitoolRemediation explains how to let hcitool read RSSI values.
+const hcitoolRemediation = "hcitool needs CAP_NET_RAW to read RSSI values: run bluelock as root, " +
+	"give hcitool the capability with `sudo setcap cap_net_raw+ep $(command -v hcitool)`, " +
+	"scan through a root `bluelock helper` with bluetooth_helper, or use scanner=bluez"
+
+// NewScanner returns the Bluetooth scanner picked by the scanner flag: hcitool,
+// BlueZ over D-Bus, or with auto hcitool when it's allowed to read RSSI and
+// BlueZ otherwise.
+func NewScanner() (Scanner, error) {
+	switch ScannerBackend {
+	case "auto":
+		if hcitoolAllowed() {
+			return hcitoolScanner{}, nil
+		}
+		if _, err := exec.LookPath("hcitool"); err == nil {
+			slog.Info("hcitool lacks CAP_NET_RAW, scanning through BlueZ instead")
+		}
+		return bluezScanner{adapter: BluetoothAdapter}, nil
+	case "hcitool":
+		if !hcitoolAllowed() {
+			return nil, errors.New(hcitoolRemediation)
+		}
+		return hcitoolScanner{}, nil
+	case "bluez":
+		return bluezScanner{adapter: BluetoothAdapter}, nil
+	}
+	return nil, fmt.Errorf("unknown scanner %q, use auto, hcitool or bluez", ScannerBackend)
+}
+
+// capNetRaw is CAP_NET_RAW's bit in capability sets.
+const capNetRaw = 13
+
+// hcitoolAllowed reports whether hcitool can open a raw HCI socket: it's
+// installed and either we have CAP_NET_RAW or the binary carries it.
+func hcitoolAllowed() bool {
+	path, err := exec.LookPath("hcitool")
+	if err != nil {
+		return false
+	}
+	if os.Geteuid() == 0 {
+		return true
+	}
+	if status, err := os.ReadFile("/proc/self/status"); err == nil {
+		for _, line := range strings.Split(string(status), "\n") {
+			if value, ok := strings.CutPrefix(line, "CapEff:"); ok {
+				if caps, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64); err == nil && caps&(1<<capNetRaw) != 0 {
+					return true
+				}
+			}
+		}
+	}
+	// File capabilities: a little-endian magic word, then the permitted set
+	buf := make([]byte, 24)
+	n, err := syscall.Getxattr(path, "security.capability", buf)
+	return err == nil && n >= 8 && binary.LittleEndian.Uint32(buf[4:8])&(1<<capNetRaw) != 0
+}
+
+// PairedDevices lists the devices paired with BlueZ, from bluetoothctl.
+func PairedDevices() ([]PairedDevice, error) {
+	out, err := RunCommand([]string{"bluetoothctl", "devices", "Paired"}, lockCommandTimeout, nil)
+	if err != nil {
+		return nil, errors.New("bluetoothctl: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	var devices []PairedDevice
+	for _, line := range strings.Split(string(out), "\n") {
+		// Device AA:BB:CC:DD:EE:FF Phone
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+		if len(fields) < 2 || fields[0] != "Device" {
+			continue
+		}
+		device := PairedDevice{Address: fields[1]}
+		if len(fields) == 3 {
+			device.Name = fields[2]
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bleScanWindow is how long each scan listens for the device's advertisements.
+const bleScanWindow = 2 * time.Second
+
+// windowsScanScript listens for BLE advertisements from the device through the
+// WinRT advertisement watcher and prints the strongest RSSI it heard. A device
+// that doesn't advertise but is connected prints CONNECTED, otherwise NONE.
+// It's formatted with the address as a number, the scan window in seconds and
+// the address as 12 hex digits.
+const windowsScanScript = `
+$ErrorActionPreference = 'Stop'
+$null = [Windows.Devices.Bluetooth.Advertisement.BluetoothLEAdvertisementWatcher, Windows.Devices.Bluetooth, ContentType = WindowsRuntime]
+$watcher = New-Object Windows.Devices.Bluetooth.Advertisement.BluetoothLEAdvertisementWatcher
+$watcher.ScanningMode = 'Active'
+$null = Register-ObjectEvent -InputObject $watcher -EventName Received -SourceIdentifier bluelock
+$best = $null
+$watcher.Start()
+$deadline = (Get-Date).AddSeconds(%[2]d)
+while ((Get-Date) -lt $deadline) {
+	$e = Wait-Event -SourceIdentifier bluelock -Timeout 1
+	if ($e -eq $null) { continue }
+	$a = $e.SourceEventArgs
+	if ($a.BluetoothAddress -eq %[1]d -and ($best -eq $null -or $a.RawSignalStrengthInDBm -gt $best)) { $best = $a.RawSignalStrengthInDBm }
+	Remove-Event -EventIdentifier $e.EventIdentifier
+}
+$watcher.Stop()
+Unregister-Event -SourceIdentifier bluelock
+if ($best -ne $null) { "RSSI $best"; exit }
+$device = Get-PnpDevice -Class Bluetooth -ErrorAction SilentlyContinue | Where-Object { $_.InstanceId -like '*%[3]s*' } | Select-Object -First 1
+if ($device -ne $null) {
+	$connected = Get-PnpDeviceProperty -InstanceId $device.InstanceId -KeyName '{83DA6326-97A6-4088-9453-A1923F573B29} 15' -ErrorAction SilentlyContinue
+	if ($connected.Data) { 'CONNECTED'; exit }
+}
+'NONE'
+`
+
+// scannerBackends are the scanners built for Windows.
+const scannerBackends = "winrt"
+
+// winrtScanner scans for the device with the Windows Bluetooth APIs.
+type winrtScanner struct{}
+
+// NewScanner returns the Bluetooth scanner, the WinRT APIs through PowerShell on Windows.
+func NewScanner() (Scanner, error) {
+	if ScannerBackend != "auto" {
+		return nil, fmt.Errorf("scanner %q isn't available here, use auto", ScannerBackend)
+	}
+	return winrtScanner{}, nil
+}
+
+// ReadRSSI listens for the device's advertisements. Windows only reports RSSI for
+// BLE advertisements; a classic device that's connected but not advertising has
+// no RSSI, so it's reported at 0, which is always in range.
+func (winrtScanner) ReadRSSI(address string) (rssi int, found bool, err error) {
+	hex := strings.ToUpper(strings.ReplaceAll(address, ":", ""))
+	number, err := strconv.ParseUint(hex, 16, 48)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid Bluetooth address %q", address)
+	}
+	script := fmt.Sprintf(windowsScanScript, number, int(bleScanWindow/time.Second), hex)
+	argv := []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script}
+	out, err := RunCommand(argv, bleScanWindow+lockCommandTimeout, nil)
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		return 0, false, errors.New("powershell: " + strings.TrimSpace(output+" "+err.Error()))
+	}
+
+	lines := strings.Split(output, "\n")
+	result := strings.TrimSpace(lines[len(lines)-1])
+	switch {
+	case strings.HasPrefix(result, "RSSI "):
+		rssi, err = strconv.Atoi(strings.TrimPrefix(result, "RSSI "))
+		if err != nil {
+			return 0, false, fmt.Errorf("powershell: failed to parse RSSI value: %w", err)
+		}
+		return rssi, true, nil
+	case result == "CONNECTED":
+		slog.Debug("Device connected without advertising, no RSSI available")
+		return 0, true, nil
+	default:
+		return 0, false, nil
+	}
+}
+
+// pnpAddress finds the address in a Bluetooth device's PnP instance id, such as
+// BTHENUM\{...}_LOCALMFG&0000\8&2B1E3F&0&AABBCCDDEEFF_C00000000 or BTHLE\DEV_AABBCCDDEEFF\...
+var pnpAddress = regexp.MustCompile(`(?i)(?:DEV_|&)([0-9A-F]{12})(?:_|\\|$)`)
+
+// PairedDevices lists the paired Bluetooth devices PnP knows about.
+func PairedDevices() ([]PairedDevice, error) {
+	script := `Get-PnpDevice -Class Bluetooth -ErrorAction SilentlyContinue | ForEach-Object { $_.InstanceId + '|' + $_.FriendlyName }`
+	argv := []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script}
+	out, err := RunCommand(argv, lockCommandTimeout, nil)
+	if err != nil {
+		return nil, errors.New("powershell: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	seen := map[string]bool{}
+	var devices []PairedDevice
+	for _, line := range strings.Split(string(out), "\n") {
+		id, name, _ := strings.Cut(strings.TrimSpace(line), "|")
+		match := pnpAddress.FindStringSubmatch(id)
+		if match == nil {
+			continue
+		}
+		hex := strings.ToUpper(match[1])
+		address := hex[0:2] + ":" + hex[2:4] + ":" + hex[4:6] + ":" + hex[6:8] + ":" + hex[8:10] + ":" + hex[10:12]
+		if !seen[address] {
+			seen[address] = true
+			devices = append(devices, PairedDevice{Address: address, Name: name})
+		}
+	}
+	return devices, nil
+}
@@ -0,0 +1,82 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// bluezScanner reads the device's RSSI from BlueZ over the system bus, which
+// needs no privileges. BlueZ only knows the RSSI while it's discovering or the
+// device is advertising; a connected device without one is reported at 0,
+// which is always in range.
+type bluezScanner struct {
+	adapter string
+}
+
+// ReadRSSI reads the device's RSSI. found is false when BlueZ has neither an
+// RSSI for it nor a connection to it.
+func (b bluezScanner) ReadRSSI(address string) (rssi int, found bool, err error) {
+	path := "/org/bluez/" + b.adapter + "/dev_" + strings.ReplaceAll(strings.ToUpper(address), ":", "_")
+	reply, err := DBusCall("system", "org.bluez", path, "org.freedesktop.DBus.Properties.Get", "'org.bluez.Device1'", "'RSSI'")
+	if err == nil {
+		value, err := ParseDBusInt(reply)
+		if err != nil {
+			return 0, false, fmt.Errorf("bluez: failed to parse RSSI value: %w", err)
+		}
+		return int(value), true, nil
+	}
+	if strings.Contains(err.Error(), "UnknownObject") || strings.Contains(err.Error(), "UnknownMethod") {
+		return 0, false, fmt.Errorf("bluez doesn't know %s on %s, pair it first", address, b.adapter)
+	}
+
+	// No RSSI without discovery, fall back to the connection
+	connected, err := b.Connected(address)
+	return 0, connected, err
+}
+
+// Connected reports whether BlueZ has a connection to the device.
+func (b bluezScanner) Connected(address string) (bool, error) {
+	path := "/org/bluez/" + b.adapter + "/dev_" + strings.ReplaceAll(strings.ToUpper(address), ":", "_")
+	reply, err := DBusCall("system", "org.bluez", path, "org.freedesktop.DBus.Properties.Get", "'org.bluez.Device1'", "'Connected'")
+	if err != nil {
+		return false, fmt.Errorf("bluez: %w", err)
+	}
+	connected, err := ParseDBusBool(reply)
+	if err != nil {
+		return false, fmt.Errorf("bluez: %w", err)
+	}
+	return connected, nil
+}
+
+// bluezObject finds each device's address, RSSI and pairing in a
+// GetManagedObjects reply.
+var (
+	bluezAddress = regexp.MustCompile(`'Address': <'([0-9A-Fa-f:]{17})'>`)
+	bluezRSSI    = regexp.MustCompile(`'RSSI': <int16 (-?\d+)>`)
+	bluezPaired  = regexp.MustCompile(`'Paired': <true>`)
+)
+
+// Nearby lists the devices BlueZ has an RSSI for, which are the ones it has
+// heard from lately while discovering or connected.
+func (b bluezScanner) Nearby() ([]NearbyDevice, error) {
+	reply, err := DBusCall("system", "org.bluez", "/", "org.freedesktop.DBus.ObjectManager.GetManagedObjects")
+	if err != nil {
+		return nil, fmt.Errorf("bluez: %w", err)
+	}
+	var devices []NearbyDevice
+	prefix := "objectpath '/org/bluez/" + b.adapter + "/dev_"
+	for _, object := range strings.Split(reply, prefix)[1:] {
+		address := bluezAddress.FindStringSubmatch(object)
+		rssi := bluezRSSI.FindStringSubmatch(object)
+		if address == nil || rssi == nil {
+			continue
+		}
+		value, _ := strconv.Atoi(rssi[1])
+		devices = append(devices, NearbyDevice{Address: strings.ToUpper(address[1]), RSSI: value, Paired: bluezPaired.MatchString(object)})
+	}
+	return devices, nil
+}
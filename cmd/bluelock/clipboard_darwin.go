@@ -0,0 +1,14 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClearClipboard empties the pasteboard by copying nothing.
+func ClearClipboard() error {
+	if out, err := RunCommand([]string{"pbcopy"}, lockCommandTimeout, nil); err != nil {
+		return fmt.Errorf("pbcopy: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ClearClipboard empties the clipboard and the primary selection, with wl-copy
+// on Wayland and xsel on X11.
+func ClearClipboard() error {
+	var commands [][]string
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		commands = [][]string{{"wl-copy", "--clear"}, {"wl-copy", "--primary", "--clear"}}
+	case os.Getenv("DISPLAY") != "":
+		commands = [][]string{{"xsel", "--clipboard", "--clear"}, {"xsel", "--primary", "--clear"}}
+	default:
+		return errors.New("no clipboard to clear")
+	}
+	if _, err := exec.LookPath(commands[0][0]); err != nil {
+		return fmt.Errorf("install %s to clear the clipboard", commands[0][0])
+	}
+	var failed []error
+	for _, argv := range commands {
+		if out, err := RunCommand(argv, lockCommandTimeout, nil); err != nil {
+			failed = append(failed, fmt.Errorf("%s: %v: %s", argv[0], err, strings.TrimSpace(string(out))))
+		}
+	}
+	return errors.Join(failed...)
+}
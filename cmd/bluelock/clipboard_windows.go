@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+var (
+	openClipboard  = syscall.NewLazyDLL("user32.dll").NewProc("OpenClipboard")
+	emptyClipboard = syscall.NewLazyDLL("user32.dll").NewProc("EmptyClipboard")
+	closeClipboard = syscall.NewLazyDLL("user32.dll").NewProc("CloseClipboard")
+)
+
+// ClearClipboard empties the clipboard.
+func ClearClipboard() error {
+	if ok, _, err := openClipboard.Call(0); ok == 0 {
+		return fmt.Errorf("OpenClipboard: %v", err)
+	}
+	defer closeClipboard.Call()
+	if ok, _, err := emptyClipboard.Call(); ok == 0 {
+		return fmt.Errorf("EmptyClipboard: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// SplitCommand splits a command line into arguments without involving a shell.
+// Single and double quotes group words and a backslash escapes the next character.
+func SplitCommand(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, line)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in %q", line)
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// commandFlag is a flag holding a command as argv. On the command line the value
+// is split with SplitCommand; a config file can give the array directly.
+type commandFlag []string
+
+func (c *commandFlag) String() string { return strings.Join(*c, " ") }
+
+func (c *commandFlag) Set(value string) error {
+	argv, err := SplitCommand(value)
+	if err != nil {
+		return err
+	}
+	*c = argv
+	return nil
+}
+
+// SetArgs sets the command from an array, taking each element as one argument.
+func (c *commandFlag) SetArgs(argv []string) error {
+	*c = argv
+	return nil
+}
+
+// commandWaitDelay is how long RunCommand waits for a command's output to close
+// once the command exited or was killed.
+const commandWaitDelay = time.Second
+
+// RunCommand runs argv with a timeout and extra environment variables, returning
+// its combined output.
+func RunCommand(argv []string, timeout time.Duration, env []string) ([]byte, error) {
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	// A background process it left holding the output open would otherwise
+	// keep us waiting past the timeout
+	cmd.WaitDelay = commandWaitDelay
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return out, fmt.Errorf("%s timed out after %s", argv[0], timeout)
+	}
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// It exited fine, only what it left running still had the output
+		return out, nil
+	}
+	return out, err
+}
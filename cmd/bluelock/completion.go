@@ -0,0 +1,409 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// command is a subcommand as completion knows it.
+type command struct {
+	name  string
+	usage string
+	// flags are the subcommand's own flags, with a trailing = for those that
+	// take a value. Subcommands that read the settings, like config, take the
+	// daemon's flags instead.
+	flags       []string
+	daemonFlags bool
+	// values completes the value of one of flags, by name
+	values func(name string) []completion
+	// positionals completes the next argument after args
+	positionals func(args []string) []completion
+}
+
+// commands are bluelock's subcommands, as dispatched in main.
+var commands = []command{
+	{name: "setup", usage: "Pick the device, check the desktop and calibrate the thresholds", daemonFlags: true},
+	{name: "status", usage: "Print the running daemon's state", flags: []string{"format=", "follow", "socket="},
+		values: func(name string) []completion {
+			if name == "format" {
+				return words("json", "text", "waybar", "polybar", "i3blocks")
+			}
+			return nil
+		}},
+	{name: "top", usage: "Live dashboard of the running daemon", flags: []string{"socket="}},
+	{name: "events", usage: "Print the daemon's events as JSON lines", flags: []string{"follow", "socket="}},
+	{name: "history", usage: "Show recorded events", flags: []string{"db=", "from=", "to=", "type=", "limit=", "json"}},
+	{name: "export", usage: "Export recorded events as CSV or JSON", flags: []string{"db=", "from=", "to=", "format=", "type=", "output="},
+		values: func(name string) []completion {
+			if name == "format" {
+				return words("csv", "json")
+			}
+			return nil
+		}},
+	{name: "simulate", usage: "Replay an RSSI trace with other thresholds", flags: []string{"trace=", "lock_rssi=", "unlock_rssi=", "session_timeout=", "lock_warning="}},
+	{name: "stats", usage: "Summarize recorded locks and unlocks", flags: []string{"db=", "from=", "to=", "unlock_rssi=", "false_lock_window="}},
+	{name: "audit", usage: "Verify the audit log", flags: []string{"file=", "key_file="},
+		positionals: func(args []string) []completion {
+			if len(args) == 0 {
+				return words("verify")
+			}
+			return nil
+		}},
+	{name: "helper", usage: "Run the privileged scanning helper", flags: []string{"socket=", "group="}},
+	{name: "install", usage: "Install the systemd unit", flags: []string{"system", "socket"}},
+	{name: "uninstall", usage: "Remove the systemd unit", flags: []string{"system"}},
+	{name: "config", usage: "Get or set a setting in the config file", daemonFlags: true, positionals: completeConfig},
+	{name: "disable", usage: "Stop locking and unlocking until bluelock enable", flags: []string{"until=", "reason="}},
+	{name: "enable", usage: "End a bluelock disable"},
+	{name: "profile", usage: "List the profiles or pick one", daemonFlags: true, positionals: completeProfile},
+	{name: "version", usage: "Print the version and build information", flags: []string{"json"}},
+	{name: "completion", usage: "Print a bash, zsh or fish completion script",
+		positionals: func(args []string) []completion {
+			if len(args) == 0 {
+				return words("bash", "zsh", "fish")
+			}
+			return nil
+		}},
+}
+
+// completion is a candidate for the word being completed, with a description
+// for the shells that show one.
+type completion struct {
+	value       string
+	description string
+}
+
+// words makes completions without descriptions.
+func words(values ...string) []completion {
+	completions := make([]completion, len(values))
+	for i, value := range values {
+		completions[i] = completion{value: value}
+	}
+	return completions
+}
+
+// RunCompletionCommand implements `bluelock completion bash|zsh|fish`, which
+// prints a script that completes bluelock's commands and flags by asking
+// `bluelock __complete`.
+func RunCompletionCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: bluelock completion bash|zsh|fish")
+		return 2
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown shell %q, use bash, zsh or fish\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+// RunCompleteCommand implements `bluelock __complete <word>...`, which the
+// completion scripts call with the words after bluelock, the last being the
+// one to complete, and prints a candidate per line, tab-separated from its
+// description.
+func RunCompleteCommand(args []string) int {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	DefineFlags()
+	for _, c := range complete(args[:len(args)-1], args[len(args)-1]) {
+		if c.description != "" {
+			fmt.Printf("%s\t%s\n", c.value, c.description)
+		} else {
+			fmt.Println(c.value)
+		}
+	}
+	return 0
+}
+
+// complete returns the candidates for cur after the words before it.
+func complete(before []string, cur string) []completion {
+	var cmd *command
+	if len(before) > 0 {
+		for i := range commands {
+			if commands[i].name == before[0] {
+				cmd = &commands[i]
+				before = before[1:]
+				break
+			}
+		}
+	}
+
+	// --flag=value, or a value after a --flag
+	if name, value, ok := strings.Cut(cur, "="); ok && strings.HasPrefix(name, "-") {
+		var candidates []completion
+		for _, c := range flagValues(cmd, name) {
+			c.value = name + "=" + c.value
+			candidates = append(candidates, c)
+		}
+		return matching(candidates, name+"="+value)
+	}
+	if len(before) > 0 {
+		if prev := before[len(before)-1]; strings.HasPrefix(prev, "-") && !strings.Contains(prev, "=") && takesValue(cmd, prev) {
+			return matching(flagValues(cmd, prev), cur)
+		}
+	}
+
+	if strings.HasPrefix(cur, "-") {
+		return matching(flagNames(cmd), cur)
+	}
+	var positional []string
+	for i := 0; i < len(before); i++ {
+		if !strings.HasPrefix(before[i], "-") {
+			positional = append(positional, before[i])
+		} else if !strings.Contains(before[i], "=") && takesValue(cmd, before[i]) {
+			i++
+		}
+	}
+	switch {
+	case cmd == nil && len(before) == 0:
+		candidates := make([]completion, len(commands))
+		for i, c := range commands {
+			candidates[i] = completion{value: c.name, description: c.usage}
+		}
+		return matching(candidates, cur)
+	case cmd != nil && cmd.positionals != nil:
+		return matching(cmd.positionals(positional), cur)
+	}
+	return nil
+}
+
+// matching keeps the candidates starting with prefix.
+func matching(candidates []completion, prefix string) []completion {
+	var kept []completion
+	for _, c := range candidates {
+		if strings.HasPrefix(c.value, prefix) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// flagName returns the real name of a flag as given, such as --lock-rssi or
+// --device, without its dashes.
+func flagName(cmd *command, arg string) string {
+	if cmd == nil || cmd.daemonFlags {
+		arg = canonicalFlagArgs([]string{arg})[0]
+	}
+	return strings.TrimLeft(arg, "-")
+}
+
+// flagNames returns the flags cmd takes, or the daemon's without one.
+func flagNames(cmd *command) []completion {
+	var candidates []completion
+	if cmd == nil || cmd.daemonFlags {
+		flag.VisitAll(func(f *flag.Flag) {
+			candidates = append(candidates, completion{value: "--" + f.Name, description: f.Usage})
+		})
+		return candidates
+	}
+	for _, name := range cmd.flags {
+		candidates = append(candidates, completion{value: "--" + strings.TrimSuffix(name, "=")})
+	}
+	return candidates
+}
+
+// takesValue reports whether the flag arg is followed by its value, like
+// --profile work, rather than being a switch like --debug.
+func takesValue(cmd *command, arg string) bool {
+	name := flagName(cmd, arg)
+	if cmd == nil || cmd.daemonFlags {
+		f := flag.Lookup(name)
+		if f == nil {
+			return false
+		}
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		return !ok || !b.IsBoolFlag()
+	}
+	for _, f := range cmd.flags {
+		if f == name+"=" {
+			return true
+		}
+	}
+	return false
+}
+
+// flagValues returns what the flag arg can be set to, where that's known.
+func flagValues(cmd *command, arg string) []completion {
+	name := flagName(cmd, arg)
+	if cmd != nil && !cmd.daemonFlags {
+		if cmd.values == nil {
+			return nil
+		}
+		return cmd.values(name)
+	}
+	return settingValues(name)
+}
+
+// settingValues returns what a setting can be set to, where that's known:
+// the choices of the settings that have a few, the profiles in the config
+// files and the paired devices.
+func settingValues(name string) []completion {
+	switch name {
+	case "desktop_env":
+		return words("auto", "CINNAMON", "GNOME", "KDE", "MATE", "XFCE", "LXQT", "BUDGIE", "SWAY", "HYPRLAND", "WAYLAND", "I3LOCK", "XSECURELOCK", "LIGHTDM", "DBUS", "LOGINCTL")
+	case "scanner":
+		return words("auto", "hcitool", "bluez")
+	case "log_format":
+		return words("text", "json")
+	case "log_target":
+		return words("auto", "stderr", "file", "journal", "syslog")
+	case "presence":
+		return words("bluetooth", "ble", "connection", "exec", "lan", "mqtt", "peer", "usb", "worn")
+	case "presence_failure":
+		return words(FailAbsent, FailPresent, FailLast)
+	case "outside_schedule":
+		return words(OutsideIdle, OutsideLockOnly)
+	case "on_exit":
+		return words(ExitLeave, ExitLock, ExitRestore)
+	case "device_policy":
+		return words(PolicyAny, PolicyAll)
+	case "ssh_agent":
+		return words(SSHAgentLock, SSHAgentDelete)
+	case "suspend_mode":
+		return words(SuspendSleep, SuspendHibernate, SuspendHybrid, SuspendThenHib)
+	case "lock_consoles":
+		return words("physlock", "vlock")
+	case "profile":
+		return append(profileCompletions(), completion{value: autoProfile, description: "Pick the first profile whose match fits"})
+	case "bluetooth_device_address", "worn_device":
+		return pairedCompletions()
+	case "lock_device":
+		return append(pairedCompletions(), completion{value: "unknown", description: "Any unpaired device"})
+	}
+	if f := flag.Lookup(name); f != nil {
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			return words("true", "false")
+		}
+	}
+	return nil
+}
+
+// completeConfig completes `bluelock config get|set <setting> <value>`.
+func completeConfig(args []string) []completion {
+	switch {
+	case len(args) == 0:
+		return []completion{{"get", "Print a setting, or all of them"}, {"set", "Write a setting to the config file"}}
+	case len(args) == 1 && (args[0] == "get" || args[0] == "set"):
+		var candidates []completion
+		flag.VisitAll(func(f *flag.Flag) {
+			if f.Name != "config" {
+				candidates = append(candidates, completion{value: f.Name, description: f.Usage})
+			}
+		})
+		return candidates
+	case len(args) == 2 && args[0] == "set":
+		return settingValues(strings.ReplaceAll(args[1], "-", "_"))
+	}
+	return nil
+}
+
+// completeProfile completes `bluelock profile list|use <name>`.
+func completeProfile(args []string) []completion {
+	switch {
+	case len(args) == 0:
+		return []completion{{"list", "Show the profiles and the active one"}, {"use", "Make the config file select a profile"}}
+	case len(args) == 1 && args[0] == "use":
+		return settingValues("profile")
+	}
+	return nil
+}
+
+// profileCompletions returns the profiles in the config files.
+func profileCompletions() []completion {
+	if err := LoadSettings(); err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(Profiles))
+	for name := range Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return words(names...)
+}
+
+// pairedCompletions returns the paired devices' addresses, described by
+// their names.
+func pairedCompletions() []completion {
+	devices, err := PairedDevices()
+	if err != nil {
+		return nil
+	}
+	candidates := make([]completion, len(devices))
+	for i, d := range devices {
+		candidates[i] = completion{value: d.Address, description: d.Name}
+	}
+	return candidates
+}
+
+// bashCompletion completes with `bluelock __complete` in bash. The words are
+// split from the line itself, since bash splits at = and : too, and the
+// candidates trimmed to what bash takes for the current word.
+const bashCompletion = `# bash completion for bluelock, from: bluelock completion bash
+_bluelock() {
+	local line=${COMP_LINE:0:COMP_POINT}
+	local -a words
+	read -ra words <<< "$line"
+	[[ $line =~ [[:space:]]$ ]] && words+=("")
+	local cur=${words[${#words[@]}-1]}
+	local prefix=${cur%"${cur##*[=:]}"}
+	local IFS=$'\n' candidate
+	COMPREPLY=()
+	for candidate in $("${words[0]}" __complete "${words[@]:1}" 2>/dev/null); do
+		candidate=${candidate%%$'\t'*}
+		COMPREPLY+=("${candidate#"$prefix"}")
+	done
+}
+complete -o default -F _bluelock bluelock
+`
+
+// zshCompletion completes with `bluelock __complete` in zsh, falling back to
+// file names where it has nothing.
+const zshCompletion = `#compdef bluelock
+# zsh completion for bluelock, from: bluelock completion zsh
+_bluelock() {
+	local -a lines candidates
+	local line value
+	lines=("${(@f)$(${words[1]} __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	for line in $lines; do
+		[[ -z $line ]] && continue
+		value=${line%%$'\t'*}
+		value=${value//:/\\:}
+		if [[ $line == *$'\t'* ]]; then
+			candidates+=("$value:${line#*$'\t'}")
+		else
+			candidates+=("$value")
+		fi
+	done
+	if (( ${#candidates} )); then
+		_describe -V bluelock candidates
+	else
+		_files
+	fi
+}
+if [[ $zsh_eval_context[-1] == loadautofunc ]]; then
+	_bluelock "$@"
+else
+	compdef _bluelock bluelock
+fi
+`
+
+// fishCompletion completes with `bluelock __complete` in fish, which takes
+// the tab-separated descriptions as they are.
+const fishCompletion = `# fish completion for bluelock, from: bluelock completion fish
+function __bluelock_complete
+	set -l tokens (commandline -opc) (commandline -ct)
+	bluelock __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c bluelock -f -a '(__bluelock_complete)'
+`
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/config"
+)
+
+// systemConfigDir holds the config used when the user has none of their own.
+const systemConfigDir = "/etc/bluelock"
+
+// configNames are the config file names looked for, in order.
+var configNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// DefaultConfigFile returns the user's config file, read without --config:
+// bluelock/config.{json,yaml,yml,toml} under $XDG_CONFIG_HOME (~/.config), or
+// "" if there is none.
+func DefaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return findConfig(filepath.Join(dir, "bluelock"))
+}
+
+// UserConfigFile returns the config file given with --config, else the user's own.
+func UserConfigFile() string {
+	if ConfigFile != "" {
+		return ConfigFile
+	}
+	return DefaultConfigFile()
+}
+
+// SystemConfigFile returns the config file in /etc/bluelock, whose settings
+// are the defaults for every user, or "" if there is none.
+func SystemConfigFile() string {
+	return findConfig(systemConfigDir)
+}
+
+// findConfig returns the first of configNames that exists in dir.
+func findConfig(dir string) string {
+	for _, name := range configNames {
+		if path := filepath.Join(dir, name); fileExists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// ConfigLayers returns the config files to read, most important first: the
+// user's own (or --config), then the system-wide defaults.
+func ConfigLayers(userFile string) []string {
+	var layers []string
+	if userFile != "" {
+		layers = append(layers, userFile)
+	}
+	system := SystemConfigFile()
+	if system == "" {
+		return layers
+	}
+	if info, err := os.Stat(system); err == nil && userFile != "" {
+		if same, err := os.Stat(userFile); err == nil && os.SameFile(info, same) {
+			return layers
+		}
+	}
+	return append(layers, system)
+}
+
+// stateFile returns where bluelock keeps a state file such as its history:
+// bluelock/<name> under $XDG_STATE_HOME (~/.local/state). Files from before
+// that, in ~/.local/share/bluelock, are still used where they exist.
+func stateFile(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "bluelock-" + name
+	}
+	if legacy := filepath.Join(home, ".local", "share", "bluelock", name); fileExists(legacy) {
+		return legacy
+	}
+	dir := os.Getenv("XDG_STATE_HOME")
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "bluelock", name)
+}
+
+// fileExists reports whether path exists.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// argsSetter is implemented by flags that take an array from the config file as a
+// whole, such as commands given as argv.
+type argsSetter interface {
+	SetArgs(args []string) error
+}
+
+// ReadConfigFile returns the settings in a config file, upgraded to the
+// current config_version.
+func ReadConfigFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := config.Decode(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := migrateConfig(path, values); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return values, nil
+}
+
+// envPrefix starts the environment variables that set flags, e.g. BLUELOCK_LOCK_RSSI=-20.
+const envPrefix = "BLUELOCK_"
+
+// ApplyEnvironment sets each flag not given on the command line from its
+// BLUELOCK_<NAME> environment variable. They win over the config file.
+func ApplyEnvironment() error {
+	onCommandLine := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { onCommandLine[f.Name] = true })
+
+	var names []string
+	flag.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	for _, name := range names {
+		variable := envPrefix + strings.ToUpper(name)
+		value, ok := os.LookupEnv(variable)
+		if !ok || onCommandLine[name] {
+			continue
+		}
+		if err := flag.Set(name, bareSeconds(flag.Lookup(name), value)); err != nil {
+			return fmt.Errorf("%s: invalid value %q: %v", variable, value, err)
+		}
+	}
+	return nil
+}
+
+// ApplyConfigFile sets flags from a JSON, YAML or TOML config file whose keys are flag names,
+// e.g. {"lock_rssi": -20, "pre_lock_hook": ["playerctl pause"]}. Arrays set
+// repeatable flags once per element. Flags already set, on the command line, in
+// the environment or by a more important config file, win over the file.
+func ApplyConfigFile(path string) error {
+	values, err := ReadConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	// The users section isn't a flag, it maps users to devices for system mode.
+	// A user already given by a more important file keeps their settings.
+	if users, ok := values["users"]; ok {
+		var section map[string]UserConfig
+		raw, _ := json.Marshal(users)
+		if err := json.Unmarshal(raw, &section); err != nil {
+			return fmt.Errorf("%s: invalid users: %v", path, err)
+		}
+		if Users == nil {
+			Users = map[string]UserConfig{}
+		}
+		for name, config := range section {
+			if _, ok := Users[name]; !ok {
+				Users[name] = config
+			}
+		}
+		delete(values, "users")
+	}
+
+	// So is the profiles section, merged the same way
+	profiles, err := profilesSection(path, values)
+	if err != nil {
+		return err
+	}
+	if Profiles == nil {
+		Profiles = map[string]Profile{}
+	}
+	for name, profile := range profiles {
+		if _, ok := Profiles[name]; !ok {
+			Profiles[name] = profile
+		}
+	}
+
+	alreadySet := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { alreadySet[f.Name] = true })
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := flag.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+		if alreadySet[name] {
+			continue
+		}
+		if err := setFromConfig(f, values[name]); err != nil {
+			return fmt.Errorf("%s: invalid %s: %v", path, name, err)
+		}
+	}
+	return nil
+}
+
+// setFromConfig sets a flag to a value from a config file. Arrays set
+// repeatable flags once per element, replacing what they held.
+func setFromConfig(f *flag.Flag, value any) error {
+	list, ok := value.([]any)
+	if setter, isArgs := f.Value.(argsSetter); ok && isArgs {
+		args := make([]string, len(list))
+		for i, value := range list {
+			args[i] = fmt.Sprint(value)
+		}
+		return setter.SetArgs(args)
+	}
+	if !ok {
+		list = []any{value}
+	}
+	if repeated, isList := f.Value.(*stringList); isList {
+		*repeated = (*repeated)[:0]
+	}
+	for _, value := range list {
+		if err := f.Value.Set(bareSeconds(f, fmt.Sprint(value))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bareSeconds reads a plain number given for a duration flag as seconds, the
+// way older config files wrote intervals. Anything else, such as "90s" or
+// "30m", is left for the flag to parse.
+func bareSeconds(f *flag.Flag, value string) string {
+	if !isDurationFlag(f) {
+		return value
+	}
+	if _, err := strconv.ParseFloat(value, 64); err != nil {
+		return value
+	}
+	return value + "s"
+}
+
+// isDurationFlag reports whether f takes a duration.
+func isDurationFlag(f *flag.Flag) bool {
+	if f == nil {
+		return false
+	}
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return false
+	}
+	_, isDuration := getter.Get().(time.Duration)
+	return isDuration
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RunConfigCommand implements `bluelock config get [setting]` and
+// `bluelock config set <setting> <value>...`, which edits the user's config
+// file. A running daemon reloads the file on its own.
+func RunConfigCommand(args []string) int {
+	// Daemon flags such as --config may come first
+	DefineFlags()
+	flag.CommandLine.Parse(canonicalFlagArgs(args))
+	args = flag.Args()
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: bluelock config [--config=file] get [setting] | set <setting> <value>...")
+		return 2
+	}
+	if err := LoadSettings(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	switch args[0] {
+	case "get":
+		return configGet(args[1:])
+	case "set":
+		return configSet(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown config command %q, use get or set\n", args[0])
+		return 2
+	}
+}
+
+// configGet prints one setting, or all of them, as the daemon would see them.
+func configGet(args []string) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: bluelock config get [setting]")
+		return 2
+	}
+	if len(args) == 0 {
+		flag.VisitAll(func(f *flag.Flag) { fmt.Printf("%s = %s\n", f.Name, f.Value) })
+		return 0
+	}
+	f := lookupSetting(args[0])
+	if f == nil {
+		fmt.Fprintf(os.Stderr, "Unknown setting %q\n", args[0])
+		return 2
+	}
+	fmt.Println(f.Value)
+	return 0
+}
+
+// configSet checks a new value for a setting and writes it to the user's
+// config file. Lists and commands take one argument per element.
+func configSet(args []string) int {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: bluelock config set <setting> <value>...")
+		return 2
+	}
+	f := lookupSetting(args[0])
+	if f == nil || f.Name == "config" {
+		fmt.Fprintf(os.Stderr, "Unknown setting %q\n", args[0])
+		return 2
+	}
+	name, values := f.Name, args[1:]
+
+	// Set the flag to check the value, then the whole configuration for this setting
+	var stored any
+	switch value := f.Value.(type) {
+	case argsSetter:
+		if err := value.SetArgs(values); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			return 2
+		}
+		stored = values
+	case *stringList:
+		*value = append((*value)[:0], values...)
+		stored = values
+	default:
+		if len(values) != 1 {
+			fmt.Fprintf(os.Stderr, "%s takes a single value\n", name)
+			return 2
+		}
+		if err := flag.Set(name, bareSeconds(f, values[0])); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: invalid value %q: %v\n", name, values[0], err)
+			return 2
+		}
+		stored = configValue(f)
+	}
+	if err := ValidateConfig(); err != nil {
+		for _, problem := range strings.Split(err.Error(), "\n") {
+			if strings.HasPrefix(problem, name+":") {
+				fmt.Fprintln(os.Stderr, problem)
+				return 2
+			}
+		}
+	}
+
+	path, err := updateUserConfig(map[string]any{name: stored})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("Set %s to %s in %s\n", name, f.Value, path)
+	if fixedSettings[name] {
+		fmt.Printf("It's also given on the command line or as %s%s, which wins over the file.\n", envPrefix, strings.ToUpper(name))
+	} else if _, ok := Profiles[activeProfile].Settings[name]; ok {
+		fmt.Printf("The %s profile sets it too, which wins while it's active.\n", activeProfile)
+	} else if isLiveSetting(name) {
+		fmt.Println("A running bluelock picks it up at its next check.")
+	} else {
+		fmt.Println("Restart bluelock to apply it.")
+	}
+	return 0
+}
+
+// lookupSetting finds a setting by name, with dashes or underscores, or by
+// one of the flagAliases.
+func lookupSetting(name string) *flag.Flag {
+	name = strings.ReplaceAll(name, "-", "_")
+	if alias, ok := flagAliases[name]; ok {
+		name = alias
+	}
+	return flag.Lookup(name)
+}
+
+// configValue returns a flag's value as it's written in a JSON config file.
+func configValue(f *flag.Flag) any {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return f.Value.String()
+	}
+	switch value := getter.Get().(type) {
+	case bool:
+		return value
+	case int:
+		return json.Number(f.Value.String())
+	default:
+		return f.Value.String()
+	}
+}
+
+// updateUserConfig writes settings into the user's config file, creating
+// ~/.config/bluelock/config.json if there's none, and returns its path. Only
+// JSON files are rewritten, YAML and TOML ones keep their comments.
+func updateUserConfig(settings map[string]any) (string, error) {
+	path := UserConfigFile()
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find the config directory: %v", err)
+		}
+		path = filepath.Join(dir, "bluelock", "config.json")
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".json" {
+		names := make([]string, 0, len(settings))
+		for name := range settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("only JSON config files can be edited this way, so %s keeps its comments; change %s there by hand", path, strings.Join(names, ", "))
+	}
+	file := map[string]any{}
+	if fileExists(path) {
+		var err error
+		if file, err = ReadConfigFile(path); err != nil {
+			return "", err
+		}
+	}
+	for name, value := range settings {
+		file[name] = value
+	}
+	if err := WriteConfigFile(path, file); err != nil {
+		return "", fmt.Errorf("failed to write the config file: %v", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// With confirm_unlock the device coming into range only arms the unlock, which
+// completes when it's confirmed within confirm_window: with unlock_pin sent to
+// POST /unlock or the Home Assistant lock, or without one only by the
+// notification's Unlock button, as the API token alone doesn't prove the user
+// is there. A relayed Bluetooth signal alone then doesn't open the session.
+
+// maxPINAttempts is how many wrong PINs an armed unlock takes before it lapses.
+const maxPINAttempts = 3
+
+var (
+	errNotArmed = errors.New("no unlock is waiting for confirmation")
+	errWrongPIN = errors.New("wrong PIN")
+)
+
+// The armed unlock, only used from the monitor loop: when it lapses (zero when
+// none is armed), whether the last one lapsed unconfirmed so it waits for the
+// device to leave before arming again, and the wrong PINs so far.
+var (
+	armedUntil  time.Time
+	armLapsed   bool
+	pinAttempts int
+)
+
+// needsConfirmation reports whether an unlock for reason must be confirmed.
+// Only the device coming into range does; manual unlocks are the user already.
+func needsConfirmation(reason string) bool {
+	return ConfirmUnlock && reason == ReasonInRange
+}
+
+// armUnlock arms an unlock, or lets it lapse once confirm_window is over. It's
+// called on every check the device is in range while the unlock waits.
+func armUnlock(now time.Time) {
+	if armLapsed || now.Before(armedUntil) {
+		return
+	}
+	if !armedUntil.IsZero() {
+		slog.Info("Unlock not confirmed in time, waiting for the device to leave")
+		lapseUnlock()
+		return
+	}
+	armedUntil, pinAttempts = now.Add(ConfirmWindow), 0
+	slog.Info("Unlock armed, waiting for confirmation", "window", ConfirmWindow)
+	EmitEvent(Event{Type: EventUnlockArmed, Reason: ReasonInRange, RSSI: lastRSSI(), Message: ConfirmWindow.String()})
+	if UnlockPIN == "" {
+		go offerUnlockButton(ConfirmWindow)
+	}
+}
+
+// lapseUnlock drops the armed unlock until the device has left.
+func lapseUnlock() {
+	armedUntil, armLapsed = time.Time{}, true
+}
+
+// disarmUnlock forgets any armed or lapsed unlock once the device is out of
+// range, so its next arrival arms again.
+func disarmUnlock() {
+	armedUntil, armLapsed = time.Time{}, false
+}
+
+// confirmUnlock completes the armed unlock if pin is right. It runs on the
+// monitor loop.
+func confirmUnlock(pin string) error {
+	if armedUntil.IsZero() || time.Now().After(armedUntil) {
+		return errNotArmed
+	}
+	if UnlockPIN != "" && subtle.ConstantTimeCompare([]byte(pin), []byte(UnlockPIN)) != 1 {
+		pinAttempts++
+		slog.Warn("Wrong unlock PIN", "attempts", pinAttempts)
+		if pinAttempts >= maxPINAttempts {
+			slog.Warn("Too many wrong PINs, waiting for the device to leave")
+			lapseUnlock()
+		}
+		return errWrongPIN
+	}
+	armedUntil = time.Time{}
+	if err := unlockSession(ReasonConfirmed); err != nil {
+		return err
+	}
+	machine.UnlockManually(time.Now())
+	updateState(func(s *DaemonState) { s.ManualLock = false })
+	return nil
+}
+
+// offerUnlockButton shows a notification with an Unlock button for window and
+// confirms the unlock when it's pressed. The signal is followed with gdbus
+// monitor, started before the notification so a quick press isn't missed.
+func offerUnlockButton(window time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), window)
+	cmd := exec.CommandContext(ctx, "gdbus", "monitor", "--session", "--dest", "org.freedesktop.Notifications")
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		cancel()
+		slog.Warn("Can't offer an unlock button", "err", err)
+		return
+	}
+	defer func() {
+		cancel()
+		cmd.Wait()
+	}()
+
+	id, err := NotifyAction("Unlock?", "Your device is near. Press Unlock within "+window.String()+" to unlock.", UrgencyCritical, "unlock", "Unlock")
+	if err != nil {
+		slog.Warn("Can't offer an unlock button", "err", err)
+		return
+	}
+	defer CloseNotification(id)
+	// e.g. "/org/freedesktop/Notifications: org.freedesktop.Notifications.ActionInvoked (uint32 42, 'unlock')"
+	want := fmt.Sprintf(".ActionInvoked (uint32 %d, 'unlock')", id)
+	lines := bufio.NewScanner(stdout)
+	for lines.Scan() {
+		if strings.Contains(lines.Text(), want) {
+			runOnMonitor(func() {
+				if err := confirmUnlock(""); err != nil {
+					slog.Info("Unlock button pressed too late", "err", err)
+				}
+			})
+			return
+		}
+	}
+}
@@ -0,0 +1,66 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+)
+
+// consoleLockCommand returns the command that locks every virtual console with
+// lock_consoles, which is "physlock" or "vlock".
+func consoleLockCommand(locker string) ([]string, error) {
+	switch locker {
+	case "physlock":
+		// -d detaches once the consoles are locked
+		return []string{"physlock", "-d"}, nil
+	case "vlock":
+		// vlock needs a console of its own to run on
+		return []string{"openvt", "-s", "--", "vlock", "-a"}, nil
+	}
+	return nil, fmt.Errorf("unknown lock_consoles %q, use physlock or vlock", locker)
+}
+
+// LockConsoles locks the virtual consoles as well as the graphical session, so a
+// root shell left on a TTY isn't open while the device is away. Both lockers need
+// root, or physlock installed setuid.
+func LockConsoles() {
+	if LockConsolesWith == "" {
+		return
+	}
+	// The console lockers run as root, look at everyone's processes
+	if processNames(-1)[LockConsolesWith] {
+		return
+	}
+	argv, err := consoleLockCommand(LockConsolesWith)
+	if err != nil {
+		slog.Error("Failed to lock the consoles", "err", err)
+		return
+	}
+	if out, err := RunCommand(argv, lockCommandTimeout, nil); err != nil {
+		slog.Error("Failed to lock the consoles", "locker", LockConsolesWith, "err", err, "output", strings.TrimSpace(string(out)))
+		EmitEvent(Event{Type: EventError, Message: "console lock failed: " + err.Error()})
+		return
+	}
+	slog.Info("Consoles locked", "locker", LockConsolesWith)
+}
+
+// UnlockConsoles stops the console locker. Neither can be asked to unlock, so it
+// only happens with unlock_by_killing_locker; otherwise the consoles stay locked
+// until the password is typed.
+func UnlockConsoles() {
+	if LockConsolesWith == "" || !processNames(-1)[LockConsolesWith] {
+		return
+	}
+	if !UnlockByKillingLocker {
+		slog.Info("Consoles stay locked, set unlock_by_killing_locker to unlock them", "locker", LockConsolesWith)
+		return
+	}
+	if err := exec.Command("pkill", "-x", LockConsolesWith).Run(); err != nil {
+		slog.Warn("Failed to unlock the consoles", "locker", LockConsolesWith, "err", err)
+		return
+	}
+	slog.Info("Consoles unlocked", "locker", LockConsolesWith)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dbusTimeout bounds every D-Bus call so a hung service can't stall the daemon.
+const dbusTimeout = 5 * time.Second
+
+// DBusCall calls a D-Bus method with `gdbus` and returns the reply in GVariant text
+// form, e.g. "(uint32 5,)". bus is "session" or "system"; args are GVariant text.
+func DBusCall(bus, dest, path, method string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbusTimeout)
+	defer cancel()
+
+	cmdArgs := []string{"call", "--" + bus, "--dest", dest, "--object-path", path, "--method", method, "--"}
+	cmd := exec.CommandContext(ctx, "gdbus", append(cmdArgs, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %s", method, strings.TrimSpace(stderr.String()+" "+err.Error()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// GVariantString quotes s as a GVariant string literal.
+func GVariantString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// gvariantValue strips the tuple, variant and type decoration from a single-value
+// reply, turning "(uint32 5,)" into "5" and "(<true>,)" into "true".
+func gvariantValue(reply string) string {
+	v := strings.TrimSpace(reply)
+	v = strings.TrimPrefix(v, "(")
+	v = strings.TrimSuffix(v, ")")
+	v = strings.TrimSuffix(strings.TrimSpace(v), ",")
+	v = strings.TrimPrefix(v, "<")
+	v = strings.TrimSuffix(v, ">")
+	for _, prefix := range []string{"byte ", "int16 ", "uint16 ", "int32 ", "uint32 ", "int64 ", "uint64 ", "objectpath ", "@s "} {
+		v = strings.TrimPrefix(v, prefix)
+	}
+	return strings.Trim(v, "'")
+}
+
+// ParseDBusUint parses a reply holding a single unsigned integer.
+func ParseDBusUint(reply string) (uint64, error) {
+	return strconv.ParseUint(gvariantValue(reply), 10, 64)
+}
+
+// ParseDBusBool parses a reply holding a single boolean.
+func ParseDBusBool(reply string) (bool, error) {
+	return strconv.ParseBool(gvariantValue(reply))
+}
+
+// ParseDBusInt parses a reply holding a single signed integer.
+func ParseDBusInt(reply string) (int64, error) {
+	return strconv.ParseInt(gvariantValue(reply), 10, 64)
+}
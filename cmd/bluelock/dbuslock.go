@@ -0,0 +1,141 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// dbusLock locks through org.freedesktop.ScreenSaver on the session bus, falling
+// back to asking logind to lock the session. Between them this covers any desktop
+// that implements the freedesktop interface or listens to logind's Lock signal.
+func dbusLock() error {
+	_, saverErr := DBusCall("session", "org.freedesktop.ScreenSaver", "/org/freedesktop/ScreenSaver", "org.freedesktop.ScreenSaver.Lock")
+	if saverErr == nil {
+		return nil
+	}
+	_, logindErr := DBusCall("system", "org.freedesktop.login1", logindSessionPath(), "org.freedesktop.login1.Session.Lock")
+	if logindErr == nil {
+		return nil
+	}
+	return errors.Join(saverErr, logindErr)
+}
+
+// dbusUnlock asks logind to unlock the session, falling back to deactivating the
+// freedesktop screensaver, which KDE allows.
+func dbusUnlock() error {
+	_, logindErr := DBusCall("system", "org.freedesktop.login1", logindSessionPath(), "org.freedesktop.login1.Session.Unlock")
+	if logindErr == nil {
+		return nil
+	}
+	_, saverErr := DBusCall("session", "org.freedesktop.ScreenSaver", "/org/freedesktop/ScreenSaver", "org.freedesktop.ScreenSaver.SetActive", "false")
+	if saverErr == nil {
+		return nil
+	}
+	return errors.Join(logindErr, saverErr)
+}
+
+// dbusLockActive reports whether the screensaver is active, falling back to the
+// session's LockedHint in logind.
+func dbusLockActive() (bool, error) {
+	reply, saverErr := DBusCall("session", "org.freedesktop.ScreenSaver", "/org/freedesktop/ScreenSaver", "org.freedesktop.ScreenSaver.GetActive")
+	if saverErr == nil {
+		return ParseDBusBool(reply)
+	}
+	reply, logindErr := DBusCall("system", "org.freedesktop.login1", logindSessionPath(), "org.freedesktop.DBus.Properties.Get",
+		GVariantString("org.freedesktop.login1.Session"), GVariantString("LockedHint"))
+	if logindErr == nil {
+		return ParseDBusBool(reply)
+	}
+	return false, errors.Join(saverErr, logindErr)
+}
+
+// gnomeLock locks GNOME Shell through org.gnome.ScreenSaver, falling back to
+// gnome-screensaver-command on old releases and to logind when neither is there.
+func gnomeLock() error {
+	_, err := DBusCall("session", "org.gnome.ScreenSaver", "/org/gnome/ScreenSaver", "org.gnome.ScreenSaver.Lock")
+	if err == nil {
+		return nil
+	}
+	if _, lookErr := exec.LookPath("gnome-screensaver-command"); lookErr == nil {
+		return exec.Command("gnome-screensaver-command", "-l").Run()
+	}
+	if logindErr := exec.Command("loginctl", "lock-session", loginctlSession()).Run(); logindErr != nil {
+		return errors.Join(err, fmt.Errorf("loginctl lock-session: %v", logindErr))
+	}
+	return nil
+}
+
+// gnomeUnlock unlocks GNOME Shell through logind, whose Unlock signal the shell
+// honors; org.gnome.ScreenSaver won't deactivate a locked screen. Falls back to
+// gnome-screensaver-command on old releases.
+func gnomeUnlock() error {
+	err := exec.Command("loginctl", "unlock-session", loginctlSession()).Run()
+	if err == nil {
+		return nil
+	}
+	if _, lookErr := exec.LookPath("gnome-screensaver-command"); lookErr == nil {
+		return exec.Command("gnome-screensaver-command", "-d").Run()
+	}
+	return fmt.Errorf("loginctl unlock-session: %v", err)
+}
+
+// gnomeLockActive asks org.gnome.ScreenSaver whether the screen is locked,
+// falling back to gnome-screensaver-command -q.
+func gnomeLockActive() (bool, error) {
+	reply, err := DBusCall("session", "org.gnome.ScreenSaver", "/org/gnome/ScreenSaver", "org.gnome.ScreenSaver.GetActive")
+	if err == nil {
+		return ParseDBusBool(reply)
+	}
+	if _, lookErr := exec.LookPath("gnome-screensaver-command"); lookErr == nil {
+		return screensaverQuery("gnome-screensaver-command")
+	}
+	return false, err
+}
+
+// kdeLock locks through kscreenlocker's org.freedesktop.ScreenSaver service,
+// falling back to logind. Unlocking always goes through logind, which
+// kscreenlocker listens to.
+func kdeLock() error {
+	_, err := DBusCall("session", "org.freedesktop.ScreenSaver", "/ScreenSaver", "org.freedesktop.ScreenSaver.Lock")
+	if err == nil {
+		return nil
+	}
+	if logindErr := exec.Command("loginctl", "lock-session", loginctlSession()).Run(); logindErr != nil {
+		return errors.Join(err, fmt.Errorf("loginctl lock-session: %v", logindErr))
+	}
+	return nil
+}
+
+// kdeLockActive asks kscreenlocker whether the screen is locked, falling back to
+// the session's LockedHint.
+func kdeLockActive() (bool, error) {
+	reply, err := DBusCall("session", "org.freedesktop.ScreenSaver", "/ScreenSaver", "org.freedesktop.ScreenSaver.GetActive")
+	if err == nil {
+		return ParseDBusBool(reply)
+	}
+	return loginctlLockedHint()
+}
+
+// logindSessionPath returns the logind object path of our session.
+func logindSessionPath() string {
+	return "/org/freedesktop/login1/session/" + dbusLabelEscape(loginctlSession())
+}
+
+// dbusLabelEscape escapes s for use in an object path the way systemd does: any
+// character other than a letter or a non-leading digit becomes _ and its hex code.
+func dbusLabelEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || (i > 0 && c >= '0' && c <= '9') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	return b.String()
+}
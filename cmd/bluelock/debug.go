@@ -0,0 +1,69 @@
+package main
+
+import (
+	"expvar"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// daemonStarted is when the daemon started, for the uptime in expvar.
+var daemonStarted = time.Now()
+
+// StartDebug serves Go's profiler and expvar on addr in the background, for
+// looking into a daemon that uses too much CPU or memory:
+//
+//	go tool pprof http://127.0.0.1:6060/debug/pprof/profile
+//	curl http://127.0.0.1:6060/debug/pprof/goroutine?debug=2
+//
+// It has no token, so it only listens on localhost.
+func StartDebug(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	listener, err := net.Listen("tcp", localAddr(addr))
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			slog.Error("Debug endpoint stopped", "err", err)
+		}
+	}()
+	slog.Info("Debug endpoint listening", "addr", listener.Addr().String())
+	return nil
+}
+
+func init() {
+	// Next to expvar's memstats and cmdline, what's most often asked for in a
+	// bug report
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	expvar.Publish("uptime_seconds", expvar.Func(func() any { return int(time.Since(daemonStarted).Seconds()) }))
+	expvar.Publish("state", expvar.Func(func() any { return CurrentState() }))
+}
+
+// loopbackAddr reports whether addr, as localAddr completes it, is on a
+// loopback interface.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(localAddr(addr))
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,112 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// desktopNames maps XDG_CURRENT_DESKTOP entries to desktop_env values.
+var desktopNames = map[string]string{
+	"x-cinnamon": "CINNAMON",
+	"cinnamon":   "CINNAMON",
+	"gnome":      "GNOME",
+	"kde":        "KDE",
+	"mate":       "MATE",
+	"xfce":       "XFCE",
+	"lxqt":       "LXQT",
+	"budgie":     "BUDGIE",
+	"sway":       "SWAY",
+	"hyprland":   "HYPRLAND",
+}
+
+// desktopProcesses maps processes that give a desktop away to desktop_env values,
+// in order of preference.
+var desktopProcesses = []struct{ process, env string }{
+	{"cinnamon-screensaver", "CINNAMON"},
+	{"mate-screensaver", "MATE"},
+	{"plasmashell", "KDE"},
+	{"xfce4-session", "XFCE"},
+	{"lxqt-session", "LXQT"},
+	{"budgie-panel", "BUDGIE"},
+	{"gnome-shell", "GNOME"},
+	{"sway", "SWAY"},
+	{"Hyprland", "HYPRLAND"},
+	{"xscreensaver", "XSCREENSAVER"},
+}
+
+// DetectDesktopEnv works out desktop_env from the compositors' IPC variables and
+// XDG_CURRENT_DESKTOP, falling back to the processes that are running (ignoring
+// X11-only lockers under Wayland), and to WAYLAND, LIGHTDM or LOGINCTL when
+// nothing is recognized.
+func DetectDesktopEnv() string {
+	if os.Getenv("SWAYSOCK") != "" {
+		return "SWAY"
+	}
+	if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "" {
+		return "HYPRLAND"
+	}
+	for _, name := range strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":") {
+		if env, ok := desktopNames[strings.ToLower(strings.TrimSpace(name))]; ok {
+			return env
+		}
+	}
+
+	// Services often don't get the session's environment, look at what's running
+	running := runningProcesses()
+	wayland := isWaylandSession()
+	for _, p := range desktopProcesses {
+		// An X11 screensaver can't lock a Wayland session
+		if p.env == "XSCREENSAVER" && wayland {
+			continue
+		}
+		if running[p.process] {
+			return p.env
+		}
+	}
+
+	// Other compositors lock through their idle daemon and an ext-session-lock locker
+	if wayland {
+		return "WAYLAND"
+	}
+	// Without a screensaver daemon, LightDM can still lock the session itself
+	if running["lightdm"] {
+		return "LIGHTDM"
+	}
+	return "LOGINCTL"
+}
+
+// runningProcesses returns the executable names of the processes running as
+// the daemon's user, so another user's screen locker doesn't count as ours.
+func runningProcesses() map[string]bool {
+	return processNames(os.Getuid())
+}
+
+// processNames returns the executable names of the processes in /proc owned by
+// uid, or of every process with uid -1.
+func processNames(uid int) map[string]bool {
+	running := map[string]bool{}
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, dir := range dirs {
+		if uid >= 0 {
+			info, err := os.Stat(dir)
+			if err != nil {
+				continue
+			}
+			if st, ok := info.Sys().(*syscall.Stat_t); !ok || int(st.Uid) != uid {
+				continue
+			}
+		}
+		cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+		argv0, _, _ := bytes.Cut(cmdline, []byte{0})
+		running[filepath.Base(string(argv0))] = true
+	}
+	return running
+}
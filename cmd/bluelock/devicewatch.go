@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Device policies, for when a user has several devices: present while any of
+// them is in range, or only while all of them are.
+const (
+	PolicyAny = "any"
+	PolicyAll = "all"
+)
+
+// deviceReading is the outcome of one scan of a device.
+type deviceReading struct {
+	device string
+	round  int   // The coordinator's round the scan was asked for
+	rssi   *int  // nil when the device didn't answer
+	err    error // The scan failing
+}
+
+// deviceWatch scans one device on its own goroutine whenever the coordinator
+// asks, keeping the latest reading, so a slow or hung scan of one device
+// doesn't hold up the decisions about the others.
+type deviceWatch struct {
+	device string
+	scan   chan int             // Rounds to scan for, dropped while a scan runs
+	done   chan<- deviceReading // Sent each reading as its scan finishes
+
+	mu      sync.Mutex
+	reading deviceReading
+	busy    bool // A scan is running or its reading isn't queued yet
+}
+
+// watchDevices starts a deviceWatch for each device, once however many users
+// share it, until ctx is done. Each reading is sent on done.
+func watchDevices(ctx context.Context, devices []string, done chan<- deviceReading) map[string]*deviceWatch {
+	watches := map[string]*deviceWatch{}
+	for _, device := range devices {
+		if _, ok := watches[device]; ok {
+			continue
+		}
+		w := &deviceWatch{device: device, scan: make(chan int, 1), done: done}
+		watches[device] = w
+		go w.run(ctx)
+	}
+	return watches
+}
+
+// run scans the device for every round asked for until ctx is done.
+func (w *deviceWatch) run(ctx context.Context) {
+	for {
+		var round int
+		select {
+		case <-ctx.Done():
+			return
+		case round = <-w.scan:
+		}
+		started := time.Now()
+		rssi, found, err := scanner.ReadRSSI(w.device)
+		ObserveScanDuration(time.Since(started))
+		reading := deviceReading{device: w.device, round: round, err: err}
+		if err == nil && found {
+			reading.rssi = &rssi
+		}
+		w.mu.Lock()
+		w.reading = reading
+		w.mu.Unlock()
+		// Busy until the reading is queued, so a newer one can't overtake it
+		select {
+		case w.done <- reading:
+		case <-ctx.Done():
+			return
+		}
+		w.mu.Lock()
+		w.busy = false
+		w.mu.Unlock()
+	}
+}
+
+// request asks for a scan for round, unless the last one is still running.
+// It reports whether the scan was asked for.
+func (w *deviceWatch) request(round int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.busy {
+		return false
+	}
+	w.busy = true
+	w.scan <- round
+	return true
+}
+
+// latest returns the latest reading and whether a scan is still running.
+func (w *deviceWatch) latest() (deviceReading, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.reading, w.busy
+}
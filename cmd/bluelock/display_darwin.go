@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetDisplayPower puts the displays to sleep, or wakes them by declaring the
+// user active.
+func SetDisplayPower(on bool) error {
+	argv := []string{"pmset", "displaysleepnow"}
+	if on {
+		argv = []string{"caffeinate", "-u", "-t", "1"}
+	}
+	if out, err := RunCommand(argv, lockCommandTimeout, nil); err != nil {
+		return fmt.Errorf("%s: %v: %s", argv[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SetDisplayPower turns the displays on or off, with whatever the desktop
+// offers: sway, Hyprland, GNOME's Mutter, KDE's kscreen-doctor, wlopm on other
+// wlroots compositors (wlr-output-power-management) and DPMS on X11.
+func SetDisplayPower(on bool) error {
+	state := map[bool]string{true: "on", false: "off"}[on]
+	var argv []string
+	switch {
+	case os.Getenv("SWAYSOCK") != "":
+		argv = []string{"swaymsg", "output * power " + state}
+	case os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "":
+		argv = []string{"hyprctl", "dispatch", "dpms", state}
+	case DesktopEnv == "GNOME":
+		// PowerSaveMode 0 is on, 3 is off
+		mode := map[bool]string{true: "<int32 0>", false: "<int32 3>"}[on]
+		_, err := DBusCall("session", "org.gnome.Mutter.DisplayConfig", "/org/gnome/Mutter/DisplayConfig", "org.freedesktop.DBus.Properties.Set", "'org.gnome.Mutter.DisplayConfig'", "'PowerSaveMode'", mode)
+		return err
+	case DesktopEnv == "KDE":
+		argv = []string{"kscreen-doctor", "--dpms", state}
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		if _, err := exec.LookPath("wlopm"); err != nil {
+			return errors.New("install wlopm to turn the displays off on this compositor")
+		}
+		argv = []string{"wlopm", "--" + state, "*"}
+	case os.Getenv("DISPLAY") != "":
+		argv = []string{"xset", "dpms", "force", state}
+	default:
+		return errors.New("no display to turn " + state)
+	}
+	if out, err := RunCommand(argv, lockCommandTimeout, nil); err != nil {
+		return fmt.Errorf("%s: %v: %s", argv[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
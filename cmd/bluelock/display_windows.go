@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// postMessage is user32's PostMessageW, which doesn't wait for every window to
+// answer like SendMessage would.
+var postMessage = syscall.NewLazyDLL("user32.dll").NewProc("PostMessageW")
+
+// The broadcast that turns the monitors off (2) or on (-1).
+const (
+	hwndBroadcast   = 0xffff
+	wmSysCommand    = 0x0112
+	scMonitorPower  = 0xf170
+	monitorPowerOff = 2
+	monitorPowerOn  = ^uintptr(0) // -1
+)
+
+// SetDisplayPower turns the monitors on or off.
+func SetDisplayPower(on bool) error {
+	state := uintptr(monitorPowerOff)
+	if on {
+		state = monitorPowerOn
+	}
+	if ok, _, err := postMessage.Call(hwndBroadcast, wmSysCommand, scMonitorPower, state); ok == 0 {
+		return fmt.Errorf("PostMessage: %v", err)
+	}
+	return nil
+}
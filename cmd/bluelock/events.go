@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types emitted by the daemon.
+const (
+	EventRSSISample  = "rssi_sample"
+	EventStateChange = "state_change"
+	EventLock        = "lock"
+	EventUnlock      = "unlock"
+	EventError       = "error"
+	EventLockPending = "lock_pending"
+	EventLockCancel  = "lock_canceled"
+	EventDeviceLost  = "device_lost"
+	EventLockVetoed  = "lock_vetoed"
+	EventLockFailed  = "lock_failed"
+	EventHealth      = "health"
+	EventArrived     = "arrived"
+	EventDeparted    = "departed"
+	EventLeftBehind  = "left_behind"
+	EventUnlockArmed = "unlock_armed"
+)
+
+// Event is a single structured event, written to subscribers as one JSON line.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Device  string    `json:"device,omitempty"`
+	User    string    `json:"user,omitempty"`
+	RSSI    *int      `json:"rssi,omitempty"`
+	From    string    `json:"from,omitempty"`
+	To      string    `json:"to,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// recentEventLimit is how many events are kept for clients that connect later.
+const recentEventLimit = 100
+
+var (
+	eventMu          sync.Mutex
+	eventSubscribers = map[chan Event]struct{}{}
+	eventHandlers    []func(Event)
+	recentEvents     []Event
+)
+
+// HandleEvents registers fn to be called synchronously for every event. Handlers
+// must be quick; anything slow should use SubscribeEvents instead.
+func HandleEvents(fn func(Event)) {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	eventHandlers = append(eventHandlers, fn)
+}
+
+// EmitEvent stamps an event and delivers it to every handler and subscriber. Slow
+// subscribers miss events rather than blocking the monitor loop.
+func EmitEvent(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Device == "" {
+		e.Device = CurrentState().Device
+	}
+
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	recentEvents = append(recentEvents, e)
+	if len(recentEvents) > recentEventLimit {
+		recentEvents = recentEvents[len(recentEvents)-recentEventLimit:]
+	}
+	for _, fn := range eventHandlers {
+		fn(e)
+	}
+	for ch := range eventSubscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// SubscribeEvents returns a channel receiving every future event, the events
+// emitted so far, and a function that ends the subscription.
+func SubscribeEvents(buffer int) (<-chan Event, []Event, func()) {
+	ch := make(chan Event, buffer)
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	eventSubscribers[ch] = struct{}{}
+	recent := append([]Event(nil), recentEvents...)
+	cancel := func() {
+		eventMu.Lock()
+		defer eventMu.Unlock()
+		if _, ok := eventSubscribers[ch]; ok {
+			delete(eventSubscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, recent, cancel
+}
+
+// DefaultEventsSocket returns the default event socket path under $XDG_RUNTIME_DIR.
+func DefaultEventsSocket() string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return ""
+	}
+	return filepath.Join(runtimeDir, "bluelock", "events.sock")
+}
+
+// StartEventSocket serves the event stream on a Unix socket at path, or on the
+// "events" socket systemd passed us. A client sends "follow" to stream events as
+// they happen, or "recent" to get the buffered events, or asks for the daemon
+// state with "status" or "status follow".
+func StartEventSocket(path string) error {
+	listener := activatedListener("events")
+	if listener == nil {
+		var err error
+		if listener, err = listenEventSocket(path); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				slog.Error("Event socket stopped", "err", err)
+				return
+			}
+			go serveEvents(conn)
+		}
+	}()
+	return nil
+}
+
+// listenEventSocket creates the event socket, only usable by us.
+func listenEventSocket(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	// Remove a socket left behind by a previous run
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// serveEvents writes events to a single socket client.
+func serveEvents(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	request, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	request = strings.TrimSpace(request)
+	if request == "status" || request == "status follow" {
+		serveStatus(conn, request == "status follow")
+		return
+	}
+	follow := request == "follow"
+
+	events, recent, cancel := SubscribeEvents(64)
+	defer cancel()
+
+	encoder := json.NewEncoder(conn)
+	for _, e := range recent {
+		if err := encoder.Encode(e); err != nil {
+			return
+		}
+	}
+	if !follow {
+		return
+	}
+	for e := range events {
+		if err := encoder.Encode(e); err != nil {
+			return
+		}
+	}
+}
+
+// RunEventsCommand implements `bluelock events`, printing recent events from the
+// running daemon and, with --follow, streaming new ones.
+func RunEventsCommand(args []string) int {
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	follow := fs.Bool("follow", false, "Keep streaming events as they happen")
+	socket := fs.String("socket", DefaultEventsSocket(), "Event socket of the running daemon")
+	fs.Parse(args)
+
+	conn, err := net.Dial("unix", *socket)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect to the bluelock daemon:", err)
+		return 1
+	}
+	defer conn.Close()
+
+	request := "recent\n"
+	if *follow {
+		request = "follow\n"
+	}
+	if _, err := io.WriteString(conn, request); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to request events:", err)
+		return 1
+	}
+	if _, err := io.Copy(os.Stdout, conn); err != nil {
+		fmt.Fprintln(os.Stderr, "Event stream interrupted:", err)
+		return 1
+	}
+	return 0
+}
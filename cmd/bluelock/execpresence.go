@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// What a failed presence_command counts as.
+const (
+	FailAbsent  = "absent"
+	FailPresent = "present"
+	FailLast    = "last" // Its previous answer, absent before the first
+)
+
+// execPresence runs presence_command, the contract for presence sources
+// outside bluelock such as a face detection script. It's present when the
+// command exits 0 and absent when it exits 1, unless it prints a JSON object
+// like {"present": true, "reason": "face seen"} on stdout, which wins. Any
+// other exit status, bad JSON or running past presence_timeout fails the
+// check, which counts as presence_failure says. The command gets
+// BLUELOCK_DEVICE and BLUELOCK_MODE, locked or unlocked.
+type execPresence struct {
+	argv []string
+	last bool
+}
+
+// execResult is presence_command's JSON output.
+type execResult struct {
+	Present *bool  `json:"present"`
+	Reason  string `json:"reason"`
+}
+
+func (*execPresence) Name() string { return "exec" }
+
+func (e *execPresence) Present() (bool, error) {
+	present, err := e.run()
+	if err == nil {
+		e.last = present
+		return present, nil
+	}
+	switch PresenceFailure {
+	case FailPresent:
+		present = true
+	case FailLast:
+		present = e.last
+	default:
+		return false, err
+	}
+	slog.Warn("Presence command failed", "err", err, "counts_as", present)
+	EmitEvent(Event{Type: EventError, Message: "exec: " + err.Error()})
+	return present, nil
+}
+
+// run runs the command once and reads its answer.
+func (e *execPresence) run() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), PresenceTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, e.argv[0], e.argv[1:]...)
+	st := CurrentState()
+	cmd.Env = append(os.Environ(), "BLUELOCK_DEVICE="+st.Device, "BLUELOCK_MODE="+st.Mode)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = time.Second // Children left holding stdout after a kill
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return false, fmt.Errorf("%s timed out after %s", e.argv[0], PresenceTimeout)
+	}
+	var exit *exec.ExitError
+	if err != nil && (!errors.As(err, &exit) || exit.ExitCode() != 1) {
+		return false, fmt.Errorf("%s: %s", e.argv[0], strings.TrimSpace(stderr.String()+" "+err.Error()))
+	}
+
+	if out := bytes.TrimSpace(stdout.Bytes()); bytes.HasPrefix(out, []byte("{")) {
+		var result execResult
+		if err := json.Unmarshal(out, &result); err != nil {
+			return false, fmt.Errorf("%s printed invalid JSON: %v", e.argv[0], err)
+		}
+		if result.Present == nil {
+			return false, fmt.Errorf("%s printed JSON without \"present\"", e.argv[0])
+		}
+		slog.Debug("Presence command", "present", *result.Present, "reason", result.Reason)
+		return *result.Present, nil
+	}
+	return err == nil, nil
+}
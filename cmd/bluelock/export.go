@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunExportCommand implements `bluelock export`, dumping recorded events as CSV or JSON.
+func RunExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	db := fs.String("db", DefaultHistoryDB(), "History database")
+	from := fs.String("from", "", "Start time (e.g. 2024-06-01, 14:00, 2h), defaults to the oldest event")
+	to := fs.String("to", "", "End time, defaults to now")
+	format := fs.String("format", "csv", "Output format: csv or json")
+	types := fs.String("type", "", "Comma-separated event types to export (e.g. rssi_sample)")
+	output := fs.String("output", "", "Write to this file instead of stdout")
+	fs.Parse(args)
+
+	if *format != "csv" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "--format: must be csv or json, not %q\n", *format)
+		return 2
+	}
+	var q HistoryQuery
+	var err error
+	if *from != "" {
+		if q.From, err = ParseTimeArg(*from); err != nil {
+			fmt.Fprintln(os.Stderr, "--from:", err)
+			return 2
+		}
+	}
+	if *to != "" {
+		if q.To, err = ParseTimeArg(*to); err != nil {
+			fmt.Fprintln(os.Stderr, "--to:", err)
+			return 2
+		}
+	}
+	if *types != "" {
+		q.Types = strings.Split(*types, ",")
+	}
+
+	events, err := QueryHistory(*db, q)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read history:", err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to create output file:", err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if *format == "json" {
+		err = ExportJSON(w, events)
+	} else {
+		err = ExportCSV(w, events)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Export failed:", err)
+		return 1
+	}
+	return 0
+}
+
+// csvHeader lists the columns written by ExportCSV.
+var csvHeader = []string{"time", "type", "device", "rssi", "from", "to", "reason", "message"}
+
+// ExportCSV writes events as CSV with a header row. Empty RSSI cells mean the
+// device didn't answer.
+func ExportCSV(w io.Writer, events []Event) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, e := range events {
+		rssi := ""
+		if e.RSSI != nil {
+			rssi = strconv.Itoa(*e.RSSI)
+		}
+		cw.Write([]string{e.Time.Format(time.RFC3339Nano), e.Type, e.Device, rssi, e.From, e.To, e.Reason, e.Message})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportJSON writes events as a JSON array.
+func ExportJSON(w io.Writer, events []Event) error {
+	if events == nil {
+		events = []Event{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(events)
+}
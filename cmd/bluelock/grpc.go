@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/grpcapi"
+)
+
+// The gRPC API serves the Bluelock service of bluelock.proto over cleartext
+// HTTP/2, with the messages and framing from the grpcapi package.
+
+// StartGRPC starts the gRPC API on addr in the background. Calls must carry
+// the api_token as authorization metadata.
+func StartGRPC(addr, token string) error {
+	if token == "" {
+		return errors.New("api_token must be set when grpc_listen is used")
+	}
+	listener, err := net.Listen("tcp", localAddr(addr))
+	if err != nil {
+		return err
+	}
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{
+		Handler:           grpcHandler(token),
+		ReadHeaderTimeout: 5 * time.Second,
+		Protocols:         &protocols,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			slog.Error("gRPC API stopped", "err", err)
+		}
+	}()
+	slog.Info("gRPC API listening", "addr", listener.Addr().String())
+	return nil
+}
+
+// grpcHandler checks the token and runs the method called.
+func grpcHandler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			http.Error(w, "this is bluelock's gRPC API", http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			grpcStatus(w, grpcapi.CodeUnauthenticated, "missing or invalid token")
+			return
+		}
+		request, err := grpcapi.ReadMessage(r.Body)
+		if err != nil {
+			grpcStatus(w, grpcapi.CodeInvalidArgument, err.Error())
+			return
+		}
+
+		switch strings.TrimPrefix(r.URL.Path, grpcapi.Service) {
+		case "Status":
+			grpcReply(w, statusMessage(CurrentState()))
+		case "Pause":
+			var pause grpcapi.PauseRequest
+			if err := pause.Unmarshal(request); err != nil {
+				grpcStatus(w, grpcapi.CodeInvalidArgument, err.Error())
+				return
+			}
+			if pause.Seconds < 0 {
+				grpcStatus(w, grpcapi.CodeInvalidArgument, "seconds can't be negative")
+				return
+			}
+			runOnMonitor(func() { pauseFor(time.Duration(pause.Seconds) * time.Second) })
+			grpcReply(w, statusMessage(CurrentState()))
+		case "Lock":
+			runOnMonitor(lockManually)
+			grpcReply(w, statusMessage(CurrentState()))
+		case "UpdateConfig":
+			var message grpcapi.ConfigUpdate
+			if err := message.Unmarshal(request); err != nil {
+				grpcStatus(w, grpcapi.CodeInvalidArgument, err.Error())
+				return
+			}
+			update := configUpdateFrom(&message)
+			runOnMonitor(func() { err = applyConfigUpdate(update) })
+			if err != nil {
+				grpcStatus(w, grpcapi.CodeInvalidArgument, err.Error())
+				return
+			}
+			slog.Info("Configuration updated through the gRPC API")
+			var config map[string]any
+			runOnMonitor(func() { config = currentConfig() })
+			grpcReply(w, configMessage(config))
+		case "Watch":
+			var watch grpcapi.WatchRequest
+			if err := watch.Unmarshal(request); err != nil {
+				grpcStatus(w, grpcapi.CodeInvalidArgument, err.Error())
+				return
+			}
+			grpcWatch(w, r, &watch)
+		default:
+			grpcStatus(w, grpcapi.CodeUnimplemented, "unknown method "+r.URL.Path)
+		}
+	})
+}
+
+// grpcWatch streams events until the client goes away.
+func grpcWatch(w http.ResponseWriter, r *http.Request, watch *grpcapi.WatchRequest) {
+	types := map[string]bool{}
+	for _, t := range watch.Types {
+		types[t] = true
+	}
+	events, recent, cancel := SubscribeEvents(64)
+	defer cancel()
+
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(e Event) error {
+		if len(types) > 0 && !types[e.Type] {
+			return nil
+		}
+		if err := grpcapi.WriteMessage(w, eventMessage(e)); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	if watch.Recent {
+		for _, e := range recent {
+			if send(e) != nil {
+				return
+			}
+		}
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				grpcStatus(w, grpcapi.CodeOK, "")
+				return
+			}
+			if send(e) != nil {
+				return
+			}
+		}
+	}
+}
+
+// grpcReply sends a unary call's response message.
+func grpcReply(w http.ResponseWriter, message []byte) {
+	w.WriteHeader(http.StatusOK)
+	grpcapi.WriteMessage(w, message)
+	grpcStatus(w, grpcapi.CodeOK, "")
+}
+
+// grpcStatus ends the call with a status, in the trailers.
+func grpcStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", message)
+	}
+}
+
+// statusMessage encodes the state as a Status message.
+func statusMessage(st DaemonState) []byte {
+	message := grpcapi.Status{
+		Mode:       st.Mode,
+		RSSI:       int32(st.RSSI),
+		Connected:  st.Connected,
+		InRange:    st.InRange,
+		ManualLock: st.ManualLock,
+		Health:     st.Health,
+	}
+	if !st.LastSeen.IsZero() {
+		message.LastSeenUnix = st.LastSeen.Unix()
+	}
+	if !st.PausedUntil.IsZero() {
+		message.PausedUntilUnix = st.PausedUntil.Unix()
+	}
+	return message.Marshal()
+}
+
+// eventMessage encodes an event as an Event message.
+func eventMessage(e Event) []byte {
+	message := grpcapi.Event{
+		TimeUnixNano: e.Time.UnixNano(),
+		Type:         e.Type,
+		Device:       e.Device,
+		From:         e.From,
+		To:           e.To,
+		Reason:       e.Reason,
+		Message:      e.Message,
+		User:         e.User,
+	}
+	if e.RSSI != nil {
+		rssi := int32(*e.RSSI)
+		message.RSSI = &rssi
+	}
+	return message.Marshal()
+}
+
+// configMessage encodes the settings as a Config message, as text.
+func configMessage(config map[string]any) []byte {
+	message := grpcapi.Config{Settings: map[string]string{}}
+	for name, value := range config {
+		message.Settings[name] = fmt.Sprint(value)
+	}
+	return message.Marshal()
+}
+
+// configUpdateFrom turns a ConfigUpdate message into the update PATCH /config
+// makes.
+func configUpdateFrom(message *grpcapi.ConfigUpdate) ConfigUpdate {
+	number := func(n *int32) *int {
+		if n == nil {
+			return nil
+		}
+		v := int(*n)
+		return &v
+	}
+	return ConfigUpdate{
+		BluetoothDeviceAddress: message.BluetoothDeviceAddress,
+		LockRSSI:               number(message.LockRSSI),
+		UnlockRSSI:             number(message.UnlockRSSI),
+		CheckInterval:          message.CheckInterval,
+		SessionTimeout:         message.SessionTimeout,
+		Debug:                  message.Debug,
+		Schedule:               message.Schedule,
+		OutsideSchedule:        message.OutsideSchedule,
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Backend health states, reported in the status and on /metrics.
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded" // Scans fail now and then or can't keep up with check_interval
+	HealthBlind    = "blind"    // Scans keep failing, so bluelock can't tell where the device is
+)
+
+// recordScan updates the backend health and the scan error count after a scan
+// round that took elapsed and failed with err, emitting a health event when
+// the state changes.
+func recordScan(elapsed time.Duration, err error) {
+	if err != nil {
+		ObserveScanError()
+	}
+	var from, to string
+	var failures int
+	updateState(func(s *DaemonState) {
+		if err != nil {
+			s.ScanFailures++
+		} else {
+			s.ScanFailures = 0
+		}
+		s.ScanSeconds = elapsed.Seconds()
+		from, failures = s.Health, s.ScanFailures
+		to = healthFor(failures, elapsed)
+		s.Health = to
+	})
+	if from == to {
+		return
+	}
+
+	var message string
+	switch {
+	case to == HealthBlind:
+		message = fmt.Sprintf("%d scans in a row failed: %v", failures, err)
+	case err != nil:
+		message = "scan failed: " + err.Error()
+	case to == HealthDegraded:
+		message = fmt.Sprintf("scan took %s, longer than check_interval", elapsed.Round(time.Millisecond))
+	}
+	if to == HealthOK {
+		slog.Info("Bluetooth scanning recovered", "was", from)
+	} else {
+		slog.Warn("Bluetooth scanning unhealthy", "health", to, "reason", message)
+	}
+	EmitEvent(Event{Type: EventHealth, From: from, To: to, Message: message})
+}
+
+// healthFor works out the health from the consecutive failures and the
+// latest scan's duration.
+func healthFor(failures int, elapsed time.Duration) string {
+	switch {
+	case failures >= BlindAfter:
+		return HealthBlind
+	case failures > 0 || elapsed > CheckInterval:
+		return HealthDegraded
+	default:
+		return HealthOK
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHelperSocket is where `bluelock helper` listens unless told otherwise.
+const DefaultHelperSocket = "/run/bluelock/hci.sock"
+
+// helperTimeout bounds a single request to the helper, scan included.
+const helperTimeout = 15 * time.Second
+
+// bluetoothAddress matches a Bluetooth device address, the only input the helper takes.
+var bluetoothAddress = regexp.MustCompile(`^([0-9A-Fa-f]{2}:){5}[0-9A-Fa-f]{2}$`)
+
+// helperRequest asks the helper for a device's RSSI.
+type helperRequest struct {
+	Address string `json:"address"`
+}
+
+// helperResponse is the helper's answer, one JSON line per request.
+type helperResponse struct {
+	RSSI  int    `json:"rssi"`
+	Found bool   `json:"found"`
+	Error string `json:"error,omitempty"`
+}
+
+// RunHelperCommand implements `bluelock helper`, the privileged half of a split
+// daemon. It runs as root and only reads RSSI values for the unprivileged daemon,
+// which connects with --bluetooth_helper. It takes no configuration beyond its
+// socket, so nothing running as root ever executes configurable commands.
+func RunHelperCommand(args []string) int {
+	fs := flag.NewFlagSet("helper", flag.ExitOnError)
+	socket := fs.String("socket", DefaultHelperSocket, "Unix socket to listen on")
+	group := fs.String("group", "bluetooth", "Group allowed to use the socket")
+	fs.Parse(args)
+
+	gid, err := user.LookupGroup(*group)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unknown group %q, create it or pick another with --group: %v\n", *group, err)
+		return 2
+	}
+	scanner, err := NewScanner()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	listener, err := listenHelper(*socket, gid.Gid)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to listen on the helper socket:", err)
+		return 1
+	}
+	slog.Info("Bluetooth helper listening", "socket", *socket, "group", *group)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			slog.Error("Helper socket stopped", "err", err)
+			return 1
+		}
+		go serveHelper(conn, scanner)
+	}
+}
+
+// listenHelper creates the helper socket, usable by root and the members of gid.
+func listenHelper(path, gid string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	// Remove a socket left behind by a previous run
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := strconv.Atoi(gid)
+	if err := os.Chown(path, -1, id); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// serveHelper answers the requests of a single client.
+func serveHelper(conn net.Conn, scanner Scanner) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	encoder := json.NewEncoder(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(time.Minute))
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var request helperRequest
+		var response helperResponse
+		if err := json.Unmarshal(line, &request); err != nil || !bluetoothAddress.MatchString(request.Address) {
+			response.Error = "invalid request"
+		} else if rssi, found, err := scanner.ReadRSSI(strings.ToUpper(request.Address)); err != nil {
+			response.Error = err.Error()
+		} else {
+			response.RSSI, response.Found = rssi, found
+		}
+		conn.SetWriteDeadline(time.Now().Add(helperTimeout))
+		if encoder.Encode(response) != nil {
+			return
+		}
+	}
+}
+
+// helperScanner reads RSSI values through `bluelock helper`, so the daemon
+// itself needs no privileges.
+type helperScanner struct {
+	socket string
+}
+
+// ReadRSSI asks the helper for the device's RSSI.
+func (h helperScanner) ReadRSSI(address string) (rssi int, found bool, err error) {
+	conn, err := net.DialTimeout("unix", h.socket, helperTimeout)
+	if err != nil {
+		return 0, false, fmt.Errorf("bluetooth helper: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(helperTimeout))
+	if err := json.NewEncoder(conn).Encode(helperRequest{Address: address}); err != nil {
+		return 0, false, fmt.Errorf("bluetooth helper: %w", err)
+	}
+	var response helperResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return 0, false, fmt.Errorf("bluetooth helper: %w", err)
+	}
+	if response.Error != "" {
+		return 0, false, errors.New("bluetooth helper: " + response.Error)
+	}
+	return response.RSSI, response.Found, nil
+}
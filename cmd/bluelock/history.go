@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// historySchema creates the table holding every recorded event.
+const historySchema = `PRAGMA journal_mode=WAL;
+CREATE TABLE IF NOT EXISTS events (
+	id INTEGER PRIMARY KEY,
+	ts INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	device TEXT,
+	rssi INTEGER,
+	from_state TEXT,
+	to_state TEXT,
+	reason TEXT,
+	message TEXT
+);
+CREATE INDEX IF NOT EXISTS events_ts ON events(ts);
+`
+
+// DefaultHistoryDB returns the default location of the history database.
+func DefaultHistoryDB() string {
+	return stateFile("history.db")
+}
+
+// StartHistory records every event to the SQLite database at path through a
+// long-running `sqlite3` process, deleting rows older than retention.
+func StartHistory(path string, retention time.Duration) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	cmd := exec.Command("sqlite3", "-batch", path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting sqlite3: %w", err)
+	}
+	if _, err := io.WriteString(stdin, historySchema); err != nil {
+		return err
+	}
+
+	events, _, _ := SubscribeEvents(1024)
+	go func() {
+		prune := time.NewTicker(time.Hour)
+		defer prune.Stop()
+		pruneHistory(stdin, retention)
+		for {
+			select {
+			case e := <-events:
+				if _, err := io.WriteString(stdin, insertEventSQL(e)); err != nil {
+					slog.Error("History recording stopped", "err", err)
+					return
+				}
+			case <-prune.C:
+				pruneHistory(stdin, retention)
+			}
+		}
+	}()
+	return nil
+}
+
+// pruneHistory deletes events older than retention. A zero retention keeps everything.
+func pruneHistory(w io.Writer, retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-retention).UnixMilli()
+	fmt.Fprintf(w, "DELETE FROM events WHERE ts < %d;\n", cutoff)
+}
+
+// insertEventSQL returns the statement recording e.
+func insertEventSQL(e Event) string {
+	rssi := "NULL"
+	if e.RSSI != nil {
+		rssi = strconv.Itoa(*e.RSSI)
+	}
+	return fmt.Sprintf("INSERT INTO events (ts, type, device, rssi, from_state, to_state, reason, message) VALUES (%d, %s, %s, %s, %s, %s, %s, %s);\n",
+		e.Time.UnixMilli(), sqlQuote(e.Type), sqlQuote(e.Device), rssi,
+		sqlQuote(e.From), sqlQuote(e.To), sqlQuote(e.Reason), sqlQuote(e.Message))
+}
+
+// sqlQuote quotes s as an SQL string literal.
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// HistoryQuery selects events from the history database.
+type HistoryQuery struct {
+	From  time.Time
+	To    time.Time
+	Types []string
+	Limit int // Keep only the most recent Limit events, 0 for all
+}
+
+// QueryHistory returns the matching events from the database at path, oldest first.
+func QueryHistory(path string, q HistoryQuery) ([]Event, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	where := []string{"1=1"}
+	if !q.From.IsZero() {
+		where = append(where, fmt.Sprintf("ts >= %d", q.From.UnixMilli()))
+	}
+	if !q.To.IsZero() {
+		where = append(where, fmt.Sprintf("ts <= %d", q.To.UnixMilli()))
+	}
+	if len(q.Types) > 0 {
+		quoted := make([]string, len(q.Types))
+		for i, t := range q.Types {
+			quoted[i] = sqlQuote(t)
+		}
+		where = append(where, "type IN ("+strings.Join(quoted, ", ")+")")
+	}
+	query := "SELECT id, ts, type, device, rssi, from_state, to_state, reason, message FROM events WHERE " +
+		strings.Join(where, " AND ") + " ORDER BY ts DESC, id DESC"
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+	query = "SELECT * FROM (" + query + ") ORDER BY ts, id"
+
+	cmd := exec.Command("sqlite3", "-json", "-readonly", path, query)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3: %s", strings.TrimSpace(stderr.String()+" "+err.Error()))
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+
+	var rows []struct {
+		TS      int64  `json:"ts"`
+		Type    string `json:"type"`
+		Device  string `json:"device"`
+		RSSI    *int   `json:"rssi"`
+		From    string `json:"from_state"`
+		To      string `json:"to_state"`
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(out, &rows); err != nil {
+		return nil, fmt.Errorf("parsing sqlite3 output: %w", err)
+	}
+	events := make([]Event, len(rows))
+	for i, row := range rows {
+		events[i] = Event{
+			Time:    time.UnixMilli(row.TS),
+			Type:    row.Type,
+			Device:  row.Device,
+			RSSI:    row.RSSI,
+			From:    row.From,
+			To:      row.To,
+			Reason:  row.Reason,
+			Message: row.Message,
+		}
+	}
+	return events, nil
+}
+
+// ParseTimeArg parses a command-line time: RFC 3339, "2006-01-02", "2006-01-02 15:04",
+// "15:04" (today), or a duration such as "2h" meaning that long ago.
+func ParseTimeArg(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			now := time.Now()
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// RunHistoryCommand implements `bluelock history`, printing recorded events.
+func RunHistoryCommand(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	db := fs.String("db", DefaultHistoryDB(), "History database")
+	from := fs.String("from", "24h", "Start time (e.g. 14:00, 2024-06-01, 2h)")
+	to := fs.String("to", "", "End time, defaults to now")
+	types := fs.String("type", "", "Comma-separated event types to show (e.g. lock,unlock)")
+	limit := fs.Int("limit", 200, "Show at most this many of the most recent events, 0 for all")
+	asJSON := fs.Bool("json", false, "Print events as JSON lines")
+	fs.Parse(args)
+
+	q := HistoryQuery{Limit: *limit}
+	var err error
+	if q.From, err = ParseTimeArg(*from); err != nil {
+		fmt.Fprintln(os.Stderr, "--from:", err)
+		return 2
+	}
+	if *to != "" {
+		if q.To, err = ParseTimeArg(*to); err != nil {
+			fmt.Fprintln(os.Stderr, "--to:", err)
+			return 2
+		}
+	}
+	if *types != "" {
+		q.Types = strings.Split(*types, ",")
+	}
+
+	events, err := QueryHistory(*db, q)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read history:", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, e := range events {
+			encoder.Encode(e)
+		}
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tTYPE\tRSSI\tDETAILS")
+	for _, e := range events {
+		rssi := "-"
+		if e.RSSI != nil {
+			rssi = strconv.Itoa(*e.RSSI)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Time.Format("2006-01-02 15:04:05"), e.Type, rssi, eventDetails(e))
+	}
+	w.Flush()
+	return 0
+}
+
+// eventDetails summarizes the type-specific fields of an event.
+func eventDetails(e Event) string {
+	var parts []string
+	if e.From != "" || e.To != "" {
+		parts = append(parts, e.From+" -> "+e.To)
+	}
+	if e.Reason != "" {
+		parts = append(parts, "reason="+e.Reason)
+	}
+	if e.Message != "" {
+		parts = append(parts, e.Message)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+)
+
+// haDevice groups the entities under one device in Home Assistant.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// publishDiscovery announces a presence binary sensor, an RSSI sensor and a lock
+// entity through Home Assistant MQTT discovery. The configs are retained, so
+// Home Assistant picks them up whenever it starts.
+func publishDiscovery(prefix string) {
+	node := haNodeID()
+	device := haDevice{
+		Identifiers:  []string{"bluelock_" + node},
+		Name:         "bluelock " + hostname(),
+		Manufacturer: "bluelock",
+		Model:        CurrentState().Device,
+	}
+	common := func(name, object string) map[string]any {
+		return map[string]any{
+			"name":                  name,
+			"unique_id":             "bluelock_" + node + "_" + object,
+			"object_id":             "bluelock_" + node + "_" + object,
+			"availability_topic":    prefix + "/availability",
+			"payload_available":     "online",
+			"payload_not_available": "offline",
+			"device":                device,
+		}
+	}
+
+	presence := common("Presence", "presence")
+	presence["state_topic"] = prefix + "/presence"
+	presence["payload_on"] = "present"
+	presence["payload_off"] = "away"
+	presence["device_class"] = "presence"
+
+	rssi := common("RSSI", "rssi")
+	rssi["state_topic"] = prefix + "/rssi"
+	rssi["unit_of_measurement"] = "dBm"
+	rssi["device_class"] = "signal_strength"
+	rssi["state_class"] = "measurement"
+	rssi["entity_category"] = "diagnostic"
+
+	lock := common("Screen lock", "lock")
+	lock["state_topic"] = prefix + "/lock"
+	lock["state_locked"] = "locked"
+	lock["state_unlocked"] = "unlocked"
+	lock["command_topic"] = prefix + "/lock/set"
+	lock["payload_lock"] = "LOCK"
+	lock["payload_unlock"] = "UNLOCK"
+	if ConfirmUnlock && UnlockPIN != "" {
+		// Home Assistant asks for the PIN and sends it along, "UNLOCK 4711"
+		lock["code_format"] = ".+"
+		lock["command_template"] = "{{ value }} {{ code }}"
+	}
+
+	entities := []struct {
+		component, object string
+		config            map[string]any
+	}{
+		{"binary_sensor", "presence", presence},
+		{"sensor", "rssi", rssi},
+		{"lock", "lock", lock},
+	}
+	for _, entity := range entities {
+		body, err := json.Marshal(entity.config)
+		if err != nil {
+			slog.Error("Failed to encode Home Assistant discovery config", "err", err)
+			continue
+		}
+		publishMQTT(HADiscoveryPrefix+"/"+entity.component+"/bluelock_"+node+"/"+entity.object+"/config", string(body), true)
+	}
+}
+
+// handleLockCommand runs a LOCK or UNLOCK sent from Home Assistant.
+// With confirm_unlock an UNLOCK only confirms an armed unlock, and needs
+// unlock_pin after the command, since anyone on the broker can send one.
+func handleLockCommand(topic string, payload []byte) {
+	command, pin, _ := strings.Cut(strings.TrimSpace(string(payload)), " ")
+	command = strings.ToUpper(command)
+	slog.Info("Lock command received over MQTT", "command", command)
+	switch command {
+	case "LOCK":
+		go runOnMonitor(lockManually)
+	case "UNLOCK":
+		if !ConfirmUnlock {
+			go runOnMonitor(unlockManually)
+			return
+		}
+		if UnlockPIN == "" {
+			slog.Warn("Ignoring the MQTT unlock, with confirm_unlock and no unlock_pin only the notification confirms")
+			return
+		}
+		go runOnMonitor(func() {
+			if err := confirmUnlock(strings.TrimSpace(pin)); err != nil {
+				slog.Warn("MQTT unlock not confirmed", "err", err)
+			}
+		})
+	default:
+		slog.Warn("Unknown MQTT lock command", "topic", topic, "command", command)
+	}
+}
+
+// haNodeID turns the host name into an id Home Assistant accepts in topics and
+// unique ids.
+func haNodeID() string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '_'
+		}
+	}, hostname())
+}
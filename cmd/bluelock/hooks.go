@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// hookVetoExitCode is the exit status a pre-lock hook uses to veto the lock.
+const hookVetoExitCode = 100
+
+// runHooks runs the hook commands for one phase ("pre" or "post") of a lock or
+// unlock, or for an arrival or departure, one after another, and reports
+// whether any of them exited with hookVetoExitCode. Each gets hook_timeout and
+// environment variables describing what triggered it:
+//
+//	BLUELOCK_ACTION   lock, unlock, arrive or depart
+//	BLUELOCK_PHASE    pre or post, empty for arrive and depart
+//	BLUELOCK_REASON   in_range, out_of_range, session_timeout or manual
+//	BLUELOCK_TRIGGER  rssi, timeout or manual
+//	BLUELOCK_DEVICE   Bluetooth device address
+//	BLUELOCK_RSSI     latest RSSI, empty if the device didn't answer
+func runHooks(hooks []string, phase, action, reason string) (vetoed bool) {
+	if len(hooks) == 0 {
+		return false
+	}
+	if DryRun {
+		slog.Info("Dry run: would run hooks", "phase", phase, "action", action, "hooks", hooks)
+		return false
+	}
+	rssi := ""
+	if r := lastRSSI(); r != nil {
+		rssi = strconv.Itoa(*r)
+	}
+	env := []string{
+		"BLUELOCK_ACTION=" + action,
+		"BLUELOCK_PHASE=" + phase,
+		"BLUELOCK_REASON=" + reason,
+		"BLUELOCK_TRIGGER=" + auditTrigger(reason),
+		"BLUELOCK_DEVICE=" + CurrentState().Device,
+		"BLUELOCK_RSSI=" + rssi,
+	}
+	for _, hook := range hooks {
+		argv, err := SplitCommand(hook)
+		if err != nil {
+			slog.Error("Invalid hook", "phase", phase, "action", action, "err", err)
+			continue
+		}
+		out, err := RunCommand(argv, HookTimeout, env)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == hookVetoExitCode {
+			slog.Debug("Hook vetoed", "phase", phase, "action", action, "hook", hook)
+			vetoed = true
+			continue
+		}
+		if err != nil {
+			slog.Warn("Hook failed", "phase", phase, "action", action, "hook", hook, "err", err, "output", strings.TrimSpace(string(out)))
+			continue
+		}
+		slog.Debug("Hook ran", "phase", phase, "action", action, "hook", hook)
+	}
+	return vetoed
+}
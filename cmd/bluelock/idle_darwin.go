@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hidIdleTime is the HIDIdleTime property ioreg prints, in nanoseconds.
+var hidIdleTime = regexp.MustCompile(`"HIDIdleTime" = (\d+)`)
+
+// IdleTime returns how long the keyboard and mouse have gone unused, from
+// the HID system's idle time.
+func IdleTime() (time.Duration, error) {
+	out, err := RunCommand([]string{"ioreg", "-c", "IOHIDSystem", "-d", "4"}, lockCommandTimeout, nil)
+	if err != nil {
+		return 0, errors.New("ioreg: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	m := hidIdleTime.FindSubmatch(out)
+	if m == nil {
+		return 0, errors.New("ioreg: no HIDIdleTime")
+	}
+	ns, err := strconv.ParseInt(string(m[1]), 10, 64)
+	return time.Duration(ns), err
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IdleTime returns how long the keyboard and mouse have gone unused, from
+// GNOME's idle monitor, xprintidle on X11, or logind's IdleHint, which only
+// tells once the desktop has itself decided the session is idle.
+func IdleTime() (time.Duration, error) {
+	reply, err := DBusCall("session", "org.gnome.Mutter.IdleMonitor", "/org/gnome/Mutter/IdleMonitor/Core", "org.gnome.Mutter.IdleMonitor.GetIdletime")
+	if err == nil {
+		ms, err := ParseDBusUint(reply)
+		return time.Duration(ms) * time.Millisecond, err
+	}
+	if os.Getenv("DISPLAY") != "" {
+		if out, err := exec.Command("xprintidle").Output(); err == nil {
+			ms, err := strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64)
+			return time.Duration(ms) * time.Millisecond, err
+		}
+	}
+
+	out, err := exec.Command("loginctl", "show-session", loginctlSession(), "-p", "IdleHint", "-p", "IdleSinceHint").Output()
+	if err != nil {
+		return 0, errors.New("no idle time from GNOME, xprintidle or logind")
+	}
+	props := map[string]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if name, value, ok := strings.Cut(line, "="); ok {
+			props[name] = strings.TrimSpace(value)
+		}
+	}
+	since, err := strconv.ParseInt(props["IdleSinceHint"], 10, 64)
+	if props["IdleHint"] != "yes" || err != nil || since == 0 {
+		return 0, errors.New("logind only knows when the session is idle, install xprintidle for the idle time")
+	}
+	return time.Since(time.UnixMicro(since)), nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// user32's GetLastInputInfo and kernel32's GetTickCount, both in milliseconds
+// since boot.
+var (
+	getLastInputInfo = syscall.NewLazyDLL("user32.dll").NewProc("GetLastInputInfo")
+	getTickCount     = syscall.NewLazyDLL("kernel32.dll").NewProc("GetTickCount")
+)
+
+// lastInputInfo is LASTINPUTINFO.
+type lastInputInfo struct {
+	size uint32
+	time uint32
+}
+
+// IdleTime returns how long the keyboard and mouse have gone unused in this
+// session.
+func IdleTime() (time.Duration, error) {
+	info := lastInputInfo{size: uint32(unsafe.Sizeof(lastInputInfo{}))}
+	if ok, _, err := getLastInputInfo.Call(uintptr(unsafe.Pointer(&info))); ok == 0 {
+		return 0, fmt.Errorf("GetLastInputInfo: %v", err)
+	}
+	now, _, _ := getTickCount.Call()
+	return time.Duration(uint32(now)-info.time) * time.Millisecond, nil
+}
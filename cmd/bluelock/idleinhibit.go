@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log/slog"
+	"os/exec"
+)
+
+// idleInhibitReason is what the inhibitor tells the desktop.
+const idleInhibitReason = "Your Bluetooth device is at the desk"
+
+// idleInhibitor is the process holding the idle inhibit, nil when none is held.
+var idleInhibitor *exec.Cmd
+
+// updateIdleInhibit holds an idle inhibit while the session is unlocked and
+// the device is clearly present, its RSSI at least inhibit_idle_margin above
+// unlock_rssi, so the desktop's own idle timeout doesn't blank or lock the
+// screen under a user who is reading rather than typing. It runs after each
+// check.
+func updateIdleInhibit() {
+	st := CurrentState()
+	want := InhibitIdle && st.Mode == "unlocked" && st.Connected && st.RSSI >= UnlockRSSI+InhibitIdleMargin
+	switch {
+	case want && idleInhibitor == nil:
+		cmd, err := IdleInhibitCommand()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			slog.Warn("Failed to inhibit the idle timeout", "err", err)
+			return
+		}
+		slog.Info("Device at the desk, inhibiting the idle timeout", "rssi", st.RSSI)
+		idleInhibitor = cmd
+		go cmd.Wait()
+	case !want && idleInhibitor != nil:
+		releaseIdleInhibit()
+		slog.Info("Idle timeout no longer inhibited")
+	}
+}
+
+// releaseIdleInhibit drops the idle inhibit, if one is held.
+func releaseIdleInhibit() {
+	if idleInhibitor != nil {
+		stopIdleInhibitor(idleInhibitor)
+		idleInhibitor = nil
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// IdleInhibitCommand returns a process that keeps the display from sleeping,
+// and with it the screen from locking, until it's killed or bluelock exits.
+func IdleInhibitCommand() (*exec.Cmd, error) {
+	return exec.Command("caffeinate", "-d", "-i", "-w", strconv.Itoa(os.Getpid())), nil
+}
+
+// stopIdleInhibitor ends the inhibitor.
+func stopIdleInhibitor(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
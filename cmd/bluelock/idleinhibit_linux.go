@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// IdleInhibitCommand returns a process that inhibits the idle timeout until
+// it's killed or bluelock exits: gnome-session-inhibit on GNOME, otherwise a
+// logind idle inhibitor, which KDE and most idle daemons respect.
+func IdleInhibitCommand() (*exec.Cmd, error) {
+	// Waits for bluelock to go away, so the inhibit doesn't outlive it
+	wait := []string{"tail", "--pid=" + strconv.Itoa(os.Getpid()), "-f", "/dev/null"}
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("gnome-session-inhibit"); err == nil && DesktopEnv == "GNOME" {
+		cmd = exec.Command("gnome-session-inhibit", append([]string{"--inhibit", "idle", "--reason", idleInhibitReason}, wait...)...)
+	} else {
+		cmd = exec.Command("systemd-inhibit", append([]string{"--what=idle", "--who=bluelock", "--why=" + idleInhibitReason, "--mode=block"}, wait...)...)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd, nil
+}
+
+// stopIdleInhibitor ends the inhibitor along with the command it waits on.
+func stopIdleInhibitor(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// IdleInhibitCommand isn't available on Windows, where execution state
+// requests keep the display on but don't stop the screen saver from locking.
+func IdleInhibitCommand() (*exec.Cmd, error) {
+	return nil, errors.New("the idle timeout can't be inhibited on Windows")
+}
+
+// stopIdleInhibitor ends the inhibitor.
+func stopIdleInhibitor(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
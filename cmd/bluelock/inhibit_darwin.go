@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// pmsetAssertion is a process holding a display sleep assertion in `pmset -g
+// assertions`, e.g. `pid 412(zoom.us): [0x...] 00:10:00 PreventUserIdleDisplaySleep named: "Meeting"`.
+var pmsetAssertion = regexp.MustCompile(`pid \d+\(([^)]*)\):.*PreventUserIdleDisplaySleep named: "([^"]*)"`)
+
+// Inhibitors lists the applications keeping the display from sleeping, e.g.
+// a video player or a call.
+func Inhibitors() ([]string, error) {
+	out, err := RunCommand([]string{"pmset", "-g", "assertions"}, lockCommandTimeout, nil)
+	if err != nil {
+		return nil, errors.New("pmset: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	var inhibitors []string
+	for _, match := range pmsetAssertion.FindAllStringSubmatch(string(out), -1) {
+		inhibitors = append(inhibitors, inhibitorName(match[1], match[2]))
+	}
+	return inhibitors, nil
+}
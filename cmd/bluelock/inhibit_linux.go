@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// gnomeInhibitIdle is GNOME's inhibit flag for keeping the session from going idle.
+const gnomeInhibitIdle = 8
+
+// logindInhibitor is one (what, who, why, mode, uid, pid) in a ListInhibitors reply.
+var logindInhibitor = regexp.MustCompile(`\('([^']*)', '([^']*)', '([^']*)', '([^']*)'`)
+
+// Inhibitors lists the applications keeping the screen from blanking or
+// locking, e.g. a video player or a presentation: GNOME's session inhibitors,
+// KDE's, and logind's idle inhibitors.
+func Inhibitors() ([]string, error) {
+	var inhibitors []string
+	var failed []error
+
+	// GNOME
+	reply, err := DBusCall("session", "org.gnome.SessionManager", "/org/gnome/SessionManager", "org.gnome.SessionManager.GetInhibitors")
+	if err == nil {
+		for _, match := range dbusPath.FindAllStringSubmatch(reply, -1) {
+			flags, err := DBusCall("session", "org.gnome.SessionManager", match[1], "org.gnome.SessionManager.Inhibitor.GetFlags")
+			if n, perr := ParseDBusUint(flags); err != nil || perr != nil || n&gnomeInhibitIdle == 0 {
+				continue
+			}
+			app, _ := DBusCall("session", "org.gnome.SessionManager", match[1], "org.gnome.SessionManager.Inhibitor.GetAppId")
+			reason, _ := DBusCall("session", "org.gnome.SessionManager", match[1], "org.gnome.SessionManager.Inhibitor.GetReason")
+			inhibitors = append(inhibitors, inhibitorName(gvariantValue(app), gvariantValue(reason)))
+		}
+	}
+
+	// KDE
+	reply, err = DBusCall("session", "org.freedesktop.PowerManagement.Inhibit", "/org/freedesktop/PowerManagement/Inhibit", "org.freedesktop.PowerManagement.Inhibit.HasInhibit")
+	if err == nil {
+		if inhibited, _ := ParseDBusBool(reply); inhibited {
+			inhibitors = append(inhibitors, "an application")
+		}
+	}
+
+	// logind, e.g. systemd-inhibit --what=idle
+	reply, err = DBusCall("system", "org.freedesktop.login1", "/org/freedesktop/login1", "org.freedesktop.login1.Manager.ListInhibitors")
+	if err != nil {
+		failed = append(failed, err)
+	}
+	for _, match := range logindInhibitor.FindAllStringSubmatch(reply, -1) {
+		what, who, why, mode := match[1], match[2], match[3], match[4]
+		if mode == "block" && strings.Contains(":"+what+":", ":idle:") {
+			inhibitors = append(inhibitors, inhibitorName(who, why))
+		}
+	}
+	if len(inhibitors) == 0 && len(failed) > 0 {
+		return nil, errors.Join(failed...)
+	}
+	return inhibitors, nil
+}
@@ -0,0 +1,9 @@
+package main
+
+import "errors"
+
+// Inhibitors isn't available on Windows, where listing the display requests
+// (powercfg /requests) needs an administrator.
+func Inhibitors() ([]string, error) {
+	return nil, errors.New("screensaver inhibitors can't be listed on Windows")
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The systemd units bluelock installs.
+const (
+	unitName   = "bluelock.service"
+	socketName = "bluelock.socket"
+)
+
+// installStartTimeout is how long a freshly installed unit gets to come up.
+const installStartTimeout = 5 * time.Second
+
+// RunInstallCommand implements `bluelock install [--system] [-- daemon flags]`,
+// writing a systemd unit that runs the daemon with the given flags, enabling and
+// starting it, and checking that it stays up.
+func RunInstallCommand(args []string) int {
+	fs := flag.NewFlagSet("install", flag.ExitOnError)
+	system := fs.Bool("system", false, "Install a system unit instead of a user unit")
+	socket := fs.Bool("socket", false, "Also install a socket unit so systemd holds the event socket and starts bluelock when it's used")
+	fs.Parse(args)
+	if *socket && *system {
+		fmt.Fprintln(os.Stderr, "--socket is only for user units")
+		return 2
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to find the bluelock binary:", err)
+		return 1
+	}
+	path, err := unitPath(*system)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to create the unit directory:", err)
+		return 1
+	}
+	if err := os.WriteFile(path, []byte(systemdUnit(executable, fs.Args(), *system, *socket)), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write the unit:", err)
+		return 1
+	}
+	fmt.Println("Wrote", path)
+	units := []string{unitName}
+	if *socket {
+		socketPath := filepath.Join(filepath.Dir(path), socketName)
+		if err := os.WriteFile(socketPath, []byte(socketUnit), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to write the socket unit:", err)
+			return 1
+		}
+		fmt.Println("Wrote", socketPath)
+		units = []string{socketName, unitName}
+	}
+
+	commands := [][]string{{"daemon-reload"}, append([]string{"enable"}, units...), append([]string{"restart"}, units...)}
+	for _, command := range commands {
+		if err := systemctl(*system, command...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	// A daemon that exits on bad flags is active for a moment, so give it time
+	time.Sleep(installStartTimeout)
+	if err := systemctl(*system, "is-active", "--quiet", unitName); err != nil {
+		fmt.Fprintf(os.Stderr, "%s didn't stay up, see `journalctl %s-u bluelock`\n", unitName, journalctlScope(*system))
+		return 1
+	}
+	fmt.Printf("%s is enabled and running.\n", unitName)
+	return 0
+}
+
+// RunUninstallCommand implements `bluelock uninstall [--system]`, stopping and
+// removing the unit `bluelock install` wrote.
+func RunUninstallCommand(args []string) int {
+	fs := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	system := fs.Bool("system", false, "Remove the system unit instead of the user unit")
+	fs.Parse(args)
+
+	path, err := unitPath(*system)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(os.Stderr, "bluelock isn't installed:", path, "doesn't exist")
+		return 1
+	}
+	socketPath := filepath.Join(filepath.Dir(path), socketName)
+	units := []string{unitName}
+	if _, err := os.Stat(socketPath); err == nil {
+		units = append(units, socketName)
+	}
+	if err := systemctl(*system, append([]string{"disable", "--now"}, units...)...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if err := os.Remove(path); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to remove the unit:", err)
+		return 1
+	}
+	os.Remove(socketPath)
+	if err := systemctl(*system, "daemon-reload"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("Removed", path)
+	return 0
+}
+
+// unitPath returns where the unit file goes.
+func unitPath(system bool) (string, error) {
+	if system {
+		return filepath.Join("/etc/systemd/system", unitName), nil
+	}
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(config, "systemd", "user", unitName), nil
+}
+
+// socketUnit holds the event socket while the graphical session is up, handing
+// it to bluelock as "events" and starting bluelock when a client connects.
+const socketUnit = `[Unit]
+Description=bluelock event socket
+PartOf=graphical-session.target
+
+[Socket]
+ListenStream=%t/bluelock/events.sock
+SocketMode=0600
+DirectoryMode=0700
+FileDescriptorName=events
+
+[Install]
+WantedBy=graphical-session.target
+`
+
+// systemdUnit renders the unit file. A user unit belongs to the graphical
+// session, it can't see bluetooth.target, which only exists in the system
+// manager; a system unit waits for the Bluetooth stack instead.
+func systemdUnit(executable string, args []string, system, socket bool) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\nDescription=Lock the screen when your phone leaves\nDocumentation=https://github.com/samhardeman/bluetooth-unlock\n")
+	if system {
+		b.WriteString("Wants=bluetooth.target\nAfter=bluetooth.target\n")
+	} else {
+		b.WriteString("PartOf=graphical-session.target\nAfter=graphical-session.target\n")
+	}
+	if socket {
+		b.WriteString("Requires=" + socketName + "\nAfter=" + socketName + "\n")
+	}
+
+	b.WriteString("\n[Service]\nExecStart=" + systemdQuote(executable))
+	for _, arg := range args {
+		b.WriteString(" " + systemdQuote(arg))
+	}
+	// The watchdog restarts bluelock if a scan hangs
+	b.WriteString("\nType=notify\nWatchdogSec=60\nRestart=on-failure\nRestartSec=5\n")
+
+	b.WriteString("\n[Install]\n")
+	if system {
+		b.WriteString("WantedBy=multi-user.target\n")
+	} else {
+		b.WriteString("WantedBy=graphical-session.target\n")
+	}
+	return b.String()
+}
+
+// systemdQuote quotes an ExecStart argument, escaping the characters systemd
+// would otherwise expand.
+func systemdQuote(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// systemctl runs systemctl against the user or system manager.
+func systemctl(system bool, args ...string) error {
+	if !system {
+		args = append([]string{"--user"}, args...)
+	}
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// journalctlScope is the journalctl flag that selects the user journal.
+func journalctlScope(system bool) string {
+	if system {
+		return ""
+	}
+	return "--user "
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// journalSocket is where systemd-journald accepts native protocol messages.
+const journalSocket = "/run/systemd/journal/socket"
+
+// logSink delivers a formatted record to a system logger.
+type logSink interface {
+	write(level slog.Level, message string, attrs []slog.Attr) error
+}
+
+// sinkHandler is a slog.Handler writing to a logSink with a syslog priority per level.
+type sinkHandler struct {
+	sink   logSink
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string // Group prefix for attribute keys, e.g. "api."
+}
+
+func (h *sinkHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *sinkHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := append([]slog.Attr(nil), h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, h.qualify(a)...)
+		return true
+	})
+	return h.sink.write(r.Level, r.Message, attrs)
+}
+
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		clone.attrs = append(clone.attrs, h.qualify(a)...)
+	}
+	return &clone
+}
+
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// qualify flattens groups and applies the handler's group prefix to attribute keys.
+func (h *sinkHandler) qualify(a slog.Attr) []slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		return []slog.Attr{{Key: h.prefix + a.Key, Value: a.Value}}
+	}
+	nested := &sinkHandler{prefix: h.prefix + a.Key + "."}
+	var out []slog.Attr
+	for _, ga := range a.Value.Group() {
+		out = append(out, nested.qualify(ga)...)
+	}
+	return out
+}
+
+// syslogPriority maps a slog level to a syslog priority.
+func syslogPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// formatLogLine renders a message followed by key=value attributes.
+func formatLogLine(message string, attrs []slog.Attr) string {
+	var b strings.Builder
+	b.WriteString(message)
+	for _, a := range attrs {
+		value := a.Value.String()
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", a.Key, value)
+	}
+	return b.String()
+}
+
+// journalSink writes records to journald over its native protocol, so each
+// attribute becomes a searchable field (e.g. BLUELOCK_RSSI=-12).
+type journalSink struct {
+	conn *net.UnixConn
+}
+
+func newJournalSink() (*journalSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalSink{conn: conn}, nil
+}
+
+func (j *journalSink) write(level slog.Level, message string, attrs []slog.Attr) error {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", formatLogLine(message, attrs))
+	writeJournalField(&buf, "PRIORITY", strconv.Itoa(syslogPriority(level)))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", "bluelock")
+	for _, a := range attrs {
+		writeJournalField(&buf, "BLUELOCK_"+journalFieldName(a.Key), a.Value.String())
+	}
+	_, err := j.conn.Write(buf.Bytes())
+	return err
+}
+
+// writeJournalField appends one field, using the length-prefixed form for multi-line values.
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(buf, "%s=%s\n", name, value)
+		return
+	}
+	buf.WriteString(name + "\n")
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
+
+// journalFieldName converts an attribute key to a valid journal field name.
+func journalFieldName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// pingTimeout is how long the lan provider waits for each host to answer.
+const pingTimeout = "1"
+
+// Addresses in ARP tables, as Linux, macOS ("0:1a:2b:...") and Windows
+// ("00-1a-2b-...") print them.
+var (
+	neighbourIP  = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`)
+	neighbourMAC = regexp.MustCompile(`\b[0-9A-Fa-f]{1,2}(?:[:-][0-9A-Fa-f]{1,2}){5}\b`)
+)
+
+// lanPresence is the phone being on the local network, for the hosts in
+// presence_host: an address or hostname counts while it answers a ping or ARP,
+// a MAC address while it's in the ARP table. Wi-Fi reaches further than
+// Bluetooth, so it's most useful next to another provider.
+type lanPresence struct {
+	hosts []string
+}
+
+func (lanPresence) Name() string { return "lan" }
+
+func (l lanPresence) Present() (bool, error) {
+	var failed []error
+	var table map[string]string
+	for _, host := range l.hosts {
+		if !bluetoothAddress.MatchString(strings.ReplaceAll(host, "-", ":")) {
+			if err := PingHost(host); err == nil {
+				return true, nil
+			}
+		}
+		// Phones often ignore pings while asleep but still answer ARP
+		if table == nil {
+			var err error
+			if table, err = neighbours(); err != nil {
+				failed = append(failed, err)
+				table = map[string]string{}
+			}
+		}
+		if lanNeighbour(host, table) {
+			return true, nil
+		}
+	}
+	if len(failed) > 0 {
+		return false, errors.Join(failed...)
+	}
+	return false, nil
+}
+
+// lanNeighbour reports whether host, a MAC address, IP address or hostname,
+// is in the ARP table.
+func lanNeighbour(host string, table map[string]string) bool {
+	if mac := strings.ReplaceAll(strings.ToUpper(host), "-", ":"); bluetoothAddress.MatchString(mac) {
+		for _, known := range table {
+			if known == mac {
+				return true
+			}
+		}
+		return false
+	}
+	ips := []string{host}
+	if net.ParseIP(host) == nil {
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			slog.Debug("Failed to look up presence_host", "host", host, "err", err)
+		}
+		ips = addrs
+	}
+	for _, ip := range ips {
+		if _, ok := table[ip]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// neighbours reads the ARP table as a map from IP to MAC address, skipping
+// entries without an answer.
+func neighbours() (map[string]string, error) {
+	text, err := ARPTable()
+	if err != nil {
+		return nil, err
+	}
+	table := map[string]string{}
+	for _, line := range strings.Split(text, "\n") {
+		ip, mac := neighbourIP.FindString(line), neighbourMAC.FindString(line)
+		if ip == "" || mac == "" {
+			continue
+		}
+		parts := strings.FieldsFunc(mac, func(r rune) bool { return r == ':' || r == '-' })
+		for i, part := range parts {
+			if len(part) == 1 {
+				part = "0" + part
+			}
+			parts[i] = strings.ToUpper(part)
+		}
+		mac = strings.Join(parts, ":")
+		if mac == "00:00:00:00:00:00" || mac == "FF:FF:FF:FF:FF:FF" {
+			continue
+		}
+		table[ip] = mac
+	}
+	return table, nil
+}
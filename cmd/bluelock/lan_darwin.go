@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// PingHost sends host one ping and returns an error when it doesn't answer.
+func PingHost(host string) error {
+	_, err := RunCommand([]string{"ping", "-c", "1", "-t", pingTimeout, host}, lockCommandTimeout, nil)
+	return err
+}
+
+// ARPTable returns the ARP table from arp, where entries without an answer
+// are "(incomplete)".
+func ARPTable() (string, error) {
+	out, err := RunCommand([]string{"arp", "-an"}, lockCommandTimeout, nil)
+	if err != nil {
+		return "", errors.New("arp: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// PingHost sends host one ping and returns an error when it doesn't answer.
+func PingHost(host string) error {
+	_, err := RunCommand([]string{"ping", "-c", "1", "-W", pingTimeout, host}, lockCommandTimeout, nil)
+	return err
+}
+
+// ARPTable returns the kernel's ARP table, where entries without an answer
+// have an all-zero address.
+func ARPTable() (string, error) {
+	data, err := os.ReadFile("/proc/net/arp")
+	if err != nil {
+		return "", fmt.Errorf("failed to read the ARP table: %v", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// PingHost sends host one ping and returns an error when it doesn't answer.
+// Windows' ping exits 0 on "Destination host unreachable" replies from the
+// router, so the reply itself is checked.
+func PingHost(host string) error {
+	out, err := RunCommand([]string{"ping", "-n", "1", "-w", pingTimeout + "000", host}, lockCommandTimeout, nil)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(out), "TTL=") {
+		return errors.New("ping: no reply from " + host)
+	}
+	return nil
+}
+
+// ARPTable returns the ARP table from arp.
+func ARPTable() (string, error) {
+	out, err := RunCommand([]string{"arp", "-a"}, lockCommandTimeout, nil)
+	if err != nil {
+		return "", errors.New("arp: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// leftBehindIdle is how recently the keyboard or mouse must have been used for
+// the machine to count as in use.
+const leftBehindIdle = time.Minute
+
+// unseenSince is when the device last answered before its current absence,
+// zero while it answers, and leftBehindAlerted whether this absence was
+// already reported. Both are only used from the monitor loop.
+var (
+	unseenSince       time.Time
+	leftBehindAlerted bool
+)
+
+// checkLeftBehind warns once when the machine is in use but the device hasn't
+// answered for left_behind_after, which likely means the phone was left
+// somewhere while its owner moved on with the laptop.
+func checkLeftBehind(now time.Time) {
+	if LeftBehindAfter <= 0 {
+		return
+	}
+	st := CurrentState()
+	if st.Connected {
+		unseenSince, leftBehindAlerted = time.Time{}, false
+		return
+	}
+	if unseenSince.IsZero() {
+		unseenSince = now
+		if !st.LastSeen.IsZero() {
+			unseenSince = st.LastSeen
+		}
+	}
+	if leftBehindAlerted || now.Sub(unseenSince) < LeftBehindAfter {
+		return
+	}
+	if idle, err := IdleTime(); err != nil || idle >= leftBehindIdle {
+		return
+	}
+	leftBehindAlerted = true
+	unseen := now.Sub(unseenSince).Round(time.Second)
+	slog.Warn("Device unseen while the machine is in use", "unseen", unseen)
+	EmitEvent(Event{Type: EventLeftBehind, Message: unseen.String()})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// cgSession is the fast user switching helper. It switches to the login window
+// at once, but newer macOS versions no longer ship it.
+const cgSession = "/System/Library/CoreServices/Menu Extras/User.menu/Contents/Resources/CGSession"
+
+// lockVerifyTimeout is how long macOS gets to report the screen locked.
+const lockVerifyTimeout = 3 * time.Second
+
+// sessionLocker locks the macOS console session.
+type sessionLocker struct{}
+
+// NewLocker returns the macOS locker, env doesn't matter there.
+func NewLocker(env string) (Locker, error) {
+	if LockConsolesWith != "" {
+		return nil, errors.New("lock_consoles is only supported on Linux")
+	}
+	return sessionLocker{}, nil
+}
+
+// Lock runs lock_command if one is set, otherwise it suspends the session
+// with CGSession or sleeps the display, which locks it when a password is
+// required immediately after sleep. With verify_lock it waits for the screen
+// to report locked.
+func (sessionLocker) Lock() error {
+	argv := LockCommand
+	if len(argv) == 0 {
+		argv = []string{"pmset", "displaysleepnow"}
+		if _, err := os.Stat(cgSession); err == nil {
+			argv = []string{cgSession, "-suspend"}
+		}
+	}
+	_, err := withRetries(LockRetries, func() error {
+		if err := runLockCommand(argv); err != nil {
+			return err
+		}
+		if !VerifyLock {
+			return nil
+		}
+		if waitForScreenLocked(true) {
+			return nil
+		}
+		return errors.New("the screen didn't lock, check that a password is required immediately after the display sleeps")
+	})
+	return err
+}
+
+// Unlock wakes the display, so Touch ID or an Apple Watch can unlock it,
+// then runs unlock_command as the helper that authenticates, if one is set.
+func (sessionLocker) Unlock() error {
+	if err := runLockCommand([]string{"caffeinate", "-u", "-t", "1"}); err != nil {
+		return err
+	}
+	if len(UnlockCommand) == 0 {
+		return nil
+	}
+	_, err := withRetries(LockRetries, func() error {
+		if err := runLockCommand(UnlockCommand); err != nil {
+			return err
+		}
+		if !VerifyLock || waitForScreenLocked(false) {
+			return nil
+		}
+		return errors.New("the screen is still locked")
+	})
+	return err
+}
+
+// runLockCommand runs a lock or unlock command, putting its output in the error.
+func runLockCommand(argv []string) error {
+	out, err := RunCommand(argv, lockCommandTimeout, nil)
+	if err == nil {
+		return nil
+	}
+	if output := strings.TrimSpace(string(out)); output != "" {
+		return fmt.Errorf("%s: %v: %s", argv[0], err, output)
+	}
+	return fmt.Errorf("%s: %v", argv[0], err)
+}
+
+// waitForScreenLocked waits for the screen to be locked or unlocked and reports
+// whether it got there in time.
+func waitForScreenLocked(locked bool) bool {
+	for deadline := time.Now().Add(lockVerifyTimeout); time.Now().Before(deadline); time.Sleep(250 * time.Millisecond) {
+		if screenLocked() == locked {
+			return true
+		}
+	}
+	return false
+}
+
+// screenLocked reports whether the console session's screen is locked, which
+// the window server records in the IORegistry.
+func screenLocked() bool {
+	out, err := exec.Command("ioreg", "-n", "Root", "-d1").Output()
+	return err == nil && strings.Contains(string(out), `"CGSSessionScreenIsLocked"=Yes`)
+}
+
+// sessionLocked reports whether the screen is locked.
+func sessionLocked() (bool, error) {
+	return screenLocked(), nil
+}
+
+// DetectDesktopEnv returns MACOS, the only screen locker there is.
+func DetectDesktopEnv() string {
+	return "MACOS"
+}
+
+// NewUserLocker fails, system mode needs logind.
+func NewUserLocker(name string) (Locker, error) {
+	return nil, errors.New("system mode is only supported on Linux")
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// desktopLocker locks the session through the desktop environment's screen
+// locker, lock_command, or the fallbacks.
+type desktopLocker struct {
+	env string
+}
+
+// NewLocker returns the locker for the desktop environment env.
+func NewLocker(env string) (Locker, error) {
+	if LockConsolesWith != "" {
+		if _, err := consoleLockCommand(LockConsolesWith); err != nil {
+			return nil, err
+		}
+	}
+	slog.Info("Using logind session", "session", loginctlSession())
+	return desktopLocker{env: env}, nil
+}
+
+// Lock locks with lock_command, or based on desktop environment, then the
+// consoles with lock_consoles. Failed attempts are retried, then the other
+// lockers are tried in turn and the first that works is used from then on.
+func (l desktopLocker) Lock() error {
+	var errs []error
+	for i, locker := range lockerChain(l.env) {
+		retries := LockRetries
+		if i > 0 {
+			slog.Warn("Trying fallback locker", "locker", locker)
+			retries = 0
+		}
+		err := runLocker(locker, true, retries)
+		if err == nil {
+			if locker != activeLocker && activeLocker != "" {
+				slog.Info("Switched screen locker", "locker", locker)
+			}
+			activeLocker = locker
+			LockConsoles()
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", strings.ToLower(locker), err))
+	}
+	return errors.Join(errs...)
+}
+
+// Unlock unlocks the consoles, then the session with the locker that locked it.
+func (l desktopLocker) Unlock() error {
+	UnlockConsoles()
+	locker := activeLocker
+	if locker == "" {
+		locker = lockerChain(l.env)[0]
+	}
+	if locker == customLocker && len(UnlockCommand) == 0 {
+		locker = l.env
+	}
+	return runLocker(locker, false, LockRetries)
+}
+
+// Watch warns about Wayland compositors bluelock can't lock, and follows the
+// screensaver for locks made outside bluelock.
+func (l desktopLocker) Watch() {
+	CheckWaylandSessionLock()
+	WatchLockState(l.env)
+}
+
+// sessionLocked reports whether the screen is locked, as far as the desktop's
+// screen locker tells.
+func sessionLocked() (bool, error) {
+	return lockActive(DesktopEnv)
+}
+
+// lockCommandFor returns the command that locks the given desktop environment.
+func lockCommandFor(env string) []string {
+	switch env {
+	case customLocker:
+		return LockCommand
+	case "LOGINCTL", "WAYLAND":
+		return []string{"loginctl", "lock-session", loginctlSession()}
+	case "XSCREENSAVER":
+		return []string{"xscreensaver-command", "-lock"}
+	case "MATE":
+		return []string{"mate-screensaver-command", "-l"}
+	case "CINNAMON":
+		return []string{"cinnamon-screensaver-command", "-l"}
+	case "SWAY":
+		// swaylock needs the Wayland socket, without it have sway start it
+		if os.Getenv("WAYLAND_DISPLAY") == "" {
+			return []string{"swaymsg", "exec", "swaylock -f"}
+		}
+		return []string{"swaylock", "-f"}
+	case "HYPRLAND":
+		// With hypridle running, let its lock_cmd decide how to lock
+		if runningProcesses()["hypridle"] {
+			return []string{"loginctl", "lock-session", loginctlSession()}
+		}
+		return []string{"hyprctl", "dispatch", "exec", "hyprlock"}
+	case "XFCE":
+		if runningProcesses()["xfce4-screensaver"] {
+			return []string{"xfce4-screensaver-command", "-l"}
+		}
+		return []string{"xflock4"}
+	case "LXQT":
+		return []string{"lxqt-leave", "--lockscreen"}
+	case "BUDGIE":
+		return []string{budgieScreensaverCommand(), "-l"}
+	case "LIGHTDM":
+		return []string{"dm-tool", "lock"}
+	case "XDG_SCREENSAVER":
+		return []string{"xdg-screensaver", "lock"}
+	}
+	return nil
+}
+
+// unlockCommandFor returns the command that unlocks the given desktop environment.
+func unlockCommandFor(env string) []string {
+	switch env {
+	case customLocker:
+		return UnlockCommand
+	case "LOGINCTL", "KDE":
+		return []string{"loginctl", "unlock-session", loginctlSession()}
+	case "XSCREENSAVER":
+		return []string{"pkill", "xscreensaver"}
+	case "MATE":
+		return []string{"mate-screensaver-command", "-d"}
+	case "CINNAMON":
+		return []string{"cinnamon-screensaver-command", "-d"}
+	case "SWAY":
+		// swaylock unlocks cleanly on SIGUSR1
+		return []string{"pkill", "-USR1", "-x", "swaylock"}
+	case "XFCE":
+		if runningProcesses()["xfce4-screensaver"] {
+			return []string{"xfce4-screensaver-command", "-d"}
+		}
+		// xflock4 hands off to whatever locker is installed, only logind can ask it to stop
+		return []string{"loginctl", "unlock-session", loginctlSession()}
+	case "LXQT":
+		return []string{"loginctl", "unlock-session", loginctlSession()}
+	case "BUDGIE":
+		return []string{budgieScreensaverCommand(), "-d"}
+	case "I3LOCK", "XSECURELOCK":
+		if !UnlockByKillingLocker {
+			return nil
+		}
+		return []string{"pkill", "-x", strings.ToLower(env)}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// lockWorkStation is user32's LockWorkStation, which locks the interactive session.
+var lockWorkStation = syscall.NewLazyDLL("user32.dll").NewProc("LockWorkStation")
+
+// lockVerifyTimeout is how long Windows gets to show the sign-in screen.
+const lockVerifyTimeout = 3 * time.Second
+
+// workstationLocker locks the Windows session. Windows only unlocks at the
+// sign-in screen, so unlocking needs unlock_command.
+type workstationLocker struct{}
+
+// NewLocker returns the Windows locker, env doesn't matter there.
+func NewLocker(env string) (Locker, error) {
+	if LockConsolesWith != "" {
+		return nil, errors.New("lock_consoles is only supported on Linux")
+	}
+	return workstationLocker{}, nil
+}
+
+// Lock runs lock_command if one is set, otherwise it locks the workstation.
+// With verify_lock it waits for the sign-in screen to come up.
+func (workstationLocker) Lock() error {
+	_, err := withRetries(LockRetries, func() error {
+		if len(LockCommand) > 0 {
+			if out, err := RunCommand(LockCommand, lockCommandTimeout, nil); err != nil {
+				return fmt.Errorf("%s: %v: %s", LockCommand[0], err, strings.TrimSpace(string(out)))
+			}
+		} else if ok, _, err := lockWorkStation.Call(); ok == 0 {
+			return fmt.Errorf("LockWorkStation: %v", err)
+		}
+		if !VerifyLock {
+			return nil
+		}
+		for deadline := time.Now().Add(lockVerifyTimeout); time.Now().Before(deadline); time.Sleep(250 * time.Millisecond) {
+			if logonUIRunning() {
+				return nil
+			}
+		}
+		return errors.New("the sign-in screen didn't come up")
+	})
+	return err
+}
+
+// Unlock runs unlock_command. Without one the session stays locked until the
+// user signs in.
+func (workstationLocker) Unlock() error {
+	if len(UnlockCommand) == 0 {
+		slog.Info("Windows can't be unlocked by bluelock, sign in to unlock")
+		return nil
+	}
+	_, err := withRetries(LockRetries, func() error {
+		if out, err := RunCommand(UnlockCommand, lockCommandTimeout, nil); err != nil {
+			return fmt.Errorf("%s: %v: %s", UnlockCommand[0], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	})
+	return err
+}
+
+// logonUIRunning reports whether LogonUI.exe, which draws the sign-in screen, is running.
+func logonUIRunning() bool {
+	out, err := exec.Command("tasklist", "/FI", "IMAGENAME eq LogonUI.exe", "/NH").Output()
+	return err == nil && strings.Contains(string(out), "LogonUI.exe")
+}
+
+// sessionLocked can't tell on Windows, which doesn't let other programs see
+// the sign-in screen.
+func sessionLocked() (bool, error) {
+	return false, errors.New("can't tell whether the screen is locked on Windows")
+}
+
+// DetectDesktopEnv returns WINDOWS, the only screen locker there is.
+func DetectDesktopEnv() string {
+	return "WINDOWS"
+}
+
+// NewUserLocker fails, system mode needs logind.
+func NewUserLocker(name string) (Locker, error) {
+	return nil, errors.New("system mode is only supported on Linux")
+}
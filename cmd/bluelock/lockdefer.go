@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// lockDeferral returns what keeps an automatic lock from happening now, e.g.
+// "an inhibitor (mpv: video playing)", or "" when nothing does. Like a
+// pre-lock hook's veto it holds for at most max_lock_veto.
+func lockDeferral() string {
+	if RespectInhibitors {
+		inhibitors, err := Inhibitors()
+		if err != nil {
+			slog.Debug("Failed to list the screensaver inhibitors", "err", err)
+		}
+		if len(inhibitors) > 0 {
+			return "an inhibitor (" + strings.Join(inhibitors, ", ") + ")"
+		}
+	}
+	if app := busyApp(); app != "" {
+		return app
+	}
+	return ""
+}
+
+// busyApp returns the first --defer_lock_for entry that matches now, as
+// "obs running" or "libreoffice-impress fullscreen", or "". An entry matches
+// a running process or the focused window's class, with :fullscreen only that
+// window while it's fullscreen. Names are compared ignoring case.
+func busyApp() string {
+	if len(DeferLockFor) == 0 {
+		return ""
+	}
+	focused, fullscreen, err := FocusedWindow()
+	if err != nil {
+		slog.Debug("Failed to read the focused window", "err", err)
+	}
+	var running map[string]bool
+	for _, entry := range DeferLockFor {
+		name, onlyFullscreen := strings.CutSuffix(strings.ToLower(strings.TrimSpace(entry)), ":fullscreen")
+		switch {
+		case onlyFullscreen:
+			if fullscreen && strings.EqualFold(focused, name) {
+				return name + " fullscreen"
+			}
+			continue
+		case strings.EqualFold(focused, name):
+			return name + " focused"
+		}
+		if running == nil {
+			if running, err = RunningApps(); err != nil {
+				slog.Debug("Failed to list the running applications", "err", err)
+				running = map[string]bool{}
+			}
+		}
+		for app := range running {
+			if strings.EqualFold(app, name) {
+				return name + " running"
+			}
+		}
+	}
+	return ""
+}
+
+// inhibitorName describes an inhibitor by its application and reason.
+func inhibitorName(app, reason string) string {
+	if reason == "" {
+		return app
+	}
+	return app + ": " + reason
+}
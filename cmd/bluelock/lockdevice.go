@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// lockDeviceUnknown is the lock_device entry for any unpaired device.
+const lockDeviceUnknown = "unknown"
+
+// lockDevice is a lock_device entry, a device whose approach locks the screen.
+type lockDevice struct {
+	address string // A device address, or lockDeviceUnknown
+	rssi    int    // How strong it has to be to count as near
+}
+
+// parseLockDevices parses the lock_device entries, address[=rssi] or
+// unknown[=rssi], taking unlock_rssi when no RSSI is given.
+func parseLockDevices() ([]lockDevice, error) {
+	var devices []lockDevice
+	for _, entry := range LockDevices {
+		address, threshold, hasRSSI := strings.Cut(strings.TrimSpace(entry), "=")
+		device := lockDevice{address: strings.ToUpper(address), rssi: UnlockRSSI}
+		if strings.EqualFold(address, lockDeviceUnknown) {
+			device.address = lockDeviceUnknown
+		} else if !bluetoothAddress.MatchString(address) {
+			return nil, fmt.Errorf("%q has no valid device address, use AA:BB:CC:DD:EE:FF=-60 or unknown=-50", entry)
+		}
+		if hasRSSI {
+			rssi, err := strconv.Atoi(strings.TrimSpace(threshold))
+			if err != nil || rssi < minRSSI || rssi > maxRSSI {
+				return nil, fmt.Errorf("%q has an invalid RSSI, use %d to %d", entry, minRSSI, maxRSSI)
+			}
+			device.rssi = rssi
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// wantsNearby reports whether a lock_device entry needs a nearbyScanner.
+func wantsNearby() bool {
+	devices, _ := parseLockDevices()
+	for _, device := range devices {
+		if device.address == lockDeviceUnknown {
+			return true
+		}
+	}
+	return false
+}
+
+// lockDeviceNear returns the first lock_device that's within its range, or
+// "". A device that can't be read counts as away.
+func lockDeviceNear() (address string, rssi int) {
+	devices, _ := parseLockDevices()
+	var nearby []NearbyDevice
+	listed := false
+	for _, device := range devices {
+		if device.address != lockDeviceUnknown {
+			rssi, found, err := scanner.ReadRSSI(device.address)
+			if err != nil {
+				slog.Debug("Failed to read a lock_device", "device", device.address, "err", err)
+			} else if found && rssi >= device.rssi {
+				return device.address, rssi
+			}
+			continue
+		}
+		if !listed {
+			var err error
+			if nearby, err = scanner.(nearbyScanner).Nearby(); err != nil {
+				slog.Debug("Failed to list nearby devices", "err", err)
+			}
+			listed = true
+		}
+		for _, seen := range nearby {
+			if !seen.Paired && seen.Address != strings.ToUpper(BluetoothDeviceAddress) && seen.RSSI >= device.rssi {
+				return seen.Address, seen.RSSI
+			}
+		}
+	}
+	return "", 0
+}
+
+// checkLockDevices reports whether a lock_device is near, logging when one
+// comes or they've all gone.
+func checkLockDevices() bool {
+	if len(LockDevices) == 0 {
+		return false
+	}
+	address, rssi := lockDeviceNear()
+	if address != CurrentState().LockDevice {
+		updateState(func(s *DaemonState) { s.LockDevice = address })
+		if address != "" {
+			slog.Warn("A lock_device is near, locking", "device", address, "rssi", rssi)
+		} else {
+			slog.Info("The lock_device left")
+		}
+	}
+	return address != ""
+}
@@ -0,0 +1,323 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// lockVerifyTimeout is how long the screen locker gets to report the new state.
+const lockVerifyTimeout = 3 * time.Second
+
+// customLocker names lock_command and unlock_command in the locker chain.
+const customLocker = "CUSTOM"
+
+// fallbackLockers are tried in order when the configured locker fails.
+var fallbackLockers = []string{"LOGINCTL", "DBUS", "GNOME", "CINNAMON", "MATE", "XFCE", "LXQT", "BUDGIE", "SWAY", "HYPRLAND", "XSCREENSAVER", "I3LOCK", "LIGHTDM", "XDG_SCREENSAVER"}
+
+// x11Lockers only work in X11 sessions.
+var x11Lockers = map[string]bool{"XSCREENSAVER": true, "XDG_SCREENSAVER": true, "I3LOCK": true, "XSECURELOCK": true}
+
+// activeLocker is the locker that last locked the screen, tried first from then
+// on. It is only used from the monitor loop.
+var activeLocker string
+
+// lockerChain lists the lockers to try: the one that worked last, lock_command or
+// the configured desktop environment, then the fallbacks, leaving out X11-only
+// lockers in a Wayland session.
+func lockerChain(env string) []string {
+	var chain []string
+	if activeLocker != "" {
+		chain = append(chain, activeLocker)
+	}
+	if len(LockCommand) > 0 {
+		chain = append(chain, customLocker)
+	}
+	chain = append(chain, env)
+	if LockFallback {
+		if isWaylandSession() {
+			chain = append(chain, "WAYLAND")
+		}
+		chain = append(chain, fallbackLockers...)
+	}
+	wayland := isWaylandSession()
+	seen := map[string]bool{}
+	unique := chain[:0]
+	for _, locker := range chain {
+		// X11 screensavers can't lock a Wayland session, don't trust them to
+		if wayland && x11Lockers[locker] && locker != env {
+			continue
+		}
+		if !seen[locker] {
+			seen[locker] = true
+			unique = append(unique, locker)
+		}
+	}
+	return unique
+}
+
+// errCannotVerify is returned by lockActive when the locker can't be queried.
+var errCannotVerify = errors.New("lock state can't be queried")
+
+// lockAction returns the function that locks (or, with locked false, unlocks) the
+// screen through locker, or nil if the locker can't do that.
+func lockAction(locker string, locked bool) func() error {
+	switch locker {
+	case "DBUS":
+		if locked {
+			return dbusLock
+		}
+		return dbusUnlock
+	case "GNOME":
+		if locked {
+			return gnomeLock
+		}
+		return gnomeUnlock
+	case "KDE":
+		if locked {
+			return kdeLock
+		}
+	case "HYPRLAND":
+		if !locked {
+			return hyprlockUnlock
+		}
+	case "WAYLAND":
+		if !locked {
+			return waylandUnlock
+		}
+	case "LIGHTDM":
+		if !locked {
+			return lightdmUnlock
+		}
+	case "I3LOCK", "XSECURELOCK":
+		// Both run until unlocked (i3lock with -n, forking it would leave a child
+		// holding our output open), start them in the background, through
+		// xss-lock if that's managing the screen
+		if locked && runningProcesses()["xss-lock"] {
+			return lockAction("LOGINCTL", true)
+		}
+		if locked && locker == "I3LOCK" {
+			return func() error { return startDetached("i3lock", "-n") }
+		}
+		if locked {
+			return func() error { return startDetached("xsecurelock") }
+		}
+	}
+	argv := unlockCommandFor(locker)
+	if locked {
+		argv = lockCommandFor(locker)
+	}
+	if len(argv) == 0 {
+		return nil
+	}
+	return func() error {
+		out, err := RunCommand(argv, lockCommandTimeout, nil)
+		if err == nil {
+			return nil
+		}
+		if output := strings.TrimSpace(string(out)); output != "" {
+			return fmt.Errorf("%s: %v: %s", argv[0], err, output)
+		}
+		return fmt.Errorf("%s: %v", argv[0], err)
+	}
+}
+
+// runLocker locks or unlocks through locker and waits for the screen to reach the
+// wanted state, retrying up to retries times.
+func runLocker(locker string, locked bool, retries int) error {
+	action := lockAction(locker, locked)
+	if action == nil && !locked && (locker == "I3LOCK" || locker == "XSECURELOCK") {
+		return fmt.Errorf("%s can only be unlocked by killing it, set unlock_by_killing_locker to allow that", strings.ToLower(locker))
+	}
+	if action == nil {
+		return fmt.Errorf("no command for desktop_env %q, set lock_command and unlock_command", locker)
+	}
+	_, err := withRetries(retries, func() error {
+		if err := action(); err != nil {
+			return err
+		}
+		if !VerifyLock {
+			return nil
+		}
+		return waitForLockState(locker, locked)
+	})
+	return err
+}
+
+// startDetached starts a locker that keeps running while the screen is locked.
+func startDetached(argv ...string) error {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s: %v", argv[0], err)
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// hyprlockUnlock asks hyprlock to unlock with SIGUSR1. Versions that don't handle
+// it are terminated instead, which is the only way to unlock them.
+func hyprlockUnlock() error {
+	if !runningProcesses()["hyprlock"] {
+		return nil
+	}
+	if err := exec.Command("pkill", "-USR1", "-x", "hyprlock").Run(); err != nil {
+		return fmt.Errorf("pkill hyprlock: %v", err)
+	}
+	for deadline := time.Now().Add(lockVerifyTimeout); time.Now().Before(deadline); time.Sleep(250 * time.Millisecond) {
+		if !runningProcesses()["hyprlock"] {
+			return nil
+		}
+	}
+	slog.Warn("hyprlock ignored SIGUSR1, terminating it")
+	if err := exec.Command("pkill", "-TERM", "-x", "hyprlock").Run(); err != nil {
+		return fmt.Errorf("pkill hyprlock: %v", err)
+	}
+	return nil
+}
+
+// waitForLockState polls the screen locker until it reports the wanted state.
+func waitForLockState(env string, locked bool) error {
+	deadline := time.Now().Add(lockVerifyTimeout)
+	for {
+		active, err := lockActive(env)
+		if err == errCannotVerify || (err == nil && active == locked) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("checking the lock state: %v", err)
+			}
+			if locked {
+				return errors.New("the screen is still unlocked")
+			}
+			return errors.New("the screen is still locked")
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// lockActive asks the desktop environment's screen locker whether the screen is locked.
+func lockActive(env string) (bool, error) {
+	switch env {
+	case "LOGINCTL":
+		return loginctlLockedHint()
+	case "KDE":
+		return kdeLockActive()
+	case "WAYLAND":
+		// Not every ext-session-lock locker sets LockedHint, a running one counts too
+		if sessionLockerRunning() != "" {
+			return true, nil
+		}
+		return loginctlLockedHint()
+	case "GNOME":
+		return gnomeLockActive()
+	case "XSCREENSAVER":
+		// Unlocking kills xscreensaver, so no daemon means unlocked
+		if exec.Command("pgrep", "-x", "xscreensaver").Run() != nil {
+			return false, nil
+		}
+		out, err := exec.Command("xscreensaver-command", "-time").Output()
+		if err != nil {
+			return false, err
+		}
+		return strings.Contains(string(out), "locked"), nil
+	case "MATE":
+		return screensaverQuery("mate-screensaver-command")
+	case "CINNAMON":
+		return screensaverQuery("cinnamon-screensaver-command")
+	case "DBUS":
+		return dbusLockActive()
+	case "SWAY":
+		// swaylock -f stays running for exactly as long as the screen is locked
+		return runningProcesses()["swaylock"], nil
+	case "HYPRLAND":
+		return runningProcesses()["hyprlock"], nil
+	case "I3LOCK", "XSECURELOCK":
+		return runningProcesses()[strings.ToLower(env)], nil
+	case "LIGHTDM":
+		return lightdmLocked()
+	case "XFCE":
+		if runningProcesses()["xfce4-screensaver"] {
+			return screensaverQuery("xfce4-screensaver-command")
+		}
+		return loginctlLockedHint()
+	case "LXQT":
+		// LXQt locks with xscreensaver unless configured otherwise
+		if runningProcesses()["xscreensaver"] {
+			return lockActive("XSCREENSAVER")
+		}
+		return loginctlLockedHint()
+	case "BUDGIE":
+		return screensaverQuery(budgieScreensaverCommand())
+	}
+	// Custom commands and xdg-screensaver can't be checked
+	return false, errCannotVerify
+}
+
+// budgieScreensaverCommand returns budgie-screensaver-command, or the
+// gnome-screensaver-command older Budgie releases use.
+func budgieScreensaverCommand() string {
+	if _, err := exec.LookPath("budgie-screensaver-command"); err == nil {
+		return "budgie-screensaver-command"
+	}
+	return "gnome-screensaver-command"
+}
+
+// loginctlLockedHint returns the LockedHint logind keeps for our session.
+func loginctlLockedHint() (bool, error) {
+	return loginctlSessionFlag("LockedHint")
+}
+
+// loginctlSessionFlag reads a yes/no property of our logind session.
+func loginctlSessionFlag(property string) (bool, error) {
+	return sessionFlag(loginctlSession(), property)
+}
+
+// lightdmLocked reports whether LightDM is showing the lock screen, either by
+// LockedHint or because the greeter took over from our session.
+func lightdmLocked() (bool, error) {
+	if hint, err := loginctlLockedHint(); err != nil || hint {
+		return hint, err
+	}
+	active, err := loginctlSessionFlag("Active")
+	return !active, err
+}
+
+// lightdmUnlock asks logind to unlock the session and switches back to it from
+// the LightDM greeter.
+func lightdmUnlock() error {
+	if err := exec.Command("loginctl", "unlock-session", loginctlSession()).Run(); err != nil {
+		return fmt.Errorf("loginctl unlock-session: %v", err)
+	}
+	if out, err := exec.Command("loginctl", "activate", loginctlSession()).CombinedOutput(); err != nil {
+		return fmt.Errorf("loginctl activate: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// waylandUnlock asks logind to unlock the session, then has swaylock or hyprlock
+// unlock themselves with SIGUSR1 in case they don't listen to logind.
+func waylandUnlock() error {
+	if err := exec.Command("loginctl", "unlock-session", loginctlSession()).Run(); err != nil {
+		return fmt.Errorf("loginctl unlock-session: %v", err)
+	}
+	for _, locker := range []string{"swaylock", "hyprlock"} {
+		exec.Command("pkill", "-USR1", "-x", locker).Run()
+	}
+	return nil
+}
+
+// screensaverQuery runs a gnome-screensaver style `command -q`, which prints
+// "The screensaver is active" or "The screensaver is inactive".
+func screensaverQuery(command string) (bool, error) {
+	out, err := exec.Command(command, "-q").Output()
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(string(out), "is active"), nil
+}
@@ -0,0 +1,66 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// lockWatchRestart is how long to wait before following the screen locker again
+// after gdbus monitor exits.
+const lockWatchRestart = 30 * time.Second
+
+// WatchLockState follows the screen locker's ActiveChanged signal on desktops that
+// have one (KDE, GNOME and DBUS), so locks and unlocks the user does themselves
+// are reflected in the daemon state instead of being undone on the next check.
+func WatchLockState(env string) {
+	var dest string
+	switch env {
+	case "KDE", "DBUS":
+		dest = "org.freedesktop.ScreenSaver"
+	case "GNOME":
+		dest = "org.gnome.ScreenSaver"
+	default:
+		return
+	}
+	go func() {
+		for {
+			if err := followActiveChanged(dest); err != nil {
+				slog.Debug("Stopped following the screen locker", "dest", dest, "err", err)
+			}
+			time.Sleep(lockWatchRestart)
+		}
+	}()
+}
+
+// followActiveChanged runs gdbus monitor on dest until it exits, handing every
+// ActiveChanged signal to the monitor loop.
+func followActiveChanged(dest string) error {
+	cmd := exec.Command("gdbus", "monitor", "--session", "--dest", dest)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		// e.g. "/ScreenSaver: org.freedesktop.ScreenSaver.ActiveChanged (true,)"
+		line := scanner.Text()
+		_, args, ok := strings.Cut(line, ".ActiveChanged ")
+		if !ok {
+			continue
+		}
+		active, err := ParseDBusBool(args)
+		if err != nil {
+			continue
+		}
+		controlQueue <- func() { lockChangedOutside(active) }
+	}
+	return cmd.Wait()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotatingFile is an io.Writer appending to a log file that is rotated once it
+// grows past MaxSize bytes or has been written to for MaxAge. Rotated files are
+// optionally gzipped, and only the newest MaxBackups are kept.
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+	Compress   bool
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	cleanupMu sync.Mutex // Held by cleanup instead of mu, so writes don't wait for the compression
+}
+
+// Write appends p to the log file, rotating it first if needed.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	tooBig := f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize
+	tooOld := f.MaxAge > 0 && time.Since(f.opened) > f.MaxAge
+	if tooBig || tooOld {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// open opens the log file for appending.
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+// rotate moves the current file aside and starts a new one.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	backup := f.Path + "." + time.Now().Format("20060102-150405.000")
+	if err := os.Rename(f.Path, backup); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	go f.cleanup(backup)
+	return nil
+}
+
+// cleanup compresses a freshly rotated file and removes backups beyond MaxBackups.
+// It runs in the background, so failures can't be logged through this file and go
+// to stderr instead.
+func (f *RotatingFile) cleanup(backup string) {
+	f.cleanupMu.Lock()
+	defer f.cleanupMu.Unlock()
+
+	if f.Compress {
+		if err := gzipFile(backup); err != nil {
+			slog.New(slog.NewTextHandler(os.Stderr, nil)).Warn("Failed to compress log file", "file", backup, "err", err)
+		}
+	}
+	if f.MaxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(f.Path + ".*")
+	if err != nil {
+		return
+	}
+	// Backup names end in a timestamp, so they sort oldest first
+	sort.Slice(backups, func(i, j int) bool {
+		return strings.TrimSuffix(backups[i], ".gz") < strings.TrimSuffix(backups[j], ".gz")
+	})
+	for len(backups) > f.MaxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
+
+// gzipFile replaces path with a gzipped copy named path.gz.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// logLevel is the minimum level logged; it follows the debug setting.
+var logLevel = new(slog.LevelVar)
+
+// SetupLogging installs the default logger. target is "stderr", "file", "journal",
+// "syslog" or "auto", which uses log_file when set, the journal when running under
+// systemd and stderr otherwise. The journal falls back to syslog, and both fall
+// back to stderr.
+func SetupLogging(format, target string) error {
+	SetDebug(Debug)
+
+	if target == "auto" {
+		switch {
+		case LogFile != "":
+			target = "file"
+		case stderrIsJournal():
+			target = "journal"
+		default:
+			target = "stderr"
+		}
+	}
+
+	var output io.Writer = os.Stderr
+	if target == "file" {
+		if LogFile == "" {
+			return fmt.Errorf("log_target=file requires log_file")
+		}
+		output = &RotatingFile{
+			Path:       LogFile,
+			MaxSize:    int64(LogMaxSizeMB) << 20,
+			MaxAge:     LogMaxAge,
+			MaxBackups: LogMaxBackups,
+			Compress:   LogCompress,
+		}
+	}
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var streamHandler slog.Handler
+	switch format {
+	case "text":
+		streamHandler = slog.NewTextHandler(output, opts)
+	case "json":
+		streamHandler = slog.NewJSONHandler(output, opts)
+	default:
+		return fmt.Errorf("log_format must be text or json, not %q", format)
+	}
+
+	var sink logSink
+	var sinkErr error
+	switch target {
+	case "stderr", "file":
+	case "journal":
+		if sink, sinkErr = newJournalSink(); sinkErr == nil {
+			break
+		}
+		fallthrough
+	case "syslog":
+		sink, sinkErr = newSyslogSink()
+	default:
+		return fmt.Errorf("log_target must be auto, stderr, file, journal or syslog, not %q", target)
+	}
+
+	if sink != nil && sinkErr == nil {
+		slog.SetDefault(slog.New(&sinkHandler{sink: sink, level: logLevel}))
+		return nil
+	}
+	slog.SetDefault(slog.New(streamHandler))
+	if sinkErr != nil {
+		slog.Warn("System logger unavailable, logging to stderr", "log_target", target, "err", sinkErr)
+	}
+	return nil
+}
+
+// SetDebug turns debug logging on or off.
+func SetDebug(enabled bool) {
+	Debug = enabled
+	if enabled {
+		logLevel.Set(slog.LevelDebug)
+	} else {
+		logLevel.Set(slog.LevelInfo)
+	}
+}
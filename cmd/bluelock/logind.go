@@ -0,0 +1,143 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logindSession is the session bluelock locks and unlocks, found once at startup.
+var logindSession string
+
+// loginctlSession returns the logind session bluelock locks and unlocks, so
+// loginctl and logind never pick a session on their own.
+func loginctlSession() string {
+	if logindSession == "" {
+		logindSession = findLogindSession()
+	}
+	return logindSession
+}
+
+// findLogindSession works out our logind session the way sd_pid_get_session
+// does: logind_session if set, then XDG_SESSION_ID, then the session scope our
+// cgroup is in. A service outside any session, like a user unit, gets the
+// user's display session. "auto" is the last resort.
+func findLogindSession() string {
+	if LogindSession != "" {
+		return LogindSession
+	}
+	if id := os.Getenv("XDG_SESSION_ID"); id != "" {
+		return id
+	}
+	if id := cgroupSession(); id != "" {
+		return id
+	}
+	out, err := exec.Command("loginctl", "show-user", strconv.Itoa(os.Getuid()), "-p", "Display", "--value").Output()
+	if id := strings.TrimSpace(string(out)); err == nil && id != "" {
+		return id
+	}
+	slog.Warn("Couldn't find our logind session, letting logind pick one; set logind_session if the wrong one locks")
+	return "auto"
+}
+
+// cgroupSession returns the id from the session-<id>.scope in our cgroup path,
+// or "" when we're not in a session scope.
+func cgroupSession() string {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		for dir := parts[2]; dir != "/" && dir != "."; dir = path.Dir(dir) {
+			name := path.Base(dir)
+			if strings.HasPrefix(name, "session-") && strings.HasSuffix(name, ".scope") {
+				return strings.TrimSuffix(strings.TrimPrefix(name, "session-"), ".scope")
+			}
+		}
+	}
+	return ""
+}
+
+// userLocker locks and unlocks every logind session of a user, for system mode.
+type userLocker struct {
+	user string
+}
+
+// NewUserLocker returns the locker for the sessions of the user called name.
+func NewUserLocker(name string) (Locker, error) {
+	if _, err := user.Lookup(name); err != nil {
+		return nil, err
+	}
+	return userLocker{user: name}, nil
+}
+
+// Lock locks each of the user's sessions and, with verify_lock, waits for their
+// LockedHint.
+func (l userLocker) Lock() error {
+	return l.each("lock-session", true)
+}
+
+// Unlock unlocks each of the user's sessions.
+func (l userLocker) Unlock() error {
+	return l.each("unlock-session", false)
+}
+
+// each runs a loginctl command on every session of the user, retrying failures.
+func (l userLocker) each(command string, locked bool) error {
+	var errs []error
+	for _, id := range userSessions(l.user) {
+		_, err := withRetries(LockRetries, func() error {
+			if out, err := exec.Command("loginctl", command, id).CombinedOutput(); err != nil {
+				return fmt.Errorf("loginctl %s %s: %v: %s", command, id, err, strings.TrimSpace(string(out)))
+			}
+			if !VerifyLock {
+				return nil
+			}
+			for deadline := time.Now().Add(lockVerifyTimeout); time.Now().Before(deadline); time.Sleep(250 * time.Millisecond) {
+				if hint, err := sessionFlag(id, "LockedHint"); err == nil && hint == locked {
+					return nil
+				}
+			}
+			if locked {
+				return fmt.Errorf("session %s didn't lock", id)
+			}
+			return fmt.Errorf("session %s didn't unlock", id)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// userSessions lists the ids of the logind sessions of the user called name.
+// logind doesn't know users without a session, they have none to lock.
+func userSessions(name string) []string {
+	out, err := exec.Command("loginctl", "show-user", name, "-p", "Sessions", "--value").Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(out))
+}
+
+// sessionFlag reads a yes/no property of a logind session.
+func sessionFlag(id, property string) (bool, error) {
+	out, err := exec.Command("loginctl", "show-session", id, "-p", property, "--value").Output()
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(out)) == "yes", nil
+}
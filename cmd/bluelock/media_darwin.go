@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// mediaApps are the players PauseMedia knows how to ask over AppleScript.
+var mediaApps = []string{"Music", "Spotify", "TV"}
+
+// PauseMedia pauses the media apps that are playing, and returns them for
+// ResumeMedia.
+func PauseMedia() ([]string, error) {
+	var paused []string
+	var failed []error
+	for _, app := range mediaApps {
+		script := fmt.Sprintf(`if application %q is running then
+	tell application %q
+		if player state is playing then
+			pause
+			return "paused"
+		end if
+	end tell
+end if`, app, app)
+		out, err := RunCommand([]string{"osascript", "-e", script}, lockCommandTimeout, nil)
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %v: %s", app, err, strings.TrimSpace(string(out))))
+		} else if strings.TrimSpace(string(out)) == "paused" {
+			paused = append(paused, app)
+		}
+	}
+	return paused, errors.Join(failed...)
+}
+
+// ResumeMedia starts the apps PauseMedia paused again.
+func ResumeMedia(apps []string) error {
+	var failed []error
+	for _, app := range apps {
+		if out, err := RunCommand([]string{"osascript", "-e", fmt.Sprintf("tell application %q to play", app)}, lockCommandTimeout, nil); err != nil {
+			failed = append(failed, fmt.Errorf("%s: %v: %s", app, err, strings.TrimSpace(string(out))))
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// SetMuted mutes or unmutes the output, and returns whether it was muted before.
+func SetMuted(muted bool) (bool, error) {
+	out, err := RunCommand([]string{"osascript", "-e", "output muted of (get volume settings)"}, lockCommandTimeout, nil)
+	if err != nil {
+		return false, fmt.Errorf("osascript: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	was := strings.TrimSpace(string(out)) == "true"
+	if out, err := RunCommand([]string{"osascript", "-e", fmt.Sprintf("set volume output muted %t", muted)}, lockCommandTimeout, nil); err != nil {
+		return was, fmt.Errorf("osascript: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return was, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// mprisName finds the media players on the session bus.
+var mprisName = regexp.MustCompile(`'(org\.mpris\.MediaPlayer2\.[^']+)'`)
+
+// PauseMedia pauses every MPRIS media player that's playing, and returns
+// them for ResumeMedia.
+func PauseMedia() ([]string, error) {
+	reply, err := DBusCall("session", "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus.ListNames")
+	if err != nil {
+		return nil, err
+	}
+	var paused []string
+	var failed []error
+	for _, match := range mprisName.FindAllStringSubmatch(reply, -1) {
+		player := match[1]
+		status, err := DBusCall("session", player, "/org/mpris/MediaPlayer2", "org.freedesktop.DBus.Properties.Get", "'org.mpris.MediaPlayer2.Player'", "'PlaybackStatus'")
+		if err != nil || gvariantValue(status) != "Playing" {
+			continue
+		}
+		if _, err := DBusCall("session", player, "/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player.Pause"); err != nil {
+			failed = append(failed, err)
+			continue
+		}
+		paused = append(paused, player)
+	}
+	return paused, errors.Join(failed...)
+}
+
+// ResumeMedia starts the players PauseMedia paused again.
+func ResumeMedia(players []string) error {
+	var failed []error
+	for _, player := range players {
+		if _, err := DBusCall("session", player, "/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player.Play"); err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// SetMuted mutes or unmutes the default output with pactl (PulseAudio, or
+// PipeWire's pulse server) or wpctl (WirePlumber), and returns whether it was
+// muted before.
+func SetMuted(muted bool) (bool, error) {
+	value := map[bool]string{true: "1", false: "0"}[muted]
+	if _, err := exec.LookPath("pactl"); err == nil {
+		out, err := RunCommand([]string{"pactl", "get-sink-mute", "@DEFAULT_SINK@"}, lockCommandTimeout, nil)
+		if err != nil {
+			return false, fmt.Errorf("pactl: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		was := strings.Contains(string(out), "yes")
+		if out, err := RunCommand([]string{"pactl", "set-sink-mute", "@DEFAULT_SINK@", value}, lockCommandTimeout, nil); err != nil {
+			return was, fmt.Errorf("pactl: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return was, nil
+	}
+	out, err := RunCommand([]string{"wpctl", "get-volume", "@DEFAULT_AUDIO_SINK@"}, lockCommandTimeout, nil)
+	if err != nil {
+		return false, fmt.Errorf("neither pactl nor wpctl works: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	was := strings.Contains(string(out), "[MUTED]")
+	if out, err := RunCommand([]string{"wpctl", "set-mute", "@DEFAULT_AUDIO_SINK@", value}, lockCommandTimeout, nil); err != nil {
+		return was, fmt.Errorf("wpctl: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return was, nil
+}
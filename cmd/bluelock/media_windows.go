@@ -0,0 +1,21 @@
+package main
+
+import "errors"
+
+// Windows only has toggles for playback and muting, which can't tell what's
+// playing or muted, so the media away actions aren't available there.
+
+// PauseMedia isn't available on Windows.
+func PauseMedia() ([]string, error) {
+	return nil, errors.New("media can't be paused on Windows")
+}
+
+// ResumeMedia isn't available on Windows.
+func ResumeMedia(players []string) error {
+	return errors.New("media can't be resumed on Windows")
+}
+
+// SetMuted isn't available on Windows.
+func SetMuted(muted bool) (bool, error) {
+	return false, errors.New("audio can't be muted on Windows")
+}
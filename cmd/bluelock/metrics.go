@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// scanDurationBuckets are the upper bounds, in seconds, of the scan latency histogram.
+var scanDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics holds the counters exposed on /metrics.
+type Metrics struct {
+	mu              sync.Mutex
+	locks           map[string]int
+	unlocks         map[string]int
+	scanErrors      int
+	scanCount       int
+	scanSum         float64
+	scanBucketCount []int
+}
+
+var metrics = &Metrics{
+	locks:           map[string]int{},
+	unlocks:         map[string]int{},
+	scanBucketCount: make([]int, len(scanDurationBuckets)),
+}
+
+func init() {
+	HandleEvents(metrics.record)
+}
+
+// record updates the counters from an event.
+func (m *Metrics) record(e Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch e.Type {
+	case EventLock:
+		m.locks[e.Reason]++
+	case EventUnlock:
+		m.unlocks[e.Reason]++
+	}
+}
+
+// ObserveScanError counts a scan that failed.
+func ObserveScanError() {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.scanErrors++
+}
+
+// ObserveScanDuration records how long a single device scan took.
+func ObserveScanDuration(d time.Duration) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	seconds := d.Seconds()
+	metrics.scanCount++
+	metrics.scanSum += seconds
+	for i, bound := range scanDurationBuckets {
+		if seconds <= bound {
+			metrics.scanBucketCount[i]++
+		}
+	}
+}
+
+// handleMetrics serves the metrics in the Prometheus text format.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.WriteTo(w, CurrentState())
+}
+
+// WriteTo writes the metrics for the given state in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer, st DaemonState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	device := fmt.Sprintf("device=%q", st.Device)
+
+	writeMetricHeader(w, "bluelock_rssi", "gauge", "RSSI from the latest successful scan.")
+	if !st.LastSeen.IsZero() {
+		fmt.Fprintf(w, "bluelock_rssi{%s} %d\n", device, st.RSSI)
+	}
+	writeMetricHeader(w, "bluelock_device_connected", "gauge", "Whether the device answered the latest scan.")
+	fmt.Fprintf(w, "bluelock_device_connected{%s} %d\n", device, boolMetric(st.Connected))
+	writeMetricHeader(w, "bluelock_device_in_range", "gauge", "Whether the device is within the unlock threshold.")
+	fmt.Fprintf(w, "bluelock_device_in_range{%s} %d\n", device, boolMetric(st.InRange))
+	writeMetricHeader(w, "bluelock_device_last_seen_seconds", "gauge", "Seconds since the device last answered a scan.")
+	if !st.LastSeen.IsZero() {
+		fmt.Fprintf(w, "bluelock_device_last_seen_seconds{%s} %.3f\n", device, time.Since(st.LastSeen).Seconds())
+	}
+	writeMetricHeader(w, "bluelock_locked", "gauge", "Whether bluelock considers the session locked.")
+	fmt.Fprintf(w, "bluelock_locked %d\n", boolMetric(st.Mode == "locked"))
+
+	writeMetricHeader(w, "bluelock_locks_total", "counter", "Locks performed, by reason.")
+	writeReasonCounts(w, "bluelock_locks_total", m.locks)
+	writeMetricHeader(w, "bluelock_unlocks_total", "counter", "Unlocks performed, by reason.")
+	writeReasonCounts(w, "bluelock_unlocks_total", m.unlocks)
+	writeMetricHeader(w, "bluelock_scan_errors_total", "counter", "Scans that failed.")
+	fmt.Fprintf(w, "bluelock_scan_errors_total %d\n", m.scanErrors)
+
+	writeMetricHeader(w, "bluelock_scan_consecutive_failures", "gauge", "Scans that failed in a row.")
+	fmt.Fprintf(w, "bluelock_scan_consecutive_failures %d\n", st.ScanFailures)
+	writeMetricHeader(w, "bluelock_health", "gauge", "Backend health, 1 for the current state.")
+	for _, health := range []string{HealthOK, HealthDegraded, HealthBlind} {
+		fmt.Fprintf(w, "bluelock_health{state=%q} %d\n", health, boolMetric(st.Health == health))
+	}
+
+	writeMetricHeader(w, "bluelock_scan_duration_seconds", "histogram", "Time taken by a single device scan.")
+	for i, bound := range scanDurationBuckets {
+		fmt.Fprintf(w, "bluelock_scan_duration_seconds_bucket{le=\"%g\"} %d\n", bound, m.scanBucketCount[i])
+	}
+	fmt.Fprintf(w, "bluelock_scan_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.scanCount)
+	fmt.Fprintf(w, "bluelock_scan_duration_seconds_sum %g\n", m.scanSum)
+	fmt.Fprintf(w, "bluelock_scan_duration_seconds_count %d\n", m.scanCount)
+}
+
+// writeMetricHeader writes the HELP and TYPE lines for a metric.
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeReasonCounts writes one sample per reason, in a stable order.
+func writeReasonCounts(w io.Writer, name string, counts map[string]int) {
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "%s{reason=%q} %d\n", name, reason, counts[reason])
+	}
+}
+
+// boolMetric converts a bool to a 0/1 sample value.
+func boolMetric(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configVersion is the config file layout this bluelock reads. Files without
+// config_version are version 0.
+const configVersion = 1
+
+// configMigrations each upgrade a config file's values by one version, the
+// first from 0 to 1. They report whether they changed anything.
+var configMigrations = []func(values map[string]any) bool{
+	// 1: durations were plain numbers of seconds, they're "5s" strings now
+	func(values map[string]any) bool {
+		changed := false
+		for name, value := range values {
+			if n, ok := value.(json.Number); ok && isDurationFlag(flag.Lookup(name)) {
+				values[name] = n.String() + "s"
+				changed = true
+			}
+		}
+		return changed
+	},
+}
+
+// migrateConfig brings the values read from path up to configVersion. A JSON
+// file that needed changes is rewritten in place, after copying the original to
+// <path>.v<version>.bak. YAML and TOML files are only upgraded in memory, since
+// rewriting them would lose their comments.
+func migrateConfig(path string, values map[string]any) error {
+	version := 0
+	if raw, ok := values["config_version"]; ok {
+		n, err := strconv.Atoi(fmt.Sprint(raw))
+		if err != nil || n < 0 {
+			return fmt.Errorf("config_version: must be a whole number, not %v", raw)
+		}
+		version = n
+		delete(values, "config_version")
+	}
+	if version > configVersion {
+		return fmt.Errorf("config_version %d is newer than this bluelock understands (%d), upgrade bluelock", version, configVersion)
+	}
+
+	changed := false
+	for v := version; v < configVersion; v++ {
+		if configMigrations[v](values) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".json" {
+		slog.Warn("Config file uses an old layout, update it and set config_version", "path", path, "config_version", version, "current", configVersion)
+		return nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	err := copyFile(path, backup)
+	if err == nil {
+		err = WriteConfigFile(path, values)
+	}
+	if err != nil {
+		slog.Warn("Failed to upgrade the config file, using the upgraded settings for this run only", "path", path, "err", err)
+		return nil
+	}
+	slog.Info("Upgraded config file", "path", path, "from", version, "to", configVersion, "backup", backup)
+	return nil
+}
+
+// WriteConfigFile replaces the JSON config file at path with values, marked
+// with the current config_version. A new file is only readable by its owner,
+// an existing one keeps its permissions.
+func WriteConfigFile(path string, values map[string]any) error {
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	upgraded := map[string]any{"config_version": configVersion}
+	for name, value := range values {
+		upgraded[name] = value
+	}
+	body, err := json.MarshalIndent(upgraded, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(body, '\n'), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// copyFile copies src to dst with the same permissions.
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, info.Mode().Perm())
+}
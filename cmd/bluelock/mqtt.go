@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/proximity"
+)
+
+// mqttKeepAlive is how often the broker expects to hear from us.
+const mqttKeepAlive = 60 * time.Second
+
+// mqttClient is the connection to the broker, nil when MQTT is disabled.
+var mqttClient *MQTTClient
+
+// DefaultMQTTTopicPrefix returns the default topic prefix, bluelock/<hostname>.
+func DefaultMQTTTopicPrefix() string {
+	return "bluelock/" + hostname()
+}
+
+// hostname returns the machine's host name, or "localhost" if it's unknown.
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "localhost"
+	}
+	return name
+}
+
+// StartMQTT connects to mqtt_broker and publishes the desk-presence state under
+// mqtt_topic_prefix, all retained so late subscribers get the current value:
+//
+//	<prefix>/availability  online or offline (the last will)
+//	<prefix>/presence      present or away
+//	<prefix>/rssi          latest RSSI reading
+//	<prefix>/lock          locked or unlocked
+//	<prefix>/event         every lock, unlock and device_lost event as JSON (not retained)
+//
+// With homeassistant set it also announces the entities for Home Assistant and
+// takes LOCK and UNLOCK commands on <prefix>/lock/set.
+func StartMQTT() error {
+	tlsConfig, err := mqttTLSConfig()
+	if err != nil {
+		return err
+	}
+	clientID := MQTTClientID
+	if clientID == "" {
+		clientID = "bluelock-" + hostname()
+	}
+	prefix := MQTTTopicPrefix
+	mqttClient = &MQTTClient{
+		Broker:      MQTTBroker,
+		ClientID:    clientID,
+		Username:    MQTTUsername,
+		Password:    MQTTPassword,
+		TLSConfig:   tlsConfig,
+		KeepAlive:   mqttKeepAlive,
+		WillTopic:   prefix + "/availability",
+		WillPayload: "offline",
+		WillRetain:  true,
+	}
+	mqttClient.OnConnect = func() {
+		// Republish everything, the broker may have lost it or we missed changes
+		if HomeAssistant {
+			publishDiscovery(prefix)
+		}
+		st := CurrentState()
+		publishMQTT(prefix+"/availability", "online", true)
+		publishMQTT(prefix+"/presence", presenceValue(st.InRange), true)
+		publishMQTT(prefix+"/lock", st.Mode, true)
+		if st.Connected {
+			publishMQTT(prefix+"/rssi", strconv.Itoa(st.RSSI), true)
+		}
+	}
+
+	if HomeAssistant {
+		mqttClient.Subscribe(prefix+"/lock/set", handleLockCommand)
+	}
+	for _, provider := range presenceProviders {
+		if p, ok := provider.(*mqttPresence); ok {
+			mqttClient.Subscribe(p.topic, p.receive)
+		}
+	}
+
+	events, _, _ := SubscribeEvents(64)
+	go func() {
+		present := CurrentState().InRange
+		for e := range events {
+			switch e.Type {
+			case EventRSSISample:
+				if e.RSSI != nil {
+					publishMQTT(prefix+"/rssi", strconv.Itoa(*e.RSSI), true)
+				}
+				if inRange := e.RSSI != nil && proximity.InRange(*e.RSSI, CurrentSettings().UnlockRSSI); inRange != present {
+					present = inRange
+					publishMQTT(prefix+"/presence", presenceValue(present), true)
+				}
+			case EventStateChange:
+				publishMQTT(prefix+"/lock", e.To, true)
+			case EventLock, EventUnlock, EventDeviceLost, EventArrived, EventDeparted:
+				if body, err := json.Marshal(e); err == nil {
+					publishMQTT(prefix+"/event", string(body), false)
+				}
+			}
+		}
+	}()
+	go mqttClient.Run()
+	return nil
+}
+
+// StopMQTT marks bluelock offline and leaves the broker on shutdown, rather
+// than leaving that to the last will once the broker notices.
+func StopMQTT() {
+	if mqttClient == nil {
+		return
+	}
+	publishMQTT(MQTTTopicPrefix+"/availability", "offline", true)
+	mqttClient.Disconnect()
+}
+
+// publishMQTT publishes a message, dropping it if the broker is unreachable. The
+// retained state is republished on reconnect.
+func publishMQTT(topic, payload string, retain bool) {
+	if err := mqttClient.Publish(topic, []byte(payload), retain); err != nil {
+		slog.Debug("MQTT publish failed", "topic", topic, "err", err)
+	}
+}
+
+// presenceValue is the presence topic payload.
+func presenceValue(inRange bool) string {
+	if inRange {
+		return "present"
+	}
+	return "away"
+}
+
+// mqttTLSConfig builds the TLS settings from mqtt_ca_file, mqtt_cert_file and
+// mqtt_key_file. It returns nil to use the system roots without a client certificate.
+func mqttTLSConfig() (*tls.Config, error) {
+	if MQTTCAFile == "" && MQTTCertFile == "" {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if MQTTCAFile != "" {
+		pem, err := os.ReadFile(MQTTCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + MQTTCAFile)
+		}
+	}
+	if MQTTCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(MQTTCertFile, MQTTKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types.
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttSubscribe  = 8
+	mqttPingreq    = 12
+	mqttDisconnect = 14
+)
+
+const (
+	mqttDialTimeout = 10 * time.Second // Bounds connecting and each write
+	mqttMaxBackoff  = time.Minute      // Longest wait between reconnects
+)
+
+// MQTTClient is a minimal MQTT 3.1.1 client: it publishes and subscribes at QoS 0
+// and reconnects on its own, resubscribing and calling OnConnect each time.
+type MQTTClient struct {
+	Broker      string // tcp://host:1883, ssl://host:8883 (also mqtt:// and mqtts://)
+	ClientID    string
+	Username    string
+	Password    string
+	TLSConfig   *tls.Config
+	KeepAlive   time.Duration // 0 turns the keep-alive off
+	WillTopic   string        // Last will, published by the broker if we vanish
+	WillPayload string
+	WillRetain  bool
+	OnConnect   func() // Called after every successful connect
+
+	mu            sync.Mutex
+	conn          net.Conn
+	subscriptions map[string]func(topic string, payload []byte)
+	nextID        uint16
+	closed        bool // Disconnect was called
+}
+
+// Run connects to the broker and keeps the connection up until Disconnect.
+func (c *MQTTClient) Run() {
+	backoff := time.Second
+	for {
+		err := c.session()
+		if c.isClosed() {
+			return
+		}
+		slog.Warn("MQTT connection lost", "broker", c.Broker, "err", err, "retry_in", backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > mqttMaxBackoff {
+			backoff = mqttMaxBackoff
+		}
+	}
+}
+
+// session runs a single connection until it fails.
+func (c *MQTTClient) session() error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	if _, err := conn.Write(c.connectPacket()); err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(mqttDialTimeout))
+	kind, body, err := readMQTTPacket(reader)
+	if err != nil {
+		return err
+	}
+	if kind != mqttConnack || len(body) < 2 {
+		return fmt.Errorf("expected CONNACK, got packet type %d", kind)
+	}
+	if body[1] != 0 {
+		return fmt.Errorf("broker refused connection: %s", connackReason(body[1]))
+	}
+	slog.Info("Connected to MQTT broker", "broker", c.Broker)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return errors.New("disconnected")
+	}
+	c.conn = conn
+	filters := make([]string, 0, len(c.subscriptions))
+	for filter := range c.subscriptions {
+		filters = append(filters, filter)
+	}
+	c.mu.Unlock()
+	for _, filter := range filters {
+		if err := c.sendSubscribe(filter); err != nil {
+			return err
+		}
+	}
+	if c.OnConnect != nil {
+		go c.OnConnect()
+	}
+
+	// Ping the broker so it doesn't drop us, and notice when it's gone
+	done := make(chan struct{})
+	defer close(done)
+	if c.KeepAlive > 0 {
+		go func() {
+			ticker := time.NewTicker(c.KeepAlive / 2)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					c.write([]byte{mqttPingreq << 4, 0})
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		var deadline time.Time
+		if c.KeepAlive > 0 {
+			deadline = time.Now().Add(c.KeepAlive * 3 / 2)
+		}
+		conn.SetReadDeadline(deadline)
+		kind, body, err := readMQTTPacket(reader)
+		if err != nil {
+			return err
+		}
+		if kind == mqttPublish {
+			c.dispatch(body)
+		}
+	}
+}
+
+// dial opens the network connection to the broker.
+func (c *MQTTClient) dial() (net.Conn, error) {
+	u, err := url.Parse(c.Broker)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: mqttDialTimeout}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		return dialer.Dial("tcp", hostWithPort(u.Host, "1883"))
+	case "ssl", "tls", "mqtts":
+		config := c.TLSConfig
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName = u.Hostname()
+		}
+		return tls.DialWithDialer(dialer, "tcp", hostWithPort(u.Host, "8883"), config)
+	default:
+		return nil, fmt.Errorf("unsupported MQTT broker scheme %q", u.Scheme)
+	}
+}
+
+// hostWithPort adds port to host unless it already has one.
+func hostWithPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// connectPacket builds the CONNECT packet.
+func (c *MQTTClient) connectPacket() []byte {
+	var flags byte = 0x02 // Clean session
+	var payload []byte
+	payload = appendMQTTString(payload, c.ClientID)
+	if c.WillTopic != "" {
+		flags |= 0x04
+		if c.WillRetain {
+			flags |= 0x20
+		}
+		payload = appendMQTTString(payload, c.WillTopic)
+		payload = appendMQTTString(payload, c.WillPayload)
+	}
+	if c.Username != "" {
+		flags |= 0x80
+		payload = appendMQTTString(payload, c.Username)
+		if c.Password != "" {
+			flags |= 0x40
+			payload = appendMQTTString(payload, c.Password)
+		}
+	}
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(c.KeepAlive/time.Second))
+	return mqttPacket(mqttConnect<<4, append(body, payload...))
+}
+
+// Publish sends a QoS 0 message. It fails when the client isn't connected.
+func (c *MQTTClient) Publish(topic string, payload []byte, retain bool) error {
+	var header byte = mqttPublish << 4
+	if retain {
+		header |= 0x01
+	}
+	body := appendMQTTString(nil, topic)
+	return c.write(mqttPacket(header, append(body, payload...)))
+}
+
+// Subscribe registers handler for messages matching filter, which may contain
+// + and # wildcards. The subscription is renewed on every reconnect.
+func (c *MQTTClient) Subscribe(filter string, handler func(topic string, payload []byte)) {
+	c.mu.Lock()
+	if c.subscriptions == nil {
+		c.subscriptions = map[string]func(string, []byte){}
+	}
+	c.subscriptions[filter] = handler
+	connected := c.conn != nil
+	c.mu.Unlock()
+	if connected {
+		c.sendSubscribe(filter)
+	}
+}
+
+// sendSubscribe sends a SUBSCRIBE packet for filter.
+func (c *MQTTClient) sendSubscribe(filter string) error {
+	c.mu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	c.mu.Unlock()
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendMQTTString(body, filter)
+	body = append(body, 0) // QoS 0
+	return c.write(mqttPacket(mqttSubscribe<<4|0x02, body))
+}
+
+// Connected reports whether the client is connected to the broker now.
+func (c *MQTTClient) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// Disconnect tells the broker we're leaving on purpose, so the will isn't sent,
+// and stops Run from reconnecting.
+func (c *MQTTClient) Disconnect() {
+	c.write([]byte{mqttDisconnect << 4, 0})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// isClosed reports whether Disconnect was called.
+func (c *MQTTClient) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// write sends a packet on the current connection.
+func (c *MQTTClient) write(packet []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return errors.New("not connected to the MQTT broker")
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(mqttDialTimeout))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// dispatch hands an incoming PUBLISH to the matching subscription handlers.
+func (c *MQTTClient) dispatch(body []byte) {
+	if len(body) < 2 {
+		return
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return
+	}
+	topic, payload := string(body[2:2+n]), body[2+n:]
+	c.mu.Lock()
+	var handlers []func(string, []byte)
+	for filter, handler := range c.subscriptions {
+		if mqttTopicMatch(filter, topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	c.mu.Unlock()
+	for _, handler := range handlers {
+		handler(topic, payload)
+	}
+}
+
+// mqttTopicMatch reports whether topic matches a subscription filter.
+func mqttTopicMatch(filter, topic string) bool {
+	f, t := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, part := range f {
+		if part == "#" {
+			return true
+		}
+		if i >= len(t) || (part != "+" && part != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
+
+// readMQTTPacket reads one control packet and returns its type and body. Only
+// QoS 0 is subscribed to, so PUBLISH bodies never carry a packet id.
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("malformed MQTT packet length")
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+// mqttPacket frames body with a fixed header.
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// appendMQTTString appends a length-prefixed UTF-8 string.
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// connackReason explains a CONNACK return code.
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	default:
+		return fmt.Sprintf("code %d", code)
+	}
+}
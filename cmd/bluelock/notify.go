@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Notification urgency levels from the freedesktop notification spec.
+const (
+	UrgencyLow      byte = 0
+	UrgencyNormal   byte = 1
+	UrgencyCritical byte = 2
+)
+
+// errorNotifyInterval limits how often backend errors are shown.
+const errorNotifyInterval = 10 * time.Minute
+
+// Notify shows a desktop notification through org.freedesktop.Notifications and
+// returns its id. A non-zero replaces updates that notification instead of adding one.
+func Notify(summary, body string, urgency byte, replaces uint32) (uint32, error) {
+	return notify(summary, body, "@as []", urgency, replaces)
+}
+
+// NotifyAction shows a desktop notification with a button labelled label,
+// whose press the server signals as ActionInvoked with key.
+func NotifyAction(summary, body string, urgency byte, key, label string) (uint32, error) {
+	return notify(summary, body, "["+GVariantString(key)+", "+GVariantString(label)+"]", urgency, 0)
+}
+
+// notify calls the notification server's Notify with the actions given as
+// GVariant text.
+func notify(summary, body, actions string, urgency byte, replaces uint32) (uint32, error) {
+	reply, err := DBusCall("session", "org.freedesktop.Notifications", "/org/freedesktop/Notifications",
+		"org.freedesktop.Notifications.Notify",
+		GVariantString("bluelock"), strconv.FormatUint(uint64(replaces), 10), GVariantString("bluetooth"),
+		GVariantString(summary), GVariantString(body), actions,
+		fmt.Sprintf("{'urgency': <byte %d>}", urgency), "-1")
+	if err != nil {
+		return 0, err
+	}
+	id, err := ParseDBusUint(reply)
+	return uint32(id), err
+}
+
+// CloseNotification takes down a notification shown by Notify.
+func CloseNotification(id uint32) error {
+	_, err := DBusCall("session", "org.freedesktop.Notifications", "/org/freedesktop/Notifications",
+		"org.freedesktop.Notifications.CloseNotification", strconv.FormatUint(uint64(id), 10))
+	return err
+}
+
+// StartNotifications shows desktop notifications for the event kinds enabled by
+// the notify_* flags.
+func StartNotifications() {
+	events, _, _ := SubscribeEvents(64)
+	go func() {
+		n := &notifier{}
+		for e := range events {
+			n.handle(e)
+		}
+	}()
+}
+
+// notifier turns events into notifications, tracking what it has already shown.
+type notifier struct {
+	errorID     uint32    // Notification reused for backend errors
+	lastErrorAt time.Time // When a backend error was last shown
+	blindID     uint32    // Notification shown while scanning is blind, 0 if none
+	failed      bool      // Whether a notification failure was already logged
+}
+
+func (n *notifier) handle(e Event) {
+	title, body := describeEvent(e)
+	switch e.Type {
+	case EventLock:
+		if e.Reason == ReasonSessionTimeout {
+			if NotifySessionTimeout {
+				n.show(title, body, UrgencyNormal, 0)
+			}
+		} else if NotifyLock {
+			n.show(title, body, UrgencyNormal, 0)
+		}
+	case EventUnlock:
+		if NotifyUnlock {
+			n.show(title, body, UrgencyLow, 0)
+		}
+	case EventLockPending:
+		// The lock warning is opt-in, so it's always shown
+		n.show(title, body, UrgencyCritical, 0)
+	case EventLockFailed:
+		// The screen is open while bluelock thinks it should be locked
+		n.show(title, body, UrgencyCritical, 0)
+	case EventDeviceLost:
+		if NotifyDeviceLost {
+			n.show(title, body, UrgencyNormal, 0)
+		}
+	case EventUnlockArmed:
+		// Without a PIN the notification with the Unlock button says it
+		if UnlockPIN != "" {
+			n.show(title, body, UrgencyCritical, 0)
+		}
+	case EventLeftBehind:
+		// left_behind_after is opt-in, and the point is to be noticed
+		n.show(title, body, UrgencyCritical, 0)
+	case EventArrived, EventDeparted:
+		if NotifyPresence {
+			n.show(title, body, UrgencyLow, 0)
+		}
+	case EventHealth:
+		// Critical notifications stay up, until scanning works again
+		if e.To == HealthBlind && NotifyErrors {
+			n.blindID = n.show(title, body, UrgencyCritical, n.blindID)
+		} else if e.From == HealthBlind && n.blindID != 0 {
+			CloseNotification(n.blindID)
+			n.blindID = 0
+		}
+	case EventError:
+		// While blind the health notification already says scans fail
+		if NotifyErrors && n.blindID == 0 && time.Since(n.lastErrorAt) >= errorNotifyInterval {
+			n.lastErrorAt = time.Now()
+			n.errorID = n.show(title, body, UrgencyCritical, n.errorID)
+		}
+	}
+}
+
+// describeEvent returns a human-readable title and body for an event, shared by
+// desktop notifications and push messages.
+func describeEvent(e Event) (title, body string) {
+	switch e.Type {
+	case EventLock:
+		if e.Reason == ReasonSessionTimeout {
+			return "Session timeout", "The session was locked after " + CurrentSettings().SessionTimeout.String() + "."
+		}
+		return "System locked", "Locked: " + describeReason(e)
+	case EventUnlock:
+		return "System unlocked", "Unlocked: " + describeReason(e)
+	case EventLockPending:
+		return "Locking soon", "Device out of range, " + e.Message + "."
+	case EventLockFailed:
+		return "Lock failed", "The screen could not be locked: " + e.Message
+	case EventLockVetoed:
+		if e.Message != "" {
+			return "Lock deferred", "The session stays unlocked for " + e.Message + " (" + describeReason(e) + ")."
+		}
+		return "Lock vetoed", "A pre-lock hook kept the session unlocked (" + describeReason(e) + ")."
+	case EventDeviceLost:
+		return "Device lost", e.Device + " stopped answering."
+	case EventUnlockArmed:
+		return "Unlock armed", "Device in range, confirm within " + e.Message + " to unlock."
+	case EventLeftBehind:
+		return "Left your phone behind?", e.Device + " hasn't answered for " + e.Message + " while this machine is in use."
+	case EventArrived:
+		return "Device arrived", e.Device + " is near."
+	case EventDeparted:
+		return "Device departed", e.Device + " left."
+	case EventError:
+		return "Bluetooth check failed", e.Message
+	case EventHealth:
+		switch e.To {
+		case HealthBlind:
+			return "bluelock is blind", "Scanning keeps failing, so bluelock can't tell whether the device is there (" + e.Message + ")."
+		case HealthDegraded:
+			return "Bluetooth check degraded", e.Message
+		default:
+			return "Bluetooth check recovered", "Scanning works again."
+		}
+	default:
+		return e.Type, eventDetails(e)
+	}
+}
+
+// show displays a notification and returns its id, logging failures once.
+func (n *notifier) show(summary, body string, urgency byte, replaces uint32) uint32 {
+	id, err := Notify(summary, body, urgency, replaces)
+	if err != nil {
+		if !n.failed {
+			slog.Warn("Failed to show desktop notification", "err", err)
+			n.failed = true
+		}
+		return replaces
+	}
+	n.failed = false
+	return id
+}
+
+// describeReason explains a lock or unlock event in words.
+func describeReason(e Event) string {
+	rssi := ""
+	if e.RSSI != nil {
+		rssi = fmt.Sprintf(" (RSSI %d)", *e.RSSI)
+	}
+	switch e.Reason {
+	case ReasonInRange:
+		return "device in range" + rssi
+	case ReasonOutOfRange:
+		return "device out of range" + rssi
+	case ReasonSessionTimeout:
+		return "session timeout"
+	case ReasonManual:
+		return "requested manually"
+	case ReasonExternal:
+		return "outside bluelock"
+	case ReasonCrash:
+		return "bluelock crashed"
+	case ReasonExit:
+		return "bluelock stopped"
+	case ReasonLockDevice:
+		return "a lock_device came near"
+	case ReasonActive:
+		return "keyboard or mouse in use"
+	case ReasonPeer:
+		return "a peer machine saw you leave"
+	case ReasonElsewhere:
+		return "the device is nearer another machine" + rssi
+	case ReasonConfirmed:
+		return "device in range and confirmed" + rssi
+	default:
+		return e.Reason
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// What on_exit does with the session when the daemon stops.
+const (
+	ExitLeave   = "leave"            // Leave it as it is
+	ExitLock    = "lock"             // Lock it, failing safe
+	ExitRestore = "restore-previous" // Lock or unlock it back to how it was at startup
+)
+
+// modeAtStart is "locked" or "unlocked" as the session was when the daemon
+// started, or empty when that's unknown, for on_exit=restore-previous.
+var modeAtStart string
+
+// recordModeAtStart works out how the session was at startup: from the screen
+// locker where it tells, otherwise from the state saved before a restart.
+func recordModeAtStart(restored bool) {
+	locked, err := sessionLocked()
+	switch {
+	case err == nil && locked:
+		modeAtStart = "locked"
+	case err == nil:
+		modeAtStart = "unlocked"
+	case restored:
+		modeAtStart = CurrentState().Mode
+	case OnExit == ExitRestore:
+		slog.Warn("Can't tell whether the screen is locked, on_exit=restore-previous will leave it as it is", "err", err)
+	}
+}
+
+// applyOnExit carries out on_exit once the monitor loop has stopped. It only
+// unlocks with the device in range at the last check.
+func applyOnExit() {
+	switch OnExit {
+	case ExitLock:
+		exitTo("locked")
+	case ExitRestore:
+		st := CurrentState()
+		if modeAtStart == "" || modeAtStart == st.Mode {
+			return
+		}
+		if modeAtStart == "unlocked" && !st.InRange {
+			// Never open a session that's been left alone
+			slog.Info("Leaving the session locked on exit, the device wasn't in range", "on_exit", OnExit)
+			return
+		}
+		exitTo(modeAtStart)
+	}
+}
+
+// exitTo locks or unlocks the session on the way out. It skips the hooks and
+// away actions, which would be cut short as the daemon exits.
+func exitTo(mode string) {
+	if mode == "locked" {
+		slog.Info("Locking on exit", "on_exit", OnExit)
+		if err := LockSystem(); err != nil {
+			slog.Error("Failed to lock the system on exit", "desktop_env", DesktopEnv, "err", err)
+			return
+		}
+		machine.Mode = "locked"
+		EmitEvent(Event{Type: EventLock, Reason: ReasonExit})
+	} else {
+		slog.Info("Unlocking on exit", "on_exit", OnExit)
+		if err := UnlockSystem(); err != nil {
+			slog.Error("Failed to unlock the system on exit", "desktop_env", DesktopEnv, "err", err)
+			return
+		}
+		machine.UnlockManually(time.Now())
+		EmitEvent(Event{Type: EventUnlock, Reason: ReasonExit})
+	}
+	setMode(mode, ReasonExit)
+}
+
+// applySeatsOnExit carries out on_exit for system mode's seats. Their state at
+// startup isn't known, so only lock applies.
+func applySeatsOnExit(seats []*seat) {
+	if OnExit != ExitLock {
+		return
+	}
+	for _, s := range seats {
+		if s.lock(ReasonExit) == nil {
+			s.machine.LockManually()
+		}
+	}
+}
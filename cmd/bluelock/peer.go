@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Peer mode: bluelock instances sharing a peer_secret tell each other over UDP
+// whether they see the user, so that walking away from one locks them all.
+// Every message is signed with the secret and stamped, and stale or repeated
+// ones are dropped.
+
+// How often peers repeat their presence, and how long a peer's last word
+// counts for the peer presence provider.
+const (
+	peerHeartbeat = 10 * time.Second
+	peerStale     = 3 * peerHeartbeat
+)
+
+// peerMaxSkew is how far a message's time may be from ours, which bounds how
+// long a captured message could be replayed.
+const peerMaxSkew = 30 * time.Second
+
+// peerMessage is what peers send each other.
+type peerMessage struct {
+	ID      string `json:"id"`   // Random per instance, to ignore our own broadcasts
+	Host    string `json:"host"` // For the logs
+	Present bool   `json:"present"`
+	RSSI    *int   `json:"rssi,omitempty"`
+	Event   string `json:"event,omitempty"` // EventDeparted when the user just left this machine
+	Time    int64  `json:"time"`            // Unix nanoseconds
+}
+
+// peerPacket is a peerMessage with its HMAC-SHA256 under peer_secret.
+type peerPacket struct {
+	Message json.RawMessage `json:"message"`
+	MAC     string          `json:"mac"`
+}
+
+// peerSeen is what a peer last said.
+type peerSeen struct {
+	host    string
+	present bool
+	rssi    *int
+	at      time.Time
+}
+
+var (
+	peerConn  net.PacketConn
+	peerID    string
+	peerMu    sync.Mutex
+	peerState = map[string]peerSeen{}  // By peer id
+	peerNonce = map[string]time.Time{} // Messages already seen, by id and time, until they're stale
+)
+
+// StartPeers listens for peers on peer_port and starts telling them our
+// presence.
+func StartPeers() error {
+	if len(PeerSecret) < 16 {
+		return errors.New("peer_secret must be at least 16 characters")
+	}
+	conn, err := net.ListenPacket("udp4", ":"+strconv.Itoa(PeerPort))
+	if err != nil {
+		return err
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	peerConn, peerID = conn, hex.EncodeToString(id)
+	slog.Info("Peer mode on", "port", PeerPort)
+
+	go receivePeers()
+	go func() {
+		for range time.Tick(peerHeartbeat) {
+			sendPeers(CurrentState().InRange, "")
+		}
+	}()
+	return nil
+}
+
+// sendPeers tells the peers whether we see the user, and with EventDeparted
+// that they just left.
+func sendPeers(present bool, event string) {
+	if peerConn == nil {
+		return
+	}
+	message, _ := json.Marshal(peerMessage{ID: peerID, Host: hostname(), Present: present, RSSI: lastRSSI(), Event: event, Time: time.Now().UnixNano()})
+	packet, _ := json.Marshal(peerPacket{Message: message, MAC: peerMAC(message)})
+	for _, addr := range peerAddresses() {
+		if _, err := peerConn.WriteTo(packet, addr); err != nil {
+			slog.Debug("Failed to reach a peer", "addr", addr, "err", err)
+		}
+	}
+}
+
+// peerAddresses resolves peer_address, a host with or without a port, or the
+// local network's broadcast address without one.
+func peerAddresses() []net.Addr {
+	if len(PeerAddresses) == 0 {
+		return []net.Addr{&net.UDPAddr{IP: net.IPv4bcast, Port: PeerPort}}
+	}
+	var addrs []net.Addr
+	for _, peer := range PeerAddresses {
+		if _, _, err := net.SplitHostPort(peer); err != nil {
+			peer = net.JoinHostPort(peer, strconv.Itoa(PeerPort))
+		}
+		addr, err := net.ResolveUDPAddr("udp4", peer)
+		if err != nil {
+			slog.Debug("Failed to resolve a peer", "peer", peer, "err", err)
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// receivePeers reads the peers' messages, locking when one saw the user leave.
+func receivePeers() {
+	buf := make([]byte, 4096)
+	for {
+		n, from, err := peerConn.ReadFrom(buf)
+		if err != nil {
+			slog.Warn("Stopped listening for peers", "err", err)
+			return
+		}
+		m, err := openPeerPacket(buf[:n])
+		if err != nil {
+			slog.Debug("Ignoring a peer message", "from", from, "err", err)
+			continue
+		}
+		if m.ID == peerID {
+			continue
+		}
+		peerMu.Lock()
+		peerState[m.ID] = peerSeen{host: m.Host, present: m.Present, rssi: m.RSSI, at: time.Now()}
+		peerMu.Unlock()
+		if m.Event == EventDeparted {
+			slog.Info("A peer saw you leave", "peer", m.Host)
+			runOnMonitor(func() { lockByPeer(m.Host) })
+		}
+	}
+}
+
+// openPeerPacket checks a packet's signature, age and novelty.
+func openPeerPacket(data []byte) (peerMessage, error) {
+	var packet peerPacket
+	var m peerMessage
+	if err := json.Unmarshal(data, &packet); err != nil {
+		return m, err
+	}
+	mac, err := hex.DecodeString(packet.MAC)
+	if err != nil || !hmac.Equal(mac, peerMACBytes(packet.Message)) {
+		return m, errors.New("bad signature, is peer_secret the same?")
+	}
+	if err := json.Unmarshal(packet.Message, &m); err != nil {
+		return m, err
+	}
+	sent := time.Unix(0, m.Time)
+	if skew := time.Since(sent); skew > peerMaxSkew || skew < -peerMaxSkew {
+		return m, errors.New("too old, or the clocks are off")
+	}
+
+	peerMu.Lock()
+	defer peerMu.Unlock()
+	for nonce, at := range peerNonce {
+		if time.Since(at) > 2*peerMaxSkew {
+			delete(peerNonce, nonce)
+		}
+	}
+	nonce := m.ID + "/" + strconv.FormatInt(m.Time, 10)
+	if _, ok := peerNonce[nonce]; ok {
+		return m, errors.New("replayed")
+	}
+	peerNonce[nonce] = time.Now()
+	return m, nil
+}
+
+// peerMAC signs a message with peer_secret.
+func peerMAC(message []byte) string {
+	return hex.EncodeToString(peerMACBytes(message))
+}
+
+func peerMACBytes(message []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(PeerSecret))
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// lockByPeer locks because a peer saw the user leave. Like a manual lock it
+// holds until the device has left this machine's range too, and someone typing
+// here keeps it unlocked. It runs on the monitor loop.
+func lockByPeer(host string) {
+	if machine.Mode == "locked" || machine.Active {
+		return
+	}
+	if lockSession(ReasonPeer) != nil {
+		return
+	}
+	machine.LockManually()
+	updateState(func(s *DaemonState) { s.ManualLock = true })
+}
+
+// peerPresence is any peer seeing the user lately.
+type peerPresence struct{}
+
+func (peerPresence) Name() string { return "peer" }
+
+func (peerPresence) Present() (bool, error) {
+	peerMu.Lock()
+	defer peerMu.Unlock()
+	heard := false
+	for _, seen := range peerState {
+		if time.Since(seen.at) < peerStale {
+			heard = true
+			if seen.present {
+				return true, nil
+			}
+		}
+	}
+	if !heard {
+		return false, errors.New("no peer heard from lately")
+	}
+	return false, nil
+}
+
+// followMeMargin is how much stronger a peer must see the device for follow_me
+// to hand the session over, so that it doesn't flap between two desks.
+const followMeMargin = 3
+
+// followingPeer is the peer currently nearer the device with follow_me, "" for
+// none. It is only used from the monitor loop.
+var followingPeer string
+
+// followMe tells the peers our RSSI at every check and, when one of them sees
+// the device followMeMargin stronger, counts the user as away here, so only
+// the nearest machine stays unlocked. It reports whether it did.
+func followMe(inRange, away bool) (bool, bool, bool) {
+	if !FollowMe {
+		return inRange, away, false
+	}
+	sendPeers(inRange, "")
+	peer := ""
+	if inRange {
+		peer = nearerPeer()
+	}
+	if peer != followingPeer {
+		if peer != "" {
+			slog.Info("The device is nearer a peer", "peer", peer)
+		} else {
+			slog.Info("The device is nearest here again")
+		}
+		followingPeer = peer
+	}
+	if peer == "" {
+		return inRange, away, false
+	}
+	return false, true, true
+}
+
+// nearerPeer returns the peer that heard the device followMeMargin stronger
+// than we did within the last few checks, "" if none did.
+func nearerPeer() string {
+	ours := lastRSSI()
+	if ours == nil {
+		return ""
+	}
+	fresh := max(3*CheckInterval, 5*time.Second)
+	peerMu.Lock()
+	defer peerMu.Unlock()
+	nearest, best := "", *ours+followMeMargin-1
+	for _, seen := range peerState {
+		if seen.present && seen.rssi != nil && *seen.rssi > best && time.Since(seen.at) < fresh {
+			nearest, best = seen.host, *seen.rssi
+		}
+	}
+	return nearest
+}
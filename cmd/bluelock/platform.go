@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/locker"
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/proximity"
+)
+
+// Scanner measures how close the Bluetooth device is. Each platform has its own,
+// picked by build tags in bluetooth_<os>.go.
+type Scanner = proximity.Scanner
+
+// PairedDevice is a device the system knows, offered by `bluelock setup`.
+// Each platform lists them with PairedDevices in bluetooth_<os>.go.
+type PairedDevice = proximity.PairedDevice
+
+// Locker locks and unlocks the screen and checks that it worked. Each platform
+// has its own, picked by build tags in lock_<os>.go.
+type Locker = locker.Locker
+
+// lockWatcher is implemented by lockers that can follow the screen being locked
+// or unlocked outside bluelock. Watch is called once at startup.
+type lockWatcher = locker.Watcher
+
+// nearbyScanner is implemented by scanners that can list every device in
+// range, which lock_device=unknown needs.
+type nearbyScanner = proximity.NearbyScanner
+
+// NearbyDevice is a device a nearbyScanner sees.
+type NearbyDevice = proximity.NearbyDevice
+
+// The platform's scanner and locker, set up in main.
+var (
+	scanner      Scanner
+	screenLocker Locker
+)
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/proximity"
+)
+
+// PresenceProvider tells whether the user is at the machine, from one source.
+// The monitor loop asks every configured provider each check.
+type PresenceProvider interface {
+	// Name is the provider's name in --presence.
+	Name() string
+	// Present reports whether the source sees the user. err is for the check
+	// itself failing, which doesn't count either way.
+	Present() (present bool, err error)
+}
+
+// connectionChecker is implemented by scanners that can tell whether the
+// device is connected, which the connection provider needs.
+type connectionChecker = proximity.ConnectionChecker
+
+var (
+	// presenceProviders are the providers picked by --presence and named in
+	// unlock_when and lock_when, set up in main.
+	presenceProviders []PresenceProvider
+
+	// unlockWhen and lockWhen are the parsed unlock_when and lock_when. With
+	// neither holding the lock state stays as it is.
+	unlockWhen, lockWhen *presenceExpr
+)
+
+// NewPresenceProvider returns the built-in provider with that name.
+func NewPresenceProvider(name string) (PresenceProvider, error) {
+	switch name {
+	case "bluetooth":
+		return bluetoothPresence{}, nil
+	case "ble":
+		if _, ok := scanner.(nearbyScanner); !ok {
+			return nil, errors.New("presence ble needs a scanner that hears advertisements, use scanner=bluez")
+		}
+		return blePresence{}, nil
+	case "connection":
+		if _, ok := scanner.(connectionChecker); !ok {
+			return nil, errors.New("presence connection isn't available with this scanner")
+		}
+		return connectionPresence{}, nil
+	case "exec":
+		if len(PresenceCommand) == 0 {
+			return nil, errors.New("presence exec needs a presence_command")
+		}
+		return &execPresence{argv: PresenceCommand}, nil
+	case "lan":
+		if len(PresenceHosts) == 0 {
+			return nil, errors.New("presence lan needs a presence_host")
+		}
+		return lanPresence{hosts: PresenceHosts}, nil
+	case "mqtt":
+		if MQTTBroker == "" || PresenceTopic == "" {
+			return nil, errors.New("presence mqtt needs an mqtt_broker and a presence_topic")
+		}
+		return &mqttPresence{topic: PresenceTopic}, nil
+	case "worn":
+		return wornPresence{}, nil
+	case "peer":
+		if PeerSecret == "" {
+			return nil, errors.New("presence peer needs a peer_secret")
+		}
+		return peerPresence{}, nil
+	case "usb":
+		if len(USBTokens) == 0 {
+			return nil, errors.New("presence usb needs a usb_device")
+		}
+		return usbPresence{ids: USBTokens}, nil
+	}
+	return nil, fmt.Errorf("unknown presence provider %q, use bluetooth, ble, connection, exec, lan, mqtt, peer, usb or worn", name)
+}
+
+// presenceNames returns the providers named by --presence, unlock_when and
+// lock_when, each once, or bluetooth when none are.
+func presenceNames() []string {
+	var names []string
+	for _, name := range PresenceNames {
+		names = append(names, strings.TrimSpace(name))
+	}
+	for _, s := range []string{UnlockWhen, LockWhen} {
+		if e, err := parsePresenceExpr(s); err == nil && e != nil {
+			names = e.names(names)
+		}
+	}
+	if len(names) == 0 {
+		return []string{"bluetooth"}
+	}
+	var unique []string
+	for _, name := range names {
+		if !containsFold(unique, name) {
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+// setupPresence creates the providers and parses unlock_when and lock_when.
+// Without unlock_when the user is present while any provider says so, and
+// without lock_when absent when unlock_when doesn't hold. A usb_device that
+// no setting names only keeps the session from locking while it's plugged in.
+func setupPresence() error {
+	presenceProviders = nil
+	names := presenceNames()
+	anchor := len(USBTokens) > 0 && !containsFold(names, "usb")
+	for _, name := range names {
+		provider, err := NewPresenceProvider(name)
+		if err != nil {
+			return err
+		}
+		presenceProviders = append(presenceProviders, provider)
+	}
+	var err error
+	if unlockWhen, err = parsePresenceExpr(UnlockWhen); err != nil {
+		return fmt.Errorf("unlock_when: %v", err)
+	}
+	if unlockWhen == nil {
+		unlockWhen = anyPresent(presenceProviders)
+	}
+	if lockWhen, err = parsePresenceExpr(LockWhen); err != nil {
+		return fmt.Errorf("lock_when: %v", err)
+	}
+	if lockWhen == nil {
+		lockWhen = &presenceExpr{op: "not", args: []*presenceExpr{unlockWhen}}
+	}
+	if anchor {
+		presenceProviders = append(presenceProviders, usbPresence{ids: USBTokens})
+		notUSB := &presenceExpr{op: "not", args: []*presenceExpr{{op: "name", name: "usb"}}}
+		lockWhen = &presenceExpr{op: "and", args: []*presenceExpr{lockWhen, notUSB}}
+	}
+	return nil
+}
+
+// CheckPresence asks every provider and reports whether unlock_when and
+// lock_when hold. Failed providers are reported and count as not seeing the
+// user, and only when all of them failed is the check an error.
+func CheckPresence() (unlock, lock bool, err error) {
+	results := map[string]bool{}
+	var failed []error
+	for _, provider := range presenceProviders {
+		ok, err := provider.Present()
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", provider.Name(), err))
+			continue
+		}
+		results[provider.Name()] = ok
+	}
+	updateState(func(s *DaemonState) { s.Presence = results })
+	if len(failed) > 0 && len(failed) == len(presenceProviders) {
+		return false, false, errors.Join(failed...)
+	}
+	for _, err := range failed {
+		slog.Warn("Presence check failed", "err", err)
+		EmitEvent(Event{Type: EventError, Message: err.Error()})
+	}
+	return unlockWhen.eval(results), lockWhen.eval(results), nil
+}
+
+// devicePresent is whether the user last arrived rather than departed, once
+// presenceKnown. Both are only used from the monitor loop.
+var devicePresent, presenceKnown bool
+
+// reportPresence emits arrived when unlock_when starts to hold and departed
+// when lock_when does, and runs the arrive and depart hooks, whatever that
+// does to the lock. The first check only records where the user is.
+func reportPresence(unlock, lock bool) {
+	if !unlock && !lock {
+		return
+	}
+	if !presenceKnown {
+		presenceKnown, devicePresent = true, unlock
+		return
+	}
+	if unlock == devicePresent {
+		return
+	}
+	devicePresent = unlock
+	if unlock {
+		slog.Info("Device arrived")
+		EmitEvent(Event{Type: EventArrived, Reason: ReasonInRange, RSSI: lastRSSI()})
+		go runHooks(ArriveHooks, "", "arrive", ReasonInRange)
+		sendPeers(true, "")
+	} else {
+		slog.Info("Device departed")
+		EmitEvent(Event{Type: EventDeparted, Reason: ReasonOutOfRange, RSSI: lastRSSI()})
+		go runHooks(DepartHooks, "", "depart", ReasonOutOfRange)
+		sendPeers(false, EventDeparted)
+	}
+}
+
+// bluetoothPresence is the device's RSSI reaching unlock_rssi, the default.
+type bluetoothPresence struct{}
+
+func (bluetoothPresence) Name() string { return "bluetooth" }
+
+func (bluetoothPresence) Present() (bool, error) {
+	return PingBluetoothDevice()
+}
+
+// blePresence is the device's Bluetooth LE advertisements being heard at
+// unlock_rssi, which works without pairing or a connection.
+type blePresence struct{}
+
+func (blePresence) Name() string { return "ble" }
+
+func (blePresence) Present() (bool, error) {
+	devices, err := scanner.(nearbyScanner).Nearby()
+	if err != nil {
+		return false, err
+	}
+	for _, device := range devices {
+		if strings.EqualFold(device.Address, BluetoothDeviceAddress) {
+			slog.Debug("BLE advertisement", "rssi", device.RSSI)
+			return RSSIInRange(device.RSSI), nil
+		}
+	}
+	return false, nil
+}
+
+// connectionPresence is the device being connected at all, whatever its RSSI.
+type connectionPresence struct{}
+
+func (connectionPresence) Name() string { return "connection" }
+
+func (connectionPresence) Present() (bool, error) {
+	return scanner.(connectionChecker).Connected(BluetoothDeviceAddress)
+}
+
+// wornPresence is a smartwatch, worn_device or the tracked device, being worn
+// as its heart rate measurements tell, so a watch left on the desk doesn't
+// count.
+type wornPresence struct{}
+
+func (wornPresence) Name() string { return "worn" }
+
+func (wornPresence) Present() (bool, error) {
+	address := WornDevice
+	if address == "" {
+		address = BluetoothDeviceAddress
+	}
+	return WatchWorn(address)
+}
+
+// usbPresence is one of the usb_device tokens, e.g. a YubiKey, being plugged in.
+type usbPresence struct {
+	ids []string
+}
+
+func (usbPresence) Name() string { return "usb" }
+
+func (u usbPresence) Present() (bool, error) {
+	devices, err := USBDevices()
+	if err != nil {
+		return false, err
+	}
+	for _, device := range devices {
+		if containsFold(u.ids, device) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// presentPayloads are the presence_topic messages that mean present, those of
+// Home Assistant's device trackers and binary sensors among them. Anything
+// else, like not_home or another zone's name, means away.
+var presentPayloads = []string{"home", "present", "on", "true", "1", "occupied", "detected"}
+
+// mqttPresence is presence_topic's last message, e.g. a Home Assistant phone
+// tracker's state. It counts as a failed check before the first message and
+// while the broker is unreachable, when the last one may be out of date.
+type mqttPresence struct {
+	topic string
+
+	mu       sync.Mutex
+	received bool
+	present  bool
+}
+
+func (*mqttPresence) Name() string { return "mqtt" }
+
+func (m *mqttPresence) Present() (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case !mqttClient.Connected():
+		return false, errors.New("not connected to the MQTT broker")
+	case !m.received:
+		return false, fmt.Errorf("nothing on %s yet", m.topic)
+	}
+	return m.present, nil
+}
+
+// receive takes a message on presence_topic.
+func (m *mqttPresence) receive(topic string, payload []byte) {
+	value := strings.TrimSpace(string(payload))
+	present := containsFold(presentPayloads, value)
+	m.mu.Lock()
+	changed := !m.received || present != m.present
+	m.received, m.present = true, present
+	m.mu.Unlock()
+	if changed {
+		slog.Info("MQTT presence", "topic", topic, "value", value, "present", present)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// providerNames are the built-in presence providers.
+var providerNames = []string{"bluetooth", "ble", "connection", "exec", "lan", "mqtt", "peer", "usb", "worn"}
+
+// presenceExpr is a parsed unlock_when or lock_when, combining provider names
+// with AND, OR, NOT and parentheses (also &&, || and !). A provider whose
+// check failed counts as not seeing the user.
+type presenceExpr struct {
+	op   string // "name", "and", "or" or "not"
+	name string
+	args []*presenceExpr
+}
+
+// eval reports whether the expression holds for the providers' answers.
+func (e *presenceExpr) eval(results map[string]bool) bool {
+	switch e.op {
+	case "name":
+		return results[e.name]
+	case "not":
+		return !e.args[0].eval(results)
+	case "and":
+		for _, arg := range e.args {
+			if !arg.eval(results) {
+				return false
+			}
+		}
+		return true
+	default:
+		for _, arg := range e.args {
+			if arg.eval(results) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// names appends the providers the expression refers to.
+func (e *presenceExpr) names(names []string) []string {
+	if e.op == "name" {
+		return append(names, e.name)
+	}
+	for _, arg := range e.args {
+		names = arg.names(names)
+	}
+	return names
+}
+
+// anyPresent is the expression for providers without unlock_when, present
+// while any of them says so.
+func anyPresent(providers []PresenceProvider) *presenceExpr {
+	e := &presenceExpr{op: "or"}
+	for _, provider := range providers {
+		e.args = append(e.args, &presenceExpr{op: "name", name: provider.Name()})
+	}
+	return e
+}
+
+// parsePresenceExpr parses an unlock_when or lock_when, nil when it's empty.
+func parsePresenceExpr(s string) (*presenceExpr, error) {
+	p := &exprParser{tokens: tokenizeExpr(s)}
+	if len(p.tokens) == 0 {
+		return nil, nil
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token != "" {
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+	return e, nil
+}
+
+// tokenizeExpr splits an expression into parentheses, operators and names.
+func tokenizeExpr(s string) []string {
+	for _, op := range []string{"(", ")", "&&", "||", "!"} {
+		s = strings.ReplaceAll(s, op, " "+op+" ")
+	}
+	return strings.Fields(s)
+}
+
+// exprParser is a recursive descent parser where NOT binds tightest, then
+// AND, then OR.
+type exprParser struct {
+	tokens []string
+}
+
+func (p *exprParser) peek() string {
+	if len(p.tokens) == 0 {
+		return ""
+	}
+	return p.tokens[0]
+}
+
+func (p *exprParser) next() string {
+	token := p.peek()
+	if token != "" {
+		p.tokens = p.tokens[1:]
+	}
+	return token
+}
+
+func (p *exprParser) or() (*presenceExpr, error) {
+	return p.binary("or", "||", p.and)
+}
+
+func (p *exprParser) and() (*presenceExpr, error) {
+	return p.binary("and", "&&", p.unary)
+}
+
+// binary parses operands joined by the operator op or its symbol.
+func (p *exprParser) binary(op, symbol string, operand func() (*presenceExpr, error)) (*presenceExpr, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	e := &presenceExpr{op: op, args: []*presenceExpr{first}}
+	for token := p.peek(); strings.EqualFold(token, op) || token == symbol; token = p.peek() {
+		p.next()
+		arg, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		e.args = append(e.args, arg)
+	}
+	if len(e.args) == 1 {
+		return first, nil
+	}
+	return e, nil
+}
+
+func (p *exprParser) unary() (*presenceExpr, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("a provider is missing at the end")
+	case strings.EqualFold(token, "not") || token == "!":
+		arg, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &presenceExpr{op: "not", args: []*presenceExpr{arg}}, nil
+	case token == "(":
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("a ) is missing")
+		}
+		return e, nil
+	case token == ")" || token == "&&" || token == "||":
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+	name := strings.ToLower(token)
+	for _, known := range providerNames {
+		if name == known {
+			return &presenceExpr{op: "name", name: name}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown presence provider %q, use %s", token, strings.Join(providerNames, ", "))
+}
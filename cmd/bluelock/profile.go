@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Profile is a named set of settings from the config file's profiles section,
+// e.g. {"office": {"lock_rssi": -12, "match": {"hostname": ["work-laptop"]}}}.
+// Its settings win over the rest of the config files but not over the command
+// line or the environment.
+type Profile struct {
+	Settings map[string]any
+	Match    ProfileMatch
+}
+
+// ProfileMatch is when --profile=auto picks a profile. Every criterion given
+// must hold, and holds when any of its values does.
+type ProfileMatch struct {
+	Hostname   []string `json:"hostname"`
+	DesktopEnv []string `json:"desktop_env"`
+	SSID       []string `json:"ssid"` // Wi-Fi networks, matched exactly
+}
+
+// autoProfile is the --profile value that picks a profile by its match.
+const autoProfile = "auto"
+
+var (
+	// Profiles is the config files' profiles section, keyed by name.
+	Profiles map[string]Profile
+
+	// activeProfile is the profile whose settings are applied, "" for none.
+	activeProfile string
+)
+
+// profilesSection takes the profiles section out of a config file's values.
+func profilesSection(path string, values map[string]any) (map[string]Profile, error) {
+	raw, ok := values["profiles"]
+	if !ok {
+		return nil, nil
+	}
+	delete(values, "profiles")
+	section, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: profiles must map profile names to settings", path)
+	}
+	profiles := map[string]Profile{}
+	for name, raw := range section {
+		settings, ok := raw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: profiles.%s must map settings to values", path, name)
+		}
+		var profile Profile
+		if match, ok := settings["match"]; ok {
+			data, _ := json.Marshal(match)
+			if err := json.Unmarshal(data, &profile.Match); err != nil {
+				return nil, fmt.Errorf("%s: invalid profiles.%s.match: %v", path, name, err)
+			}
+			delete(settings, "match")
+		}
+		for setting := range settings {
+			switch setting {
+			case "config", "profile", "profiles", "users":
+				return nil, fmt.Errorf("%s: profiles.%s can't set %s", path, name, setting)
+			}
+			if flag.Lookup(setting) == nil {
+				return nil, fmt.Errorf("%s: profiles.%s: unknown setting %q", path, name, setting)
+			}
+		}
+		profile.Settings = settings
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// pickProfile returns the profile to use for --profile=name: that profile, or
+// with auto the first by name whose match holds, or "" when none does.
+func pickProfile(name string, profiles map[string]Profile) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	if name != autoProfile {
+		if _, ok := profiles[name]; !ok {
+			return "", fmt.Errorf("profile: no profile named %q in the config files", name)
+		}
+		return name, nil
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if profiles[name].Match.holds() {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// holds reports whether the match fits this machine. A profile without a
+// match is only used when it's named.
+func (m ProfileMatch) holds() bool {
+	if len(m.Hostname) == 0 && len(m.DesktopEnv) == 0 && len(m.SSID) == 0 {
+		return false
+	}
+	if len(m.Hostname) > 0 {
+		hostname, _ := os.Hostname()
+		if !containsFold(m.Hostname, hostname) {
+			return false
+		}
+	}
+	if len(m.DesktopEnv) > 0 {
+		env := strings.ToUpper(DesktopEnv)
+		if env == "" || env == "AUTO" {
+			env = DetectDesktopEnv()
+		}
+		if !containsFold(m.DesktopEnv, env) {
+			return false
+		}
+	}
+	if len(m.SSID) > 0 {
+		ssid := wifiSSID()
+		found := false
+		for _, want := range m.SSID {
+			found = found || want == ssid
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplyProfile sets the flags from a profile's settings, except those given on
+// the command line or in the environment.
+func ApplyProfile(name string) error {
+	profile := Profiles[name]
+	settings := make([]string, 0, len(profile.Settings))
+	for setting := range profile.Settings {
+		settings = append(settings, setting)
+	}
+	sort.Strings(settings)
+	for _, setting := range settings {
+		if fixedSettings[setting] {
+			continue
+		}
+		if err := setFromConfig(flag.Lookup(setting), profile.Settings[setting]); err != nil {
+			return fmt.Errorf("profiles.%s: invalid %s: %v", name, setting, err)
+		}
+	}
+	return nil
+}
+
+// RunProfileCommand implements `bluelock profile [list]`, which shows the
+// profiles and the active one, and `bluelock profile use <name|auto>`, which
+// makes the user's config file select one. A running daemon switches at its
+// next check.
+func RunProfileCommand(args []string) int {
+	DefineFlags()
+	flag.CommandLine.Parse(canonicalFlagArgs(args))
+	args = flag.Args()
+	if err := LoadSettings(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(args) == 0 || args[0] == "list" && len(args) == 1 {
+		return profileList()
+	}
+	if args[0] != "use" || len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: bluelock profile [list] | use <name|auto>")
+		return 2
+	}
+
+	name := args[1]
+	if name != autoProfile {
+		if _, ok := Profiles[name]; !ok {
+			fmt.Fprintf(os.Stderr, "No profile named %q, see `bluelock profile list`\n", name)
+			return 2
+		}
+	}
+	path, err := updateUserConfig(map[string]any{"profile": name})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Set profile to %s in %s\n", name, path)
+	if fixedSettings["profile"] {
+		fmt.Printf("--profile or %sPROFILE is also given, which wins over the file.\n", envPrefix)
+	} else {
+		fmt.Println("A running bluelock switches at its next check, settings other than " + strings.Join(liveSettings, ", ") + " need a restart.")
+	}
+	return 0
+}
+
+// profileList prints the profiles, marking the active one.
+func profileList() int {
+	if len(Profiles) == 0 {
+		fmt.Println("No profiles in the config files.")
+		return 0
+	}
+	names := make([]string, 0, len(Profiles))
+	for name := range Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		marker := " "
+		if name == activeProfile {
+			marker = "*"
+		}
+		var match []string
+		m := Profiles[name].Match
+		if len(m.Hostname) > 0 {
+			match = append(match, "hostname "+strings.Join(m.Hostname, "|"))
+		}
+		if len(m.DesktopEnv) > 0 {
+			match = append(match, "desktop_env "+strings.Join(m.DesktopEnv, "|"))
+		}
+		if len(m.SSID) > 0 {
+			match = append(match, "ssid "+strings.Join(m.SSID, "|"))
+		}
+		if len(match) > 0 {
+			fmt.Printf("%s %s (auto on %s)\n", marker, name, strings.Join(match, ", "))
+		} else {
+			fmt.Printf("%s %s\n", marker, name)
+		}
+	}
+	if ProfileName == autoProfile {
+		fmt.Println("Picking the profile automatically.")
+	}
+	return 0
+}
+
+// containsFold reports whether list has s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultNtfyServer is used when ntfy_topic is a bare topic name.
+const defaultNtfyServer = "https://ntfy.sh"
+
+// pushPublisher sends a message to a phone push service.
+type pushPublisher struct {
+	name    string
+	publish func(e Event, title, body string) error
+}
+
+// StartPush sends events whose type is in types to ntfy and/or Telegram, depending
+// on which are configured.
+func StartPush(types []string, retries int) {
+	var publishers []pushPublisher
+	if NtfyTopic != "" {
+		publishers = append(publishers, pushPublisher{"ntfy", publishNtfy})
+	}
+	if TelegramBotToken != "" && TelegramChatID != "" {
+		publishers = append(publishers, pushPublisher{"telegram", publishTelegram})
+	}
+	if len(publishers) == 0 {
+		return
+	}
+
+	wanted := map[string]bool{}
+	for _, t := range types {
+		wanted[strings.TrimSpace(t)] = true
+	}
+	events, _, _ := SubscribeEvents(64)
+	go func() {
+		for e := range events {
+			if !wanted[e.Type] {
+				continue
+			}
+			title, body := describeEvent(e)
+			for _, p := range publishers {
+				go func(p pushPublisher) {
+					attempts, err := withRetries(retries, func() error { return p.publish(e, title, body) })
+					if err != nil {
+						slog.Warn("Push notification failed", "service", p.name, "event", e.Type, "attempts", attempts, "err", err)
+					}
+				}(p)
+			}
+		}
+	}()
+}
+
+// ntfyURL returns the publish URL for ntfy_topic, which is either a full URL or a
+// topic name on ntfy.sh.
+func ntfyURL(topic string) string {
+	if strings.HasPrefix(topic, "http://") || strings.HasPrefix(topic, "https://") {
+		return topic
+	}
+	return defaultNtfyServer + "/" + topic
+}
+
+// publishNtfy publishes a message to the configured ntfy topic.
+func publishNtfy(e Event, title, body string) error {
+	req, err := http.NewRequest(http.MethodPost, ntfyURL(NtfyTopic), strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", "bluelock: "+title)
+	req.Header.Set("Tags", "lock,"+e.Type)
+	// A lost device might mean someone took the phone, make it stand out
+	if e.Type == EventDeviceLost || e.Type == EventError {
+		req.Header.Set("Priority", "high")
+	}
+	if NtfyToken != "" {
+		req.Header.Set("Authorization", "Bearer "+NtfyToken)
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkStatus(resp)
+}
+
+// publishTelegram sends a message to the configured chat through the Telegram bot API.
+func publishTelegram(e Event, title, body string) error {
+	endpoint := "https://api.telegram.org/bot" + TelegramBotToken + "/sendMessage"
+	resp, err := webhookClient.PostForm(endpoint, url.Values{
+		"chat_id": {TelegramChatID},
+		"text":    {"bluelock: " + title + "\n" + body},
+	})
+	if err != nil {
+		// The error text contains the URL, keep the bot token out of the logs
+		return errors.New(strings.ReplaceAll(err.Error(), TelegramBotToken, "REDACTED"))
+	}
+	return checkStatus(resp)
+}
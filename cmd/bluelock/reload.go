@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// liveSettings are the settings a running daemon picks up when its config
+// files change, the same ones the API can change. Others need a restart.
+var liveSettings = []string{"bluetooth_device_address", "lock_rssi", "unlock_rssi", "check_interval", "session_timeout", "debug", "schedule", "outside_schedule"}
+
+var (
+	// fixedSettings are the flags given on the command line or in the
+	// environment, which config files don't change.
+	fixedSettings = map[string]bool{}
+
+	// loadedConfig is the signature of the config files last read, and
+	// loadedValues their merged settings.
+	loadedConfig string
+	loadedValues map[string]string
+)
+
+// configSignature identifies the current config files by path, size and
+// modification time, and the profile --profile=auto would pick now.
+func configSignature() string {
+	var parts []string
+	for _, path := range ConfigLayers(UserConfigFile()) {
+		if info, err := os.Stat(path); err == nil {
+			parts = append(parts, fmt.Sprintf("%s:%d:%d", path, info.Size(), info.ModTime().UnixNano()))
+		}
+	}
+	if ProfileName == autoProfile {
+		picked, _ := pickProfile(autoProfile, Profiles)
+		parts = append(parts, "profile="+picked)
+	}
+	return strings.Join(parts, "|")
+}
+
+// mergedConfig reads the config files and returns each setting from the
+// active profile or the most important file that has it, as the text a flag
+// would take, along with the profiles and the name of the active one.
+func mergedConfig() (map[string]string, map[string]Profile, string, error) {
+	merged := map[string]string{}
+	profiles := map[string]Profile{}
+	for _, path := range ConfigLayers(UserConfigFile()) {
+		values, err := ReadConfigFile(path)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		section, err := profilesSection(path, values)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		for name, profile := range section {
+			if _, ok := profiles[name]; !ok {
+				profiles[name] = profile
+			}
+		}
+		for name, value := range values {
+			if _, ok := merged[name]; !ok {
+				merged[name] = fmt.Sprint(value)
+			}
+		}
+	}
+
+	name := ProfileName
+	if !fixedSettings["profile"] {
+		name = flag.Lookup("profile").DefValue
+		if value, ok := merged["profile"]; ok {
+			name = value
+		}
+	}
+	delete(merged, "profile")
+	active, err := pickProfile(name, profiles)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	for setting, value := range profiles[active].Settings {
+		merged[setting] = fmt.Sprint(value)
+	}
+	ProfileName = name
+	return merged, profiles, active, nil
+}
+
+// rememberConfig records the config files just loaded, for ReloadConfig.
+func rememberConfig() {
+	loadedConfig = configSignature()
+	loadedValues, _, _, _ = mergedConfig()
+}
+
+// ReloadConfig applies the live settings again when a config file changed,
+// e.g. through `bluelock config set`, and logs the other changes as needing a
+// restart. It runs on the monitor loop.
+func ReloadConfig() {
+	signature := configSignature()
+	if signature == loadedConfig {
+		return
+	}
+	loadedConfig = signature
+	merged, profiles, active, err := mergedConfig()
+	if err != nil {
+		slog.Warn("Not reloading the changed config file", "err", err)
+		return
+	}
+	previous := loadedValues
+	loadedValues = merged
+	Profiles = profiles
+	loadedConfig = configSignature() // With the profile just picked
+	if active != activeProfile {
+		slog.Info("Switched profile", "from", activeProfile, "to", active)
+		activeProfile = active
+	}
+
+	// A setting left out of every file goes back to its default
+	value := func(name string) (string, bool) {
+		if fixedSettings[name] {
+			return "", false
+		}
+		f := flag.Lookup(name)
+		if v, ok := merged[name]; ok {
+			return bareSeconds(f, v), true
+		}
+		return f.DefValue, true
+	}
+	var update ConfigUpdate
+	var problems []string
+	if v, ok := value("bluetooth_device_address"); ok {
+		update.BluetoothDeviceAddress = &v
+	}
+	for _, name := range []string{"lock_rssi", "unlock_rssi"} {
+		if v, ok := value(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				problems = append(problems, name)
+				continue
+			}
+			if name == "lock_rssi" {
+				update.LockRSSI = &n
+			} else {
+				update.UnlockRSSI = &n
+			}
+		}
+	}
+	if v, ok := value("check_interval"); ok {
+		update.CheckInterval = &v
+	}
+	if v, ok := value("session_timeout"); ok {
+		update.SessionTimeout = &v
+	}
+	if v, ok := value("schedule"); ok {
+		update.Schedule = &v
+	}
+	if v, ok := value("outside_schedule"); ok {
+		update.OutsideSchedule = &v
+	}
+	if v, ok := value("debug"); ok {
+		debug, err := strconv.ParseBool(v)
+		if err != nil {
+			problems = append(problems, "debug")
+		} else {
+			update.Debug = &debug
+		}
+	}
+	if len(problems) > 0 {
+		slog.Warn("Not reloading the changed config file", "invalid", strings.Join(problems, ","))
+		return
+	}
+	if err := applyConfigUpdate(update); err != nil {
+		slog.Warn("Not reloading the changed config file", "err", err)
+		return
+	}
+	slog.Info("Reloaded the config file", "path", UserConfigFile())
+
+	var restart []string
+	for name := range merged {
+		if merged[name] != previous[name] && !isLiveSetting(name) {
+			restart = append(restart, name)
+		}
+	}
+	for name := range previous {
+		if _, ok := merged[name]; !ok && !isLiveSetting(name) {
+			restart = append(restart, name)
+		}
+	}
+	if len(restart) > 0 {
+		sort.Strings(restart)
+		slog.Warn("Restart bluelock to apply the other changed settings", "settings", strings.Join(restart, ","))
+	}
+}
+
+// isLiveSetting reports whether name is one of liveSettings.
+func isLiveSetting(name string) bool {
+	for _, live := range liveSettings {
+		if name == live {
+			return true
+		}
+	}
+	return false
+}
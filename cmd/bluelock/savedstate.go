@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SavedState is the part of the daemon state kept in a state file across
+// restarts, so a crash or an upgrade in the middle of a pause neither relocks
+// at once nor forgets the pause.
+type SavedState struct {
+	Device       string    `json:"device"` // Only restored for the same device
+	Boot         string    `json:"boot,omitempty"`
+	Mode         string    `json:"mode"`
+	ManualLock   bool      `json:"manual_lock"`
+	LastUnlocked time.Time `json:"last_unlocked"` // For session_timeout
+	PausedUntil  time.Time `json:"paused_until"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// savedStateFile is where the state is kept.
+func savedStateFile() string {
+	return stateFile("state.json")
+}
+
+// bootID identifies the current boot where the system tells, so the lock mode
+// from before a reboot isn't restored into a fresh session.
+func bootID() string {
+	data, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// lastSaved is what saveState last wrote. It is only used from the monitor loop.
+var lastSaved SavedState
+
+// saveState writes the state file when the state changed since the last time,
+// with the last-seen time to the minute so a device in range doesn't rewrite
+// it at every check.
+func saveState() {
+	st := CurrentState()
+	s := SavedState{
+		Device:       st.Device,
+		Boot:         bootID(),
+		Mode:         machine.Mode,
+		ManualLock:   machine.ManualLock,
+		LastUnlocked: machine.LastUnlockedTime.Round(0),
+		PausedUntil:  st.PausedUntil.Round(0),
+		LastSeen:     st.LastSeen.Truncate(time.Minute),
+	}
+	if s == lastSaved {
+		return
+	}
+	// Warn once per change rather than at every check
+	lastSaved = s
+	data, _ := json.MarshalIndent(s, "", "  ")
+	path := savedStateFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		slog.Warn("Failed to save the state", "err", err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		slog.Warn("Failed to save the state", "err", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		slog.Warn("Failed to save the state", "err", err)
+	}
+}
+
+// readSavedState returns the state saved before the daemon last stopped, or
+// nil when there is none.
+func readSavedState() (*SavedState, error) {
+	data, err := os.ReadFile(savedStateFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var s SavedState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %v", savedStateFile(), err)
+	}
+	return &s, nil
+}
+
+// restoreState picks up where the daemon was before it stopped: a pause that
+// hasn't run out and when the device was last seen, and since the same boot
+// whether it was locked or unlocked. It's called once at startup, before the
+// monitor loop runs, and reports whether it restored the lock mode.
+func restoreState(now time.Time) bool {
+	s, err := readSavedState()
+	if err != nil {
+		slog.Warn("Failed to read the saved state", "err", err)
+		return false
+	}
+	if s == nil {
+		return false
+	}
+	if !strings.EqualFold(s.Device, BluetoothDeviceAddress) {
+		slog.Info("Not restoring the state saved for another device", "device", s.Device)
+		return false
+	}
+	// Where the boot can't be told apart, it's taken as a new one
+	boot := bootID()
+	sameBoot := boot != "" && s.Boot == boot && (s.Mode == "locked" || s.Mode == "unlocked")
+	if sameBoot {
+		machine.Mode, machine.ManualLock = s.Mode, s.ManualLock
+		if !s.LastUnlocked.IsZero() {
+			machine.LastUnlockedTime = s.LastUnlocked
+		}
+	}
+	updateState(func(st *DaemonState) {
+		if sameBoot {
+			st.Mode, st.ManualLock = s.Mode, s.ManualLock
+		}
+		if s.PausedUntil.After(now) {
+			st.PausedUntil = s.PausedUntil
+		}
+		st.LastSeen = s.LastSeen
+	})
+	lastSaved = *s
+	args := []any{"last_seen", s.LastSeen}
+	if sameBoot {
+		args = append(args, "mode", s.Mode)
+	}
+	if s.PausedUntil.After(now) {
+		args = append(args, "paused_until", s.PausedUntil.Format(time.DateTime))
+	}
+	slog.Info("Restored the state from before the restart", args...)
+	return sameBoot
+}
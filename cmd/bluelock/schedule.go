@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// What bluelock does outside its schedule.
+const (
+	OutsideIdle     = "idle"      // Neither lock nor unlock
+	OutsideLockOnly = "lock_only" // Lock as usual but never unlock
+)
+
+// scheduleWindow is one part of a schedule, such as "Mon-Fri 08:00-18:00".
+type scheduleWindow struct {
+	days       [7]bool // Indexed by time.Weekday
+	start, end int     // Minutes after midnight, end may be before start to go past midnight
+}
+
+// weekdays are the day names a schedule takes.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseSchedule parses windows separated by semicolons, each days (Mon-Fri,
+// Sat,Sun, or left out for every day) followed by a time range, e.g.
+// "Mon-Fri 08:00-18:00; Sat 10:00-14:00". An empty schedule is always on.
+func parseSchedule(spec string) ([]scheduleWindow, error) {
+	var windows []scheduleWindow
+	for _, part := range strings.Split(spec, ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 || !strings.Contains(fields[len(fields)-1], ":") {
+			return nil, fmt.Errorf("%q: use days and a time range, like Mon-Fri 08:00-18:00", strings.TrimSpace(part))
+		}
+		var w scheduleWindow
+		if len(fields) == 1 {
+			w.days = [7]bool{true, true, true, true, true, true, true}
+		} else if err := w.parseDays(fields[0]); err != nil {
+			return nil, err
+		}
+		from, to, ok := strings.Cut(fields[len(fields)-1], "-")
+		var err error
+		if !ok {
+			return nil, fmt.Errorf("%q: the time range needs a start and an end, like 08:00-18:00", fields[len(fields)-1])
+		}
+		if w.start, err = parseClock(from); err != nil {
+			return nil, err
+		}
+		if w.end, err = parseClock(to); err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// parseDays parses "Mon-Fri", "Sat,Sun" or a mix such as "Mon,Wed-Fri".
+func (w *scheduleWindow) parseDays(text string) error {
+	for _, item := range strings.Split(text, ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		first, ok := weekdays[strings.ToLower(from)]
+		if !ok {
+			return fmt.Errorf("%q isn't a day, use Mon, Tue, Wed, Thu, Fri, Sat or Sun", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[strings.ToLower(to)]; !ok {
+				return fmt.Errorf("%q isn't a day, use Mon, Tue, Wed, Thu, Fri, Sat or Sun", to)
+			}
+		}
+		// Ranges may wrap around the week, as in Fri-Mon
+		for day := first; ; day = (day + 1) % 7 {
+			w.days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock parses a time of day such as 08:00 into minutes after midnight.
+func parseClock(text string) (int, error) {
+	t, err := time.Parse("15:04", text)
+	if err != nil {
+		if text == "24:00" {
+			return 24 * 60, nil
+		}
+		return 0, fmt.Errorf("%q isn't a time of day, use HH:MM", text)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether t falls in the window. A window past midnight
+// belongs to the day it starts on.
+func (w scheduleWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return w.days[t.Weekday()] && minute >= w.start && minute < w.end
+	}
+	yesterday := (t.Weekday() + 6) % 7
+	return w.days[t.Weekday()] && minute >= w.start || w.days[yesterday] && minute < w.end
+}
+
+// inSchedule reports whether bluelock enforces at t, which it always does
+// without a schedule.
+func inSchedule(t time.Time) bool {
+	windows, err := parseSchedule(Schedule)
+	if err != nil || len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// outsideSchedule returns what to do now: "" inside the schedule, or
+// OutsideIdle or OutsideLockOnly. It logs when that changes.
+func outsideSchedule(now time.Time) string {
+	outside := ""
+	if !inSchedule(now) {
+		outside = OutsideSchedule
+	}
+	if outside != CurrentState().OutsideSchedule {
+		updateState(func(s *DaemonState) { s.OutsideSchedule = outside })
+		switch outside {
+		case "":
+			slog.Info("Schedule started, locking and unlocking", "schedule", Schedule)
+		case OutsideLockOnly:
+			slog.Info("Outside the schedule, locking but not unlocking", "schedule", Schedule)
+		default:
+			slog.Info("Outside the schedule, idling", "schedule", Schedule)
+		}
+	}
+	return outside
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends a state such as READY=1 to systemd's notification socket. It
+// does nothing when we weren't started by systemd with Type=notify.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	// A leading @ means an abstract socket
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		slog.Debug("Failed to notify systemd", "state", state, "err", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Debug("Failed to notify systemd", "state", state, "err", err)
+	}
+}
+
+// watchdogInterval returns how often systemd wants WATCHDOG=1, half of
+// WatchdogSec= to leave room, or 0 when the watchdog is off.
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// pingWatchdog tells systemd the monitor loop is still turning. If a scan hangs
+// the pings stop and systemd restarts us.
+func pingWatchdog() {
+	if watchdogInterval() > 0 {
+		sdNotify("WATCHDOG=1")
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How setup calibrates: a few readings at the desk, then a while walking away.
+const (
+	setupNearSamples  = 5
+	setupAwayDuration = 20 * time.Second
+	setupSampleEvery  = 2 * time.Second
+)
+
+// setupMargin is how far below the weakest reading at the desk the threshold
+// goes when the device dropped out entirely while away.
+const setupMargin = 3
+
+// RunSetupCommand implements `bluelock setup`, which asks for the device, checks
+// the desktop environment, calibrates the RSSI thresholds and writes the user's
+// config file. bluelock runs it on its own when started without a config in a
+// terminal.
+func RunSetupCommand(args []string) int {
+	DefineFlags()
+	flag.CommandLine.Parse(canonicalFlagArgs(args))
+	if err := LoadSettings(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	in := bufio.NewReader(os.Stdin)
+	fmt.Println("Setting up bluelock. Press Ctrl-C at any time to stop without saving.")
+	settings := map[string]any{}
+
+	// The device
+	fmt.Println()
+	device, ok := setupDevice(in)
+	if !ok {
+		return 1
+	}
+	settings["bluetooth_device_address"] = device
+	BluetoothDeviceAddress = device
+
+	// The desktop
+	detected := DetectDesktopEnv()
+	fmt.Printf("\nThe desktop environment looks like %s.\n", detected)
+	if env := strings.ToUpper(prompt(in, "Press Enter to use it, or type another (GNOME, KDE, SWAY, ...): ")); env != "" && env != detected {
+		settings["desktop_env"] = env
+	}
+
+	// The thresholds
+	fmt.Println()
+	if rssi, ok := setupCalibrate(in, device); ok {
+		settings["lock_rssi"] = json.Number(strconv.Itoa(rssi))
+		settings["unlock_rssi"] = json.Number(strconv.Itoa(rssi))
+	}
+
+	path, err := updateUserConfig(settings)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("\nWrote", path)
+
+	if runtime.GOOS == "linux" && setupYes(in, "Install and start the systemd user unit now? [Y/n] ") {
+		return RunInstallCommand(nil)
+	}
+	fmt.Println("Run bluelock to start it.")
+	return 0
+}
+
+// setupDevice offers the paired devices and returns the one picked, or an
+// address typed in.
+func setupDevice(in *bufio.Reader) (string, bool) {
+	devices, err := PairedDevices()
+	if err != nil {
+		fmt.Println("Couldn't list the paired devices:", err)
+	}
+	if len(devices) > 0 {
+		fmt.Println("Paired devices:")
+		for i, device := range devices {
+			fmt.Printf("  %d) %s  %s\n", i+1, device.Address, device.Name)
+		}
+	} else {
+		fmt.Println("No paired devices found, pair your phone first or type its address.")
+	}
+	for {
+		fmt.Print("Device number or address: ")
+		line, err := in.ReadString('\n')
+		if err != nil {
+			fmt.Println()
+			return "", false
+		}
+		answer := strings.TrimSpace(line)
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(devices) {
+			return strings.ToUpper(devices[n-1].Address), true
+		}
+		if bluetoothAddress.MatchString(answer) {
+			return strings.ToUpper(answer), true
+		}
+		fmt.Println("That's neither a number from the list nor an address like AA:BB:CC:DD:EE:FF.")
+	}
+}
+
+// setupCalibrate reads the device's RSSI at the desk and while walking away,
+// and returns a threshold between the two.
+func setupCalibrate(in *bufio.Reader, device string) (int, bool) {
+	var s Scanner = helperScanner{socket: BluetoothHelper}
+	if BluetoothHelper == "" {
+		var err error
+		if s, err = NewScanner(); err != nil {
+			fmt.Println("Skipping calibration:", err)
+			return 0, false
+		}
+	}
+	if !setupYes(in, "Calibrate the signal thresholds now? Keep the device at your desk. [Y/n] ") {
+		return 0, false
+	}
+
+	near, ok := setupSample(s, device, setupNearSamples*setupSampleEvery)
+	if !ok {
+		fmt.Println("The device didn't answer at the desk, so the default thresholds stay. Is it connected?")
+		return 0, false
+	}
+	nearMin := near[0]
+	for _, rssi := range near {
+		nearMin = min(nearMin, rssi)
+	}
+	fmt.Printf("At the desk: %s\n", joinRSSI(near))
+
+	prompt(in, fmt.Sprintf("Press Enter, then walk away for %s with the device.", setupAwayDuration))
+	far, ok := setupSample(s, device, setupAwayDuration)
+	rssi := nearMin - setupMargin
+	if ok {
+		farMax := far[0]
+		for _, r := range far {
+			farMax = max(farMax, r)
+		}
+		fmt.Printf("Away: %s\n", joinRSSI(far))
+		if farMax >= nearMin {
+			fmt.Println("The signal away was as strong as at the desk, so the threshold may need tuning later.")
+		} else {
+			rssi = (nearMin + farMax + 1) / 2
+		}
+	} else {
+		fmt.Println("Away: the device dropped out")
+	}
+	fmt.Printf("Locking and unlocking at RSSI %d.\n", rssi)
+	return rssi, true
+}
+
+// setupSample reads the RSSI every setupSampleEvery for d, printing progress,
+// and returns the readings the device answered.
+func setupSample(s Scanner, device string, d time.Duration) ([]int, bool) {
+	var readings []int
+	for deadline := time.Now().Add(d); time.Now().Before(deadline); time.Sleep(setupSampleEvery) {
+		rssi, found, err := s.ReadRSSI(device)
+		switch {
+		case err != nil:
+			fmt.Print("!")
+		case !found:
+			fmt.Print("-")
+		default:
+			fmt.Print(".")
+			readings = append(readings, rssi)
+		}
+	}
+	fmt.Println()
+	return readings, len(readings) > 0
+}
+
+// needsSetup reports whether bluelock was started bare in a terminal with
+// nothing telling it which device to watch.
+func needsSetup() bool {
+	if len(os.Args) > 1 || UserConfigFile() != "" || SystemConfigFile() != "" || os.Getenv(envPrefix+"BLUETOOTH_DEVICE_ADDRESS") != "" {
+		return false
+	}
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// prompt asks a question and returns the trimmed answer.
+func prompt(in *bufio.Reader, question string) string {
+	fmt.Print(question)
+	answer, _ := in.ReadString('\n')
+	return strings.TrimSpace(answer)
+}
+
+// setupYes asks a yes/no question that defaults to yes.
+func setupYes(in *bufio.Reader, question string) bool {
+	answer := strings.ToLower(prompt(in, question))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// joinRSSI formats readings for display.
+func joinRSSI(readings []int) string {
+	parts := make([]string, len(readings))
+	for i, rssi := range readings {
+		parts[i] = strconv.Itoa(rssi)
+	}
+	return strings.Join(parts, " ")
+}
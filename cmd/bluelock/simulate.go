@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TraceSample is a single recorded scan. Found is false when the device didn't answer.
+type TraceSample struct {
+	Time  time.Time
+	RSSI  int
+	Found bool
+}
+
+// RunSimulateCommand implements `bluelock simulate`, replaying a recorded RSSI trace
+// through the state machine and reporting when it would have locked or unlocked.
+func RunSimulateCommand(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	trace := fs.String("trace", "", "RSSI trace from `bluelock export` (CSV or JSON)")
+	fs.IntVar(&LockRSSI, "lock_rssi", defaultLockRSSI, "RSSI value to lock the system")
+	fs.IntVar(&UnlockRSSI, "unlock_rssi", defaultUnlockRSSI, "RSSI value to unlock the system")
+	fs.DurationVar(&SessionTimeout, "session_timeout", defaultSessionTimeout, "Session timeout duration")
+	fs.DurationVar(&LockWarning, "lock_warning", defaultLockWarning, "Warn this long before locking when the device leaves, 0 to lock at once")
+	fs.Parse(args)
+
+	if *trace == "" {
+		fmt.Fprintln(os.Stderr, "--trace is required")
+		return 2
+	}
+	samples, err := LoadTrace(*trace)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load trace:", err)
+		return 1
+	}
+	if len(samples) == 0 {
+		fmt.Fprintln(os.Stderr, "The trace contains no RSSI samples.")
+		return 1
+	}
+
+	fmt.Printf("Simulating %d samples from %s to %s (lock_rssi=%d, unlock_rssi=%d, session_timeout=%s, lock_warning=%s)\n\n",
+		len(samples), samples[0].Time.Format("2006-01-02 15:04:05"), samples[len(samples)-1].Time.Format("2006-01-02 15:04:05"),
+		LockRSSI, UnlockRSSI, SessionTimeout, LockWarning)
+
+	counts := map[string]map[string]int{ActionLock: {}, ActionUnlock: {}, ActionWarn: {}}
+	machine := NewStateMachine(samples[0].Time)
+	for _, sample := range samples {
+		inRange := sample.Found && RSSIInRange(sample.RSSI)
+		action, reason := machine.Step(sample.Time, inRange, false)
+		if action == ActionNone {
+			continue
+		}
+		if counts[action] != nil {
+			counts[action][reason]++
+		}
+		rssi := "none"
+		if sample.Found {
+			rssi = strconv.Itoa(sample.RSSI)
+		}
+		fmt.Printf("%s  %-11s  rssi=%-5s reason=%s\n", sample.Time.Format("2006-01-02 15:04:05"), strings.ToUpper(action), rssi, reason)
+	}
+
+	fmt.Println()
+	fmt.Printf("Locks:   %s\n", summarizeCounts(counts[ActionLock]))
+	fmt.Printf("Unlocks: %s\n", summarizeCounts(counts[ActionUnlock]))
+	if LockWarning > 0 {
+		fmt.Printf("Warnings: %s\n", summarizeCounts(counts[ActionWarn]))
+	}
+	return 0
+}
+
+// summarizeCounts formats per-reason counts as "3 (out_of_range: 2, session_timeout: 1)".
+func summarizeCounts(counts map[string]int) string {
+	total := 0
+	var parts []string
+	for reason, n := range counts {
+		total += n
+		parts = append(parts, fmt.Sprintf("%s: %d", reason, n))
+	}
+	if total == 0 {
+		return "0"
+	}
+	sort.Strings(parts)
+	return fmt.Sprintf("%d (%s)", total, strings.Join(parts, ", "))
+}
+
+// LoadTrace reads RSSI samples from a CSV or JSON file written by `bluelock export`.
+// CSV files only need "time" and "rssi" columns; an empty rssi means no answer.
+func LoadTrace(path string) ([]TraceSample, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var samples []TraceSample
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		samples, err = readJSONTrace(file)
+	} else {
+		samples, err = readCSVTrace(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+	return samples, nil
+}
+
+// readJSONTrace reads the rssi_sample events from a JSON array of events.
+func readJSONTrace(r io.Reader) ([]TraceSample, error) {
+	var events []Event
+	if err := json.NewDecoder(r).Decode(&events); err != nil {
+		return nil, err
+	}
+	var samples []TraceSample
+	for _, e := range events {
+		if e.Type != EventRSSISample {
+			continue
+		}
+		sample := TraceSample{Time: e.Time}
+		if e.RSSI != nil {
+			sample.RSSI, sample.Found = *e.RSSI, true
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// readCSVTrace reads samples from a CSV file with a header row.
+func readCSVTrace(r io.Reader) ([]TraceSample, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	timeCol, ok := columns["time"]
+	if !ok {
+		return nil, errors.New(`missing "time" column`)
+	}
+	rssiCol, ok := columns["rssi"]
+	if !ok {
+		return nil, errors.New(`missing "rssi" column`)
+	}
+	typeCol, hasType := columns["type"]
+
+	var samples []TraceSample
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(i int) string {
+			if i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		// Exported traces contain every event type, only samples matter here
+		if hasType && field(typeCol) != EventRSSISample {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, field(timeCol))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid time %q", line, field(timeCol))
+		}
+		sample := TraceSample{Time: t}
+		if value := field(rssiCol); value != "" {
+			if sample.RSSI, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("line %d: invalid rssi %q", line, value)
+			}
+			sample.Found = true
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
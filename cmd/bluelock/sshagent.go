@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// What ssh_agent does to the ssh agent on departure.
+const (
+	SSHAgentLock   = "lock"   // ssh-add -x, unlocked again on return
+	SSHAgentDelete = "delete" // ssh-add -D, for good
+)
+
+// askpassEnv hands the agent's lock password to bluelock when ssh-add runs it
+// as SSH_ASKPASS.
+const askpassEnv = "BLUELOCK_ASKPASS"
+
+// sshAgentPassword is the password bluelock locked the agent with, "" while
+// it hasn't.
+var sshAgentPassword string
+
+// runAskpass answers ssh-add's password prompt when bluelock runs as its
+// SSH_ASKPASS, and reports whether it did.
+func runAskpass() bool {
+	password := os.Getenv(askpassEnv)
+	if password == "" {
+		return false
+	}
+	fmt.Println(password)
+	return true
+}
+
+// LockSSHAgent locks the agent with a random password, or with
+// SSHAgentDelete removes its identities.
+func LockSSHAgent(mode string) error {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return errors.New("SSH_AUTH_SOCK isn't set, so there's no agent to lock")
+	}
+	if mode == SSHAgentDelete {
+		return sshAdd([]string{"-D"}, "")
+	}
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	password := hex.EncodeToString(secret)
+	if err := sshAdd([]string{"-x"}, password); err != nil {
+		return err
+	}
+	sshAgentPassword = password
+	return nil
+}
+
+// UnlockSSHAgent unlocks the agent if bluelock locked it. The password is kept
+// until that worked.
+func UnlockSSHAgent() error {
+	if sshAgentPassword == "" {
+		return nil
+	}
+	if err := sshAdd([]string{"-X"}, sshAgentPassword); err != nil {
+		// Keep the password to try again at the next unlock
+		return err
+	}
+	sshAgentPassword = ""
+	return nil
+}
+
+// sshAdd runs ssh-add, answering its password prompts with password.
+func sshAdd(args []string, password string) error {
+	var env []string
+	if password != "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		env = []string{"SSH_ASKPASS=" + exe, "SSH_ASKPASS_REQUIRE=force", askpassEnv + "=" + password}
+	}
+	if out, err := RunCommand(append([]string{"ssh-add"}, args...), lockCommandTimeout, env); err != nil {
+		return fmt.Errorf("ssh-add: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
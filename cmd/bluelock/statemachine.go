@@ -0,0 +1,38 @@
+package main
+
+import (
+	"time"
+
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/proximity"
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/statemachine"
+)
+
+// StateMachine is the lock state machine the daemon, system mode and
+// `bluelock simulate` drive.
+type StateMachine = statemachine.StateMachine
+
+// Actions the state machine can ask for after a check.
+const (
+	ActionNone       = statemachine.ActionNone
+	ActionLock       = statemachine.ActionLock
+	ActionUnlock     = statemachine.ActionUnlock
+	ActionWarn       = statemachine.ActionWarn
+	ActionCancelLock = statemachine.ActionCancelLock
+)
+
+// NewStateMachine returns a state machine in its initial, locked state, with
+// the current settings.
+func NewStateMachine(now time.Time) *StateMachine {
+	return statemachine.New(now, SessionTimeout, LockWarning, MaxLockVeto)
+}
+
+// syncMachine gives m the current settings, which the API and config reloads
+// change while it runs.
+func syncMachine(m *StateMachine) {
+	m.SessionTimeout, m.LockWarning, m.MaxLockVeto = SessionTimeout, LockWarning, MaxLockVeto
+}
+
+// RSSIInRange reports whether rssi is strong enough for the device to count as present.
+func RSSIInRange(rssi int) bool {
+	return proximity.InRange(rssi, UnlockRSSI)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// DayStats counts the locks and unlocks of one day.
+type DayStats struct {
+	Day     string
+	Locks   int
+	Unlocks int
+}
+
+// Stats summarizes recorded history.
+type Stats struct {
+	From, To        time.Time
+	Samples         int
+	Answered        int
+	Percentiles     map[int]int // RSSI by percentile, over answered samples
+	Days            []DayStats
+	Locks           int
+	LocksByReason   map[string]int
+	FalseLocks      int
+	DepartureLocks  int
+	TimeToLockTotal time.Duration
+}
+
+// statsPercentiles are the RSSI percentiles reported by `bluelock stats`.
+var statsPercentiles = []int{5, 25, 50, 75, 95}
+
+// ComputeStats summarizes events, which must be oldest first. A departure starts
+// at the last sample at or above unlockRSSI before an out-of-range lock; a lock
+// counts as false when an unlock follows within falseLockWindow.
+func ComputeStats(events []Event, unlockRSSI int, falseLockWindow time.Duration) Stats {
+	stats := Stats{Percentiles: map[int]int{}, LocksByReason: map[string]int{}}
+	if len(events) == 0 {
+		return stats
+	}
+	stats.From, stats.To = events[0].Time, events[len(events)-1].Time
+
+	var rssis []int
+	days := map[string]*DayStats{}
+	day := func(t time.Time) *DayStats {
+		key := t.Local().Format("2006-01-02")
+		if days[key] == nil {
+			days[key] = &DayStats{Day: key}
+		}
+		return days[key]
+	}
+
+	var lastPresent time.Time
+	var pendingLock *Event
+	for i := range events {
+		e := &events[i]
+		switch e.Type {
+		case EventRSSISample:
+			stats.Samples++
+			if e.RSSI != nil {
+				stats.Answered++
+				rssis = append(rssis, *e.RSSI)
+				if *e.RSSI >= unlockRSSI {
+					lastPresent = e.Time
+				}
+			}
+		case EventLock:
+			stats.Locks++
+			stats.LocksByReason[e.Reason]++
+			day(e.Time).Locks++
+			if e.Reason == ReasonOutOfRange && !lastPresent.IsZero() {
+				stats.DepartureLocks++
+				stats.TimeToLockTotal += e.Time.Sub(lastPresent)
+			}
+			pendingLock = e
+		case EventUnlock:
+			day(e.Time).Unlocks++
+			if pendingLock != nil && e.Time.Sub(pendingLock.Time) <= falseLockWindow {
+				stats.FalseLocks++
+			}
+			pendingLock = nil
+		}
+	}
+
+	sort.Ints(rssis)
+	for _, p := range statsPercentiles {
+		if len(rssis) > 0 {
+			stats.Percentiles[p] = percentile(rssis, p)
+		}
+	}
+	for _, d := range days {
+		stats.Days = append(stats.Days, *d)
+	}
+	sort.Slice(stats.Days, func(i, j int) bool { return stats.Days[i].Day < stats.Days[j].Day })
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted values using the nearest-rank method.
+func percentile(sorted []int, p int) int {
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// RunStatsCommand implements `bluelock stats`, summarizing recorded history.
+func RunStatsCommand(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	db := fs.String("db", DefaultHistoryDB(), "History database")
+	from := fs.String("from", "720h", "Start time (e.g. 2024-06-01, 168h)")
+	to := fs.String("to", "", "End time, defaults to now")
+	unlockRSSI := fs.Int("unlock_rssi", defaultUnlockRSSI, "RSSI at which the device counts as present")
+	falseLockWindow := fs.Duration("false_lock_window", time.Minute, "A lock undone by an unlock within this long counts as false")
+	fs.Parse(args)
+
+	var q HistoryQuery
+	var err error
+	if q.From, err = ParseTimeArg(*from); err != nil {
+		fmt.Fprintln(os.Stderr, "--from:", err)
+		return 2
+	}
+	if *to != "" {
+		if q.To, err = ParseTimeArg(*to); err != nil {
+			fmt.Fprintln(os.Stderr, "--to:", err)
+			return 2
+		}
+	}
+	events, err := QueryHistory(*db, q)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read history:", err)
+		return 1
+	}
+	if len(events) == 0 {
+		fmt.Println("No history recorded in this period.")
+		return 0
+	}
+
+	stats := ComputeStats(events, *unlockRSSI, *falseLockWindow)
+	fmt.Printf("Period:   %s to %s\n", stats.From.Format("2006-01-02 15:04"), stats.To.Format("2006-01-02 15:04"))
+	fmt.Printf("Samples:  %d (%d answered, %.1f%%)\n", stats.Samples, stats.Answered, 100*float64(stats.Answered)/math.Max(1, float64(stats.Samples)))
+	if len(stats.Percentiles) > 0 {
+		fmt.Print("RSSI:    ")
+		for _, p := range statsPercentiles {
+			fmt.Printf(" p%d=%d", p, stats.Percentiles[p])
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+
+	fmt.Println("Per day:")
+	for _, d := range stats.Days {
+		fmt.Printf("  %s  locks=%-4d unlocks=%d\n", d.Day, d.Locks, d.Unlocks)
+	}
+	fmt.Println()
+
+	fmt.Printf("Locks:    %s\n", summarizeCounts(stats.LocksByReason))
+	if stats.DepartureLocks > 0 {
+		average := stats.TimeToLockTotal / time.Duration(stats.DepartureLocks)
+		fmt.Printf("Average time to lock after departure: %s (over %d departures)\n", average.Round(100*time.Millisecond), stats.DepartureLocks)
+	}
+	fmt.Printf("False locks (unlocked again within %s): %d of %d\n", *falseLockWindow, stats.FalseLocks, stats.Locks)
+	return 0
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// statusEvery is how often a followed status is sent again when it changed
+// without an event, and how often `bluelock status --follow` retries a daemon
+// that isn't running.
+const statusEvery = 2 * time.Second
+
+// Status bar icons, one per barState.
+var barIcons = map[string]string{
+	"unlocked": "🔓",
+	"locked":   "🔒",
+	"paused":   "⏸",
+	"disabled": "⏸",
+	"blind":    "⚠",
+	"offline":  "⚠",
+}
+
+// Status bar colors, for polybar and i3blocks.
+var barColors = map[string]string{
+	"unlocked": "#8ec07c",
+	"locked":   "#fabd2f",
+	"blind":    "#fb4934",
+	"offline":  "#928374",
+}
+
+// serveStatus writes the daemon state to a socket client as a JSON line, and
+// with follow again whenever it changes.
+func serveStatus(conn net.Conn, follow bool) {
+	encoder := json.NewEncoder(conn)
+	if !follow {
+		encoder.Encode(CurrentState())
+		return
+	}
+
+	events, _, cancel := SubscribeEvents(64)
+	defer cancel()
+	ticker := time.NewTicker(statusEvery)
+	defer ticker.Stop()
+	var last []byte
+	for {
+		// The state follows the event that changed it, so it's read on the
+		// next tick as well
+		st, _ := json.Marshal(CurrentState())
+		if string(st) != string(last) {
+			if _, err := conn.Write(append(st, '\n')); err != nil {
+				return
+			}
+			last = st
+		}
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunStatusCommand implements `bluelock status`, printing the running daemon's
+// state as JSON or in the format a status bar expects, and with --follow again
+// whenever it changes.
+func RunStatusCommand(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	format := fs.String("format", "json", "Output format: json, text, waybar, polybar or i3blocks")
+	follow := fs.Bool("follow", false, "Keep printing the state whenever it changes, for bars that read a running command")
+	socket := fs.String("socket", DefaultEventsSocket(), "Event socket of the running daemon")
+	fs.Parse(args)
+
+	switch *format {
+	case "json", "text", "waybar", "polybar", "i3blocks":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format %q, use json, text, waybar, polybar or i3blocks\n", *format)
+		return 2
+	}
+
+	// The state changes with every scan, a line only when what it shows does
+	var last string
+	show := func(line string) {
+		if line != last {
+			fmt.Println(line)
+			last = line
+		}
+	}
+	for {
+		err := readStatus(*socket, *follow, func(st *DaemonState) {
+			show(formatStatus(st, *format, *follow))
+		})
+		if err == nil && !*follow {
+			return 0
+		}
+		// Bars keep showing the last line, so say the daemon is gone rather
+		// than leaving a stale state up
+		if *format == "json" {
+			fmt.Fprintln(os.Stderr, "Failed to read the bluelock daemon's status:", err)
+		} else {
+			show(formatStatus(nil, *format, *follow))
+		}
+		if !*follow {
+			return 1
+		}
+		time.Sleep(statusEvery)
+	}
+}
+
+// readStatus asks the daemon on socket for its state and calls fn with it,
+// with follow every time it changes until the connection ends.
+func readStatus(socket string, follow bool, fn func(*DaemonState)) error {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	request := "status\n"
+	if follow {
+		request = "status follow\n"
+	}
+	if _, err := io.WriteString(conn, request); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var st DaemonState
+		if err := json.Unmarshal(scanner.Bytes(), &st); err != nil {
+			return err
+		}
+		fn(&st)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if follow {
+		return io.EOF
+	}
+	return nil
+}
+
+// barState sums up the state for a bar: unlocked, locked, paused, disabled,
+// blind, or offline when st is nil because the daemon isn't running.
+func barState(st *DaemonState) string {
+	switch {
+	case st == nil:
+		return "offline"
+	case st.Disabled:
+		return "disabled"
+	case st.PausedUntil.After(time.Now()):
+		return "paused"
+	case st.Health == HealthBlind:
+		return "blind"
+	}
+	return st.Mode
+}
+
+// formatStatus renders the state in one of RunStatusCommand's formats. st is
+// nil when the daemon isn't running.
+func formatStatus(st *DaemonState, format string, follow bool) string {
+	if format == "json" {
+		data, _ := json.Marshal(st)
+		return string(data)
+	}
+
+	name := barState(st)
+	text := barIcons[name]
+	if st != nil && st.Connected {
+		text += fmt.Sprintf(" %d", st.RSSI)
+	}
+	tooltip := "bluelock isn't running"
+	if st != nil {
+		tooltip = statusTooltip(st, name)
+	}
+
+	switch format {
+	case "waybar":
+		// https://github.com/Alexays/Waybar/wiki/Module:-Custom
+		data, _ := json.Marshal(map[string]string{"text": text, "alt": name, "tooltip": tooltip, "class": name})
+		return string(data)
+	case "polybar":
+		if color, ok := barColors[name]; ok {
+			return "%{F" + color + "}" + text + "%{F-}"
+		}
+		return text
+	case "i3blocks":
+		// Full text, short text and color, or only the full text per line for
+		// interval=persist
+		if follow {
+			return text
+		}
+		return text + "\n" + barIcons[name] + "\n" + barColors[name]
+	}
+	return tooltip
+}
+
+// statusTooltip describes the state in a line.
+func statusTooltip(st *DaemonState, name string) string {
+	var parts []string
+	switch name {
+	case "paused":
+		parts = append(parts, "paused until "+st.PausedUntil.Format("15:04"))
+	case "disabled":
+		if st.DisabledUntil.IsZero() {
+			parts = append(parts, "disabled")
+		} else {
+			parts = append(parts, "disabled until "+st.DisabledUntil.Format("Jan 2 15:04"))
+		}
+	case "blind":
+		parts = append(parts, "can't scan")
+	}
+	parts = append(parts, st.Mode)
+	switch {
+	case st.Connected:
+		parts = append(parts, fmt.Sprintf("RSSI %d", st.RSSI))
+	case !st.LastSeen.IsZero():
+		parts = append(parts, "device last seen "+st.LastSeen.Format("15:04"))
+	default:
+		parts = append(parts, "device not seen")
+	}
+	if st.InRange {
+		parts = append(parts, "in range")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	supervisorMaxBackoff = 10 * time.Second // Longest wait before restarting a crashed loop
+	supervisorResetAfter = time.Minute      // A loop that ran this long starts the backoff over
+)
+
+// supervise runs loop until it returns, recovering from panics so one bad
+// scan can't silently end proximity protection. After a panic it logs the
+// stack, calls failSafe if lock_on_crash is set and restarts the loop.
+func supervise(name string, loop, failSafe func()) {
+	backoff := time.Second
+	for {
+		started := time.Now()
+		if !recovered(name, loop) {
+			return
+		}
+		if LockOnCrash {
+			recovered(name+" fail-safe", failSafe)
+		}
+		if time.Since(started) > supervisorResetAfter {
+			backoff = time.Second
+		}
+		slog.Warn("Restarting after a crash", "loop", name, "in", backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > supervisorMaxBackoff {
+			backoff = supervisorMaxBackoff
+		}
+	}
+}
+
+// recovered calls fn and reports whether it panicked.
+func recovered(name string, fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			slog.Error("Crashed", "loop", name, "panic", r, "stack", string(debug.Stack()))
+			EmitEvent(Event{Type: EventError, Message: fmt.Sprintf("%s crashed: %v", name, r)})
+		}
+	}()
+	fn()
+	return false
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Suspend puts the Mac to sleep. Whether it hibernates is up to pmset's
+// hibernatemode, so every suspend_mode sleeps alike.
+func Suspend(mode string) error {
+	if out, err := RunCommand([]string{"pmset", "sleepnow"}, lockCommandTimeout, nil); err != nil {
+		return fmt.Errorf("pmset: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+// logindSleep maps suspend_mode to logind's Manager methods.
+var logindSleep = map[string]string{
+	SuspendSleep:     "Suspend",
+	SuspendHibernate: "Hibernate",
+	SuspendHybrid:    "HybridSleep",
+	SuspendThenHib:   "SuspendThenHibernate",
+}
+
+// Suspend asks logind to put the machine to sleep. logind returns at once and
+// holds off while a sleep inhibitor blocks it.
+func Suspend(mode string) error {
+	_, err := DBusCall("system", "org.freedesktop.login1", "/org/freedesktop/login1", "org.freedesktop.login1.Manager."+logindSleep[mode], "false")
+	return err
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// setSuspendState is powrprof's SetSuspendState(hibernate, force, disableWakeEvent).
+var setSuspendState = syscall.NewLazyDLL("powrprof.dll").NewProc("SetSuspendState")
+
+// Suspend puts the machine to sleep, or hibernates it for the hibernating
+// modes. It returns once the machine is awake again.
+func Suspend(mode string) error {
+	var hibernate uintptr
+	if mode != SuspendSleep {
+		hibernate = 1
+	}
+	if ok, _, err := setSuspendState.Call(hibernate, 0, 0); ok == 0 {
+		return fmt.Errorf("SetSuspendState: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"os"
+	"syscall"
+)
+
+// syslogSink writes records to the local syslog daemon.
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogSink() (*syslogSink, error) {
+	writer, err := syslog.New(syslog.LOG_USER|syslog.LOG_INFO, "bluelock")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+func (s *syslogSink) write(level slog.Level, message string, attrs []slog.Attr) error {
+	line := formatLogLine(message, attrs)
+	switch syslogPriority(level) {
+	case 3:
+		return s.writer.Err(line)
+	case 4:
+		return s.writer.Warning(line)
+	case 6:
+		return s.writer.Info(line)
+	default:
+		return s.writer.Debug(line)
+	}
+}
+
+// stderrIsJournal reports whether stderr is connected to the journal, as it is
+// when running as a systemd service.
+func stderrIsJournal() bool {
+	stream := os.Getenv("JOURNAL_STREAM")
+	if stream == "" {
+		return false
+	}
+	info, err := os.Stderr.Stat()
+	if err != nil {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	return stream == fmt.Sprintf("%d:%d", stat.Dev, stat.Ino)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// syslogSink stands in for the syslog sink, which Windows doesn't have.
+type syslogSink struct{}
+
+func newSyslogSink() (*syslogSink, error) {
+	return nil, errors.New("syslog is not available on Windows")
+}
+
+func (s *syslogSink) write(level slog.Level, message string, attrs []slog.Attr) error {
+	return errors.ErrUnsupported
+}
+
+// stderrIsJournal reports whether stderr is connected to the journal, which it
+// never is on Windows.
+func stderrIsJournal() bool {
+	return false
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UserConfig is a user's entry in the config file's users section, for system
+// mode: the devices that unlock their sessions, and an optional unlock_rssi and
+// device_policy overriding the global ones.
+type UserConfig struct {
+	Devices      []string `json:"devices"`
+	UnlockRSSI   *int     `json:"unlock_rssi"`
+	DevicePolicy string   `json:"device_policy"`
+}
+
+// Users is the config file's users section, keyed by user name.
+var Users map[string]UserConfig
+
+// seat is one user in system mode, with their devices and own state machine.
+type seat struct {
+	User       string
+	Devices    []string
+	UnlockRSSI int
+	Policy     string // PolicyAny or PolicyAll
+	locker     Locker
+	machine    *StateMachine
+	device     string // Device with the strongest RSSI in the latest scan
+	rssi       *int   // Its RSSI, nil when none of the devices answered
+	failing    bool   // Whether locking or unlocking keeps failing, so it's reported once
+}
+
+// systemSeats sets up a seat for every user in the config file's users section
+// and every user_device entry, each of the form user=XX:XX:XX:XX:XX:XX.
+func systemSeats() ([]*seat, error) {
+	if APIListen != "" || GRPCListen != "" || HomeAssistant || Tray {
+		return nil, errors.New("api_listen, grpc_listen, homeassistant and tray control a single session, they can't be used in system mode")
+	}
+	configs := map[string]UserConfig{}
+	for name, config := range Users {
+		configs[name] = config
+	}
+	for _, entry := range UserDevices {
+		name, device, ok := strings.Cut(entry, "=")
+		name, device = strings.TrimSpace(name), strings.TrimSpace(device)
+		if !ok || name == "" || device == "" {
+			return nil, fmt.Errorf("invalid user_device %q, use user=XX:XX:XX:XX:XX:XX", entry)
+		}
+		config := configs[name]
+		config.Devices = append(config.Devices, device)
+		configs[name] = config
+	}
+	if len(configs) == 0 {
+		return nil, errors.New("system mode needs a users section or at least one user_device")
+	}
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	now := time.Now()
+	var seats []*seat
+	for _, name := range names {
+		config := configs[name]
+		if len(config.Devices) == 0 {
+			return nil, fmt.Errorf("user %q has no devices", name)
+		}
+		locker, err := NewUserLocker(name)
+		if err != nil {
+			return nil, err
+		}
+		s := &seat{User: name, UnlockRSSI: UnlockRSSI, Policy: DevicePolicy, locker: locker, machine: NewStateMachine(now)}
+		for _, device := range config.Devices {
+			s.Devices = append(s.Devices, strings.ToUpper(device))
+		}
+		if config.UnlockRSSI != nil {
+			s.UnlockRSSI = *config.UnlockRSSI
+		}
+		if config.DevicePolicy != "" {
+			s.Policy = config.DevicePolicy
+		}
+		s.device = s.Devices[0]
+		seats = append(seats, s)
+	}
+	return seats, nil
+}
+
+// RunSystemMode watches every seat's devices and locks or unlocks that user's
+// sessions on their own, for a single root daemon serving several users, until
+// ctx is done. Each device is scanned on its own goroutine, and the loop here
+// coordinates: it asks for a round of scans every check_interval and decides
+// for each user as soon as their devices' readings allow.
+func RunSystemMode(ctx context.Context, seats []*seat) {
+	var devices []string
+	owners := map[string][]*seat{}
+	for _, s := range seats {
+		slog.Info("Watching devices for user", "user", s.User, "devices", strings.Join(s.Devices, ","), "unlock_rssi", s.UnlockRSSI, "device_policy", s.Policy)
+		devices = append(devices, s.Devices...)
+		for _, device := range s.Devices {
+			owners[device] = append(owners[device], s)
+		}
+	}
+	done := make(chan deviceReading, len(devices))
+	watches := watchDevices(ctx, devices, done)
+
+	round := 0
+	supervise("system loop", func() {
+		for ctx.Err() == nil {
+			ReloadConfig()
+			round++
+			started := time.Now()
+			scans := 0
+			for _, w := range watches {
+				if w.request(round) {
+					scans++
+				} else {
+					slog.Debug("Previous scan still running", "device", w.device)
+				}
+			}
+			coordinate(ctx, seats, watches, owners, round, scans, done)
+			pingWatchdog()
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Until(started.Add(CheckInterval))):
+			}
+		}
+	}, func() {
+		// Hold the lock until each user unlocks themselves
+		for _, s := range seats {
+			if s.lock(ReasonCrash) == nil {
+				s.machine.LockManually()
+			}
+		}
+	})
+}
+
+// coordinate follows a round of scans, reporting each reading as it comes in
+// and deciding for a seat once its readings are enough, until every seat is
+// decided and the round's scans are all in or check_interval is up. Seats
+// still waiting then decide with the devices not scanned yet counted as not
+// answering. Scans that finish later are reported in the round they come in.
+func coordinate(ctx context.Context, seats []*seat, watches map[string]*deviceWatch, owners map[string][]*seat, round, scans int, done <-chan deviceReading) {
+	started := time.Now()
+	deadline := time.NewTimer(CheckInterval)
+	defer deadline.Stop()
+	pending := append([]*seat(nil), seats...)
+	for {
+		pending = slices.DeleteFunc(pending, func(s *seat) bool { return s.decide(watches, round, false) })
+		if len(pending) == 0 && scans == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case reading := <-done:
+			if reading.round == round {
+				scans--
+			}
+			for _, s := range owners[reading.device] {
+				if reading.err != nil {
+					s.emit(Event{Type: EventError, Device: reading.device, Message: reading.err.Error()})
+				}
+				EmitEvent(Event{Type: EventRSSISample, User: s.User, Device: reading.device, RSSI: reading.rssi})
+			}
+			continue
+		case <-deadline.C:
+			for _, s := range pending {
+				s.decide(watches, round, true)
+			}
+		}
+		break
+	}
+
+	// Health covers the whole round, a single device failing shouldn't flap it
+	var failed error
+	for _, w := range watches {
+		reading, busy := w.latest()
+		if busy {
+			failed = fmt.Errorf("scanning %s takes longer than check_interval", w.device)
+		} else if reading.round == round && reading.err != nil {
+			failed = reading.err
+		}
+	}
+	recordScan(time.Since(started), failed)
+}
+
+// decide acts on the seat's devices' readings for round once they tell
+// whether the user is there: with the any policy as soon as one device is in
+// range, with all as soon as one isn't, otherwise once every device was
+// scanned. final decides regardless, devices without a reading counting as
+// not answering. It reports whether it decided.
+func (s *seat) decide(watches map[string]*deviceWatch, round int, final bool) bool {
+	near, far, waiting := 0, 0, 0
+	device := s.device
+	var best *int
+	for _, d := range s.Devices {
+		reading, _ := watches[d].latest()
+		if reading.round != round {
+			if !final {
+				waiting++
+				continue
+			}
+			reading = deviceReading{}
+		}
+		if reading.rssi != nil && (best == nil || *reading.rssi > *best) {
+			device, best = d, reading.rssi
+		}
+		if reading.rssi != nil && *reading.rssi >= s.UnlockRSSI {
+			near++
+		} else {
+			far++
+		}
+	}
+	all := s.Policy == PolicyAll
+	var inRange bool
+	switch {
+	case !all && near > 0:
+		inRange = true
+	case all && far > 0:
+		inRange = false
+	case waiting > 0:
+		return false
+	default:
+		// Every device answered the same way
+		inRange = all
+	}
+
+	wasConnected := s.rssi != nil
+	s.device, s.rssi = device, best
+	if wasConnected && s.rssi == nil {
+		s.emit(Event{Type: EventDeviceLost})
+	}
+	s.step(inRange)
+	return true
+}
+
+// step runs the seat's state machine with the user in range or not and acts on
+// what it says.
+func (s *seat) step(inRange bool) {
+	now := time.Now()
+	outside := outsideSchedule(now)
+	syncMachine(s.machine)
+	s.machine.Trusted = onTrustedNetwork()
+	s.machine.LockOnly = outside == OutsideLockOnly
+	switch action, reason := s.machine.Step(now, inRange, onVacation(now) || onUnknownWifi() || outside == OutsideIdle); action {
+	case ActionUnlock:
+		if err := s.unlock(reason); err != nil {
+			// Try again at the next check
+			s.machine.DeferUnlock()
+		}
+	case ActionWarn:
+		slog.Info("Device out of range, locking soon", "user", s.User, "in", LockWarning)
+		s.emit(Event{Type: EventLockPending, Reason: reason, Message: fmt.Sprintf("locking in %d seconds", int(LockWarning.Seconds()))})
+	case ActionCancelLock:
+		slog.Info("Pending lock canceled", "user", s.User, "reason", reason)
+		s.emit(Event{Type: EventLockCancel, Reason: reason})
+	case ActionLock:
+		if err := s.lock(reason); err != nil {
+			s.machine.RetryLock(now, reason)
+		}
+	}
+}
+
+// lock locks the user's sessions.
+func (s *seat) lock(reason string) error {
+	if DryRun {
+		slog.Info("Dry run: would lock the user's sessions", "user", s.User, "reason", reason)
+	} else if err := s.locker.Lock(); err != nil {
+		slog.Error("Failed to lock the user's sessions", "user", s.User, "err", err)
+		if !s.failing {
+			s.failing = true
+			s.emit(Event{Type: EventLockFailed, Reason: reason, Message: err.Error()})
+		}
+		return err
+	}
+	slog.Info("User's sessions locked", "user", s.User, "reason", reason)
+	s.failing = false
+	s.emit(Event{Type: EventLock, Reason: reason})
+	s.emit(Event{Type: EventStateChange, From: "unlocked", To: "locked", Reason: reason})
+	return nil
+}
+
+// unlock unlocks the user's sessions. When that fails it only reports the
+// failure and returns the error.
+func (s *seat) unlock(reason string) error {
+	if DryRun {
+		slog.Info("Dry run: would unlock the user's sessions", "user", s.User, "reason", reason)
+	} else if err := s.locker.Unlock(); err != nil {
+		slog.Error("Failed to unlock the user's sessions", "user", s.User, "err", err)
+		if !s.failing {
+			s.failing = true
+			s.emit(Event{Type: EventLockFailed, Reason: reason, Message: "unlock failed: " + err.Error()})
+		}
+		return err
+	} else {
+		slog.Info("User's sessions unlocked", "user", s.User, "reason", reason)
+	}
+	s.failing = false
+	s.emit(Event{Type: EventUnlock, Reason: reason})
+	s.emit(Event{Type: EventStateChange, From: "locked", To: "unlocked", Reason: reason})
+	return nil
+}
+
+// emit sends an event for this seat.
+func (s *seat) emit(e Event) {
+	e.User = s.User
+	if e.Device == "" {
+		e.Device = s.device
+	}
+	if e.RSSI == nil {
+		e.RSSI = s.rssi
+	}
+	EmitEvent(e)
+}
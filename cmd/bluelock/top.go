@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// How much `bluelock top` keeps: samples per device for the sparklines, and
+// events for the list below them.
+const (
+	topSamples = 240
+	topEvents  = 100
+)
+
+// sparkBars are the sparkline's levels, from weakest to strongest.
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// dashboard is what `bluelock top` shows, fed by the daemon's streams.
+type dashboard struct {
+	mu      sync.Mutex
+	status  *DaemonState
+	samples map[string][]*int // RSSI samples by device, nil when it didn't answer
+	events  []Event           // The latest first
+	gone    error             // Why a stream ended, when one did
+}
+
+// RunTopCommand implements `bluelock top`, a live view of the running daemon:
+// its state, the RSSI of each device over time, the latest events and the
+// scanning health. q or Ctrl-C quits.
+func RunTopCommand(args []string) int {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	socket := fs.String("socket", DefaultEventsSocket(), "Event socket of the running daemon")
+	fs.Parse(args)
+
+	d := &dashboard{samples: map[string][]*int{}}
+	redraw := make(chan struct{}, 1)
+	changed := func() {
+		select {
+		case redraw <- struct{}{}:
+		default:
+		}
+	}
+	conn, err := net.Dial("unix", *socket)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect to the bluelock daemon:", err)
+		return 1
+	}
+	go func() {
+		err := d.followEvents(conn, changed)
+		d.stop(err)
+		changed()
+	}()
+	go func() {
+		err := readStatus(*socket, true, func(st *DaemonState) {
+			d.mu.Lock()
+			d.status = st
+			d.mu.Unlock()
+			changed()
+		})
+		d.stop(err)
+		changed()
+	}()
+
+	// Keys come in one at a time without echo, so q quits at once
+	restore := rawTerminal()
+	quit := make(chan struct{})
+	go func() {
+		in := bufio.NewReader(os.Stdin)
+		for {
+			key, err := in.ReadByte()
+			if err != nil {
+				return
+			}
+			if key == 'q' || key == 'Q' {
+				close(quit)
+				return
+			}
+		}
+	}()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	// The alternate screen, without the cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		restore()
+	}()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		width, height := terminalSize()
+		os.Stdout.WriteString("\x1b[H\x1b[2J" + d.render(width, height))
+		select {
+		case <-redraw:
+		case <-ticker.C:
+		case <-quit:
+			return 0
+		case <-interrupt:
+			return 0
+		}
+	}
+}
+
+// followEvents reads the daemon's events from conn until it closes.
+func (d *dashboard) followEvents(conn net.Conn, changed func()) error {
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "follow\n"); err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(conn)
+	for {
+		var e Event
+		if err := decoder.Decode(&e); err != nil {
+			return err
+		}
+		d.mu.Lock()
+		if e.Type == EventRSSISample {
+			samples := append(d.samples[e.Device], e.RSSI)
+			if len(samples) > topSamples {
+				samples = samples[len(samples)-topSamples:]
+			}
+			d.samples[e.Device] = samples
+		} else {
+			d.events = append([]Event{e}, d.events...)
+			if len(d.events) > topEvents {
+				d.events = d.events[:topEvents]
+			}
+		}
+		d.mu.Unlock()
+		changed()
+	}
+}
+
+// stop records why a stream ended.
+func (d *dashboard) stop(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.gone == nil {
+		if err == nil || err == io.EOF {
+			err = fmt.Errorf("the daemon closed the connection")
+		}
+		d.gone = err
+	}
+}
+
+// render draws the dashboard for a terminal of width by height.
+func (d *dashboard) render(width, height int) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var lines []string
+	line := func(format string, args ...any) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	now := time.Now()
+	st := d.status
+	if st == nil {
+		line("bluelock top   %s   waiting for the daemon", now.Format("15:04:05"))
+	} else {
+		line("bluelock top   %s   %s   health %s", now.Format("15:04:05"), barState(st), st.Health)
+		line("")
+		line("state     %s", topFlags(st, now))
+		seen := "never"
+		if !st.LastSeen.IsZero() {
+			seen = st.LastSeen.Format("15:04:05")
+		}
+		reading := "no reading"
+		if st.Connected {
+			reading = fmt.Sprintf("RSSI %d", st.RSSI)
+		}
+		line("device    %s, in range %t, last seen %s", reading, st.InRange, seen)
+		if len(st.Presence) > 0 {
+			names := make([]string, 0, len(st.Presence))
+			for name := range st.Presence {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			var presence []string
+			for _, name := range names {
+				mark := "-"
+				if st.Presence[name] {
+					mark = "+"
+				}
+				presence = append(presence, mark+name)
+			}
+			line("presence  %s", strings.Join(presence, " "))
+		}
+		line("scanning  %s, last scan %s, %d failed in a row", st.Health, time.Duration(st.ScanSeconds*float64(time.Second)).Round(time.Millisecond), st.ScanFailures)
+	}
+	if d.gone != nil {
+		line("")
+		line("stopped   %v", d.gone)
+	}
+
+	// A sparkline per device, the newest sample on the right
+	line("")
+	line("RSSI")
+	devices := make([]string, 0, len(d.samples))
+	for device := range d.samples {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	if len(devices) == 0 {
+		line("  no samples yet")
+	}
+	for _, device := range devices {
+		samples := d.samples[device]
+		last := "  -"
+		if rssi := samples[len(samples)-1]; rssi != nil {
+			last = fmt.Sprintf("%3d", *rssi)
+		}
+		room := max(width-len(device)-9, 1)
+		if len(samples) > room {
+			samples = samples[len(samples)-room:]
+		}
+		line("  %s  %s  %s", device, last, sparkline(samples))
+	}
+
+	line("")
+	line("Events")
+	if len(d.events) == 0 {
+		line("  none yet")
+	}
+	for _, e := range d.events {
+		if len(lines) >= height {
+			break
+		}
+		line("  %s  %s", e.Time.Local().Format("15:04:05"), topEvent(e))
+	}
+
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	for i, l := range lines {
+		if utf8.RuneCountInString(l) > width {
+			lines[i] = string([]rune(l)[:width])
+		}
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// topFlags lists the mode and whatever else holds it, like a pause.
+func topFlags(st *DaemonState, now time.Time) string {
+	flags := []string{st.Mode}
+	if st.PausedUntil.After(now) {
+		flags = append(flags, "paused until "+st.PausedUntil.Local().Format("15:04"))
+	}
+	if st.Disabled {
+		flags = append(flags, "disabled")
+	}
+	if st.ManualLock {
+		flags = append(flags, "locked by hand")
+	}
+	if st.Standby {
+		flags = append(flags, "standby")
+	}
+	if st.Trusted {
+		flags = append(flags, "trusted network")
+	}
+	if st.OutsideSchedule != "" {
+		flags = append(flags, "outside schedule ("+st.OutsideSchedule+")")
+	}
+	if st.LockDevice != "" {
+		flags = append(flags, "lock device "+st.LockDevice+" near")
+	}
+	if st.Active {
+		flags = append(flags, "in use")
+	}
+	return strings.Join(flags, ", ")
+}
+
+// topEvent describes an event in a line.
+func topEvent(e Event) string {
+	parts := []string{e.Type}
+	if e.From != "" || e.To != "" {
+		parts = append(parts, e.From+" -> "+e.To)
+	}
+	if e.Reason != "" {
+		parts = append(parts, e.Reason)
+	}
+	if e.User != "" {
+		parts = append(parts, "user "+e.User)
+	}
+	if e.RSSI != nil {
+		parts = append(parts, "RSSI "+strconv.Itoa(*e.RSSI))
+	}
+	if e.Message != "" {
+		parts = append(parts, e.Message)
+	}
+	return strings.Join(parts, "  ")
+}
+
+// sparkline draws samples scaled between the weakest and strongest of them,
+// with a dot where the device didn't answer.
+func sparkline(samples []*int) string {
+	low, high := 0, minRSSI
+	for _, rssi := range samples {
+		if rssi != nil {
+			low, high = min(low, *rssi), max(high, *rssi)
+		}
+	}
+	// A steady signal shouldn't swing across the whole range
+	if high-low < 10 {
+		low = high - 10
+	}
+	var b strings.Builder
+	for _, rssi := range samples {
+		if rssi == nil {
+			b.WriteRune('·')
+			continue
+		}
+		b.WriteRune(sparkBars[(*rssi-low)*(len(sparkBars)-1)/(high-low)])
+	}
+	return b.String()
+}
+
+// terminalSize returns the terminal's columns and rows, from stty or else
+// $COLUMNS and $LINES.
+func terminalSize() (int, int) {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	if out, err := cmd.Output(); err == nil {
+		if fields := strings.Fields(string(out)); len(fields) == 2 {
+			rows, err1 := strconv.Atoi(fields[0])
+			cols, err2 := strconv.Atoi(fields[1])
+			if err1 == nil && err2 == nil && rows > 0 && cols > 0 {
+				return cols, rows
+			}
+		}
+	}
+	cols, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || cols <= 0 {
+		cols = 80
+	}
+	rows, err := strconv.Atoi(os.Getenv("LINES"))
+	if err != nil || rows <= 0 {
+		rows = 24
+	}
+	return cols, rows
+}
+
+// rawTerminal turns off line buffering and echo with stty, where there is
+// one, and returns what puts the terminal back.
+func rawTerminal() func() {
+	save := exec.Command("stty", "-g")
+	save.Stdin = os.Stdin
+	saved, err := save.Output()
+	if err != nil {
+		return func() {}
+	}
+	raw := exec.Command("stty", "-icanon", "-echo", "min", "1")
+	raw.Stdin = os.Stdin
+	if raw.Run() != nil {
+		return func() {}
+	}
+	return func() {
+		restore := exec.Command("stty", strings.TrimSpace(string(saved)))
+		restore.Stdin = os.Stdin
+		restore.Run()
+	}
+}
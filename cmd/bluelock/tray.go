@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// trayPause is how long the tray's pause entry pauses for.
+const trayPause = time.Hour
+
+// Tray menu actions, as runTray reports them.
+const (
+	trayPauseAction  = "pause"
+	trayResumeAction = "resume"
+	trayLockAction   = "lock"
+	trayConfigAction = "config"
+	trayClickAction  = "click" // The icon itself was clicked
+)
+
+// Tray icons by barState, from the freedesktop icon theme.
+var trayIcons = map[string]string{
+	"unlocked": "changes-allow-symbolic",
+	"locked":   "changes-prevent-symbolic",
+	"paused":   "media-playback-pause-symbolic",
+	"disabled": "media-playback-pause-symbolic",
+	"blind":    "dialog-warning-symbolic",
+}
+
+// trayState is what the tray icon shows.
+type trayState struct {
+	icon    string
+	tooltip string
+}
+
+// StartTray shows the tray icon in the background, updating it as the state
+// changes and running what's picked from its menu.
+func StartTray() {
+	updates := make(chan trayState, 1)
+	actions := make(chan string)
+	go func() {
+		if err := runTray(updates, actions); err != nil {
+			slog.Error("The tray icon stopped", "err", err)
+		}
+		close(actions)
+	}()
+
+	go func() {
+		ticker := time.NewTicker(statusEvery)
+		defer ticker.Stop()
+		var last trayState
+		for {
+			st := CurrentState()
+			name := barState(&st)
+			if shown := (trayState{trayIcons[name], statusTooltip(&st, name)}); shown != last {
+				select {
+				case <-updates:
+				default:
+				}
+				updates <- shown
+				last = shown
+			}
+
+			select {
+			case action, ok := <-actions:
+				if !ok {
+					return
+				}
+				trayAction(action, last)
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// trayAction runs a tray menu entry.
+func trayAction(action string, shown trayState) {
+	switch action {
+	case trayPauseAction:
+		runOnMonitor(func() { pauseFor(trayPause) })
+	case trayResumeAction:
+		runOnMonitor(func() { pauseFor(0) })
+	case trayLockAction:
+		runOnMonitor(lockManually)
+	case trayConfigAction:
+		// Create the file when there's none, so there's something to open
+		path := UserConfigFile()
+		if path == "" {
+			var err error
+			if path, err = updateUserConfig(map[string]any{}); err != nil {
+				slog.Warn("Couldn't create the config file", "err", err)
+				return
+			}
+		}
+		if err := openFile(path); err != nil {
+			slog.Warn("Couldn't open the config file", "path", path, "err", err)
+		}
+	case trayClickAction:
+		Notify("bluelock", shown.tooltip, UrgencyLow, 0)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runTray uses yad, which only runs on Linux desktops.
+func runTray(updates <-chan trayState, actions chan<- string) error {
+	return errors.New("the tray icon needs yad, on Linux")
+}
+
+// openFile opens path in its default application.
+func openFile(path string) error {
+	if out, err := exec.Command("open", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("open: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
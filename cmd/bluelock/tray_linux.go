@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// trayMenu is the tray's menu for yad: entries separated by |, each a label
+// and the command yad runs when it's picked. The commands print the action
+// to yad's stdout, which is ours to read.
+var trayMenu = strings.Join([]string{
+	"Pause for an hour!echo " + trayPauseAction,
+	"Resume!echo " + trayResumeAction,
+	"Lock now!echo " + trayLockAction,
+	"Open config!echo " + trayConfigAction,
+}, "|")
+
+// runTray shows the icon with yad's notification mode, which speaks
+// StatusNotifierItem and the older XEmbed tray, until yad exits.
+func runTray(updates <-chan trayState, actions chan<- string) error {
+	cmd := exec.Command("yad", "--notification", "--listen", "--no-middle", "--image=changes-prevent-symbolic", "--text=bluelock", "--command=echo "+trayClickAction)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("yad: %v, install yad for the tray icon", err)
+	}
+
+	go func() {
+		fmt.Fprintf(stdin, "menu:%s\n", trayMenu)
+		for shown := range updates {
+			// Lines are commands to yad, so the tooltip stays on one
+			tooltip := "bluelock: " + strings.ReplaceAll(shown.tooltip, "\n", " ")
+			if _, err := io.WriteString(stdin, "icon:"+shown.icon+"\ntooltip:"+tooltip+"\n"); err != nil {
+				return
+			}
+		}
+	}()
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		actions <- strings.TrimSpace(scanner.Text())
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("yad: %v", err)
+	}
+	return fmt.Errorf("yad exited")
+}
+
+// openFile opens path in the desktop's default application.
+func openFile(path string) error {
+	if out, err := exec.Command("xdg-open", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("xdg-open: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
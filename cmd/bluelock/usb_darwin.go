@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ioregID finds a USB device's decimal vendor or product id in `ioreg -p IOUSB -l`.
+var ioregID = regexp.MustCompile(`"id(Vendor|Product)" = (\d+)`)
+
+// USBDevices lists the plugged in USB devices as vid:pid in lowercase hex,
+// e.g. "1050:0407", from the IOUSB plane.
+func USBDevices() ([]string, error) {
+	out, err := RunCommand([]string{"ioreg", "-p", "IOUSB", "-l", "-w", "0"}, lockCommandTimeout, nil)
+	if err != nil {
+		return nil, errors.New("ioreg: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	var devices []string
+	// Each device starts with a "+-o Name@..." line
+	for _, block := range strings.Split(string(out), "+-o ") {
+		ids := map[string]int{}
+		for _, match := range ioregID.FindAllStringSubmatch(block, -1) {
+			ids[match[1]], _ = strconv.Atoi(match[2])
+		}
+		vendor, ok1 := ids["Vendor"]
+		product, ok2 := ids["Product"]
+		if ok1 && ok2 {
+			devices = append(devices, fmt.Sprintf("%04x:%04x", vendor, product))
+		}
+	}
+	return devices, nil
+}
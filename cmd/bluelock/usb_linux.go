@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// USBDevices lists the plugged in USB devices as vid:pid in lowercase hex,
+// e.g. "1050:0407", from sysfs.
+func USBDevices() ([]string, error) {
+	paths, err := filepath.Glob("/sys/bus/usb/devices/*/idVendor")
+	if err != nil {
+		return nil, err
+	}
+	var devices []string
+	for _, path := range paths {
+		vendor, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		product, err := os.ReadFile(filepath.Join(filepath.Dir(path), "idProduct"))
+		if err != nil {
+			continue
+		}
+		devices = append(devices, strings.ToLower(strings.TrimSpace(string(vendor))+":"+strings.TrimSpace(string(product))))
+	}
+	return devices, nil
+}
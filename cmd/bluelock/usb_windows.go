@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// pnpUSBID finds the vendor and product ids in a PnP instance id such as
+// USB\VID_1050&PID_0407\5&1A2B3C&0&2.
+var pnpUSBID = regexp.MustCompile(`(?i)VID_([0-9A-F]{4})&PID_([0-9A-F]{4})`)
+
+// USBDevices lists the plugged in USB devices as vid:pid in lowercase hex,
+// e.g. "1050:0407", from PnP.
+func USBDevices() ([]string, error) {
+	script := `Get-PnpDevice -PresentOnly -ErrorAction SilentlyContinue | ForEach-Object { $_.InstanceId }`
+	argv := []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script}
+	out, err := RunCommand(argv, lockCommandTimeout, nil)
+	if err != nil {
+		return nil, errors.New("powershell: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	var devices []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if match := pnpUSBID.FindStringSubmatch(line); match != nil {
+			devices = append(devices, strings.ToLower(match[1]+":"+match[2]))
+		}
+	}
+	return devices, nil
+}
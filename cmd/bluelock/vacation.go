@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Vacation is a long-term disable set with `bluelock disable`, kept in a
+// state file so it survives restarts. Unlike a pause it isn't held by the
+// daemon itself.
+type Vacation struct {
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"` // Zero until `bluelock enable`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// vacationFile is where the disable is kept.
+func vacationFile() string {
+	return stateFile("disabled.json")
+}
+
+// readVacation returns the disable in effect at now, or nil.
+func readVacation(now time.Time) (*Vacation, error) {
+	data, err := os.ReadFile(vacationFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var v Vacation
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("%s: %v", vacationFile(), err)
+	}
+	if !v.Until.IsZero() && !now.Before(v.Until) {
+		return nil, nil
+	}
+	return &v, nil
+}
+
+var (
+	// vacationRead is when the monitor loop last read the state file, and
+	// vacationModTime that file's modification time then.
+	vacationRead    time.Time
+	vacationModTime time.Time
+)
+
+// onVacation reports whether bluelock is disabled, reading the state file
+// again when it changed and noticing when the disable ran out. It keeps the
+// status up to date and logs the changes.
+func onVacation(now time.Time) bool {
+	st := CurrentState()
+	info, err := os.Stat(vacationFile())
+	changed := err == nil && !info.ModTime().Equal(vacationModTime) || err != nil && !vacationModTime.IsZero()
+	expired := st.Disabled && !st.DisabledUntil.IsZero() && !now.Before(st.DisabledUntil)
+	if !changed && !expired && !vacationRead.IsZero() {
+		return st.Disabled
+	}
+	vacationRead = now
+	vacationModTime = time.Time{}
+	if err == nil {
+		vacationModTime = info.ModTime()
+	}
+
+	v, err := readVacation(now)
+	if err != nil {
+		slog.Warn("Failed to read whether bluelock is disabled", "err", err)
+		return st.Disabled
+	}
+	disabled := v != nil
+	until := time.Time{}
+	if disabled {
+		until = v.Until
+	}
+	if disabled != st.Disabled || !until.Equal(st.DisabledUntil) {
+		updateState(func(s *DaemonState) { s.Disabled, s.DisabledUntil = disabled, until })
+		switch {
+		case disabled && until.IsZero():
+			slog.Warn("bluelock is disabled until `bluelock enable`", "reason", v.Reason)
+		case disabled:
+			slog.Warn("bluelock is disabled", "until", until.Format(time.DateTime), "reason", v.Reason)
+		default:
+			slog.Info("bluelock is enabled again")
+		}
+	}
+	return disabled
+}
+
+// RunDisableCommand implements `bluelock disable [--until 2025-01-05] [--reason text]`,
+// which stops the daemon locking and unlocking until that date, or until
+// `bluelock enable`, across restarts.
+func RunDisableCommand(args []string) int {
+	fs := flag.NewFlagSet("disable", flag.ExitOnError)
+	until := fs.String("until", "", "Local date or time to enable again, such as 2025-01-05 or 2025-01-05 18:00, empty for until bluelock enable")
+	reason := fs.String("reason", "", "Why, shown in the status")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: bluelock disable [--until 2025-01-05] [--reason text]")
+		return 2
+	}
+
+	now := time.Now()
+	v := Vacation{Since: now.Truncate(time.Second), Reason: *reason}
+	if *until != "" {
+		t, err := parseUntil(*until)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		if !t.After(now) {
+			fmt.Fprintf(os.Stderr, "%s has already passed\n", *until)
+			return 2
+		}
+		v.Until = t
+	}
+
+	data, _ := json.MarshalIndent(v, "", "  ")
+	path := vacationFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to create the state directory:", err)
+		return 1
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write", path+":", err)
+		return 1
+	}
+	if v.Until.IsZero() {
+		fmt.Println("bluelock is disabled until `bluelock enable`.")
+	} else {
+		fmt.Printf("bluelock is disabled until %s.\n", v.Until.Format("Mon 2006-01-02 15:04"))
+	}
+	return 0
+}
+
+// RunEnableCommand implements `bluelock enable`, ending a `bluelock disable`.
+func RunEnableCommand(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: bluelock enable")
+		return 2
+	}
+	err := os.Remove(vacationFile())
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("bluelock wasn't disabled.")
+		return 0
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to enable bluelock:", err)
+		return 1
+	}
+	fmt.Println("bluelock is enabled again.")
+	return 0
+}
+
+// parseUntil parses a local date, which means its midnight, or a date and time.
+func parseUntil(text string) (time.Time, error) {
+	for _, layout := range []string{time.DateOnly, "2006-01-02 15:04", time.DateTime, "2006-01-02T15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q isn't a date, use 2025-01-05 or 2025-01-05 18:00", text)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RSSI readings are signed bytes.
+const (
+	minRSSI = -128
+	maxRSSI = 127
+)
+
+// usbID is a USB device's vendor and product id, as lsusb prints them.
+var usbID = regexp.MustCompile(`^[0-9A-Fa-f]{4}:[0-9A-Fa-f]{4}$`)
+
+// checkRSSI reports an RSSI threshold RSSI can't reach.
+func checkRSSI(name string, rssi int) error {
+	if rssi < minRSSI || rssi > maxRSSI {
+		return fmt.Errorf("%s: %d is out of range, RSSI goes from %d to %d and is higher the nearer the device is", name, rssi, minRSSI, maxRSSI)
+	}
+	return nil
+}
+
+// checkThresholds reports a lock_rssi above unlock_rssi, which would lock and
+// unlock in turn with the device in between.
+func checkThresholds(lockRSSI, unlockRSSI int) error {
+	if lockRSSI > unlockRSSI {
+		return fmt.Errorf("lock_rssi: %d is above unlock_rssi %d, it must be at most that", lockRSSI, unlockRSSI)
+	}
+	return nil
+}
+
+// ValidateConfig checks the settings once they're all in, from the command
+// line, the environment and the config file, and reports every one that's
+// wrong together with what it accepts.
+func ValidateConfig() error {
+	var problems []error
+	problem := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if !SystemMode {
+		switch {
+		case BluetoothDeviceAddress == defaultBluetoothDeviceAddress || BluetoothDeviceAddress == "":
+			problem("bluetooth_device_address: not set, give your device's address like AA:BB:CC:DD:EE:FF (bluetoothctl devices lists them)")
+		case !bluetoothAddress.MatchString(BluetoothDeviceAddress):
+			problem("bluetooth_device_address: %q isn't a device address, use six hex pairs like AA:BB:CC:DD:EE:FF", BluetoothDeviceAddress)
+		}
+	}
+	if SystemMode {
+		// These control the one session's state machine, which system mode doesn't run
+		for _, setting := range []struct{ name, value string }{
+			{"api_listen", APIListen},
+			{"grpc_listen", GRPCListen},
+			{"mqtt_broker", MQTTBroker},
+			{"peer_secret", PeerSecret},
+		} {
+			if setting.value != "" {
+				problem("%s: not supported in system mode, which has no single session to control", setting.name)
+			}
+		}
+	}
+	for name, config := range Users {
+		for _, device := range config.Devices {
+			if !bluetoothAddress.MatchString(device) {
+				problem("users.%s.devices: %q isn't a device address, use six hex pairs like AA:BB:CC:DD:EE:FF", name, device)
+			}
+		}
+		if config.UnlockRSSI != nil && (*config.UnlockRSSI < minRSSI || *config.UnlockRSSI > maxRSSI) {
+			problem("users.%s.unlock_rssi: %d is out of range, use %d to %d", name, *config.UnlockRSSI, minRSSI, maxRSSI)
+		}
+		if config.DevicePolicy != "" && config.DevicePolicy != PolicyAny && config.DevicePolicy != PolicyAll {
+			problem("users.%s.device_policy: must be any or all, not %q", name, config.DevicePolicy)
+		}
+	}
+	if OnExit != ExitLeave && OnExit != ExitLock && OnExit != ExitRestore {
+		problem("on_exit: must be leave, lock or restore-previous, not %q", OnExit)
+	}
+	if DevicePolicy != PolicyAny && DevicePolicy != PolicyAll {
+		problem("device_policy: must be any or all, not %q", DevicePolicy)
+	}
+	for _, entry := range UserDevices {
+		if _, device, ok := strings.Cut(entry, "="); ok && !bluetoothAddress.MatchString(strings.TrimSpace(device)) {
+			problem("user_device: %q has no valid device address, use user=AA:BB:CC:DD:EE:FF", entry)
+		}
+	}
+
+	lockErr, unlockErr := checkRSSI("lock_rssi", LockRSSI), checkRSSI("unlock_rssi", UnlockRSSI)
+	if lockErr == nil && unlockErr == nil {
+		lockErr = checkThresholds(LockRSSI, UnlockRSSI)
+	}
+	for _, err := range []error{lockErr, unlockErr} {
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	for name, d := range map[string]time.Duration{"check_interval": CheckInterval, "session_timeout": SessionTimeout, "hook_timeout": HookTimeout, "presence_timeout": PresenceTimeout, "confirm_window": ConfirmWindow} {
+		if d <= 0 {
+			problem("%s: must be a positive duration such as 5s or 30m, not %s", name, d)
+		}
+	}
+	for name, d := range map[string]time.Duration{"lock_warning": LockWarning, "max_lock_veto": MaxLockVeto, "history_retention": HistoryRetention, "activity_window": ActivityWindow, "suspend_after": SuspendAfter, "left_behind_after": LeftBehindAfter} {
+		if d < 0 {
+			problem("%s: can't be negative, use 0 to turn it off", name)
+		}
+	}
+
+	for _, subnet := range TrustedSubnets {
+		if _, _, err := net.ParseCIDR(subnet); err != nil {
+			problem("trusted_subnet: %q isn't a network, use an address and prefix length like 192.168.1.0/24", subnet)
+		}
+	}
+
+	for name, s := range map[string]string{"unlock_when": UnlockWhen, "lock_when": LockWhen} {
+		if _, err := parsePresenceExpr(s); err != nil {
+			problem("%s: %v", name, err)
+		}
+	}
+	for _, name := range presenceNames() {
+		switch name {
+		case "bluetooth", "ble", "connection", "worn":
+		case "peer":
+			if PeerSecret == "" {
+				problem("presence: peer needs a peer_secret shared with the other machines")
+			}
+		case "exec":
+			if len(PresenceCommand) == 0 {
+				problem("presence: exec needs a presence_command to run")
+			}
+		case "lan":
+			if len(PresenceHosts) == 0 {
+				problem("presence: lan needs a presence_host to look for")
+			}
+		case "usb":
+			if len(USBTokens) == 0 {
+				problem("presence: usb needs a usb_device to look for")
+			}
+		case "mqtt":
+			if MQTTBroker == "" || PresenceTopic == "" {
+				problem("presence: mqtt needs an mqtt_broker and a presence_topic to subscribe to")
+			}
+		default:
+			problem("presence: unknown provider %q, use bluetooth, ble, connection, exec, lan, mqtt, peer, usb or worn", name)
+		}
+	}
+	if PeerSecret != "" && len(PeerSecret) < 16 {
+		problem("peer_secret: too short, use at least 16 characters, e.g. from openssl rand -hex 16")
+	}
+	if FollowMe && PeerSecret == "" {
+		problem("follow_me: needs peer mode, set a peer_secret shared with the other machines")
+	}
+	if PeerPort < 1 || PeerPort > 65535 {
+		problem("peer_port: %d isn't a port, use 1 to 65535", PeerPort)
+	}
+	if WornDevice != "" && !bluetoothAddress.MatchString(WornDevice) {
+		problem("worn_device: %q isn't a device address, use six hex pairs like AA:BB:CC:DD:EE:FF", WornDevice)
+	}
+	for _, id := range USBTokens {
+		if !usbID.MatchString(id) {
+			problem("usb_device: %q isn't a USB id, use the vendor and product id in hex like 1050:0407 (lsusb lists them)", id)
+		}
+	}
+	switch PresenceFailure {
+	case FailAbsent, FailPresent, FailLast:
+	default:
+		problem("presence_failure: must be absent, present or last, not %q", PresenceFailure)
+	}
+	switch SSHAgentAway {
+	case "", SSHAgentLock, SSHAgentDelete:
+	default:
+		problem("ssh_agent: must be lock or delete, or empty to leave the agent alone, not %q", SSHAgentAway)
+	}
+	if ConfirmUnlock && UnlockPIN != "" && APIListen == "" && activatedListener("api") == nil {
+		problem("unlock_pin: is sent to the API, so confirm_unlock with a PIN needs api_listen")
+	}
+	if DebugListen != "" && !loopbackAddr(DebugListen) {
+		problem("debug_listen: %q isn't on localhost, the profiler has no token so give a port or 127.0.0.1:port", DebugListen)
+	}
+	switch SuspendMode {
+	case SuspendSleep, SuspendHibernate, SuspendHybrid, SuspendThenHib:
+	default:
+		problem("suspend_mode: must be suspend, hibernate, hybrid-sleep or suspend-then-hibernate, not %q", SuspendMode)
+	}
+	if _, err := parseLockDevices(); err != nil {
+		problem("lock_device: %v", err)
+	}
+	if _, err := parseSchedule(Schedule); err != nil {
+		problem("schedule: %v", err)
+	}
+	if OutsideSchedule != OutsideIdle && OutsideSchedule != OutsideLockOnly {
+		problem("outside_schedule: must be idle or lock_only, not %q", OutsideSchedule)
+	}
+
+	if CheckRepeat < 1 {
+		problem("check_repeat: must be at least 1, not %d", CheckRepeat)
+	}
+	if BlindAfter < 1 {
+		problem("blind_after: must be at least 1, not %d", BlindAfter)
+	}
+	for name, n := range map[string]int{"lock_retries": LockRetries, "webhook_retries": WebhookRetries, "log_max_backups": LogMaxBackups} {
+		if n < 0 {
+			problem("%s: can't be negative, not %d", name, n)
+		}
+	}
+	if LogMaxSizeMB < 1 {
+		problem("log_max_size: must be at least 1 (megabyte), not %d", LogMaxSizeMB)
+	}
+	if LogFormat != "text" && LogFormat != "json" {
+		problem("log_format: must be text or json, not %q", LogFormat)
+	}
+	switch LogTarget {
+	case "auto", "stderr", "file", "journal", "syslog":
+	default:
+		problem("log_target: must be auto, stderr, file, journal or syslog, not %q", LogTarget)
+	}
+
+	// The maps above are iterated in random order
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Error() < problems[j].Error() })
+	return errors.Join(problems...)
+}
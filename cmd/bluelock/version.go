@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse --short HEAD) \
+//		-X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ) -X main.backends=hcitool" ./cmd/bluelock
+//
+// Without them the commit and date come from the VCS information go build
+// records, and backends is every scanner built for the platform.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+	backends  = ""
+)
+
+// BuildInfo is what `bluelock version` prints.
+type BuildInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit,omitempty"`
+	BuildDate string   `json:"build_date,omitempty"`
+	Modified  bool     `json:"modified,omitempty"` // Built from a tree with uncommitted changes
+	Go        string   `json:"go"`
+	Platform  string   `json:"platform"`
+	Backends  []string `json:"backends"`
+}
+
+// currentBuild returns the build's version, filling in what the ldflags left
+// out from the build information.
+func currentBuild() BuildInfo {
+	b := BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		Go:        runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Backends:  strings.Split(scannerBackends, ","),
+	}
+	if backends != "" {
+		b.Backends = strings.Split(backends, ",")
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	if b.Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		// go install github.com/samhardeman/bluetooth-unlock/cmd/bluelock@v1.4.0
+		b.Version = strings.TrimPrefix(info.Main.Version, "v")
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if b.Commit == "" {
+				b.Commit = setting.Value
+				if len(b.Commit) > 12 {
+					b.Commit = b.Commit[:12]
+				}
+			}
+		case "vcs.time":
+			if b.BuildDate == "" {
+				b.BuildDate = setting.Value
+			}
+		case "vcs.modified":
+			b.Modified = setting.Value == "true"
+		}
+	}
+	return b
+}
+
+// String sums up the build in a line, e.g. "1.4.0 (3f2a9c1e0b7d, 2024-05-01T10:00:00Z)".
+func (b BuildInfo) String() string {
+	var details []string
+	if b.Commit != "" {
+		commit := b.Commit
+		if b.Modified {
+			commit += "-dirty"
+		}
+		details = append(details, commit)
+	}
+	if b.BuildDate != "" {
+		details = append(details, b.BuildDate)
+	}
+	if len(details) == 0 {
+		return b.Version
+	}
+	return b.Version + " (" + strings.Join(details, ", ") + ")"
+}
+
+// RunVersionCommand implements `bluelock version`, printing the version,
+// commit, build date and scanner backends, to paste into a bug report.
+func RunVersionCommand(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the build information as JSON")
+	fs.Parse(args)
+
+	b := currentBuild()
+	if *asJSON {
+		data, _ := json.MarshalIndent(b, "", "  ")
+		fmt.Println(string(data))
+		return 0
+	}
+	fmt.Printf("bluelock %s\n%s %s\nbackends: %s\n", b, b.Go, b.Platform, strings.Join(b.Backends, ", "))
+	return 0
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// WarnBeforeLock announces a lock that fires in delay unless the device comes back,
+// by running lock_warning_command in the background.
+func WarnBeforeLock(delay time.Duration) {
+	seconds := fmt.Sprint(int(delay.Round(time.Second).Seconds()))
+	slog.Info("Device out of range, locking soon", "in", delay)
+	EmitEvent(Event{Type: EventLockPending, Reason: ReasonOutOfRange, RSSI: lastRSSI(), Message: "locking in " + seconds + " seconds"})
+	if LockWarningCommand == "" {
+		return
+	}
+
+	argv, err := SplitCommand(LockWarningCommand)
+	if err != nil {
+		slog.Error("Invalid lock_warning_command", "err", err)
+		return
+	}
+	for i := range argv {
+		argv[i] = strings.ReplaceAll(argv[i], "{seconds}", seconds)
+	}
+	go func() {
+		out, err := RunCommand(argv, delay, []string{"BLUELOCK_LOCK_IN=" + seconds})
+		if err != nil {
+			slog.Warn("Lock warning command failed", "err", err, "output", strings.TrimSpace(string(out)))
+		}
+	}()
+}
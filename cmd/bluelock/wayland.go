@@ -0,0 +1,119 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// sessionLockers are ext-session-lock-v1 screen lockers. While one runs the
+// Wayland session is locked.
+var sessionLockers = []string{"swaylock", "hyprlock", "gtklock", "waylock"}
+
+// isWaylandSession reports whether we're running in a Wayland session.
+func isWaylandSession() bool {
+	return os.Getenv("XDG_SESSION_TYPE") == "wayland" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// sessionLockerRunning returns the ext-session-lock locker that's running, if any.
+func sessionLockerRunning() string {
+	running := runningProcesses()
+	for _, locker := range sessionLockers {
+		if running[locker] {
+			return locker
+		}
+	}
+	return ""
+}
+
+// CheckWaylandSessionLock warns when the compositor doesn't implement
+// ext-session-lock-v1, without which Wayland screen lockers can't lock it.
+func CheckWaylandSessionLock() {
+	if !isWaylandSession() {
+		return
+	}
+	globals, err := waylandGlobals()
+	if err != nil {
+		slog.Debug("Couldn't list the Wayland compositor's globals", "err", err)
+		return
+	}
+	if !globals["ext_session_lock_manager_v1"] {
+		slog.Warn("The Wayland compositor doesn't support ext-session-lock-v1, screen lockers may not be able to lock it")
+	}
+}
+
+// waylandGlobals connects to the compositor and returns the interfaces it
+// advertises in the registry.
+func waylandGlobals() (map[string]bool, error) {
+	display := os.Getenv("WAYLAND_DISPLAY")
+	if display == "" {
+		display = "wayland-0"
+	}
+	if !filepath.IsAbs(display) {
+		display = filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), display)
+	}
+	conn, err := net.DialTimeout("unix", display, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// wl_display (object 1): get_registry(new_id 2), then sync(new_id 3) so the
+	// callback's done event marks the end of the global list
+	var request []byte
+	request = appendWaylandMessage(request, 1, 1, 2)
+	request = appendWaylandMessage(request, 1, 0, 3)
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	globals := map[string]bool{}
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return nil, err
+		}
+		object := binary.LittleEndian.Uint32(header)
+		opcode := binary.LittleEndian.Uint16(header[4:])
+		size := int(binary.LittleEndian.Uint16(header[6:]))
+		if size < 8 {
+			return nil, errors.New("malformed Wayland message")
+		}
+		body := make([]byte, size-8)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return nil, err
+		}
+		switch {
+		case object == 1 && opcode == 0:
+			return nil, errors.New("the compositor reported a protocol error")
+		case object == 2 && opcode == 0 && len(body) >= 8:
+			// wl_registry.global(name uint, interface string, version uint)
+			length := int(binary.LittleEndian.Uint32(body[4:]))
+			if length == 0 || 8+length > len(body) {
+				return nil, fmt.Errorf("malformed wl_registry.global event")
+			}
+			globals[string(body[8:8+length-1])] = true
+		case object == 3 && opcode == 0:
+			return globals, nil
+		}
+	}
+}
+
+// appendWaylandMessage appends a request with uint32 arguments.
+func appendWaylandMessage(b []byte, object uint32, opcode uint16, args ...uint32) []byte {
+	b = binary.LittleEndian.AppendUint32(b, object)
+	b = binary.LittleEndian.AppendUint32(b, uint32(8+4*len(args))<<16|uint32(opcode))
+	for _, arg := range args {
+		b = binary.LittleEndian.AppendUint32(b, arg)
+	}
+	return b
+}
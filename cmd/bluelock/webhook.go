@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webhookTimeout bounds a single webhook delivery attempt.
+const webhookTimeout = 10 * time.Second
+
+// maxRetryAfter bounds how long a receiver's Retry-After makes us wait.
+const maxRetryAfter = 5 * time.Minute
+
+// webhookClient sends webhook requests.
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// StartWebhooks POSTs every event whose type is in types to each of urls. With
+// a secret, requests carry an X-Bluelock-Signature header with the hex
+// HMAC-SHA256 of the body, prefixed by "sha256=".
+func StartWebhooks(urls []string, types []string, secret string, retries int) {
+	wanted := map[string]bool{}
+	for _, t := range types {
+		wanted[strings.TrimSpace(t)] = true
+	}
+	events, _, _ := SubscribeEvents(256)
+	go func() {
+		for e := range events {
+			if !wanted[e.Type] {
+				continue
+			}
+			body, err := json.Marshal(e)
+			if err != nil {
+				slog.Error("Failed to encode webhook payload", "err", err)
+				continue
+			}
+			for _, url := range urls {
+				go deliverWebhook(url, e.Type, body, secret, retries)
+			}
+		}
+	}()
+}
+
+// deliverWebhook POSTs body to url, retrying failed attempts.
+func deliverWebhook(url, eventType string, body []byte, secret string, retries int) {
+	attempts, err := withRetries(retries, func() error { return postWebhook(url, eventType, body, secret) })
+	if err != nil {
+		slog.Warn("Webhook delivery failed", "url", url, "event", eventType, "attempts", attempts, "err", err)
+		return
+	}
+	slog.Debug("Webhook delivered", "url", url, "event", eventType)
+}
+
+// withRetries calls send until it succeeds, retrying up to retries times with
+// exponential backoff, or after as long as a 429's Retry-After asks. Responses
+// with any other 4xx status aren't retried. It returns the number of attempts
+// made and the last error.
+func withRetries(retries int, send func() error) (int, error) {
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil {
+			return attempt, nil
+		}
+		wait := backoff
+		if e, ok := err.(httpStatusError); ok && e.status == http.StatusTooManyRequests {
+			if e.retryAfter > 0 {
+				wait = min(e.retryAfter, maxRetryAfter)
+			}
+		} else if ok && e.status < 500 {
+			return attempt, err
+		}
+		if attempt > retries {
+			return attempt, err
+		}
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+// httpStatusError is returned when a receiver answers with a non-2xx status.
+type httpStatusError struct {
+	status     int
+	retryAfter time.Duration // From the Retry-After header, 0 without one
+}
+
+func (e httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.status, http.StatusText(e.status))
+}
+
+// checkStatus closes the response body and turns a non-2xx status into an httpStatusError.
+func checkStatus(resp *http.Response) error {
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return httpStatusError{status: resp.StatusCode, retryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+	}
+	return nil
+}
+
+// retryAfter parses a Retry-After header, either seconds or an HTTP date. It
+// returns 0 when there's none or it can't be read.
+func retryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return max(time.Until(when), 0)
+	}
+	return 0
+}
+
+// postWebhook makes a single delivery attempt.
+func postWebhook(url, eventType string, body []byte, secret string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bluelock")
+	req.Header.Set("X-Bluelock-Event", eventType)
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Bluelock-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkStatus(resp)
+}
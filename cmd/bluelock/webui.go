@@ -0,0 +1,24 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// webUI is the dashboard page, which talks to the API with the token it asks
+// for.
+//
+//go:embed webui.html
+var webUI []byte
+
+// handleUI serves the dashboard page at GET /ui.
+func handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Write(webUI)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"time"
+)
+
+// ssidCacheFor is how long a looked up SSID is reused, so checking it every
+// scan doesn't mean a round of D-Bus calls every few seconds.
+const ssidCacheFor = 30 * time.Second
+
+var (
+	cachedSSIDValue string
+	cachedSSIDAt    time.Time
+)
+
+// wifiSSID returns the current Wi-Fi network, "" when not on one or when it
+// can't be told, looking it up at most every ssidCacheFor.
+func wifiSSID() string {
+	if time.Since(cachedSSIDAt) < ssidCacheFor {
+		return cachedSSIDValue
+	}
+	ssid, err := CurrentSSID()
+	if err != nil {
+		slog.Debug("Failed to read the Wi-Fi network", "err", err)
+	}
+	cachedSSIDValue, cachedSSIDAt = ssid, time.Now()
+	return ssid
+}
+
+// knownSSID reports whether a profile matches on ssid.
+func knownSSID(ssid string) bool {
+	for _, profile := range Profiles {
+		for _, known := range profile.Match.SSID {
+			if known == ssid {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// onUnknownWifi reports whether bluelock should stand by, neither locking nor
+// unlocking, because --disable_on_unknown_wifi is set and the Wi-Fi network
+// isn't in any profile's match. It logs when that changes.
+func onUnknownWifi() bool {
+	standby := false
+	ssid := ""
+	if DisableOnUnknownWifi {
+		ssid = wifiSSID()
+		standby = ssid != "" && !knownSSID(ssid)
+	}
+	if standby != CurrentState().Standby {
+		updateState(func(s *DaemonState) { s.Standby = standby })
+		if standby {
+			slog.Warn("Standing by on an unknown Wi-Fi network", "ssid", ssid)
+		} else {
+			slog.Info("Active again, no longer on an unknown Wi-Fi network")
+		}
+	}
+	return standby
+}
+
+// onTrustedNetwork reports whether the Wi-Fi network is a trusted_ssid or
+// one of this machine's addresses is in a trusted_subnet, where bluelock
+// only unlocks. It logs when that changes.
+func onTrustedNetwork() bool {
+	trusted, where := false, ""
+	if len(TrustedSSIDs) > 0 {
+		if ssid := wifiSSID(); ssid != "" {
+			for _, known := range TrustedSSIDs {
+				if ssid == known {
+					trusted, where = true, ssid
+				}
+			}
+		}
+	}
+	if !trusted && len(TrustedSubnets) > 0 {
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			slog.Debug("Failed to read the network addresses", "err", err)
+		}
+		for _, addr := range addrs {
+			ip, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			for _, subnet := range TrustedSubnets {
+				if _, network, err := net.ParseCIDR(subnet); err == nil && network.Contains(ip.IP) {
+					trusted, where = true, subnet
+				}
+			}
+		}
+	}
+	if trusted != CurrentState().Trusted {
+		updateState(func(s *DaemonState) { s.Trusted = trusted })
+		if trusted {
+			slog.Info("On a trusted network, not locking until leaving it", "network", where)
+		} else {
+			slog.Info("Left the trusted network, locking again")
+		}
+	}
+	return trusted
+}
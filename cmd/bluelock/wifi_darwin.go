@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// CurrentSSID returns the Wi-Fi network the Mac is connected to, or "" when
+// it isn't, from networksetup.
+func CurrentSSID() (string, error) {
+	out, err := RunCommand([]string{"networksetup", "-listallhardwareports"}, lockCommandTimeout, nil)
+	if err != nil {
+		return "", errors.New("networksetup: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	// Hardware Port: Wi-Fi
+	// Device: en0
+	var device string
+	wifi := false
+	for _, line := range strings.Split(string(out), "\n") {
+		if port, ok := strings.CutPrefix(line, "Hardware Port: "); ok {
+			wifi = port == "Wi-Fi" || port == "AirPort"
+		} else if name, ok := strings.CutPrefix(line, "Device: "); ok && wifi {
+			device = strings.TrimSpace(name)
+			break
+		}
+	}
+	if device == "" {
+		return "", nil
+	}
+	out, err = RunCommand([]string{"networksetup", "-getairportnetwork", device}, lockCommandTimeout, nil)
+	if err != nil {
+		return "", errors.New("networksetup: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	// Current Wi-Fi Network: Home, or "You are not associated with an AirPort network."
+	_, ssid, ok := strings.Cut(strings.TrimSpace(string(out)), "Network: ")
+	if !ok {
+		return "", nil
+	}
+	return ssid, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// nmDeviceTypeWifi is NetworkManager's NM_DEVICE_TYPE_WIFI.
+const nmDeviceTypeWifi = 2
+
+// dbusPath finds the object paths in a reply such as "([objectpath '/a', '/b'],)".
+var dbusPath = regexp.MustCompile(`'(/[^']*)'`)
+
+// CurrentSSID returns the Wi-Fi network NetworkManager is connected to, or ""
+// when no Wi-Fi device is.
+func CurrentSSID() (string, error) {
+	reply, err := DBusCall("system", "org.freedesktop.NetworkManager", "/org/freedesktop/NetworkManager",
+		"org.freedesktop.NetworkManager.GetDevices")
+	if err != nil {
+		return "", err
+	}
+	for _, match := range dbusPath.FindAllStringSubmatch(reply, -1) {
+		device := match[1]
+		reply, err := nmProperty(device, "org.freedesktop.NetworkManager.Device", "DeviceType")
+		if err != nil {
+			return "", err
+		}
+		if kind, _ := ParseDBusUint(reply); kind != nmDeviceTypeWifi {
+			continue
+		}
+		reply, err = nmProperty(device, "org.freedesktop.NetworkManager.Device.Wireless", "ActiveAccessPoint")
+		if err != nil {
+			return "", err
+		}
+		accessPoint := gvariantValue(reply)
+		if accessPoint == "/" || accessPoint == "" {
+			continue
+		}
+		reply, err = nmProperty(accessPoint, "org.freedesktop.NetworkManager.AccessPoint", "Ssid")
+		if err != nil {
+			return "", err
+		}
+		return parseDBusBytes(reply), nil
+	}
+	return "", nil
+}
+
+// nmProperty reads a property of a NetworkManager object.
+func nmProperty(path, iface, name string) (string, error) {
+	return DBusCall("system", "org.freedesktop.NetworkManager", path, "org.freedesktop.DBus.Properties.Get",
+		GVariantString(iface), GVariantString(name))
+}
+
+// parseDBusBytes decodes a byte array reply, which gdbus prints as a
+// bytestring "(<b'Home'>,)" when it's printable and "(<[byte 0x48, ...]>,)"
+// otherwise.
+func parseDBusBytes(reply string) string {
+	v := strings.TrimSpace(reply)
+	v = strings.TrimSuffix(strings.TrimPrefix(v, "("), ")")
+	v = strings.TrimSuffix(strings.TrimSpace(v), ",")
+	v = strings.TrimSuffix(strings.TrimPrefix(v, "<"), ">")
+	if strings.HasPrefix(v, "b'") && strings.HasSuffix(v, "'") {
+		var b strings.Builder
+		text := v[2 : len(v)-1]
+		for i := 0; i < len(text); i++ {
+			if text[i] == '\\' && i+1 < len(text) {
+				i++
+			}
+			b.WriteByte(text[i])
+		}
+		return strings.TrimRight(b.String(), "\x00")
+	}
+	var ssid []byte
+	for _, field := range strings.Fields(strings.NewReplacer("[", " ", "]", " ", ",", " ", "byte", " ").Replace(v)) {
+		if n, err := strconv.ParseUint(field, 0, 8); err == nil {
+			ssid = append(ssid, byte(n))
+		}
+	}
+	return string(ssid)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// CurrentSSID returns the Wi-Fi network Windows is connected to, or "" when
+// it isn't, from netsh.
+func CurrentSSID() (string, error) {
+	out, err := RunCommand([]string{"netsh", "wlan", "show", "interfaces"}, lockCommandTimeout, nil)
+	if err != nil {
+		// Machines without a wireless adapter have no WLAN service either
+		if strings.Contains(string(out), "wlansvc") {
+			return "", nil
+		}
+		return "", errors.New("netsh: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	// "    SSID                   : Home", next to a BSSID line
+	for _, line := range strings.Split(string(out), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.TrimSpace(name) == "SSID" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", nil
+}
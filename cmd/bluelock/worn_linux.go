@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// heartRateUUID is the GATT Heart Rate Measurement characteristic, which
+// watches that broadcast their heart rate notify.
+const heartRateUUID = "00002a37-0000-1000-8000-00805f9b34fb"
+
+// heartRateFresh is how recent the last measurement must be for the watch to
+// count as worn, as most stop measuring once taken off. After twice as long
+// without one the subscription is set up again, e.g. after a reconnect.
+const heartRateFresh = 30 * time.Second
+
+var (
+	gattCharPath = regexp.MustCompile(`objectpath '(/org/bluez/[^']+/service[0-9a-f]+/char[0-9a-f]+)'`)
+	gattByte     = regexp.MustCompile(`0x([0-9a-f]{2})`)
+)
+
+// heartRate follows the watch's heart rate measurements: bluetoothctl holds
+// the notification subscription, which BlueZ drops when its client goes, and
+// gdbus monitor reads the values.
+var heartRate struct {
+	mu      sync.Mutex
+	ctl     *exec.Cmd
+	monitor *exec.Cmd
+	stdin   io.WriteCloser
+	started time.Time
+	worn    bool
+	at      time.Time // When the last measurement came
+}
+
+// WatchWorn reports whether the watch at address is worn: its last heart rate
+// measurement is fresh and says the sensor touches skin, or, for sensors that
+// can't tell, has a heart rate.
+func WatchWorn(address string) (bool, error) {
+	h := &heartRate
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ctl != nil && time.Since(h.at) > 2*heartRateFresh && time.Since(h.started) > 2*heartRateFresh {
+		stopHeartRate()
+	}
+	if h.ctl == nil {
+		path, err := heartRateCharacteristic(address)
+		if err != nil {
+			return false, err
+		}
+		if err := startHeartRate(path); err != nil {
+			return false, err
+		}
+	}
+	return h.worn && time.Since(h.at) < heartRateFresh, nil
+}
+
+// heartRateCharacteristic finds the device's Heart Rate Measurement
+// characteristic among the GATT objects BlueZ has resolved.
+func heartRateCharacteristic(address string) (string, error) {
+	reply, err := DBusCall("system", "org.bluez", "/", "org.freedesktop.DBus.ObjectManager.GetManagedObjects")
+	if err != nil {
+		return "", fmt.Errorf("bluez: %w", err)
+	}
+	device := "/dev_" + strings.ReplaceAll(strings.ToUpper(address), ":", "_") + "/"
+	for _, match := range gattCharPath.FindAllStringSubmatch(reply, -1) {
+		path := match[1]
+		if !strings.Contains(path, device) {
+			continue
+		}
+		uuid, err := DBusCall("system", "org.bluez", path, "org.freedesktop.DBus.Properties.Get", "'org.bluez.GattCharacteristic1'", "'UUID'")
+		if err == nil && gvariantValue(uuid) == heartRateUUID {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s offers no heart rate, turn on heart rate broadcasting on the watch and connect it", address)
+}
+
+// startHeartRate subscribes to the characteristic at path. heartRate.mu must
+// be held.
+func startHeartRate(path string) error {
+	h := &heartRate
+	// Neither may outlive bluelock, or the watch stays subscribed
+	monitor := exec.Command("gdbus", "monitor", "--system", "--dest", "org.bluez", "--object-path", path)
+	monitor.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+	stdout, err := monitor.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := monitor.Start(); err != nil {
+		return err
+	}
+	ctl := exec.Command("bluetoothctl")
+	ctl.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+	stdin, err := ctl.StdinPipe()
+	if err == nil {
+		err = ctl.Start()
+	}
+	if err != nil {
+		monitor.Process.Kill()
+		monitor.Wait()
+		return fmt.Errorf("bluetoothctl: %w", err)
+	}
+	fmt.Fprintf(stdin, "menu gatt\nselect-attribute %s\nnotify on\n", path)
+	h.ctl, h.monitor, h.stdin, h.started = ctl, monitor, stdin, time.Now()
+
+	go func() {
+		lines := bufio.NewScanner(stdout)
+		for lines.Scan() {
+			// e.g. "/org/bluez/hci0/dev_.../char000d: org.freedesktop.DBus.Properties.PropertiesChanged ('org.bluez.GattCharacteristic1', {'Value': <[byte 0x16, 0x48]>}, @as [])"
+			if worn, err := parseHeartRate(lines.Text()); err == nil {
+				h.mu.Lock()
+				h.worn, h.at = worn, time.Now()
+				h.mu.Unlock()
+			}
+		}
+	}()
+	return nil
+}
+
+// stopHeartRate ends the subscription. heartRate.mu must be held.
+func stopHeartRate() {
+	h := &heartRate
+	h.stdin.Close()
+	for _, cmd := range []*exec.Cmd{h.ctl, h.monitor} {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	h.ctl, h.monitor, h.stdin = nil, nil, nil
+}
+
+// parseHeartRate reads a Heart Rate Measurement from a PropertiesChanged
+// signal: the flags byte's bit 2 says the sensor can tell skin contact and
+// bit 1 that it has it, bit 0 that the heart rate takes two bytes.
+func parseHeartRate(line string) (worn bool, err error) {
+	_, value, ok := strings.Cut(line, "'Value': <[")
+	if !ok {
+		return false, errors.New("no value")
+	}
+	value, _, _ = strings.Cut(value, "]")
+	var b []byte
+	for _, match := range gattByte.FindAllStringSubmatch(value, -1) {
+		var v byte
+		fmt.Sscanf(match[1], "%x", &v)
+		b = append(b, v)
+	}
+	if len(b) < 2 {
+		return false, errors.New("short measurement")
+	}
+	flags := b[0]
+	if flags&0x04 != 0 {
+		return flags&0x02 != 0, nil
+	}
+	rate := int(b[1])
+	if flags&0x01 != 0 && len(b) > 2 {
+		rate |= int(b[2]) << 8
+	}
+	return rate > 0, nil
+}
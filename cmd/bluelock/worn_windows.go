@@ -0,0 +1,8 @@
+package main
+
+import "errors"
+
+// WatchWorn needs BlueZ's GATT support, so it's only available on Linux.
+func WatchWorn(address string) (bool, error) {
+	return false, errors.New("the worn check needs BlueZ, on Linux")
+}
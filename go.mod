@@ -0,0 +1,3 @@
+module github.com/samhardeman/bluetooth-unlock
+
+go 1.24
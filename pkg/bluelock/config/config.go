@@ -0,0 +1,31 @@
+// Package config reads bluelock's config files, which are JSON, YAML or TOML
+// objects mapping setting names to values, e.g. {"lock_rssi": -14}. The values
+// come out the way encoding/json decodes them with UseNumber, whatever the
+// format, so a program embedding bluelock can read the user's file and apply
+// the settings it knows.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// Decode parses a config file as YAML or TOML by its extension, and as JSON
+// otherwise. Numbers decode to json.Number.
+func Decode(path string, data []byte) (map[string]any, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return decodeYAML(data)
+	case ".toml":
+		return decodeTOML(data)
+	}
+	var values map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// want is the settings every file in TestDecode holds.
+var want = map[string]any{
+	"bluetooth_device_address": "AA:BB:CC:DD:EE:FF",
+	"lock_rssi":                json.Number("-18"),
+	"check_interval":           "3s",
+	"notify":                   true,
+	"trusted_networks":         []any{"home", "office"},
+	"users": map[string]any{
+		"alice": map[string]any{"lock_rssi": json.Number("-20")},
+	},
+}
+
+func TestDecode(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{
+			"bluetooth_device_address": "AA:BB:CC:DD:EE:FF",
+			"lock_rssi": -18,
+			"check_interval": "3s",
+			"notify": true,
+			"trusted_networks": ["home", "office"],
+			"users": {"alice": {"lock_rssi": -20}}
+		}`,
+		"config.yaml": `
+# bluelock
+bluetooth_device_address: "AA:BB:CC:DD:EE:FF"
+lock_rssi: -18 # a bit further
+check_interval: 3s
+notify: true
+trusted_networks:
+  - home
+  - 'office'
+users:
+  alice:
+    lock_rssi: -20
+`,
+		"config.toml": `
+# bluelock
+bluetooth_device_address = "AA:BB:CC:DD:EE:FF"
+lock_rssi = -18 # a bit further
+check_interval = "3s"
+notify = true
+trusted_networks = [
+  "home",
+  "office",
+]
+
+[users.alice]
+lock_rssi = -20
+`,
+	}
+	for path, data := range files {
+		got, err := Decode(path, []byte(data))
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\n got %#v\nwant %#v", path, got, want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	files := map[string]string{
+		"bad.json":       `{"lock_rssi": }`,
+		"tabs.yaml":      "users:\n\talice: {}\n",
+		"list.yaml":      "- a\n- b\n",
+		"indent.yaml":    "lock_rssi: -18\n  notify: true\n",
+		"header.toml":    "[users\n",
+		"novalue.toml":   "lock_rssi =\n",
+		"noequals.toml":  "lock_rssi -18\n",
+		"twice.toml":     "lock_rssi = -18\nlock_rssi = -20\n",
+		"redefined.toml": "users = 1\n[users.alice]\n",
+	}
+	for path, data := range files {
+		if got, err := Decode(path, []byte(data)); err == nil {
+			t.Errorf("%s: no error, got %#v", path, got)
+		}
+	}
+}
+
+func TestDecodeEmpty(t *testing.T) {
+	for _, path := range []string{"empty.yaml", "empty.toml"} {
+		got, err := Decode(path, nil)
+		if err != nil || len(got) != 0 {
+			t.Errorf("%s: got %#v, %v; want no settings", path, got, err)
+		}
+	}
+}
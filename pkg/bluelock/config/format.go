@@ -0,0 +1,367 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The YAML and TOML readers below cover what a config file needs: keys with
+// strings, numbers, booleans and lists, and nested sections for users. They
+// decode to the same values encoding/json does with UseNumber.
+
+// yamlLine is a non-blank YAML line with its comment removed.
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// decodeYAML reads a YAML mapping of settings.
+func decodeYAML(data []byte) (map[string]any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		text := strings.TrimRight(stripComment(raw, true), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", i+1)
+		}
+		lines = append(lines, yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return map[string]any{}, nil
+	}
+	value, next, err := parseYAMLBlock(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[next].number)
+	}
+	values, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("expected a mapping of settings")
+	}
+	return values, nil
+}
+
+// parseYAMLBlock parses the mapping or sequence starting at lines[i], whose
+// lines are indented by indent, and returns it with the index after it.
+func parseYAMLBlock(lines []yamlLine, i, indent int) (any, int, error) {
+	if isYAMLItem(lines[i].text) {
+		var list []any
+		for i < len(lines) && lines[i].indent == indent && isYAMLItem(lines[i].text) {
+			item := strings.TrimSpace(lines[i].text[1:])
+			if item != "" {
+				value, err := parseYAMLScalar(item)
+				if err != nil {
+					return nil, 0, fmt.Errorf("line %d: %v", lines[i].number, err)
+				}
+				list, i = append(list, value), i+1
+				continue
+			}
+			if i+1 >= len(lines) || lines[i+1].indent <= indent {
+				list, i = append(list, nil), i+1
+				continue
+			}
+			value, next, err := parseYAMLBlock(lines, i+1, lines[i+1].indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			list, i = append(list, value), next
+		}
+		return list, i, nil
+	}
+
+	values := map[string]any{}
+	for i < len(lines) && lines[i].indent == indent && !isYAMLItem(lines[i].text) {
+		line := lines[i]
+		key, rest, ok := cutYAMLKey(line.text)
+		if !ok {
+			return nil, 0, fmt.Errorf("line %d: expected key: value", line.number)
+		}
+		if _, dup := values[key]; dup {
+			return nil, 0, fmt.Errorf("line %d: %q appears twice", line.number, key)
+		}
+		i++
+		switch {
+		case rest != "":
+			value, err := parseYAMLScalar(rest)
+			if err != nil {
+				return nil, 0, fmt.Errorf("line %d: %v", line.number, err)
+			}
+			values[key] = value
+		case i < len(lines) && (lines[i].indent > indent || lines[i].indent == indent && isYAMLItem(lines[i].text)):
+			// A nested block, sequences may sit at the key's own indentation
+			value, next, err := parseYAMLBlock(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			values[key], i = value, next
+		default:
+			values[key] = nil
+		}
+	}
+	return values, i, nil
+}
+
+// isYAMLItem reports whether a line is a sequence entry.
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// cutYAMLKey splits "key: value" into the unquoted key and the value.
+func cutYAMLKey(text string) (key, rest string, ok bool) {
+	end := -1
+	if text[0] == '"' || text[0] == '\'' {
+		end = strings.IndexByte(text[1:], text[0]) + 1
+		if end == 0 {
+			return "", "", false
+		}
+	}
+	colon := strings.Index(text[end+1:], ":")
+	if colon < 0 {
+		return "", "", false
+	}
+	colon += end + 1
+	rest = text[colon+1:]
+	if rest != "" && rest[0] != ' ' {
+		return "", "", false
+	}
+	key, err := unquoteKey(strings.TrimSpace(text[:colon]))
+	return key, strings.TrimSpace(rest), err == nil && key != ""
+}
+
+// parseYAMLScalar parses a plain, quoted or [flow, list] value.
+func parseYAMLScalar(text string) (any, error) {
+	switch {
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, errors.New("unterminated list")
+		}
+		var list []any
+		for _, item := range splitList(text[1 : len(text)-1]) {
+			value, err := parseYAMLScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case strings.HasPrefix(text, "{"):
+		return nil, errors.New("inline mappings aren't supported, use an indented block")
+	case strings.HasPrefix(text, `"`), strings.HasPrefix(text, "'"):
+		return unquoteKey(text)
+	}
+	switch strings.ToLower(text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null", "~":
+		return nil, nil
+	}
+	if _, err := strconv.ParseFloat(text, 64); err == nil {
+		return json.Number(text), nil
+	}
+	return text, nil
+}
+
+// decodeTOML reads a TOML document of settings, with [users.<name>] tables.
+func decodeTOML(data []byte) (map[string]any, error) {
+	root := map[string]any{}
+	table := root
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		number := i + 1
+		line := strings.TrimSpace(stripComment(lines[i], false))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if strings.HasPrefix(line, "[[") || !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: expected a [table] header", number)
+			}
+			table = root
+			for _, part := range splitDotted(line[1 : len(line)-1]) {
+				name, err := unquoteKey(part)
+				if err != nil || name == "" {
+					return nil, fmt.Errorf("line %d: invalid table name %q", number, part)
+				}
+				if table[name] == nil {
+					table[name] = map[string]any{}
+				}
+				next, ok := table[name].(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("line %d: %q is already a value", number, name)
+				}
+				table = next
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", number)
+		}
+		name, err := unquoteKey(strings.TrimSpace(key))
+		if err != nil || name == "" {
+			return nil, fmt.Errorf("line %d: invalid key %q", number, strings.TrimSpace(key))
+		}
+		value = strings.TrimSpace(value)
+		// Arrays may go on over several lines
+		for strings.HasPrefix(value, "[") && !closesList(value) && i+1 < len(lines) {
+			i++
+			value += " " + strings.TrimSpace(stripComment(lines[i], false))
+		}
+		parsed, err := parseTOMLValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", number, name, err)
+		}
+		if _, dup := table[name]; dup {
+			return nil, fmt.Errorf("line %d: %q appears twice", number, name)
+		}
+		table[name] = parsed
+	}
+	return root, nil
+}
+
+// parseTOMLValue parses a string, number, boolean or array.
+func parseTOMLValue(text string) (any, error) {
+	switch {
+	case text == "":
+		return nil, errors.New("missing value")
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, errors.New("unterminated array")
+		}
+		list := []any{}
+		for _, item := range splitList(text[1 : len(text)-1]) {
+			value, err := parseTOMLValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case strings.HasPrefix(text, "{"):
+		return nil, errors.New("inline tables aren't supported, use a [table]")
+	case strings.HasPrefix(text, `"`), strings.HasPrefix(text, "'"):
+		return unquoteKey(text)
+	case text == "true":
+		return true, nil
+	case text == "false":
+		return false, nil
+	}
+	number := strings.ReplaceAll(text, "_", "")
+	if _, err := strconv.ParseFloat(number, 64); err == nil {
+		return json.Number(number), nil
+	}
+	return nil, fmt.Errorf("invalid value %s, strings need quotes", text)
+}
+
+// unquoteKey returns text without its double or single quotes, if it has any.
+func unquoteKey(text string) (string, error) {
+	if len(text) >= 2 && text[0] == '\'' && text[len(text)-1] == '\'' {
+		// YAML doubles a quote inside single quotes, TOML can't have one at all
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		return strconv.Unquote(text)
+	}
+	return text, nil
+}
+
+// stripComment removes a # comment outside quotes. YAML only starts one at the
+// beginning of the line or after a space.
+func stripComment(line string, needSpace bool) string {
+	end := len(line)
+	eachUnquoted(line, func(i int, c byte) bool {
+		if c == '#' && (!needSpace || i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			end = i
+			return false
+		}
+		return true
+	})
+	return line[:end]
+}
+
+// splitList splits the inside of a [list] on the commas outside quotes and
+// nested lists, dropping a trailing comma.
+func splitList(text string) []string {
+	var items []string
+	depth, start := 0, 0
+	eachUnquoted(text, func(i int, c byte) bool {
+		switch {
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			items = append(items, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+		return true
+	})
+	if last := strings.TrimSpace(text[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+// closesList reports whether text, which starts with [, contains its closing ].
+func closesList(text string) bool {
+	depth, closed := 0, false
+	eachUnquoted(text, func(i int, c byte) bool {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+		closed = depth == 0
+		return !closed
+	})
+	return closed
+}
+
+// splitDotted splits a TOML table name such as users."bob.smith" on its dots.
+func splitDotted(name string) []string {
+	var parts []string
+	start := 0
+	eachUnquoted(name, func(i int, c byte) bool {
+		if c == '.' {
+			parts = append(parts, strings.TrimSpace(name[start:i]))
+			start = i + 1
+		}
+		return true
+	})
+	return append(parts, strings.TrimSpace(name[start:]))
+}
+
+// eachUnquoted calls fn with every byte of text outside quoted strings, until
+// fn returns false.
+func eachUnquoted(text string, fn func(i int, c byte) bool) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		default:
+			if !fn(i, c) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package bluelock
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType says what an Event is about. The names are the ones the daemon
+// uses on its event socket.
+type EventType string
+
+// The events a Monitor emits.
+const (
+	EventRSSISample  EventType = "rssi_sample"   // A check read the device, RSSI is nil when it didn't answer
+	EventStateChange EventType = "state_change"  // The mode went From one To the other
+	EventLock        EventType = "lock"          // The screen was locked
+	EventUnlock      EventType = "unlock"        // The screen was unlocked
+	EventLockFailed  EventType = "lock_failed"   // Locking or unlocking failed with Err
+	EventLockPending EventType = "lock_pending"  // The device left, a lock follows after the lock warning
+	EventLockCancel  EventType = "lock_canceled" // The device came back before the pending lock
+	EventError       EventType = "error"         // A scan failed with Err
+)
+
+// Event is something that happened in a Monitor.
+type Event struct {
+	Time   time.Time
+	Type   EventType
+	Device string
+	RSSI   *int   // With rssi_sample, lock and unlock
+	From   string // With state_change, "locked" or "unlocked"
+	To     string
+	Reason string // Why it locked or unlocked, one of the statemachine reasons
+	Err    error  // With error and lock_failed
+}
+
+// observers are a Monitor's callbacks and subscriptions.
+type observers struct {
+	mu          sync.Mutex
+	callbacks   []func(Event)
+	subscribers map[chan Event]struct{}
+}
+
+// WithObserver calls fn with every event. fn runs on the monitor's goroutine
+// between checks, so it should return quickly; Subscribe suits slow work.
+func WithObserver(fn func(Event)) Option {
+	return func(m *Monitor) { m.observers.callbacks = append(m.observers.callbacks, fn) }
+}
+
+// Observe calls fn with every event from now on, like WithObserver.
+func (m *Monitor) Observe(fn func(Event)) {
+	m.observers.mu.Lock()
+	defer m.observers.mu.Unlock()
+	m.observers.callbacks = append(m.observers.callbacks, fn)
+}
+
+// Subscribe returns a channel receiving every event from now on, holding up to
+// buffer of them, and a function that ends the subscription and closes the
+// channel. A subscriber that falls behind misses events rather than holding
+// up the checks.
+func (m *Monitor) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	o := &m.observers
+	o.mu.Lock()
+	if o.subscribers == nil {
+		o.subscribers = map[chan Event]struct{}{}
+	}
+	o.subscribers[ch] = struct{}{}
+	o.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			o.mu.Lock()
+			delete(o.subscribers, ch)
+			o.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// emit stamps events and hands them to the callbacks and subscribers.
+func (o *observers) emit(events ...Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, e := range events {
+		if e.Time.IsZero() {
+			e.Time = time.Now()
+		}
+		for _, fn := range o.callbacks {
+			fn(e)
+		}
+		for ch := range o.subscribers {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Client calls the API of a daemon started with --grpc_listen. Make one with
+// NewClient.
+type Client struct {
+	addr  string
+	token string
+	http  *http.Client
+}
+
+// NewClient returns a client for the API at addr, host:port, sending token
+// (the daemon's api_token) with every call. It speaks cleartext HTTP/2, as the
+// daemon does.
+func NewClient(addr, token string) *Client {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &Client{
+		addr:  addr,
+		token: token,
+		http:  &http.Client{Transport: &http.Transport{Protocols: &protocols}},
+	}
+}
+
+// Error is a call's failure as the daemon reported it.
+type Error struct {
+	Code    int // One of the Code constants
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("bluelock: grpc status %d: %s", e.Code, e.Message)
+}
+
+// Status returns the daemon's state.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var st Status
+	return &st, c.unary(ctx, "Status", nil, &st)
+}
+
+// Pause pauses automatic locking and unlocking, or resumes with 0 seconds.
+func (c *Client) Pause(ctx context.Context, r *PauseRequest) (*Status, error) {
+	var st Status
+	return &st, c.unary(ctx, "Pause", r.Marshal(), &st)
+}
+
+// Lock locks the session now. The lock holds until the device has left range.
+func (c *Client) Lock(ctx context.Context) (*Status, error) {
+	var st Status
+	return &st, c.unary(ctx, "Lock", nil, &st)
+}
+
+// UpdateConfig changes the settings that can change at runtime and returns
+// the whole configuration.
+func (c *Client) UpdateConfig(ctx context.Context, u *ConfigUpdate) (*Config, error) {
+	var config Config
+	return &config, c.unary(ctx, "UpdateConfig", u.Marshal(), &config)
+}
+
+// Watch streams the daemon's events until ctx is done or the stream is closed.
+func (c *Client) Watch(ctx context.Context, r *WatchRequest) (*EventStream, error) {
+	resp, err := c.call(ctx, "Watch", r.Marshal())
+	if err != nil {
+		return nil, err
+	}
+	return &EventStream{resp: resp}, nil
+}
+
+// EventStream is the events of a Watch call.
+type EventStream struct {
+	resp *http.Response
+}
+
+// Recv returns the next event. When the stream ends it returns io.EOF, or the
+// error the daemon ended it with.
+func (s *EventStream) Recv() (*Event, error) {
+	message, err := ReadMessage(s.resp.Body)
+	if err == io.EOF {
+		if err := callStatus(s.resp); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, err
+	}
+	var e Event
+	if err := e.Unmarshal(message); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Close ends the stream.
+func (s *EventStream) Close() error {
+	return s.resp.Body.Close()
+}
+
+// unary makes a call that has a single response, read into response.
+func (c *Client) unary(ctx context.Context, method string, request []byte, response interface{ Unmarshal([]byte) error }) error {
+	resp, err := c.call(ctx, method, request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	message, err := ReadMessage(resp.Body)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	// The status comes in the trailers, after the body
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	if err := callStatus(resp); err != nil {
+		return err
+	}
+	if message == nil {
+		return errors.New("bluelock: no response message")
+	}
+	return response.Unmarshal(message)
+}
+
+// call starts a call, returning the response once its headers are in.
+func (c *Client) call(ctx context.Context, method string, request []byte) (*http.Response, error) {
+	var body bytes.Buffer
+	WriteMessage(&body, request)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+c.addr+Service+method, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("bluelock: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// callStatus returns the error a finished call ended with, nil when it
+// succeeded. A call that failed at once has the status in its headers.
+func callStatus(resp *http.Response) error {
+	header := resp.Trailer
+	if header.Get("Grpc-Status") == "" {
+		header = resp.Header
+	}
+	code, err := strconv.Atoi(header.Get("Grpc-Status"))
+	if err != nil {
+		return errors.New("bluelock: response without a grpc status")
+	}
+	if code == CodeOK {
+		return nil
+	}
+	return &Error{Code: code, Message: header.Get("Grpc-Message")}
+}
@@ -0,0 +1,254 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// message is what every message type implements.
+type message interface {
+	Marshal() []byte
+	Unmarshal([]byte) error
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		m    message
+		want []byte
+	}{
+		{"empty status", &Status{}, nil},
+		{"status", &Status{Mode: "locked", RSSI: -5, InRange: true, LastSeenUnix: 300},
+			[]byte{0x0a, 6, 'l', 'o', 'c', 'k', 'e', 'd', 0x10, 0xfb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0x20, 1, 0x28, 0xac, 0x02}},
+		{"event with an rssi of 0", &Event{Type: "lock", RSSI: ptr[int32](0)},
+			[]byte{0x12, 4, 'l', 'o', 'c', 'k', 0x20, 0}},
+		{"watch", &WatchRequest{Types: []string{"lock", ""}, Recent: true},
+			[]byte{0x0a, 4, 'l', 'o', 'c', 'k', 0x0a, 0, 0x10, 1}},
+		{"pause", &PauseRequest{Seconds: 60}, []byte{0x08, 60}},
+		{"update with zero values", &ConfigUpdate{LockRSSI: ptr[int32](0), Debug: ptr(false), Schedule: ptr("")},
+			[]byte{0x10, 0, 0x30, 0, 0x3a, 0}},
+		{"config in name order", &Config{Settings: map[string]string{"lock_rssi": "-14", "debug": "true"}},
+			[]byte{
+				0x0a, 13, 0x0a, 5, 'd', 'e', 'b', 'u', 'g', 0x12, 4, 't', 'r', 'u', 'e',
+				0x0a, 16, 0x0a, 9, 'l', 'o', 'c', 'k', '_', 'r', 's', 's', 'i', 0x12, 3, '-', '1', '4',
+			}},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Marshal(); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got % x, want % x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		in, out message
+	}{
+		{&Status{Mode: "unlocked", RSSI: -128, Connected: true, InRange: true, LastSeenUnix: 1 << 40, PausedUntilUnix: -1, ManualLock: true, Health: "blind"}, &Status{}},
+		{&Event{TimeUnixNano: 1e18, Type: "state_change", Device: "AA:BB:CC:DD:EE:FF", RSSI: ptr[int32](-20), From: "locked", To: "unlocked", Reason: "in_range", Message: "ü", User: "alice"}, &Event{}},
+		{&WatchRequest{Types: []string{"lock", "unlock"}, Recent: true}, &WatchRequest{}},
+		{&PauseRequest{Seconds: 3600}, &PauseRequest{}},
+		{&ConfigUpdate{BluetoothDeviceAddress: ptr("AA:BB:CC:DD:EE:FF"), LockRSSI: ptr[int32](-20), UnlockRSSI: ptr[int32](0), CheckInterval: ptr("3s"), SessionTimeout: ptr(""), Debug: ptr(true), Schedule: ptr("Mon-Fri 09:00-17:00"), OutsideSchedule: ptr("lock-only")}, &ConfigUpdate{}},
+		{&ConfigUpdate{}, &ConfigUpdate{}},
+		{&Config{Settings: map[string]string{"a": "1", "b": "", "": "c"}}, &Config{}},
+	}
+	for _, tt := range tests {
+		if err := tt.out.Unmarshal(tt.in.Marshal()); err != nil {
+			t.Errorf("%T: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.in, tt.out) {
+			t.Errorf("%T:\n got %+v\nwant %+v", tt.in, tt.out, tt.in)
+		}
+	}
+}
+
+func TestUnmarshalSkipsUnknownFields(t *testing.T) {
+	data := []byte{
+		0xa0, 0x01, 7, // Field 20, varint
+		0x0a, 2, 'o', 'k', // Field 1, the mode
+		0x49, 1, 2, 3, 4, 5, 6, 7, 8, // Field 9, fixed64
+		0x4a, 1, 'x', // Field 9, bytes
+		0x4d, 1, 2, 3, 4, // Field 9, fixed32
+	}
+	var st Status
+	if err := st.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Status{Mode: "ok"}); st != want {
+		t.Errorf("got %+v, want %+v", st, want)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		m    message
+		data []byte
+	}{
+		{"truncated key", &Status{}, []byte{0x80}},
+		{"field 0", &Status{}, []byte{0x00, 1}},
+		{"truncated varint", &Status{}, []byte{0x10, 0x80}},
+		{"overlong varint", &Status{}, []byte{0x10, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{"truncated length", &Status{}, []byte{0x0a}},
+		{"length past the end", &Status{}, []byte{0x0a, 5, 'a'}},
+		{"huge length", &Status{}, []byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+		{"truncated fixed64", &Status{}, []byte{0x49, 1, 2, 3}},
+		{"truncated fixed32", &Status{}, []byte{0x4d, 1}},
+		{"group start", &Status{}, []byte{0x4b}},
+		{"group end", &Status{}, []byte{0x4c}},
+		{"wire type 6", &Status{}, []byte{0x4e}},
+		{"wire type 7", &Status{}, []byte{0x4f}},
+		{"status mode as a varint", &Status{}, []byte{0x08, 1}},
+		{"status rssi as bytes", &Status{}, []byte{0x12, 0}},
+		{"event rssi as fixed32", &Event{}, []byte{0x25, 1, 2, 3, 4}},
+		{"watch types as a varint", &WatchRequest{}, []byte{0x08, 1}},
+		{"watch recent as bytes", &WatchRequest{}, []byte{0x12, 0}},
+		{"pause seconds as bytes", &PauseRequest{}, []byte{0x0a, 1, '6'}},
+		{"pause seconds as fixed64", &PauseRequest{}, []byte{0x09, 1, 2, 3, 4, 5, 6, 7, 8}},
+		{"update address as a varint", &ConfigUpdate{}, []byte{0x08, 1}},
+		{"update lock_rssi as bytes", &ConfigUpdate{}, []byte{0x12, 1, 'x'}},
+		{"update unlock_rssi as bytes", &ConfigUpdate{}, []byte{0x1a, 0}},
+		{"update debug as bytes", &ConfigUpdate{}, []byte{0x32, 0}},
+		{"update schedule as a varint", &ConfigUpdate{}, []byte{0x38, 0}},
+		{"config entry as a varint", &Config{}, []byte{0x08, 1}},
+		{"config entry malformed", &Config{}, []byte{0x0a, 1, 0x80}},
+		{"config name as a varint", &Config{}, []byte{0x0a, 2, 0x08, 1}},
+	}
+	for _, tt := range tests {
+		if err := tt.m.Unmarshal(tt.data); err == nil {
+			t.Errorf("%s: decoded % x into %+v", tt.name, tt.data, tt.m)
+		}
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"empty message", []byte{0, 0, 0, 0, 0}, []byte{}, false},
+		{"message", []byte{0, 0, 0, 0, 2, 0x08, 1, 0xff}, []byte{0x08, 1}, false},
+		{"compressed", []byte{1, 0, 0, 0, 2, 0x08, 1}, nil, true},
+		{"too large", []byte{0, 0, 1, 0, 1}, nil, true},
+		{"truncated header", []byte{0, 0, 0}, nil, true},
+		{"truncated message", []byte{0, 0, 0, 0, 3, 0x08}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ReadMessage(bytes.NewReader(tt.data))
+		if (err != nil) != tt.wantErr || !bytes.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+			t.Errorf("%s: got % x, %v", tt.name, got, err)
+		}
+	}
+	if _, err := ReadMessage(bytes.NewReader(nil)); err != io.EOF {
+		t.Errorf("at the end: got %v, want io.EOF", err)
+	}
+
+	var b bytes.Buffer
+	WriteMessage(&b, []byte{0x08, 1})
+	WriteMessage(&b, nil)
+	for _, want := range [][]byte{{0x08, 1}, {}} {
+		if got, err := ReadMessage(&b); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("written % x: read % x, %v", want, got, err)
+		}
+	}
+}
+
+// fakeDaemon answers calls the way the daemon does: the status in the
+// trailers, or in the headers when a call fails before any reply.
+func fakeDaemon(t *testing.T) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fail := func(code int, message string) {
+			w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+			w.Header().Set(http.TrailerPrefix+"Grpc-Message", message)
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			fail(CodeUnauthenticated, "missing or invalid token")
+			return
+		}
+		request, err := ReadMessage(r.Body)
+		if err != nil {
+			fail(CodeInvalidArgument, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		switch strings.TrimPrefix(r.URL.Path, Service) {
+		case "Pause":
+			var pause PauseRequest
+			if err := pause.Unmarshal(request); err != nil {
+				fail(CodeInvalidArgument, err.Error())
+				return
+			}
+			WriteMessage(w, (&Status{Mode: "unlocked", PausedUntilUnix: pause.Seconds}).Marshal())
+		case "Watch":
+			var watch WatchRequest
+			if err := watch.Unmarshal(request); err != nil {
+				fail(CodeInvalidArgument, err.Error())
+				return
+			}
+			for _, typ := range watch.Types {
+				WriteMessage(w, (&Event{Type: typ}).Marshal())
+			}
+		default:
+			fail(CodeUnimplemented, "unknown method "+r.URL.Path)
+			return
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	})
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient(t *testing.T) {
+	server := fakeDaemon(t)
+	addr := strings.TrimPrefix(server.URL, "http://")
+	ctx := context.Background()
+	c := NewClient(addr, "secret")
+
+	st, err := c.Pause(ctx, &PauseRequest{Seconds: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Status{Mode: "unlocked", PausedUntilUnix: 60}); *st != want {
+		t.Errorf("Pause: got %+v, want %+v", *st, want)
+	}
+
+	var callErr *Error
+	if _, err := c.Lock(ctx); !errors.As(err, &callErr) || callErr.Code != CodeUnimplemented {
+		t.Errorf("Lock: got %v, want an unimplemented error", err)
+	}
+	if _, err := NewClient(addr, "wrong").Status(ctx); !errors.As(err, &callErr) || callErr.Code != CodeUnauthenticated {
+		t.Errorf("Status with the wrong token: got %v, want an unauthenticated error", err)
+	}
+
+	stream, err := c.Watch(ctx, &WatchRequest{Types: []string{"lock", "unlock"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	for _, want := range []string{"lock", "unlock"} {
+		e, err := stream.Recv()
+		if err != nil || e.Type != want {
+			t.Fatalf("Recv: got %+v, %v, want a %s event", e, err, want)
+		}
+	}
+	if e, err := stream.Recv(); err != io.EOF {
+		t.Errorf("Recv at the end: got %+v, %v, want io.EOF", e, err)
+	}
+}
@@ -0,0 +1,300 @@
+package grpcapi
+
+import (
+	"sort"
+	"time"
+)
+
+// Each message has Marshal and Unmarshal methods. Unmarshal skips fields it
+// doesn't know and fails on a known field of the wrong type.
+
+// Status is the daemon's state, what Status, Pause and Lock return.
+type Status struct {
+	Mode            string // locked or unlocked
+	RSSI            int32
+	Connected       bool
+	InRange         bool
+	LastSeenUnix    int64 // 0 if never seen
+	PausedUntilUnix int64 // 0 if not paused
+	ManualLock      bool
+	Health          string // ok, degraded or blind
+}
+
+func (s *Status) Marshal() []byte {
+	var b buffer
+	b.string(1, s.Mode)
+	b.int(2, int64(s.RSSI))
+	b.bool(3, s.Connected)
+	b.bool(4, s.InRange)
+	b.int(5, s.LastSeenUnix)
+	b.int(6, s.PausedUntilUnix)
+	b.bool(7, s.ManualLock)
+	b.string(8, s.Health)
+	return b
+}
+
+func (s *Status) Unmarshal(data []byte) error {
+	*s = Status{}
+	return decode(data, func(field int, v value) (err error) {
+		switch field {
+		case 1:
+			s.Mode, err = v.string()
+		case 2:
+			s.RSSI, err = v.int32()
+		case 3:
+			s.Connected, err = v.bool()
+		case 4:
+			s.InRange, err = v.bool()
+		case 5:
+			s.LastSeenUnix, err = v.int()
+		case 6:
+			s.PausedUntilUnix, err = v.int()
+		case 7:
+			s.ManualLock, err = v.bool()
+		case 8:
+			s.Health, err = v.string()
+		}
+		return err
+	})
+}
+
+// WatchRequest asks Watch for events.
+type WatchRequest struct {
+	Types  []string // Event types to receive, all when empty
+	Recent bool     // Start with the recent events already emitted
+}
+
+func (r *WatchRequest) Marshal() []byte {
+	var b buffer
+	for _, t := range r.Types {
+		b.bytes(1, []byte(t))
+	}
+	b.bool(2, r.Recent)
+	return b
+}
+
+func (r *WatchRequest) Unmarshal(data []byte) error {
+	*r = WatchRequest{}
+	return decode(data, func(field int, v value) error {
+		switch field {
+		case 1:
+			t, err := v.string()
+			r.Types = append(r.Types, t)
+			return err
+		case 2:
+			var err error
+			r.Recent, err = v.bool()
+			return err
+		}
+		return nil
+	})
+}
+
+// Event is one of the daemon's events, as Watch streams them.
+type Event struct {
+	TimeUnixNano int64
+	Type         string
+	Device       string
+	RSSI         *int32
+	From         string
+	To           string
+	Reason       string
+	Message      string
+	User         string
+}
+
+// Time returns when the event happened.
+func (e *Event) Time() time.Time {
+	return time.Unix(0, e.TimeUnixNano)
+}
+
+func (e *Event) Marshal() []byte {
+	var b buffer
+	b.int(1, e.TimeUnixNano)
+	b.string(2, e.Type)
+	b.string(3, e.Device)
+	if e.RSSI != nil {
+		b.field(4, uint64(int64(*e.RSSI)))
+	}
+	b.string(5, e.From)
+	b.string(6, e.To)
+	b.string(7, e.Reason)
+	b.string(8, e.Message)
+	b.string(9, e.User)
+	return b
+}
+
+func (e *Event) Unmarshal(data []byte) error {
+	*e = Event{}
+	return decode(data, func(field int, v value) (err error) {
+		switch field {
+		case 1:
+			e.TimeUnixNano, err = v.int()
+		case 2:
+			e.Type, err = v.string()
+		case 3:
+			e.Device, err = v.string()
+		case 4:
+			var rssi int32
+			rssi, err = v.int32()
+			e.RSSI = &rssi
+		case 5:
+			e.From, err = v.string()
+		case 6:
+			e.To, err = v.string()
+		case 7:
+			e.Reason, err = v.string()
+		case 8:
+			e.Message, err = v.string()
+		case 9:
+			e.User, err = v.string()
+		}
+		return err
+	})
+}
+
+// PauseRequest asks Pause to pause for Seconds, or to resume with 0.
+type PauseRequest struct {
+	Seconds int64
+}
+
+func (r *PauseRequest) Marshal() []byte {
+	var b buffer
+	b.int(1, r.Seconds)
+	return b
+}
+
+func (r *PauseRequest) Unmarshal(data []byte) error {
+	*r = PauseRequest{}
+	return decode(data, func(field int, v value) (err error) {
+		if field == 1 {
+			r.Seconds, err = v.int()
+		}
+		return err
+	})
+}
+
+// ConfigUpdate holds the settings UpdateConfig changes, nil ones are left as
+// they are.
+type ConfigUpdate struct {
+	BluetoothDeviceAddress *string
+	LockRSSI               *int32
+	UnlockRSSI             *int32
+	CheckInterval          *string
+	SessionTimeout         *string
+	Debug                  *bool
+	Schedule               *string
+	OutsideSchedule        *string
+}
+
+func (u *ConfigUpdate) Marshal() []byte {
+	var b buffer
+	text := func(field int, s *string) {
+		if s != nil {
+			b.bytes(field, []byte(*s))
+		}
+	}
+	number := func(field int, n *int32) {
+		if n != nil {
+			b.field(field, uint64(int64(*n)))
+		}
+	}
+	text(1, u.BluetoothDeviceAddress)
+	number(2, u.LockRSSI)
+	number(3, u.UnlockRSSI)
+	text(4, u.CheckInterval)
+	text(5, u.SessionTimeout)
+	if u.Debug != nil {
+		var debug uint64
+		if *u.Debug {
+			debug = 1
+		}
+		b.field(6, debug)
+	}
+	text(7, u.Schedule)
+	text(8, u.OutsideSchedule)
+	return b
+}
+
+func (u *ConfigUpdate) Unmarshal(data []byte) error {
+	*u = ConfigUpdate{}
+	return decode(data, func(field int, v value) error {
+		text := func(to **string) error {
+			s, err := v.string()
+			*to = &s
+			return err
+		}
+		number := func(to **int32) error {
+			n, err := v.int32()
+			*to = &n
+			return err
+		}
+		switch field {
+		case 1:
+			return text(&u.BluetoothDeviceAddress)
+		case 2:
+			return number(&u.LockRSSI)
+		case 3:
+			return number(&u.UnlockRSSI)
+		case 4:
+			return text(&u.CheckInterval)
+		case 5:
+			return text(&u.SessionTimeout)
+		case 6:
+			debug, err := v.bool()
+			u.Debug = &debug
+			return err
+		case 7:
+			return text(&u.Schedule)
+		case 8:
+			return text(&u.OutsideSchedule)
+		}
+		return nil
+	})
+}
+
+// Config is the daemon's whole configuration, each setting as text.
+type Config struct {
+	Settings map[string]string
+}
+
+func (c *Config) Marshal() []byte {
+	names := make([]string, 0, len(c.Settings))
+	for name := range c.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b buffer
+	for _, name := range names {
+		var entry buffer
+		entry.string(1, name)
+		entry.string(2, c.Settings[name])
+		b.bytes(1, entry)
+	}
+	return b
+}
+
+func (c *Config) Unmarshal(data []byte) error {
+	*c = Config{Settings: map[string]string{}}
+	return decode(data, func(field int, v value) error {
+		if field != 1 {
+			return nil
+		}
+		entry, err := v.string()
+		if err != nil {
+			return err
+		}
+		var name, setting string
+		err = decode([]byte(entry), func(field int, v value) (err error) {
+			switch field {
+			case 1:
+				name, err = v.string()
+			case 2:
+				setting, err = v.string()
+			}
+			return err
+		})
+		c.Settings[name] = setting
+		return err
+	})
+}
@@ -0,0 +1,178 @@
+// Package grpcapi is the bluelock daemon's gRPC API, the Bluelock service of
+// bluelock.proto: its messages, the framing they travel in and a Client. The
+// little of protobuf and gRPC it needs is written out here, so neither the
+// daemon nor programs using the client need any dependencies:
+//
+//	c := grpcapi.NewClient("127.0.0.1:8789", token)
+//	st, err := c.Status(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Println(st.Mode)
+package grpcapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Service is the path prefix of the service's methods.
+const Service = "/bluelock.v1.Bluelock/"
+
+// gRPC status codes.
+const (
+	CodeOK              = 0
+	CodeInvalidArgument = 3
+	CodeUnimplemented   = 12
+	CodeUnauthenticated = 16
+)
+
+// MaxMessage bounds the messages ReadMessage accepts, which are all tiny.
+const MaxMessage = 64 << 10
+
+// ErrMalformed is returned for data that isn't a protobuf message.
+var ErrMalformed = errors.New("malformed message")
+
+// ReadMessage reads one length-prefixed message. It returns io.EOF when the
+// stream ends before the next message.
+func ReadMessage(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("reading a message: %v", err)
+	}
+	if header[0] != 0 {
+		return nil, errors.New("compressed messages aren't supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxMessage {
+		return nil, errors.New("message too large")
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, fmt.Errorf("reading a message: %v", err)
+	}
+	return message, nil
+}
+
+// WriteMessage writes a length-prefixed message.
+func WriteMessage(w io.Writer, message []byte) error {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	_, err := w.Write(append(frame, message...))
+	return err
+}
+
+// The wire types used.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// buffer builds a protobuf message. Like proto3, zero values are left out.
+type buffer []byte
+
+func (b *buffer) varint(v uint64) { *b = binary.AppendUvarint(*b, v) }
+
+func (b *buffer) tag(field, wireType int) { b.varint(uint64(field)<<3 | uint64(wireType)) }
+
+// field writes a varint field, even a 0 one as optional fields need.
+func (b *buffer) field(field int, v uint64) {
+	b.tag(field, wireVarint)
+	b.varint(v)
+}
+
+func (b *buffer) int(field int, v int64) {
+	if v != 0 {
+		b.field(field, uint64(v))
+	}
+}
+
+func (b *buffer) bool(field int, v bool) {
+	if v {
+		b.int(field, 1)
+	}
+}
+
+func (b *buffer) string(field int, s string) {
+	if s != "" {
+		b.bytes(field, []byte(s))
+	}
+}
+
+func (b *buffer) bytes(field int, data []byte) {
+	b.tag(field, wireBytes)
+	b.varint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+// value is a field's value as read off the wire.
+type value struct {
+	wireType int
+	n        uint64 // A varint
+	data     []byte // A length-delimited field
+}
+
+func (v value) want(wireType int) error {
+	if v.wireType != wireType {
+		return fmt.Errorf("wire type %d, want %d", v.wireType, wireType)
+	}
+	return nil
+}
+
+func (v value) int() (int64, error) { return int64(v.n), v.want(wireVarint) }
+
+func (v value) int32() (int32, error) { return int32(v.n), v.want(wireVarint) }
+
+func (v value) bool() (bool, error) { return v.n != 0, v.want(wireVarint) }
+
+func (v value) string() (string, error) { return string(v.data), v.want(wireBytes) }
+
+// decode calls fn with each field of a message in order. Fixed-size fields
+// are passed without their value, they aren't used by any message.
+func decode(data []byte, fn func(field int, v value) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 || key>>3 == 0 || key>>3 > 1<<29-1 {
+			return ErrMalformed
+		}
+		data = data[n:]
+		v := value{wireType: int(key & 7)}
+		switch v.wireType {
+		case wireVarint:
+			if v.n, n = binary.Uvarint(data); n <= 0 {
+				return ErrMalformed
+			}
+			data = data[n:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return ErrMalformed
+			}
+			v.data = data[n : n+int(size)]
+			data = data[n+int(size):]
+		case wireFixed64:
+			if len(data) < 8 {
+				return ErrMalformed
+			}
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return ErrMalformed
+			}
+			data = data[4:]
+		default:
+			return ErrMalformed
+		}
+		field := int(key >> 3)
+		if err := fn(field, v); err != nil {
+			return fmt.Errorf("field %d: %v", field, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package bluelock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/locker"
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/proximity"
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/proximity/proximitytest"
+)
+
+// commandLocker returns a locker.Command whose lock and unlock commands
+// append "lock" or "unlock" to a file, and a function reading them back.
+func commandLocker(t *testing.T) (locker.Command, func() []string) {
+	t.Helper()
+	log := filepath.Join(t.TempDir(), "locker.log")
+	l := locker.Command{
+		LockCommand:   []string{"sh", "-c", `echo lock >> "$0"`, log},
+		UnlockCommand: []string{"sh", "-c", `echo unlock >> "$0"`, log},
+	}
+	return l, func() []string {
+		data, err := os.ReadFile(log)
+		if err != nil {
+			return nil
+		}
+		return strings.Fields(string(data))
+	}
+}
+
+func TestHcitoolCommand(t *testing.T) {
+	hcitool := proximitytest.InstallHcitool(t)
+	var h proximity.Hcitool
+
+	hcitool.Set(t, device, proximitytest.In(-7))
+	if rssi, found, err := h.ReadRSSI(device); rssi != -7 || !found || err != nil {
+		t.Errorf("connected: %d, %v, %v", rssi, found, err)
+	}
+	if connected, err := h.Connected(device); !connected || err != nil {
+		t.Errorf("connected: Connected %v, %v", connected, err)
+	}
+	hcitool.Set(t, device, proximitytest.Gone())
+	if _, found, err := h.ReadRSSI(device); found || err != nil {
+		t.Errorf("not connected: %v, %v", found, err)
+	}
+	if connected, err := h.Connected(device); connected || err != nil {
+		t.Errorf("not connected: Connected %v, %v", connected, err)
+	}
+	hcitool.Set(t, device, proximitytest.Failed())
+	if _, _, err := h.ReadRSSI(device); err == nil || !strings.Contains(err.Error(), "Input/output error") {
+		t.Errorf("failing read: %v", err)
+	}
+
+	want := []string{"rssi " + device, "con", "rssi " + device, "con", "rssi " + device}
+	if got := hcitool.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls %q, want %q", got, want)
+	}
+}
+
+// TestIntegration runs a Monitor with its default backend against the fake
+// hcitool and locks with real commands, the whole exec path with no adapter.
+func TestIntegration(t *testing.T) {
+	hcitool := proximitytest.InstallHcitool(t)
+	l, lockerCalls := commandLocker(t)
+	m, err := New(device, WithLocker(l), WithInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, cancel := m.Subscribe(100)
+	defer cancel()
+
+	// waitFor waits for the monitor to get to mode with the screen locked or
+	// unlocked to match
+	waitFor := func(mode string, calls ...string) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for m.Mode() != mode || !reflect.DeepEqual(lockerCalls(), calls) {
+			if time.Now().After(deadline) {
+				t.Fatalf("mode %q and locker calls %v, want %q and %v", m.Mode(), lockerCalls(), mode, calls)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	hcitool.Set(t, device, proximitytest.In(-5))
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	if err := m.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+	waitFor("unlocked", "unlock")
+
+	// Scan failures leave it as it is
+	hcitool.Set(t, device, proximitytest.Failed())
+	time.Sleep(50 * time.Millisecond)
+	waitFor("unlocked", "unlock")
+
+	hcitool.Set(t, device, proximitytest.Gone())
+	waitFor("locked", "unlock", "lock")
+	hcitool.Set(t, device, proximitytest.In(-30))
+	time.Sleep(50 * time.Millisecond)
+	waitFor("locked", "unlock", "lock")
+	hcitool.Set(t, device, proximitytest.In(-10))
+	waitFor("unlocked", "unlock", "lock", "unlock")
+	m.Stop()
+
+	var scanErr error
+	for len(events) > 0 {
+		if e := <-events; e.Type == EventError && scanErr == nil {
+			scanErr = e.Err
+		}
+	}
+	if scanErr == nil || !strings.HasPrefix(scanErr.Error(), "hcitool: ") {
+		t.Errorf("scan failure reported as %v", scanErr)
+	}
+}
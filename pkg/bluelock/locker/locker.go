@@ -0,0 +1,84 @@
+// Package locker locks and unlocks a desktop session. A Locker is what the
+// bluelock state machine's lock and unlock actions are carried out with;
+// Command runs programs such as i3lock or loginctl, and Func wraps anything
+// else. The bluelock daemon has lockers for each desktop environment.
+package locker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Locker locks and unlocks the screen, returning once that's done.
+type Locker interface {
+	Lock() error
+	Unlock() error
+}
+
+// Watcher is implemented by lockers that can follow the screen being locked
+// or unlocked by other means. Watch is called once, before the first lock.
+type Watcher interface {
+	Watch()
+}
+
+// DefaultTimeout is how long Command waits for a program without a Timeout.
+const DefaultTimeout = 10 * time.Second
+
+// Command locks and unlocks by running programs, given as argv without a
+// shell, e.g. {"loginctl", "lock-session"}. The lock command must return once
+// the screen is locked. Without an unlock command, Unlock fails.
+type Command struct {
+	LockCommand   []string
+	UnlockCommand []string
+	Timeout       time.Duration // How long a command may run, DefaultTimeout if 0
+}
+
+// Lock runs the lock command.
+func (c Command) Lock() error {
+	if len(c.LockCommand) == 0 {
+		return errors.New("no lock command")
+	}
+	return c.run(c.LockCommand)
+}
+
+// Unlock runs the unlock command.
+func (c Command) Unlock() error {
+	if len(c.UnlockCommand) == 0 {
+		return errors.New("no unlock command")
+	}
+	return c.run(c.UnlockCommand)
+}
+
+// run runs argv, putting its output in the error.
+func (c Command) run(argv []string) error {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, argv[0], argv[1:]...).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out after %s", argv[0], timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", argv[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Func is a Locker made of two functions.
+type Func struct {
+	LockFunc   func() error
+	UnlockFunc func() error
+}
+
+// Lock calls LockFunc.
+func (f Func) Lock() error { return f.LockFunc() }
+
+// Unlock calls UnlockFunc.
+func (f Func) Unlock() error { return f.UnlockFunc() }
@@ -0,0 +1,58 @@
+package locker
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommand(t *testing.T) {
+	for _, name := range []string{"true", "false", "sleep"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("no %s: %v", name, err)
+		}
+	}
+
+	if err := (Command{LockCommand: []string{"true"}}).Lock(); err != nil {
+		t.Errorf("lock: %v", err)
+	}
+	if err := (Command{LockCommand: []string{"true"}}).Unlock(); err == nil {
+		t.Error("unlock without an unlock command didn't fail")
+	}
+	if err := (Command{}).Lock(); err == nil {
+		t.Error("lock without a lock command didn't fail")
+	}
+	err := (Command{UnlockCommand: []string{"false"}}).Unlock()
+	if err == nil || !strings.HasPrefix(err.Error(), "false: ") {
+		t.Errorf("unlock with a failing command: %v", err)
+	}
+
+	begin := time.Now()
+	err = (Command{LockCommand: []string{"sleep", "5"}, Timeout: 50 * time.Millisecond}).Lock()
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("lock with a hanging command: %v", err)
+	}
+	if took := time.Since(begin); took > 2*time.Second {
+		t.Errorf("timing out took %s", took)
+	}
+}
+
+func TestFunc(t *testing.T) {
+	var calls []string
+	failed := errors.New("failed")
+	f := Func{
+		LockFunc:   func() error { calls = append(calls, "lock"); return nil },
+		UnlockFunc: func() error { calls = append(calls, "unlock"); return failed },
+	}
+	if err := f.Lock(); err != nil {
+		t.Errorf("lock: %v", err)
+	}
+	if err := f.Unlock(); err != failed {
+		t.Errorf("unlock: got %v, want %v", err, failed)
+	}
+	if strings.Join(calls, " ") != "lock unlock" {
+		t.Errorf("calls: %v", calls)
+	}
+}
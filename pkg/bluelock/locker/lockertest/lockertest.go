@@ -0,0 +1,71 @@
+// Package lockertest has a recording locker.Locker for testing code that
+// locks and unlocks without a desktop session.
+package lockertest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/locker"
+)
+
+// ErrLock is a lock or unlock failing, for Locker.LockErr and UnlockErr.
+var ErrLock = errors.New("lockertest: failed")
+
+// Locker is a locker.Locker that records its calls instead of touching the
+// screen. It's safe for concurrent use.
+type Locker struct {
+	mu        sync.Mutex
+	calls     []string
+	locked    bool
+	lockErr   error
+	unlockErr error
+}
+
+var _ locker.Locker = (*Locker)(nil)
+
+// Lock records a "lock" call and returns the error set with Fail, if any.
+func (l *Locker) Lock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, "lock")
+	if l.lockErr != nil {
+		return l.lockErr
+	}
+	l.locked = true
+	return nil
+}
+
+// Unlock records an "unlock" call and returns the error set with Fail, if any.
+func (l *Locker) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, "unlock")
+	if l.unlockErr != nil {
+		return l.unlockErr
+	}
+	l.locked = false
+	return nil
+}
+
+// Fail makes Lock and Unlock return the given errors from now on, nil to
+// succeed again.
+func (l *Locker) Fail(lockErr, unlockErr error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lockErr, l.unlockErr = lockErr, unlockErr
+}
+
+// Calls returns the calls so far, "lock" or "unlock", failed ones included.
+func (l *Locker) Calls() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.calls...)
+}
+
+// Locked reports whether the last successful call was a lock.
+func (l *Locker) Locked() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.locked
+}
@@ -0,0 +1,244 @@
+// Package bluelock locks the screen when a Bluetooth device, usually a phone,
+// goes away and unlocks it when the device comes back. A Monitor checks the
+// device at an interval with a proximity.Scanner, decides with a
+// statemachine.StateMachine and acts through a locker.Locker:
+//
+//	m, err := bluelock.New("AA:BB:CC:DD:EE:FF",
+//		bluelock.WithLocker(locker.Command{LockCommand: []string{"loginctl", "lock-session"}}),
+//		bluelock.WithThresholds(-20, -14))
+//	if err != nil {
+//		return err
+//	}
+//	if err := m.Start(ctx); err != nil {
+//		return err
+//	}
+//	defer m.Stop()
+//
+// Observers given with WithObserver, and channels from Subscribe, hear about
+// every RSSI sample, state change, lock and unlock.
+//
+// The bluelock daemon in cmd/bluelock adds hooks, notifications, the APIs and
+// the other presence sources on top.
+package bluelock
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/locker"
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/proximity"
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/statemachine"
+)
+
+// The defaults, the same as the daemon's.
+const (
+	DefaultLockRSSI       = -14
+	DefaultUnlockRSSI     = -14
+	DefaultInterval       = 5 * time.Second
+	DefaultSessionTimeout = 30 * time.Minute
+)
+
+// ErrRunning is returned by Start when the monitor is already running.
+var ErrRunning = errors.New("bluelock: monitor already running")
+
+// Monitor watches a device and locks and unlocks the screen as it comes and
+// goes. Make one with New.
+type Monitor struct {
+	device         string
+	scanner        proximity.Scanner
+	locker         locker.Locker
+	lockRSSI       int
+	unlockRSSI     int
+	interval       time.Duration
+	sessionTimeout time.Duration
+	lockWarning    time.Duration
+
+	mu        sync.Mutex
+	machine   *statemachine.StateMachine
+	inRange   bool
+	cancel    context.CancelFunc
+	done      chan struct{}
+	observers observers
+	now       func() time.Time // time.Now, but a test's clock in tests
+}
+
+// Option configures a Monitor in New.
+type Option func(*Monitor)
+
+// WithBackend reads the RSSI with scanner instead of proximity.Hcitool.
+func WithBackend(scanner proximity.Scanner) Option {
+	return func(m *Monitor) { m.scanner = scanner }
+}
+
+// WithLocker locks and unlocks with l. New needs one.
+func WithLocker(l locker.Locker) Option {
+	return func(m *Monitor) { m.locker = l }
+}
+
+// WithThresholds sets the RSSI the device counts as gone below and as back
+// from. Between the two nothing changes, so a signal hovering at one
+// threshold doesn't lock and unlock in turn.
+func WithThresholds(lockRSSI, unlockRSSI int) Option {
+	return func(m *Monitor) { m.lockRSSI, m.unlockRSSI = lockRSSI, unlockRSSI }
+}
+
+// WithInterval checks the device every d.
+func WithInterval(d time.Duration) Option {
+	return func(m *Monitor) { m.interval = d }
+}
+
+// WithSessionTimeout locks after d unlocked even with the device in range.
+func WithSessionTimeout(d time.Duration) Option {
+	return func(m *Monitor) { m.sessionTimeout = d }
+}
+
+// WithLockWarning waits d after the device left before locking, in case it
+// comes back.
+func WithLockWarning(d time.Duration) Option {
+	return func(m *Monitor) { m.lockWarning = d }
+}
+
+// New returns a monitor for the device with the given address, which Start
+// starts.
+func New(device string, opts ...Option) (*Monitor, error) {
+	m := &Monitor{
+		device:         device,
+		scanner:        proximity.Hcitool{},
+		lockRSSI:       DefaultLockRSSI,
+		unlockRSSI:     DefaultUnlockRSSI,
+		interval:       DefaultInterval,
+		sessionTimeout: DefaultSessionTimeout,
+		now:            time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	switch {
+	case device == "":
+		return nil, errors.New("bluelock: no device address")
+	case m.scanner == nil:
+		return nil, errors.New("bluelock: no backend")
+	case m.locker == nil:
+		return nil, errors.New("bluelock: no locker, give one with WithLocker")
+	case m.lockRSSI > m.unlockRSSI:
+		return nil, errors.New("bluelock: the lock threshold is above the unlock threshold")
+	case m.interval <= 0 || m.sessionTimeout <= 0 || m.lockWarning < 0:
+		return nil, errors.New("bluelock: the interval and session timeout must be positive")
+	}
+	m.machine = statemachine.New(m.now(), m.sessionTimeout, m.lockWarning, 0)
+	return m, nil
+}
+
+// Start checks the device in the background until ctx is done or Stop is
+// called. A stopped monitor can be started again, and carries on from the
+// state it was in.
+func (m *Monitor) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		return ErrRunning
+	}
+	if watcher, ok := m.locker.(locker.Watcher); ok && m.done == nil {
+		watcher.Watch()
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	go m.run(ctx, m.done)
+	return nil
+}
+
+// Stop stops the monitor and waits for a check in progress to finish. The
+// screen stays as it is.
+func (m *Monitor) Stop() {
+	m.mu.Lock()
+	cancel, done := m.cancel, m.done
+	m.cancel = nil
+	m.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Mode returns "locked" or "unlocked".
+func (m *Monitor) Mode() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.machine.Mode
+}
+
+// run checks the device every interval until ctx is done.
+func (m *Monitor) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.check()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check reads the RSSI once and locks or unlocks as the state machine says,
+// then tells the observers what happened.
+func (m *Monitor) check() {
+	rssi, found, err := m.scanner.ReadRSSI(m.device)
+	if err != nil {
+		// Not knowing where the device is doesn't make it gone
+		slog.Warn("Scan failed", "device", m.device, "err", err)
+		m.observers.emit(Event{Type: EventError, Device: m.device, Err: err})
+		return
+	}
+	sample := Event{Type: EventRSSISample, Device: m.device}
+	if found {
+		sample.RSSI = &rssi
+	}
+	events := []Event{sample}
+
+	// The observers run without the lock, so they may ask for the Mode
+	m.mu.Lock()
+	defer func() {
+		m.mu.Unlock()
+		m.observers.emit(events...)
+	}()
+	from := m.machine.Mode
+	switch {
+	case !found || !proximity.InRange(rssi, m.lockRSSI):
+		m.inRange = false
+	case proximity.InRange(rssi, m.unlockRSSI):
+		m.inRange = true
+	}
+	now := m.now()
+	action, reason := m.machine.Step(now, m.inRange, false)
+	switch action {
+	case statemachine.ActionLock:
+		if err := m.locker.Lock(); err != nil {
+			slog.Error("Failed to lock", "reason", reason, "err", err)
+			m.machine.RetryLock(now, reason)
+			events = append(events, Event{Type: EventLockFailed, Device: m.device, Reason: reason, Err: err})
+		} else {
+			events = append(events, Event{Type: EventLock, Device: m.device, RSSI: sample.RSSI, Reason: reason})
+		}
+	case statemachine.ActionUnlock:
+		if err := m.locker.Unlock(); err != nil {
+			slog.Error("Failed to unlock", "reason", reason, "err", err)
+			m.machine.DeferUnlock()
+			events = append(events, Event{Type: EventLockFailed, Device: m.device, Reason: reason, Err: err})
+		} else {
+			events = append(events, Event{Type: EventUnlock, Device: m.device, RSSI: sample.RSSI, Reason: reason})
+		}
+	case statemachine.ActionWarn:
+		events = append(events, Event{Type: EventLockPending, Device: m.device, Reason: reason})
+	case statemachine.ActionCancelLock:
+		events = append(events, Event{Type: EventLockCancel, Device: m.device, Reason: reason})
+	}
+	if to := m.machine.Mode; to != from {
+		events = append(events, Event{Type: EventStateChange, Device: m.device, From: from, To: to, Reason: reason})
+	}
+}
@@ -0,0 +1,259 @@
+package bluelock
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/locker/lockertest"
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/proximity/proximitytest"
+)
+
+const device = "AA:BB:CC:DD:EE:FF"
+
+// clock is a test's time, which only moves when told to.
+type clock struct{ now time.Time }
+
+func newClock() *clock { return &clock{time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)} }
+
+func (c *clock) Now() time.Time      { return c.now }
+func (c *clock) Add(d time.Duration) { c.now = c.now.Add(d) }
+
+// newMonitor returns a monitor checking with scanner and locking with a
+// lockertest.Locker, on a clock that checks moves a second at a time.
+func newMonitor(t *testing.T, scanner *proximitytest.Scanner, opts ...Option) (*Monitor, *lockertest.Locker, *clock) {
+	t.Helper()
+	l := &lockertest.Locker{}
+	c := newClock()
+	m, err := New(device, append([]Option{WithBackend(scanner), WithLocker(l)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = c.Now
+	m.machine.LastUnlockedTime = c.Now()
+	return m, l, c
+}
+
+// checks runs n checks a second apart.
+func checks(m *Monitor, c *clock, n int) {
+	for i := 0; i < n; i++ {
+		c.Add(time.Second)
+		m.check()
+	}
+}
+
+func TestNew(t *testing.T) {
+	l := &lockertest.Locker{}
+	tests := map[string][]Option{
+		"no locker":          nil,
+		"reversed":           {WithLocker(l), WithThresholds(-10, -20)},
+		"no interval":        {WithLocker(l), WithInterval(0)},
+		"no session timeout": {WithLocker(l), WithSessionTimeout(0)},
+		"negative warning":   {WithLocker(l), WithLockWarning(-time.Second)},
+		"no backend":         {WithLocker(l), WithBackend(nil)},
+	}
+	for name, opts := range tests {
+		if _, err := New(device, opts...); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	if _, err := New("", WithLocker(l)); err == nil {
+		t.Error("no device: no error")
+	}
+	if _, err := New(device, WithLocker(l)); err != nil {
+		t.Errorf("defaults: %v", err)
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	scanner := proximitytest.NewScanner(device)
+	m, l, c := newMonitor(t, scanner, WithThresholds(-20, -10))
+	for _, tt := range []struct {
+		reading proximitytest.Reading
+		mode    string
+	}{
+		{proximitytest.In(-15), "locked"}, // Between the thresholds while locked
+		{proximitytest.In(-10), "unlocked"},
+		{proximitytest.In(-15), "unlocked"}, // Between them while unlocked
+		{proximitytest.In(-20), "unlocked"},
+		{proximitytest.In(-21), "locked"},
+		{proximitytest.In(-15), "locked"},
+		{proximitytest.Gone(), "locked"},
+		{proximitytest.In(-5), "unlocked"},
+		{proximitytest.Gone(), "locked"},
+	} {
+		scanner.Set(device, tt.reading)
+		checks(m, c, 1)
+		if got := m.Mode(); got != tt.mode {
+			t.Fatalf("after %+v: mode %q, want %q", tt.reading, got, tt.mode)
+		}
+	}
+	want := []string{"unlock", "lock", "unlock", "lock"}
+	if got := l.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls %v, want %v", got, want)
+	}
+}
+
+func TestScanFailures(t *testing.T) {
+	scanner := proximitytest.NewScanner(device, proximitytest.In(-5))
+	m, l, c := newMonitor(t, scanner)
+	checks(m, c, 1)
+	// A failing scan says nothing about where the device is
+	scanner.Set(device, proximitytest.Failed())
+	checks(m, c, 5)
+	if m.Mode() != "unlocked" || len(l.Calls()) != 1 {
+		t.Fatalf("locked on scan failures: %s, %v", m.Mode(), l.Calls())
+	}
+	if got := scanner.Calls(device); got != 6 {
+		t.Errorf("scanned %d times, want 6", got)
+	}
+}
+
+func TestLockWarning(t *testing.T) {
+	scanner := proximitytest.NewScanner(device, proximitytest.In(-5))
+	m, l, c := newMonitor(t, scanner, WithLockWarning(10*time.Second))
+	checks(m, c, 1)
+	scanner.Set(device, proximitytest.Gone())
+	checks(m, c, 10)
+	if m.Mode() != "unlocked" {
+		t.Fatal("locked before the lock warning was up")
+	}
+	checks(m, c, 1)
+	if m.Mode() != "locked" || !l.Locked() {
+		t.Fatal("didn't lock once the lock warning was up")
+	}
+}
+
+func TestSessionTimeout(t *testing.T) {
+	scanner := proximitytest.NewScanner(device, proximitytest.In(-5))
+	m, _, c := newMonitor(t, scanner, WithSessionTimeout(time.Minute))
+	// Unlocked on the first check, a minute later it's still unlocked
+	checks(m, c, 61)
+	if m.Mode() != "unlocked" {
+		t.Fatal("locked before the session timeout")
+	}
+	events, cancel := m.Subscribe(10)
+	defer cancel()
+	checks(m, c, 1)
+	if m.Mode() != "locked" {
+		t.Fatal("didn't lock on the session timeout")
+	}
+	for len(events) > 0 {
+		if e := <-events; e.Type == EventLock {
+			if e.Reason != "session_timeout" {
+				t.Errorf("locked for %q", e.Reason)
+			}
+			return
+		}
+	}
+	t.Error("no lock event")
+}
+
+func TestLockerFailures(t *testing.T) {
+	scanner := proximitytest.NewScanner(device, proximitytest.In(-5))
+	m, l, c := newMonitor(t, scanner)
+	l.Fail(lockertest.ErrLock, lockertest.ErrLock)
+	checks(m, c, 2)
+	if m.Mode() != "locked" {
+		t.Fatal("unlocked though unlocking failed")
+	}
+	l.Fail(nil, nil)
+	checks(m, c, 1)
+	scanner.Set(device, proximitytest.Gone())
+	l.Fail(lockertest.ErrLock, nil)
+	checks(m, c, 2)
+	if m.Mode() != "unlocked" {
+		t.Fatal("locked though locking failed")
+	}
+	l.Fail(nil, nil)
+	checks(m, c, 1)
+	want := []string{"unlock", "unlock", "unlock", "lock", "lock", "lock"}
+	if got := l.Calls(); !reflect.DeepEqual(got, want) || !l.Locked() {
+		t.Errorf("calls %v, want %v", got, want)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	scanner := proximitytest.NewScanner(device,
+		proximitytest.In(-5),
+		proximitytest.Gone(),
+		proximitytest.In(-5),
+		proximitytest.Failed())
+	var observed []EventType
+	m, _, c := newMonitor(t, scanner, WithLockWarning(time.Second), WithObserver(func(e Event) {
+		observed = append(observed, e.Type)
+	}))
+	events, cancel := m.Subscribe(20)
+	checks(m, c, 4)
+	cancel()
+	cancel()
+
+	want := []EventType{
+		EventRSSISample, EventUnlock, EventStateChange,
+		EventRSSISample, EventLockPending,
+		EventRSSISample, EventLockCancel,
+		EventError,
+	}
+	if !reflect.DeepEqual(observed, want) {
+		t.Errorf("observed %v, want %v", observed, want)
+	}
+	var subscribed []Event
+	for e := range events {
+		subscribed = append(subscribed, e)
+	}
+	if len(subscribed) != len(want) {
+		t.Fatalf("subscriber got %d events, want %d", len(subscribed), len(want))
+	}
+	if change := subscribed[2]; change.From != "locked" || change.To != "unlocked" || change.Reason != "in_range" {
+		t.Errorf("state change %+v", change)
+	}
+	if sample := subscribed[3]; sample.RSSI != nil {
+		t.Errorf("a device that didn't answer has RSSI %d", *sample.RSSI)
+	}
+	if sample := subscribed[0]; sample.RSSI == nil || *sample.RSSI != -5 || sample.Time.IsZero() {
+		t.Errorf("sample %+v", sample)
+	}
+	if e := subscribed[7]; e.Err != proximitytest.ErrScan {
+		t.Errorf("error event %+v", e)
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	scanner := proximitytest.NewScanner(device, proximitytest.In(-5))
+	m, l, _ := newMonitor(t, scanner, WithInterval(time.Millisecond))
+	m.now = time.Now
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := m.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start(ctx); err != ErrRunning {
+		t.Fatalf("second start: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !reflect.DeepEqual(l.Calls(), []string{"unlock"}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("monitor didn't unlock: %v", l.Calls())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	m.Stop()
+	calls := scanner.Calls(device)
+	time.Sleep(20 * time.Millisecond)
+	if scanner.Calls(device) != calls {
+		t.Fatal("still scanning after Stop")
+	}
+	m.Stop()
+
+	// A stopped monitor starts again where it was
+	if err := m.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	m.Stop()
+	if m.Mode() != "unlocked" {
+		t.Errorf("mode %q after restarting", m.Mode())
+	}
+}
@@ -0,0 +1,89 @@
+package proximity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hcitoolTimeout bounds an hcitool call, which hangs now and then when the
+// adapter is busy.
+const hcitoolTimeout = 10 * time.Second
+
+// Hcitool uses `hcitool` to read the RSSI of a connected device. hcitool needs
+// CAP_NET_RAW to read it: run as root, or give hcitool the capability with
+// `sudo setcap cap_net_raw+ep $(command -v hcitool)`.
+type Hcitool struct{}
+
+// ReadRSSI reads the device's RSSI. found is false when the device isn't connected.
+func (Hcitool) ReadRSSI(address string) (rssi int, found bool, err error) {
+	out, err := hcitool("rssi", address)
+	if err != nil {
+		// A disconnected device is expected, anything else is a backend error
+		if strings.Contains(string(out), "Not connected") {
+			return 0, false, nil
+		}
+		return 0, false, errors.New("hcitool: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	return parseRSSI(string(out))
+}
+
+// parseRSSI reads the RSSI out of `hcitool rssi`'s output.
+func parseRSSI(output string) (rssi int, found bool, err error) {
+	// RSSI return value: -5
+	if !strings.Contains(output, "RSSI return value") {
+		return 0, false, nil
+	}
+	parts := strings.Split(output, ":")
+	if len(parts) < 2 {
+		return 0, false, fmt.Errorf("hcitool: unexpected output %q", strings.TrimSpace(output))
+	}
+	rssi, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, false, fmt.Errorf("hcitool: failed to parse RSSI value: %w", err)
+	}
+	return rssi, true, nil
+}
+
+// Connected reports whether `hcitool con` lists a connection to the device.
+func (Hcitool) Connected(address string) (bool, error) {
+	out, err := hcitool("con")
+	if err != nil {
+		return false, errors.New("hcitool: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	return listsConnection(string(out), address), nil
+}
+
+// listsConnection reports whether `hcitool con`'s output lists the device.
+func listsConnection(output, address string) bool {
+	// Connections:
+	// 	< ACL AA:BB:CC:DD:EE:FF handle 11 state 1 lm MASTER
+	for _, line := range strings.Split(output, "\n") {
+		for _, field := range strings.Fields(line) {
+			if strings.EqualFold(field, address) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hcitool runs hcitool with args and returns its combined output.
+func hcitool(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hcitoolTimeout)
+	defer cancel()
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, "hcitool", args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return out.Bytes(), fmt.Errorf("timed out after %s", hcitoolTimeout)
+	}
+	return out.Bytes(), err
+}
@@ -0,0 +1,49 @@
+package proximity
+
+import "testing"
+
+func TestParseRSSI(t *testing.T) {
+	tests := []struct {
+		output string
+		rssi   int
+		found  bool
+		err    bool
+	}{
+		{"RSSI return value: -5\n", -5, true, false},
+		{"RSSI return value: 0\n", 0, true, false},
+		{"RSSI return value: 12", 12, true, false},
+		{"", 0, false, false},
+		{"Read RSSI failed: Input/output error\n", 0, false, false},
+		{"RSSI return value: abc\n", 0, false, true},
+		{"RSSI return value\n", 0, false, true},
+	}
+	for _, tt := range tests {
+		rssi, found, err := parseRSSI(tt.output)
+		if rssi != tt.rssi || found != tt.found || (err != nil) != tt.err {
+			t.Errorf("parseRSSI(%q) = %d, %v, %v; want %d, %v, error %v", tt.output, rssi, found, err, tt.rssi, tt.found, tt.err)
+		}
+	}
+}
+
+func TestListsConnection(t *testing.T) {
+	output := "Connections:\n\t< ACL AA:BB:CC:DD:EE:FF handle 11 state 1 lm MASTER\n"
+	for address, want := range map[string]bool{
+		"AA:BB:CC:DD:EE:FF": true,
+		"aa:bb:cc:dd:ee:ff": true,
+		"11:22:33:44:55:66": false,
+		"AA:BB:CC:DD:EE":    false,
+	} {
+		if got := listsConnection(output, address); got != want {
+			t.Errorf("listsConnection(%q) = %v, want %v", address, got, want)
+		}
+	}
+	if listsConnection("Connections:\n", "AA:BB:CC:DD:EE:FF") {
+		t.Error("listsConnection found a device with no connections")
+	}
+}
+
+func TestInRange(t *testing.T) {
+	if !InRange(-14, -14) || !InRange(-5, -14) || InRange(-15, -14) {
+		t.Error("InRange doesn't count the threshold itself as in range")
+	}
+}
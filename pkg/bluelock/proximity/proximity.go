@@ -0,0 +1,43 @@
+// Package proximity measures how close a Bluetooth device is. A Scanner reads
+// a device's RSSI, the signal strength, which is higher the nearer it is;
+// Hcitool is the scanner for Linux's BlueZ tools. The bluelock daemon has
+// more of them, for BlueZ over D-Bus, macOS and Windows.
+package proximity
+
+// Scanner measures how close a Bluetooth device is.
+type Scanner interface {
+	// ReadRSSI returns the device's RSSI. found is false when the device didn't
+	// answer; err is for the scan itself failing.
+	ReadRSSI(address string) (rssi int, found bool, err error)
+}
+
+// ConnectionChecker is implemented by scanners that can tell whether the
+// device is connected at all, whatever its RSSI.
+type ConnectionChecker interface {
+	Connected(address string) (bool, error)
+}
+
+// NearbyScanner is implemented by scanners that can list every device in
+// range, paired or not.
+type NearbyScanner interface {
+	Nearby() ([]NearbyDevice, error)
+}
+
+// NearbyDevice is a device a NearbyScanner sees.
+type NearbyDevice struct {
+	Address string
+	RSSI    int
+	Paired  bool
+}
+
+// PairedDevice is a device the system knows.
+type PairedDevice struct {
+	Address string
+	Name    string
+}
+
+// InRange reports whether rssi is at least the threshold, so the device counts
+// as present.
+func InRange(rssi, threshold int) bool {
+	return rssi >= threshold
+}
@@ -0,0 +1,108 @@
+package proximitytest
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// hcitoolScript answers `hcitool rssi <address>` and `hcitool con` the way
+// the real one does, from a file per device under devices/: "in <rssi>" for
+// a connected device, "fail" for a read that fails, no file for a device
+// that isn't connected. Every call is appended to calls.
+const hcitoolScript = `#!/bin/sh
+dir='%DIR%'
+echo "$*" >> "$dir/calls"
+case "$1" in
+rssi)
+	if [ ! -f "$dir/devices/$2" ]; then
+		echo "Not connected."
+		exit 1
+	fi
+	read kind value < "$dir/devices/$2"
+	if [ "$kind" != in ]; then
+		echo "Read RSSI failed: Input/output error" >&2
+		exit 1
+	fi
+	echo "RSSI return value: $value"
+	;;
+con)
+	echo "Connections:"
+	for f in "$dir"/devices/*; do
+		[ -f "$f" ] || continue
+		read kind value < "$f"
+		[ "$kind" = in ] && printf '\t< ACL %s handle 11 state 1 lm MASTER\n' "$(basename "$f")"
+	done
+	;;
+*)
+	echo "hcitool: unknown command $1" >&2
+	exit 1
+	;;
+esac
+`
+
+// Hcitool is a scripted hcitool executable put first on PATH, so code that
+// runs the real command, proximity.Hcitool or the daemon's hcitool backend,
+// can be tested end to end without an adapter. It answers rssi and con with
+// one current reading per device, a device with none isn't connected.
+type Hcitool struct {
+	dir string
+}
+
+// InstallHcitool writes a fake hcitool into a temporary directory and puts
+// that first on PATH for the rest of the test. It needs /bin/sh, the test is
+// skipped without it. Like t.Setenv, it can't be used in parallel tests.
+func InstallHcitool(t testing.TB) *Hcitool {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake hcitool is a shell script")
+	}
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("the fake hcitool needs /bin/sh")
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "devices"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	script := strings.ReplaceAll(hcitoolScript, "%DIR%", dir)
+	if err := os.WriteFile(filepath.Join(dir, "hcitool"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return &Hcitool{dir: dir}
+}
+
+// Set makes hcitool answer with r for address from its next call on: In
+// connects the device at that RSSI, Gone disconnects it and Failed makes
+// reading it fail.
+func (h *Hcitool) Set(t testing.TB, address string, r Reading) {
+	t.Helper()
+	path := filepath.Join(h.dir, "devices", address)
+	var err error
+	switch {
+	case r.Err != nil:
+		err = os.WriteFile(path, []byte("fail\n"), 0o644)
+	case r.Found:
+		err = os.WriteFile(path, []byte("in "+strconv.Itoa(r.RSSI)+"\n"), 0o644)
+	default:
+		if err = os.Remove(path); os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Calls returns the arguments of every hcitool call so far, one string each,
+// e.g. "rssi AA:BB:CC:DD:EE:FF".
+func (h *Hcitool) Calls() []string {
+	data, err := os.ReadFile(filepath.Join(h.dir, "calls"))
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
@@ -0,0 +1,85 @@
+// Package proximitytest has a scripted proximity.Scanner for testing code
+// that scans without a Bluetooth adapter or a device, and a fake hcitool
+// command for testing the code that runs it.
+package proximitytest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/samhardeman/bluetooth-unlock/pkg/bluelock/proximity"
+)
+
+// ErrScan is a scan failing, for Reading.Err.
+var ErrScan = errors.New("proximitytest: scan failed")
+
+// Reading is what one ReadRSSI call returns.
+type Reading struct {
+	RSSI  int
+	Found bool
+	Err   error
+}
+
+// In is a reading of a device answering with rssi.
+func In(rssi int) Reading { return Reading{RSSI: rssi, Found: true} }
+
+// Gone is a reading of a device that didn't answer.
+func Gone() Reading { return Reading{} }
+
+// Failed is a reading where the scan itself failed.
+func Failed() Reading { return Reading{Err: ErrScan} }
+
+// Scanner is a proximity.Scanner that plays back readings, one per ReadRSSI
+// call for each device, and keeps repeating a device's last reading once
+// they run out. A device with no readings is gone. It's safe for concurrent
+// use, so a test can Set readings while a monitor scans.
+type Scanner struct {
+	mu       sync.Mutex
+	readings map[string][]Reading
+	calls    map[string]int
+}
+
+var _ proximity.Scanner = (*Scanner)(nil)
+
+// NewScanner returns a scanner playing back readings for address.
+func NewScanner(address string, readings ...Reading) *Scanner {
+	s := &Scanner{}
+	s.Set(address, readings...)
+	return s
+}
+
+// Set replaces the readings for address, starting from the first.
+func (s *Scanner) Set(address string, readings ...Reading) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readings == nil {
+		s.readings = map[string][]Reading{}
+	}
+	s.readings[address] = readings
+}
+
+// ReadRSSI returns the device's next reading.
+func (s *Scanner) ReadRSSI(address string) (rssi int, found bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.calls == nil {
+		s.calls = map[string]int{}
+	}
+	s.calls[address]++
+	readings := s.readings[address]
+	if len(readings) == 0 {
+		return 0, false, nil
+	}
+	r := readings[0]
+	if len(readings) > 1 {
+		s.readings[address] = readings[1:]
+	}
+	return r.RSSI, r.Found, r.Err
+}
+
+// Calls returns how many times the device was scanned.
+func (s *Scanner) Calls(address string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[address]
+}
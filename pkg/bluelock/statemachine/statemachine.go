@@ -0,0 +1,218 @@
+// Package statemachine decides when to lock and unlock a session from
+// successive proximity checks. It touches nothing itself: the caller feeds it
+// each check with Step and carries out the action it returns, so the same
+// logic drives the bluelock daemon, `bluelock simulate` and programs that
+// embed it.
+package statemachine
+
+import "time"
+
+// Actions the state machine can ask for after a check.
+const (
+	ActionNone       = ""
+	ActionLock       = "lock"
+	ActionUnlock     = "unlock"
+	ActionWarn       = "warn"        // A lock is pending, warn the user
+	ActionCancelLock = "cancel_lock" // The device came back before a pending lock fired
+)
+
+// Reasons Step gives with its actions.
+const (
+	ReasonInRange        = "in_range"
+	ReasonOutOfRange     = "out_of_range"
+	ReasonSessionTimeout = "session_timeout"
+	ReasonTrusted        = "trusted" // A pending lock dropped on a trusted network
+	ReasonLockDevice     = "lock_device"
+	ReasonActive         = "active" // A pending lock dropped while the keyboard or mouse is in use
+)
+
+// StateMachine decides when to lock and unlock from successive proximity checks.
+// The settings and the conditions from Trusted on may change between checks.
+type StateMachine struct {
+	SessionTimeout time.Duration // How long a session stays unlocked, even with the device in range
+	LockWarning    time.Duration // How long a lock is pending before it fires, 0 to lock at once
+	MaxLockVeto    time.Duration // How long a lock may be vetoed, 0 to ignore vetoes
+
+	Mode             string    // "locked" or "unlocked"
+	LastUnlockedTime time.Time // When the machine last unlocked
+	ManualLock       bool      // Set by a manual lock, held until the device leaves range
+	ManualUnlock     bool      // Set by an unlock outside bluelock, held until the device is back in range
+	PendingLockSince time.Time // When the lock warning started, zero if no lock is pending
+	VetoedSince      time.Time // When a hook first vetoed the current lock, zero if not vetoed
+	Trusted          bool      // On a trusted network, where it unlocks but never locks on its own
+	LockOnly         bool      // Outside the schedule with outside_schedule=lock_only, where it never unlocks
+	Blocked          bool      // A lock_device is near, so it locks at once and doesn't unlock
+	Holding          bool      // Neither unlock_when nor lock_when holds, so it stays as it is
+	Active           bool      // The keyboard or mouse was used within activity_window, postponing a lock for leaving
+}
+
+// New returns a state machine in its initial, locked state.
+func New(now time.Time, sessionTimeout, lockWarning, maxLockVeto time.Duration) *StateMachine {
+	return &StateMachine{
+		SessionTimeout:   sessionTimeout,
+		LockWarning:      lockWarning,
+		MaxLockVeto:      maxLockVeto,
+		Mode:             "locked",
+		LastUnlockedTime: now,
+	}
+}
+
+// Step feeds one proximity check into the state machine and returns the action to
+// take along with its reason. While paused the state is never changed, and on a
+// trusted network it only unlocks, outside a lock_only schedule it only locks.
+func (m *StateMachine) Step(now time.Time, inRange, paused bool) (action, reason string) {
+	// A manual lock holds until the device has left range at least once
+	if m.ManualLock && !inRange && !m.Holding {
+		m.ManualLock = false
+	}
+	// Likewise an outside unlock holds until the device has been seen again
+	if m.ManualUnlock && inRange {
+		m.ManualUnlock = false
+	}
+
+	// While paused, keep scanning but don't change the lock state
+	if paused {
+		return ActionNone, ""
+	}
+
+	// A lock_device coming near locks without a warning, and holds the lock
+	if m.Blocked {
+		if m.Mode == "unlocked" {
+			m.lock()
+			return ActionLock, ReasonLockDevice
+		}
+		return ActionNone, ""
+	}
+
+	// The device came back while a lock was pending
+	if inRange && !m.PendingLockSince.IsZero() {
+		m.PendingLockSince = time.Time{}
+		m.VetoedSince = time.Time{}
+		return ActionCancelLock, ReasonInRange
+	}
+
+	// If device is in range and was previously locked, unlock it
+	if inRange && m.Mode == "locked" && !m.ManualLock && !m.LockOnly {
+		m.LastUnlockedTime = now // Update the last unlocked time
+		m.Mode = "unlocked"
+		m.VetoedSince = time.Time{}
+		return ActionUnlock, ReasonInRange
+	}
+
+	// On a trusted network a pending lock is dropped, and the session timeout
+	// counts from leaving it
+	if m.Trusted && m.Mode == "unlocked" {
+		m.LastUnlockedTime = now
+		if !m.PendingLockSince.IsZero() {
+			m.PendingLockSince = time.Time{}
+			return ActionCancelLock, ReasonTrusted
+		}
+		return ActionNone, ""
+	}
+
+	// Between unlock_when and lock_when nothing changes but the session timeout
+	if !inRange && m.Holding && m.Mode == "unlocked" {
+		if !m.PendingLockSince.IsZero() {
+			m.PendingLockSince = time.Time{}
+			m.VetoedSince = time.Time{}
+			return ActionCancelLock, ReasonInRange
+		}
+		if now.Sub(m.LastUnlockedTime) > m.SessionTimeout {
+			m.lock()
+			return ActionLock, ReasonSessionTimeout
+		}
+		return ActionNone, ""
+	}
+
+	// Someone is visibly using the machine, so a dip in the signal doesn't lock
+	if !inRange && m.Active && m.Mode == "unlocked" && !m.ManualUnlock {
+		if !m.PendingLockSince.IsZero() {
+			m.PendingLockSince = time.Time{}
+			m.VetoedSince = time.Time{}
+			return ActionCancelLock, ReasonActive
+		}
+		return ActionNone, ""
+	}
+
+	if !inRange && m.Mode == "unlocked" && !m.ManualUnlock {
+		// If device is out of range and was previously unlocked, lock it, warning
+		// the user first when a lock warning is configured
+		if m.LockWarning > 0 {
+			if m.PendingLockSince.IsZero() {
+				m.PendingLockSince = now
+				return ActionWarn, ReasonOutOfRange
+			}
+			if now.Sub(m.PendingLockSince) < m.LockWarning {
+				return ActionNone, ""
+			}
+		}
+		m.lock()
+		return ActionLock, ReasonOutOfRange
+	}
+
+	// Check for session timeout
+	if m.Mode == "unlocked" && now.Sub(m.LastUnlockedTime) > m.SessionTimeout {
+		m.lock()
+		return ActionLock, ReasonSessionTimeout
+	}
+	return ActionNone, ""
+}
+
+// LockManually records a lock requested by the user.
+func (m *StateMachine) LockManually() {
+	m.lock()
+	m.ManualLock = true
+	m.ManualUnlock = false
+}
+
+// UnlockManually records an unlock requested by the user. Like any unlock, it only
+// holds while the device stays in range.
+func (m *StateMachine) UnlockManually(now time.Time) {
+	m.Mode = "unlocked"
+	m.LastUnlockedTime = now
+	m.ManualLock = false
+	m.ManualUnlock = false
+	m.PendingLockSince = time.Time{}
+}
+
+// UnlockOutside records an unlock the user did without bluelock, which holds
+// even though the device is out of range until it comes back.
+func (m *StateMachine) UnlockOutside(now time.Time) {
+	m.UnlockManually(now)
+	m.ManualUnlock = true
+}
+
+// DeferUnlock undoes an unlock that waits for confirmation, so it's offered
+// again on the next check.
+func (m *StateMachine) DeferUnlock() {
+	m.Mode = "locked"
+}
+
+// Veto undoes a lock that a hook blocked, so it's tried again on the next check.
+func (m *StateMachine) Veto(now time.Time, reason string) {
+	if m.VetoedSince.IsZero() {
+		m.VetoedSince = now
+	}
+	m.RetryLock(now, reason)
+}
+
+// RetryLock undoes a lock that didn't happen, so it's tried again on the next
+// check. An out-of-range lock stays pending without repeating the warning.
+func (m *StateMachine) RetryLock(now time.Time, reason string) {
+	m.Mode = "unlocked"
+	if reason == ReasonOutOfRange {
+		m.PendingLockSince = now.Add(-m.LockWarning)
+	}
+}
+
+// CanVeto reports whether hooks may still veto the current lock, which they can
+// for at most MaxLockVeto.
+func (m *StateMachine) CanVeto(now time.Time) bool {
+	return m.MaxLockVeto > 0 && (m.VetoedSince.IsZero() || now.Sub(m.VetoedSince) < m.MaxLockVeto)
+}
+
+// lock moves the state machine to locked, dropping any pending lock.
+func (m *StateMachine) lock() {
+	m.Mode = "locked"
+	m.PendingLockSince = time.Time{}
+}
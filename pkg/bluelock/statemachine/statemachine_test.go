@@ -0,0 +1,204 @@
+package statemachine
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+// step is one check fed to the state machine, at a time after start, and the
+// action and reason expected back.
+type step struct {
+	at      time.Duration
+	inRange bool
+	action  string
+	reason  string
+}
+
+func run(t *testing.T, m *StateMachine, steps []step) {
+	t.Helper()
+	for i, s := range steps {
+		action, reason := m.Step(start.Add(s.at), s.inRange, false)
+		if action != s.action || reason != s.reason {
+			t.Fatalf("step %d (at %s, in range %v): got %q %q, want %q %q", i, s.at, s.inRange, action, reason, s.action, s.reason)
+		}
+	}
+}
+
+func TestStep(t *testing.T) {
+	tests := []struct {
+		name        string
+		lockWarning time.Duration
+		steps       []step
+	}{
+		{"starts locked and unlocks in range", 0, []step{
+			{0, true, ActionUnlock, ReasonInRange},
+			{time.Second, true, ActionNone, ""},
+		}},
+		{"stays locked out of range", 0, []step{
+			{0, false, ActionNone, ""},
+			{time.Minute, false, ActionNone, ""},
+		}},
+		{"locks when the device leaves", 0, []step{
+			{0, true, ActionUnlock, ReasonInRange},
+			{time.Second, false, ActionLock, ReasonOutOfRange},
+			{2 * time.Second, false, ActionNone, ""},
+			{3 * time.Second, true, ActionUnlock, ReasonInRange},
+		}},
+		{"warns before locking", 10 * time.Second, []step{
+			{0, true, ActionUnlock, ReasonInRange},
+			{time.Second, false, ActionWarn, ReasonOutOfRange},
+			{5 * time.Second, false, ActionNone, ""},
+			{11 * time.Second, false, ActionLock, ReasonOutOfRange},
+		}},
+		{"cancels the lock when the device comes back", 10 * time.Second, []step{
+			{0, true, ActionUnlock, ReasonInRange},
+			{time.Second, false, ActionWarn, ReasonOutOfRange},
+			{5 * time.Second, true, ActionCancelLock, ReasonInRange},
+			{6 * time.Second, true, ActionNone, ""},
+			{7 * time.Second, false, ActionWarn, ReasonOutOfRange},
+		}},
+		{"locks on the session timeout in range", 0, []step{
+			{0, true, ActionUnlock, ReasonInRange},
+			{29 * time.Minute, true, ActionNone, ""},
+			{31 * time.Minute, true, ActionLock, ReasonSessionTimeout},
+			{32 * time.Minute, true, ActionUnlock, ReasonInRange},
+		}},
+		{"a pending lock isn't warned about twice", 10 * time.Second, []step{
+			{0, true, ActionUnlock, ReasonInRange},
+			{time.Second, false, ActionWarn, ReasonOutOfRange},
+			{2 * time.Second, false, ActionNone, ""},
+			{12 * time.Second, false, ActionLock, ReasonOutOfRange},
+			{13 * time.Second, false, ActionNone, ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run(t, New(start, 30*time.Minute, tt.lockWarning, 0), tt.steps)
+		})
+	}
+}
+
+func TestPaused(t *testing.T) {
+	m := New(start, 30*time.Minute, 0, 0)
+	for i, inRange := range []bool{true, false, true} {
+		if action, _ := m.Step(start.Add(time.Duration(i)*time.Second), inRange, true); action != ActionNone {
+			t.Fatalf("paused check %d: got %q", i, action)
+		}
+	}
+	if m.Mode != "locked" {
+		t.Fatalf("mode changed while paused: %q", m.Mode)
+	}
+}
+
+func TestLockManually(t *testing.T) {
+	m := New(start, 30*time.Minute, 0, 0)
+	m.UnlockManually(start)
+	m.LockManually()
+	run(t, m, []step{
+		// Held while the device stays in range
+		{time.Second, true, ActionNone, ""},
+		{2 * time.Second, true, ActionNone, ""},
+		// Once it has left, coming back unlocks again
+		{3 * time.Second, false, ActionNone, ""},
+		{4 * time.Second, true, ActionUnlock, ReasonInRange},
+	})
+}
+
+func TestUnlockOutside(t *testing.T) {
+	m := New(start, 30*time.Minute, 0, 0)
+	m.UnlockOutside(start)
+	run(t, m, []step{
+		{time.Second, false, ActionNone, ""},
+		{2 * time.Second, true, ActionNone, ""},
+		// Having seen the device, leaving locks as usual
+		{3 * time.Second, false, ActionLock, ReasonOutOfRange},
+	})
+}
+
+func TestRetryLock(t *testing.T) {
+	m := New(start, 30*time.Minute, 10*time.Second, 0)
+	run(t, m, []step{
+		{0, true, ActionUnlock, ReasonInRange},
+		{time.Second, false, ActionWarn, ReasonOutOfRange},
+		{11 * time.Second, false, ActionLock, ReasonOutOfRange},
+	})
+	m.RetryLock(start.Add(11*time.Second), ReasonOutOfRange)
+	if m.Mode != "unlocked" {
+		t.Fatalf("mode after RetryLock: %q", m.Mode)
+	}
+	// Tried again at once, without warning again
+	run(t, m, []step{{12 * time.Second, false, ActionLock, ReasonOutOfRange}})
+}
+
+func TestDeferUnlock(t *testing.T) {
+	m := New(start, 30*time.Minute, 0, 0)
+	run(t, m, []step{{0, true, ActionUnlock, ReasonInRange}})
+	m.DeferUnlock()
+	run(t, m, []step{{time.Second, true, ActionUnlock, ReasonInRange}})
+}
+
+func TestCanVeto(t *testing.T) {
+	m := New(start, 30*time.Minute, 0, time.Minute)
+	if !m.CanVeto(start) {
+		t.Fatal("can't veto before any veto")
+	}
+	m.Veto(start, ReasonOutOfRange)
+	if !m.CanVeto(start.Add(59 * time.Second)) {
+		t.Fatal("can't veto within max_lock_veto")
+	}
+	if m.CanVeto(start.Add(time.Minute)) {
+		t.Fatal("can still veto after max_lock_veto")
+	}
+	if New(start, 30*time.Minute, 0, 0).CanVeto(start) {
+		t.Fatal("can veto with max_lock_veto 0")
+	}
+}
+
+func TestConditions(t *testing.T) {
+	unlocked := func(set func(*StateMachine)) *StateMachine {
+		m := New(start, 30*time.Minute, 10*time.Second, 0)
+		m.Step(start, true, false)
+		set(m)
+		return m
+	}
+	t.Run("trusted never locks", func(t *testing.T) {
+		m := unlocked(func(m *StateMachine) { m.Trusted = true })
+		run(t, m, []step{
+			{time.Second, false, ActionNone, ""},
+			{time.Hour, false, ActionNone, ""},
+		})
+	})
+	t.Run("trusted drops a pending lock", func(t *testing.T) {
+		m := unlocked(func(*StateMachine) {})
+		run(t, m, []step{{time.Second, false, ActionWarn, ReasonOutOfRange}})
+		m.Trusted = true
+		run(t, m, []step{{2 * time.Second, false, ActionCancelLock, ReasonTrusted}})
+	})
+	t.Run("a lock device locks at once", func(t *testing.T) {
+		m := unlocked(func(m *StateMachine) { m.Blocked = true })
+		run(t, m, []step{
+			{time.Second, true, ActionLock, ReasonLockDevice},
+			{2 * time.Second, true, ActionNone, ""},
+		})
+	})
+	t.Run("lock only never unlocks", func(t *testing.T) {
+		m := New(start, 30*time.Minute, 0, 0)
+		m.LockOnly = true
+		run(t, m, []step{{0, true, ActionNone, ""}})
+	})
+	t.Run("activity postpones a lock", func(t *testing.T) {
+		m := unlocked(func(m *StateMachine) { m.Active = true })
+		run(t, m, []step{{time.Second, false, ActionNone, ""}})
+		m.Active = false
+		run(t, m, []step{{2 * time.Second, false, ActionWarn, ReasonOutOfRange}})
+	})
+	t.Run("holding only times out", func(t *testing.T) {
+		m := unlocked(func(m *StateMachine) { m.Holding = true })
+		run(t, m, []step{
+			{time.Second, false, ActionNone, ""},
+			{31 * time.Minute, false, ActionLock, ReasonSessionTimeout},
+		})
+	})
+}